@@ -0,0 +1,259 @@
+// Command client plays the game in a terminal.
+//
+//	client                       auto-match
+//	client -code 1234            meet whoever holds room code 1234
+//	client -bot perfect -games 5 let the computer play
+//
+// On a terminal, arrows (or hjkl) pick a cell and enter/space plays it;
+// digits 0-8 play directly. Piped input is read as lines: digits, "say
+// <text>", "resign", "rematch", "quit".
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/bot"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+	"github.com/kushgupta-hiver/TTT/pkg/client"
+)
+
+const (
+	keyHelp  = "arrows/hjkl move · enter/space or 0-8 play · c chat · r resign · n rematch · q quit"
+	lineHelp = "0-8 play · say <text> · resign · rematch · quit"
+)
+
+func main() {
+	server := flag.String("server", "http://localhost:8000", "server URL")
+	code := flag.String("code", "", "4-digit room code (empty = auto-match)")
+	player := flag.String("player", "", "player id")
+	botName := flag.String("bot", "", "play automatically: random | perfect")
+	games := flag.Int("games", 1, "bot: games to play, rematching in between")
+	delay := flag.Duration("delay", 300*time.Millisecond, "bot: thinking time per move")
+	noColor := flag.Bool("no-color", false, "disable colors")
+	flag.Parse()
+
+	var strategy bot.Strategy
+	switch *botName {
+	case "":
+	case "random":
+		strategy = bot.Random(rand.New(rand.NewSource(time.Now().UnixNano())))
+	case "perfect":
+		strategy = bot.Perfect()
+	default:
+		log.Fatalf("unknown bot %q (random | perfect)", *botName)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	c, err := client.Dial(dialCtx, *server, client.Options{
+		Code:      *code,
+		Player:    *player,
+		Name:      "ttt-client",
+		Features:  []string{proto.FeatureLastMove, proto.FeatureDigitMoves, proto.FeatureChat},
+		Reconnect: true,
+	})
+	cancel()
+	if err != nil {
+		log.Fatalf("connect %s: %v", *server, err)
+	}
+
+	tty := isTerminal(os.Stdin) && isTerminal(os.Stdout)
+	v := &view{color: tty && !*noColor && os.Getenv("NO_COLOR") == "", where: "auto-match", sel: 4}
+	if *code != "" {
+		v.where = "room " + *code
+	}
+
+	p := &session{c: c, v: v, tty: tty, bot: strategy, games: *games, delay: *delay}
+	if strategy == nil && tty {
+		restore, err := rawMode()
+		if err == nil {
+			defer restore()
+			p.keys = make(chan rune)
+			v.cursor = true
+			go readKeys(os.Stdin, p.keys)
+		}
+	}
+	if strategy == nil && p.keys == nil {
+		p.lines = make(chan string)
+		go readLines(os.Stdin, p.lines)
+	}
+	p.loop(ctx)
+}
+
+// session drives one connection: server events, input and the bot.
+type session struct {
+	c   *client.Client
+	v   *view
+	tty bool
+
+	keys  chan rune
+	lines chan string
+
+	bot    bot.Strategy
+	games  int
+	delay  time.Duration
+	botDue <-chan time.Time
+}
+
+func (p *session) loop(ctx context.Context) {
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	p.draw()
+	for {
+		select {
+		case <-ctx.Done():
+			_ = p.c.Leave(context.Background())
+			return
+		case ev, ok := <-p.c.Events():
+			if !ok {
+				p.draw()
+				fmt.Println()
+				return
+			}
+			p.v.apply(ev, time.Now())
+			p.onEvent(ev)
+			p.draw()
+		case <-tick.C:
+			if p.tty && p.v.started && p.v.result == "" {
+				p.draw() // clocks
+			}
+		case k, ok := <-p.keys:
+			if !ok || !p.onKey(ctx, k) {
+				_ = p.c.Leave(context.Background())
+				return
+			}
+			p.draw()
+		case line, ok := <-p.lines:
+			if !ok || !p.onLine(ctx, line) {
+				_ = p.c.Leave(context.Background())
+				return
+			}
+		case <-p.botDue:
+			p.botDue = nil
+			if p.v.yourTurn() {
+				_ = p.c.Move(ctx, p.bot.Move(p.v.board, p.v.mark))
+			}
+		}
+	}
+}
+
+func (p *session) onEvent(ev client.Event) {
+	if p.bot == nil {
+		return
+	}
+	switch ev.(type) {
+	case client.Start, client.State:
+		if p.v.yourTurn() && p.botDue == nil {
+			p.botDue = time.After(p.delay)
+		}
+	case client.Result:
+		p.games--
+		if p.games > 0 {
+			_ = p.c.Rematch(context.Background())
+		} else {
+			_ = p.c.Leave(context.Background())
+		}
+	}
+}
+
+func (p *session) draw() {
+	help := ""
+	switch {
+	case p.bot != nil:
+	case p.keys != nil:
+		help = keyHelp
+	default:
+		help = lineHelp
+	}
+	screen := p.v.render(time.Now(), help)
+	if p.tty {
+		screen = ansiClear + screen
+		screen = strings.ReplaceAll(screen, "\n", "\r\n")
+	}
+	fmt.Print(screen)
+}
+
+// onKey handles one keypress; false quits.
+func (p *session) onKey(ctx context.Context, k rune) bool {
+	v := p.v
+	if v.typing {
+		switch k {
+		case keyEnter:
+			if strings.TrimSpace(v.input) != "" {
+				_ = p.c.Say(ctx, v.input)
+			}
+			v.typing, v.input = false, ""
+		case keyEsc:
+			v.typing, v.input = false, ""
+		case keyBackspace:
+			if r := []rune(v.input); len(r) > 0 {
+				v.input = string(r[:len(r)-1])
+			}
+		default:
+			if k >= ' ' {
+				v.input += string(k)
+			}
+		}
+		return true
+	}
+
+	switch k {
+	case keyUp, 'k', 'w':
+		v.sel = (v.sel + 6) % 9
+	case keyDown, 'j', 's':
+		v.sel = (v.sel + 3) % 9
+	case keyLeft, 'h', 'a':
+		v.sel = v.sel/3*3 + (v.sel+2)%3
+	case keyRight, 'l', 'd':
+		v.sel = v.sel/3*3 + (v.sel+1)%3
+	case keyEnter, ' ':
+		_ = p.c.Move(ctx, v.sel)
+	case 'c', 't':
+		v.typing = true
+	case 'r':
+		_ = p.c.Resign(ctx)
+	case 'n':
+		_ = p.c.Rematch(ctx)
+	case 'q', keyEsc:
+		return false
+	default:
+		if k >= '0' && k <= '8' {
+			v.sel = int(k - '0')
+			_ = p.c.Move(ctx, v.sel)
+		}
+	}
+	return true
+}
+
+// onLine handles one typed command; false quits.
+func (p *session) onLine(ctx context.Context, line string) bool {
+	cmd, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	switch strings.ToLower(cmd) {
+	case "":
+	case "say":
+		_ = p.c.Say(ctx, arg)
+	case "resign":
+		_ = p.c.Resign(ctx)
+	case "rematch":
+		_ = p.c.Rematch(ctx)
+	case "quit", "exit", "leave":
+		return false
+	default:
+		if len(cmd) == 1 && cmd[0] >= '0' && cmd[0] <= '8' {
+			_ = p.c.Move(ctx, int(cmd[0]-'0'))
+		} else {
+			fmt.Println("! unknown command (" + lineHelp + ")")
+		}
+	}
+	return true
+}
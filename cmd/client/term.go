@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Keys reported by readKeys besides printable runes.
+const (
+	keyUp rune = -(iota + 1)
+	keyDown
+	keyLeft
+	keyRight
+	keyEnter
+	keyEsc
+	keyBackspace
+)
+
+// isTerminal reports whether f is an interactive terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// rawMode switches the terminal to unbuffered, no-echo input through stty
+// and returns a function restoring the previous settings.
+func rawMode() (restore func(), err error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("-icanon", "-echo", "min", "1"); err != nil {
+		return nil, err
+	}
+	return func() { _, _ = stty(strings.TrimSpace(saved)) }, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// readKeys decodes keypresses (including arrow escape sequences) until r ends.
+func readKeys(r io.Reader, out chan<- rune) {
+	defer close(out)
+	br := bufio.NewReader(r)
+	for {
+		ch, _, err := br.ReadRune()
+		if err != nil {
+			return
+		}
+		switch ch {
+		case '\r', '\n':
+			out <- keyEnter
+		case 127, '\b':
+			out <- keyBackspace
+		case 27:
+			if br.Buffered() == 0 {
+				out <- keyEsc
+				continue
+			}
+			if b, _ := br.ReadByte(); b != '[' {
+				out <- keyEsc
+				continue
+			}
+			switch b, _ := br.ReadByte(); b {
+			case 'A':
+				out <- keyUp
+			case 'B':
+				out <- keyDown
+			case 'C':
+				out <- keyRight
+			case 'D':
+				out <- keyLeft
+			}
+		default:
+			out <- ch
+		}
+	}
+}
+
+// readLines feeds whole input lines, for pipes and dumb terminals.
+func readLines(r io.Reader, out chan<- string) {
+	defer close(out)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		out <- sc.Text()
+	}
+}
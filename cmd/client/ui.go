@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/pkg/client"
+)
+
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiDim     = "\x1b[2m"
+	ansiReverse = "\x1b[7m"
+	ansiRed     = "\x1b[31m"
+	ansiBlue    = "\x1b[34m"
+	ansiYellow  = "\x1b[33m"
+	ansiClear   = "\x1b[H\x1b[2J"
+)
+
+const chatLines = 5
+
+// view is everything the screen shows, built up from server events.
+type view struct {
+	color  bool
+	cursor bool // show the selection cursor (interactive keys)
+	where  string
+
+	mark     client.Mark
+	board    [9]string
+	next     client.Mark
+	started  bool
+	result   string
+	opponent string
+	rematch  bool // opponent asked for a rematch
+	notice   string
+	chat     []string
+
+	sel    int
+	typing bool
+	input  string
+
+	gameStart, turnStart time.Time
+}
+
+func (v *view) yourTurn() bool {
+	return v.started && v.result == "" && v.mark != "" && v.next == v.mark
+}
+
+func (v *view) apply(ev client.Event, now time.Time) {
+	switch e := ev.(type) {
+	case client.Assigned:
+		v.mark = e.You
+		v.opponent = "connected"
+	case client.Start:
+		v.board, v.started, v.result, v.rematch = e.Board, true, "", false
+		v.next = v.mark
+		if !e.YourTurn {
+			v.next = other(v.mark)
+		}
+		v.gameStart, v.turnStart = now, now
+		v.notice = ""
+	case client.State:
+		v.board, v.next = e.Board, e.NextTurn
+		v.turnStart = now
+		v.notice = ""
+		if e.LastMove != nil && e.LastMove.By == v.mark {
+			v.sel = e.LastMove.Pos
+		}
+	case client.Result:
+		v.result = e.Status
+	case client.Rematch:
+		v.rematch = true
+	case client.Opponent:
+		if e.Status == "away" {
+			v.opponent = fmt.Sprintf("away (seat held %ds)", e.GraceMs/1000)
+		} else {
+			v.opponent = "connected"
+		}
+	case client.Chat:
+		line := "[" + string(e.From) + "] " + e.Text
+		if e.Emote != "" {
+			line = "[" + string(e.From) + "] *" + e.Emote + "*"
+		}
+		v.chat = append(v.chat, line)
+		if len(v.chat) > chatLines {
+			v.chat = v.chat[len(v.chat)-chatLines:]
+		}
+	case client.System:
+		v.notice = "*** " + e.Text
+	case client.Error:
+		v.notice = "! " + e.Code
+		if e.Detail != "" {
+			v.notice += ": " + e.Detail
+		}
+	case client.Disconnected:
+		if e.Retrying {
+			v.notice = "connection lost, reconnecting..."
+		} else {
+			v.notice = "disconnected"
+		}
+	case client.Reconnected:
+		v.notice = "reconnected"
+	}
+}
+
+func (v *view) paint(s, code string) string {
+	if !v.color {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+func (v *view) cell(i int) string {
+	s := v.board[i]
+	var out string
+	switch s {
+	case "X":
+		out = v.paint(" X ", ansiBold+ansiRed)
+	case "O":
+		out = v.paint(" O ", ansiBold+ansiBlue)
+	default:
+		out = v.paint(fmt.Sprintf(" %d ", i), ansiDim)
+	}
+	if v.cursor && v.color && i == v.sel && v.yourTurn() {
+		return ansiReverse + strings.ReplaceAll(out, ansiReset, ansiReset+ansiReverse) + ansiReset
+	}
+	if v.cursor && !v.color && i == v.sel && v.yourTurn() {
+		return "[" + strings.TrimSpace(out) + "]"
+	}
+	return out
+}
+
+func clock(d time.Duration) string {
+	d = d.Truncate(time.Second)
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+func (v *view) turnText(now time.Time) string {
+	switch {
+	case v.result != "":
+		s := "Game over: " + v.result
+		if v.rematch {
+			s += "  (opponent wants a rematch)"
+		}
+		return v.paint(s, ansiBold+ansiYellow)
+	case !v.started:
+		return "Waiting for an opponent..."
+	case v.yourTurn():
+		return v.paint("Your move", ansiBold) + "  " + clock(now.Sub(v.turnStart))
+	default:
+		return "Opponent's move  " + clock(now.Sub(v.turnStart))
+	}
+}
+
+// render draws the whole screen.
+func (v *view) render(now time.Time, help string) string {
+	var sb strings.Builder
+	head := "TTT  " + v.where
+	if v.mark != "" {
+		head += "  you are " + string(v.mark)
+	}
+	if v.started {
+		head += "  game " + clock(now.Sub(v.gameStart))
+	}
+	sb.WriteString(v.paint(head, ansiBold) + "\n\n")
+
+	side := []string{"", "Opponent: " + v.opponent, "", v.turnText(now), ""}
+	if v.opponent == "" {
+		side[1] = ""
+	}
+	for row := 0; row < 3; row++ {
+		if row > 0 {
+			sb.WriteString("───┼───┼───" + "      " + side[row*2-1] + "\n")
+		}
+		for col := 0; col < 3; col++ {
+			if col > 0 {
+				sb.WriteString("│")
+			}
+			sb.WriteString(v.cell(row*3 + col))
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(v.chat) > 0 {
+		sb.WriteString("\n")
+		for _, l := range v.chat {
+			sb.WriteString("  " + l + "\n")
+		}
+	}
+	if v.typing {
+		sb.WriteString("\nsay> " + v.input + "\n")
+	}
+	if v.notice != "" {
+		sb.WriteString("\n" + v.notice + "\n")
+	}
+	if help != "" {
+		sb.WriteString("\n" + v.paint(help, ansiDim) + "\n")
+	}
+	return sb.String()
+}
+
+func other(m client.Mark) client.Mark {
+	if m == client.X {
+		return client.O
+	}
+	return client.X
+}
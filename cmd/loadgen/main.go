@@ -0,0 +1,97 @@
+// Command loadgen plays many simulated games against a server and prints
+// latency percentiles, errors and resource growth.
+//
+//	loadgen -players 2000                          in-process server
+//	loadgen -url http://localhost:8000 -mode code  a running server
+//
+// A remote server sees every player from one address; raise its
+// MAX_CONNS_PER_IP and MAX_WAITING_PER_IP first.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/bot"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/loadgen"
+)
+
+func main() {
+	url := flag.String("url", "", "server URL; empty runs an in-process server")
+	players := flag.Int("players", 1000, "simulated players")
+	mode := flag.String("mode", loadgen.ModeAuto, "auto | code")
+	games := flag.Int("games", 1, "games per player")
+	strategy := flag.String("strategy", "random", "random | perfect | script:0,4,8,...")
+	seed := flag.Int64("seed", 1, "random seed")
+	think := flag.Duration("think", 0, "pause before each move")
+	ramp := flag.Duration("ramp", 0, "spread connections over this long")
+	timeout := flag.Duration("timeout", time.Minute, "per-player time limit")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	strat, err := parseStrategy(*strategy)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	target := *url
+	if target == "" {
+		local := loadgen.NewLocal(hub.Config{MsgRate: 1000, MsgBurst: 1000})
+		defer local.Close()
+		target = local.URL
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	rep, err := loadgen.Run(ctx, loadgen.Config{
+		URL:      target,
+		Players:  *players,
+		Mode:     *mode,
+		Games:    *games,
+		Strategy: strat,
+		Seed:     *seed,
+		Think:    *think,
+		Ramp:     *ramp,
+		Timeout:  *timeout,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(rep)
+		return
+	}
+	fmt.Print(rep)
+}
+
+func parseStrategy(s string) (bot.Strategy, error) {
+	switch {
+	case s == "random":
+		return nil, nil // per-player seeded
+	case s == "perfect":
+		return bot.Perfect(), nil
+	case strings.HasPrefix(s, "script:"):
+		var order []int
+		for _, f := range strings.Split(strings.TrimPrefix(s, "script:"), ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(f))
+			if err != nil || n < 0 || n > 8 {
+				return nil, fmt.Errorf("bad script cell %q", f)
+			}
+			order = append(order, n)
+		}
+		return bot.Scripted(order...), nil
+	default:
+		return nil, fmt.Errorf("unknown strategy %q", s)
+	}
+}
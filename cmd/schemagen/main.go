@@ -0,0 +1,30 @@
+// Command schemagen writes the protocol's JSON Schema and AsyncAPI documents.
+// Run it through `go generate ./internal/proto`.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/kushgupta-hiver/TTT/internal/schema"
+)
+
+func main() {
+	out := flag.String("out", "schema", "output directory")
+	flag.Parse()
+
+	files, err := schema.Files()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatal(err)
+	}
+	for name, b := range files {
+		if err := os.WriteFile(filepath.Join(*out, name), b, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
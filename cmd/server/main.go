@@ -1,12 +1,37 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/kushgupta-hiver/TTT/internal/admin"
+	"github.com/kushgupta-hiver/TTT/internal/auth"
+	"github.com/kushgupta-hiver/TTT/internal/cluster"
 	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/health"
+	"github.com/kushgupta-hiver/TTT/internal/httpx"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/lobby"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/ratings"
+	"github.com/kushgupta-hiver/TTT/internal/stats"
+	"github.com/kushgupta-hiver/TTT/internal/store"
+	"github.com/kushgupta-hiver/TTT/internal/tlsreload"
+	"github.com/kushgupta-hiver/TTT/internal/tournament"
+	"github.com/kushgupta-hiver/TTT/internal/transport/sse"
+	"github.com/kushgupta-hiver/TTT/internal/transport/tcp"
 	"github.com/kushgupta-hiver/TTT/internal/transport/ws"
+	"github.com/kushgupta-hiver/TTT/internal/web"
 )
 
 func main() {
@@ -17,19 +42,295 @@ func main() {
 
 	mux := http.NewServeMux()
 
-	// Create ONE ws handler instance
-	wsHandler := ws.NewServer(ws.Config{}, engine.NewEngine())
+	// Sign-in tokens (and so rated games) need AUTH_SECRET.
+	var signer auth.Issuer
+	if secret := os.Getenv("AUTH_SECRET"); secret != "" {
+		var err error
+		if signer, err = auth.NewSigner([]byte(secret), nil); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Games, profiles and ratings survive restarts when STORE_FILE is set.
+	db := store.NewMemory()
+	if path := os.Getenv("STORE_FILE"); path != "" {
+		var err error
+		if db, err = store.Open(path, store.Config{}); err != nil {
+			log.Fatal(err)
+		}
+	}
+	defer db.Close()
+	book := ratings.NewBook(ratings.Config{Store: db})
+	tally := stats.NewTracker(stats.Config{Store: db})
+
+	// ONE hub shared by every transport, so their players meet
+	eng := engine.NewEngine()
+	var lob lobby.Lobby // set once the hub exists
+	cfg := hub.Config{
+		MaxConnsPerIP:   envInt("MAX_CONNS_PER_IP"),
+		MaxWaitingPerIP: envInt("MAX_WAITING_PER_IP"),
+		ResumeGrace:     envSeconds("RESUME_GRACE_SECONDS"),
+		Sides:           sidePolicy(os.Getenv("SIDE_POLICY"), db),
+		RatingOf:        func(player string) float64 { return book.Get(player).Rating },
+		OnActivity: func() {
+			if lob != nil {
+				lob.Changed()
+			}
+		},
+		OnGameOver: func(g hub.GameOver) {
+			rec := g.Record
+			sg := stats.Game{ID: rec.RoomID, X: g.X, O: g.O, Outcome: rec.Outcome, Reason: rec.Reason, Moves: len(rec.Moves), At: rec.Ended, XGuest: g.XGuest, OGuest: g.OGuest}
+			// The record, its stats and the rating change are saved together.
+			err := db.Update(func(tx store.Tx) error {
+				if err := store.SaveGame(tx, g.X, g.O, rec); err != nil {
+					return err
+				}
+				// Self-play is kept on record but not counted.
+				if err := stats.Save(tx, sg); err != nil && !errors.Is(err, stats.ErrSelfPlay) {
+					return err
+				}
+				if !rec.Rated {
+					return nil
+				}
+				// A game the book will not rate is still kept, unrated.
+				_, _, err := book.Rate(tx, ratings.Game{ID: rec.RoomID, X: g.X, O: g.O, Outcome: rec.Outcome, At: rec.Ended})
+				if errors.Is(err, ratings.ErrSelfPlay) || errors.Is(err, ratings.ErrDuplicate) {
+					log.Printf("rating game %s: %v", rec.RoomID, err)
+					return nil
+				}
+				return err
+			})
+			if err != nil {
+				log.Printf("saving game %s: %v", rec.RoomID, err)
+				return
+			}
+			if err := tally.Record(sg); err != nil {
+				log.Printf("stats %s: %v", rec.RoomID, err)
+			}
+		},
+	}
+	if signer != nil {
+		cfg.Auth = signer
+	}
+	if os.Getenv("STORE_FILE") != "" {
+		cfg.Rooms = store.NewRoomLog(db) // running games survive a crash
+	}
+	// Several processes form one server when they share a broker: one runs
+	// it on CLUSTER_LISTEN, every node (that one too) dials CLUSTER_BROKER.
+	// They prove to it that they share CLUSTER_SECRET.
+	secret := os.Getenv("CLUSTER_SECRET")
+	if secret == "" && (os.Getenv("CLUSTER_LISTEN") != "" || os.Getenv("CLUSTER_BROKER") != "") {
+		log.Fatal("CLUSTER_SECRET is required to run or join a cluster broker")
+	}
+	if ln := os.Getenv("CLUSTER_LISTEN"); ln != "" {
+		l, err := net.Listen("tcp", ln)
+		if err != nil {
+			log.Fatal(err)
+		}
+		broker := cluster.NewServer(secret)
+		defer broker.Close()
+		go func() {
+			if err := broker.Serve(l); err != nil {
+				log.Printf("cluster broker stopped: %v", err)
+			}
+		}()
+	}
+	if addr := os.Getenv("CLUSTER_BROKER"); addr != "" {
+		b, err := cluster.Dial(addr, secret)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer b.Close()
+		cfg.Cluster, cfg.Node = b, os.Getenv("NODE_NAME")
+	}
+	h := hub.NewHub(cfg, eng)
+	defer h.Close()
 
-	mux.Handle("/ws", wsHandler)   // matches exactly /ws
-	mux.Handle("/ws/", wsHandler)  // matches /ws/<anything>, e.g., /ws/1234
+	wsHandler := ws.NewServer(ws.Config{
+		AllowedOrigins: splitList(os.Getenv("ALLOWED_ORIGINS")),
+		Hub:            h,
+	}, eng)
+	mux.Handle("/ws", wsHandler)  // matches exactly /ws
+	mux.Handle("/ws/", wsHandler) // matches /ws/<anything>, e.g., /ws/1234
+
+	// Presence, public rooms and challenges
+	lob = lobby.NewLobby(lobby.Config{Hub: h})
+	defer lob.Close()
+	mux.Handle("/lobby", ws.NewLobbyServer(ws.Config{
+		AllowedOrigins: splitList(os.Getenv("ALLOWED_ORIGINS")),
+		Hub:            h,
+	}, lob))
+
+	// Fallback for clients behind websocket-hostile proxies
+	sseHandler := sse.NewServer(sse.Config{Hub: h}, eng)
+	mux.Handle("/sse", sseHandler)
+	mux.Handle("/sse/", sseHandler)
+
+	// Terminal play: `nc <host> $TCP_ADDR`, matched through the same hub
+	if tcpAddr := os.Getenv("TCP_ADDR"); tcpAddr != "" {
+		ln, err := net.Listen("tcp", tcpAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer ln.Close()
+		tcpSrv := tcp.NewServer(tcp.Config{Hub: h}, eng)
+		go func() {
+			if err := tcpSrv.Serve(ln); err != nil {
+				log.Printf("tcp transport stopped: %v", err)
+			}
+		}()
+		log.Printf("terminal play on %s ...", tcpAddr)
+	}
+
+	// Probes + introspection
+	checks := health.NewChecker(2 * time.Second)
+	checks.Register("hub", h.Ready)
+	checks.Register("store", db.Ping)
+	if cfg.Cluster != nil {
+		checks.Register("broker", cfg.Cluster.Ping)
+	}
+	mux.Handle("/healthz", checks.Liveness())
+	mux.Handle("/readyz", checks.Readiness())
+	mux.Handle("/debug/state", httpx.RequireToken(os.Getenv("DEBUG_TOKEN"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpx.JSON(w, http.StatusOK, h.Snapshot())
+	})))
+
+	// Operator API; every action is appended to ADMIN_AUDIT_FILE (or stderr).
+	var auditOut io.Writer = os.Stderr
+	if path := os.Getenv("ADMIN_AUDIT_FILE"); path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		auditOut = f
+	}
+	audit := admin.NewAuditLog(auditOut, 0)
+	mux.Handle("/admin/", httpx.RequireToken(os.Getenv("ADMIN_TOKEN"), admin.NewHandler(h, audit)))
+	if signer != nil {
+		mux.Handle("/admin/tokens", httpx.RequireToken(os.Getenv("ADMIN_TOKEN"), admin.NewTokenHandler(signer, audit)))
+	}
+	mux.Handle("/api/ratings/", ratings.NewHandler(book))
+	records := store.NewHandler(db)
+	mux.Handle("/api/games/", records)
+	mux.Handle("/api/players/", records)
+	statsHandler := stats.NewHandler(tally)
+	mux.Handle("/api/stats/", statsHandler)
+	mux.Handle("/api/leaderboard", statsHandler)
 
-	// Optional info page
-	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_, _ = w.Write([]byte("TicTacToe WS server.\nTry: ws://<host>/ws  (auto-match)\nOr:  ws://<host>/ws/1234  (room)\n"))
-	}))
+	// Tournaments: anyone may watch; ADMIN_TOKEN holders organise.
+	organiser := func(next http.Handler) http.Handler { return httpx.RequireToken(os.Getenv("ADMIN_TOKEN"), next) }
+	tournaments := tournament.NewHandler(tournament.NewManager(h), organiser)
+	mux.Handle("/api/tournaments", tournaments)
+	mux.Handle("/api/tournaments/", tournaments)
 
-	log.Printf("listening on %s ...", addr)
-	if err := http.ListenAndServe(addr, mux); err != nil {
+	// Browser client at "/"; plain-text pointers for tools at /info
+	hsts := envSeconds("HSTS_SECONDS")
+	mux.Handle("/", httpx.SecureHeaders(web.Handler(), hsts))
+	mux.Handle("/info", httpx.SecureHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("TicTacToe WS server.\nTry: ws://<host>/ws  (auto-match)\nOr:  ws://<host>/ws/1234  (room)\nNo websockets? GET /sse[/1234] + POST /sse/send?session=...\n"))
+	}), hsts))
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+
+	// Native TLS when both files are given; the pair is reloaded on change.
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	useTLS := certFile != "" && keyFile != ""
+	if useTLS {
+		rl, err := tlsreload.NewReloader(certFile, keyFile, 30*time.Second)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer rl.Close()
+		srv.TLSConfig = rl.TLSConfig()
+	}
+
+	// On SIGTERM: fail readiness and refuse new games, give the orchestrator
+	// GRACE_SECONDS to move traffic away, let running games finish (up to
+	// DRAIN_TIMEOUT_SECONDS, default 10m), then stop. Shutdown alone would
+	// cut the websockets, which it does not track.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		h.Drain()
+		log.Printf("draining ...")
+		time.Sleep(envSeconds("GRACE_SECONDS"))
+		drain := envSeconds("DRAIN_TIMEOUT_SECONDS")
+		if drain == 0 {
+			drain = 10 * time.Minute
+		}
+		wctx, cancel := context.WithTimeout(context.Background(), drain)
+		if err := h.WaitIdle(wctx); err != nil {
+			log.Printf("games still running after %s; stopping anyway", drain)
+		}
+		cancel()
+		sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(sctx)
+	}()
+
+	var err error
+	if useTLS {
+		log.Printf("listening on %s (tls) ...", addr)
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		log.Printf("listening on %s ...", addr)
+		err = srv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal(err)
 	}
 }
+
+// sidePolicy maps SIDE_POLICY to who plays X: first (arrival order),
+// random (default; sides swap on a rematch), balance (whichever signed-in
+// player has played X less, going by the stored games) or host (the room
+// opener picks with ?side=, otherwise random).
+func sidePolicy(name string, db store.Store) match.SidePolicy {
+	coin := match.RandomSides(time.Now().UnixNano())
+	switch name {
+	case "first":
+		return match.FirstComeX()
+	case "", "random":
+		return match.Alternate(coin)
+	case "balance":
+		seed, err := stats.Sides(db)
+		if err != nil {
+			log.Printf("side records: %v", err)
+		}
+		return match.Balance(coin, match.BalanceOptions{Seed: seed})
+	case "host":
+		return match.HostChooses(match.Alternate(coin))
+	default:
+		log.Fatalf("unknown SIDE_POLICY %q (first | random | balance | host)", name)
+		return nil
+	}
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// envInt reads a non-negative integer; 0 (unset) leaves the default.
+func envInt(key string) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || v < 0 {
+		return 0
+	}
+	return v
+}
+
+func envSeconds(key string) time.Duration {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || v < 0 {
+		return 0
+	}
+	return time.Duration(v) * time.Second
+}
@@ -0,0 +1,65 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`
+	Action string    `json:"action"`
+	Target string    `json:"target,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// AuditLog appends every admin action as a JSON line to w and keeps the most
+// recent entries in memory for the API.
+type AuditLog struct {
+	mu     sync.Mutex
+	w      io.Writer
+	recent []Entry
+	keep   int
+}
+
+func NewAuditLog(w io.Writer, keep int) *AuditLog {
+	if keep <= 0 {
+		keep = 256
+	}
+	return &AuditLog{w: w, keep: keep}
+}
+
+func (a *AuditLog) Record(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.recent = append(a.recent, e)
+	if len(a.recent) > a.keep {
+		a.recent = a.recent[len(a.recent)-a.keep:]
+	}
+	if a.w == nil {
+		return nil
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = a.w.Write(append(b, '\n'))
+	return err
+}
+
+// Recent returns up to n entries, newest last.
+func (a *AuditLog) Recent(n int) []Entry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if n <= 0 || n > len(a.recent) {
+		n = len(a.recent)
+	}
+	return append([]Entry(nil), a.recent[len(a.recent)-n:]...)
+}
@@ -0,0 +1,192 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/auth"
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/httpx"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+)
+
+// Controller is the slice of the game server that operators can drive.
+type Controller interface {
+	Snapshot() hub.Snapshot
+	Conns() []hub.ConnInfo
+	EndRoom(roomID string, o engine.Outcome) error
+	Kick(connID, reason string) error
+	Ban(b hub.Ban) int
+	Bans() []hub.Ban
+	Broadcast(text string) int
+}
+
+type handler struct {
+	ctl   Controller
+	iss   auth.Issuer // token endpoint only
+	audit *AuditLog
+	mux   *http.ServeMux
+}
+
+// NewHandler serves the admin API under /admin/. It does no authentication of
+// its own; wrap it (httpx.RequireToken). The X-Admin-Actor header, if set,
+// names the operator in the audit log.
+func NewHandler(ctl Controller, audit *AuditLog) http.Handler {
+	h := &handler{ctl: ctl, audit: audit, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /admin/rooms", h.rooms)
+	h.mux.HandleFunc("GET /admin/conns", h.conns)
+	h.mux.HandleFunc("POST /admin/rooms/{id}/end", h.endRoom)
+	h.mux.HandleFunc("POST /admin/conns/{id}/kick", h.kick)
+	h.mux.HandleFunc("GET /admin/bans", h.bans)
+	h.mux.HandleFunc("POST /admin/bans", h.ban)
+	h.mux.HandleFunc("POST /admin/broadcast", h.broadcast)
+	h.mux.HandleFunc("GET /admin/audit", h.auditLog)
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) { h.mux.ServeHTTP(w, r) }
+
+func (h *handler) rooms(w http.ResponseWriter, r *http.Request) {
+	httpx.JSON(w, http.StatusOK, h.ctl.Snapshot())
+}
+
+func (h *handler) conns(w http.ResponseWriter, r *http.Request) {
+	httpx.JSON(w, http.StatusOK, h.ctl.Conns())
+}
+
+func (h *handler) endRoom(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Outcome string `json:"outcome"` // "X" | "O" | "draw"
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	id := r.PathValue("id")
+	o, ok := parseOutcome(req.Outcome)
+	if !ok {
+		h.fail(w, r, "end_room", id, req.Outcome, http.StatusBadRequest, engine.ErrInvalidOutcome)
+		return
+	}
+	if err := h.ctl.EndRoom(id, o); err != nil {
+		h.fail(w, r, "end_room", id, req.Outcome, statusFor(err), err)
+		return
+	}
+	h.ok(w, r, "end_room", id, req.Outcome, map[string]string{"status": "ended"})
+}
+
+func (h *handler) kick(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "kicked by operator"
+	}
+	id := r.PathValue("id")
+	if err := h.ctl.Kick(id, req.Reason); err != nil {
+		h.fail(w, r, "kick", id, req.Reason, statusFor(err), err)
+		return
+	}
+	h.ok(w, r, "kick", id, req.Reason, map[string]string{"status": "kicked"})
+}
+
+func (h *handler) bans(w http.ResponseWriter, r *http.Request) {
+	httpx.JSON(w, http.StatusOK, h.ctl.Bans())
+}
+
+func (h *handler) ban(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Player  string `json:"player"`
+		Addr    string `json:"addr"`
+		Seconds int    `json:"seconds"`
+		Reason  string `json:"reason"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	target := "player:" + req.Player + " addr:" + req.Addr
+	if (req.Player == "" && req.Addr == "") || req.Seconds <= 0 {
+		h.fail(w, r, "ban", target, req.Reason, http.StatusBadRequest, errors.New("player or addr and positive seconds required"))
+		return
+	}
+	until := time.Now().Add(time.Duration(req.Seconds) * time.Second)
+	n := h.ctl.Ban(hub.Ban{Player: req.Player, Addr: req.Addr, Until: until})
+	h.ok(w, r, "ban", target, req.Reason+" ("+strconv.Itoa(req.Seconds)+"s)", map[string]any{"until": until, "kicked": n})
+}
+
+func (h *handler) broadcast(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Text string `json:"text"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.Text == "" {
+		h.fail(w, r, "broadcast", "", "", http.StatusBadRequest, errors.New("text required"))
+		return
+	}
+	n := h.ctl.Broadcast(req.Text)
+	h.ok(w, r, "broadcast", "", req.Text, map[string]int{"delivered": n})
+}
+
+func (h *handler) auditLog(w http.ResponseWriter, r *http.Request) {
+	n, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	httpx.JSON(w, http.StatusOK, h.audit.Recent(n))
+}
+
+func (h *handler) ok(w http.ResponseWriter, r *http.Request, action, target, detail string, body any) {
+	_ = h.audit.Record(Entry{Actor: actor(r), Action: action, Target: target, Detail: detail})
+	httpx.JSON(w, http.StatusOK, body)
+}
+
+func (h *handler) fail(w http.ResponseWriter, r *http.Request, action, target, detail string, status int, err error) {
+	_ = h.audit.Record(Entry{Actor: actor(r), Action: action, Target: target, Detail: detail, Error: err.Error()})
+	httpx.JSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if r.ContentLength == 0 {
+		return true
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(v); err != nil {
+		httpx.JSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+func actor(r *http.Request) string {
+	if a := r.Header.Get("X-Admin-Actor"); a != "" {
+		return a
+	}
+	return "admin"
+}
+
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, hub.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, engine.ErrTerminal):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func parseOutcome(s string) (engine.Outcome, bool) {
+	switch s {
+	case "X", "x":
+		return engine.XWins, true
+	case "O", "o":
+		return engine.OWins, true
+	case "draw":
+		return engine.Draw, true
+	default:
+		return engine.InProgress, false
+	}
+}
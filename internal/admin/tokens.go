@@ -0,0 +1,46 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/auth"
+)
+
+const defaultTokenTTL = 30 * 24 * time.Hour
+
+// NewTokenHandler serves POST /admin/tokens {"player", "ttlSeconds"}, minting
+// a sign-in token for player. Like NewHandler it must be wrapped for auth.
+func NewTokenHandler(iss auth.Issuer, audit *AuditLog) http.Handler {
+	h := &handler{iss: iss, audit: audit, mux: http.NewServeMux()}
+	h.mux.HandleFunc("POST /admin/tokens", h.issue)
+	return h
+}
+
+func (h *handler) issue(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Player     string `json:"player"`
+		TTLSeconds int    `json:"ttlSeconds"` // default 30 days
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.Player == "" || req.TTLSeconds < 0 {
+		h.fail(w, r, "issue_token", req.Player, "", http.StatusBadRequest, errors.New("player required"))
+		return
+	}
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	if ttl == 0 {
+		ttl = defaultTokenTTL
+	}
+	tok, err := h.iss.Issue(req.Player, ttl)
+	if err != nil {
+		h.fail(w, r, "issue_token", req.Player, "", http.StatusBadRequest, err)
+		return
+	}
+	// The token itself stays out of the audit log.
+	h.ok(w, r, "issue_token", req.Player, strconv.Itoa(int(ttl.Seconds()))+"s",
+		map[string]any{"token": tok, "expires": time.Now().Add(ttl)})
+}
@@ -0,0 +1,103 @@
+// Package auth issues and verifies player identity tokens. A token is
+// base64url(JSON claims) "." base64url(HMAC-SHA256(claims)); the server holds
+// the only key, so no session store is needed.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/infra"
+)
+
+var (
+	ErrMalformed = errors.New("malformed token")
+	ErrSignature = errors.New("bad token signature")
+	ErrExpired   = errors.New("token expired")
+	ErrNoSecret  = errors.New("auth secret not configured")
+	ErrGuestName = errors.New("player ids starting with " + GuestPrefix + " are kept for guests")
+)
+
+// GuestPrefix starts the names guests go by where they meet signed-in
+// players (see lobby); no token is issued for such a name.
+const GuestPrefix = "~"
+
+type Claims struct {
+	Player  string `json:"sub"`
+	Expires int64  `json:"exp"` // unix seconds
+}
+
+// Verifier resolves a token to the player it was issued for.
+type Verifier interface {
+	Verify(token string) (player string, err error)
+}
+
+// Issuer mints tokens; it is also a Verifier.
+type Issuer interface {
+	Verifier
+	Issue(player string, ttl time.Duration) (string, error)
+}
+
+type signer struct {
+	key   []byte
+	clock infra.Clock
+}
+
+// NewSigner uses secret as the HMAC key. clock may be nil.
+func NewSigner(secret []byte, clock infra.Clock) (Issuer, error) {
+	if len(secret) < 16 {
+		return nil, errors.New("auth secret must be at least 16 bytes")
+	}
+	if clock == nil {
+		clock = infra.SystemClock{}
+	}
+	return &signer{key: append([]byte(nil), secret...), clock: clock}, nil
+}
+
+func (s *signer) Issue(player string, ttl time.Duration) (string, error) {
+	if player == "" || ttl <= 0 {
+		return "", errors.New("token needs a player and a positive ttl")
+	}
+	if strings.HasPrefix(player, GuestPrefix) {
+		return "", ErrGuestName
+	}
+	b, err := json.Marshal(Claims{Player: player, Expires: s.clock.Now().Add(ttl).Unix()})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + s.sign(payload), nil
+}
+
+func (s *signer) Verify(token string) (string, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok || payload == "" || sig == "" {
+		return "", ErrMalformed
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.sign(payload))) {
+		return "", ErrSignature
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrMalformed
+	}
+	var c Claims
+	if err := json.Unmarshal(b, &c); err != nil || c.Player == "" {
+		return "", ErrMalformed
+	}
+	if s.clock.Now().Unix() >= c.Expires {
+		return "", ErrExpired
+	}
+	return c.Player, nil
+}
+
+func (s *signer) sign(payload string) string {
+	m := hmac.New(sha256.New, s.key)
+	m.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
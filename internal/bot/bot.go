@@ -0,0 +1,119 @@
+// Package bot picks moves for computer players (terminal client, load tests).
+package bot
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+)
+
+// Strategy chooses a free cell for me on board, or -1 if there is none.
+type Strategy interface {
+	Move(board [9]string, me engine.Mark) int
+}
+
+type StrategyFunc func(board [9]string, me engine.Mark) int
+
+func (f StrategyFunc) Move(board [9]string, me engine.Mark) int { return f(board, me) }
+
+// Random plays any free cell.
+func Random(r *rand.Rand) Strategy {
+	return StrategyFunc(func(board [9]string, _ engine.Mark) int {
+		free := freeCells(board)
+		if len(free) == 0 {
+			return -1
+		}
+		return free[r.Intn(len(free))]
+	})
+}
+
+// Perfect plays minimax; it never loses. Ties go to the lowest cell, so it
+// is deterministic.
+func Perfect() Strategy {
+	return StrategyFunc(func(board [9]string, me engine.Mark) int {
+		var b engine.Board
+		for i, s := range board {
+			b[i] = engine.Mark(s)
+		}
+		best, bestScore := -1, -2
+		for _, i := range freeCells(board) {
+			b[i] = me
+			score := -negamax(b, other(me))
+			b[i] = engine.Empty
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		return best
+	})
+}
+
+var (
+	eng    = engine.NewEngine()
+	scores sync.Map // engine.Board => negamax score; the side to move follows from the board
+)
+
+// negamax scores b for the side to move: 1 win, 0 draw, -1 loss.
+func negamax(b engine.Board, turn engine.Mark) int {
+	if s, ok := scores.Load(b); ok {
+		return s.(int)
+	}
+	s := search(b, turn)
+	scores.Store(b, s)
+	return s
+}
+
+func search(b engine.Board, turn engine.Mark) int {
+	switch eng.Outcome(b) {
+	case engine.Draw:
+		return 0
+	case engine.XWins, engine.OWins:
+		return -1 // the previous move won
+	}
+	best := -2
+	for i := range b {
+		if b[i] != engine.Empty {
+			continue
+		}
+		b[i] = turn
+		if s := -negamax(b, other(turn)); s > best {
+			best = s
+		}
+		b[i] = engine.Empty
+	}
+	return best
+}
+
+func other(m engine.Mark) engine.Mark {
+	if m == engine.X {
+		return engine.O
+	}
+	return engine.X
+}
+
+func freeCells(board [9]string) []int {
+	var out []int
+	for i, s := range board {
+		if s == "" {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// Scripted plays the first free cell of order, falling back to the lowest
+// free cell, so a scripted game is reproducible.
+func Scripted(order ...int) Strategy {
+	return StrategyFunc(func(board [9]string, _ engine.Mark) int {
+		for _, i := range order {
+			if i >= 0 && i < 9 && board[i] == "" {
+				return i
+			}
+		}
+		if free := freeCells(board); len(free) > 0 {
+			return free[0]
+		}
+		return -1
+	})
+}
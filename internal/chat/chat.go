@@ -0,0 +1,101 @@
+package chat
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	ErrEmpty    = errors.New("empty message")
+	ErrTooLong  = errors.New("message too long")
+	ErrRejected = errors.New("message rejected by filter")
+	ErrBadEmote = errors.New("unknown emote")
+)
+
+// Emotes are the quick reactions clients may send without typing.
+var Emotes = []string{"gg", "wave", "think", "laugh", "oops", "wow"}
+
+// Filter inspects a chat line before it is relayed. It may return the text
+// rewritten (e.g. masked) or ErrRejected.
+type Filter interface {
+	Filter(text string) (string, error)
+}
+
+// FilterFunc adapts a function to Filter.
+type FilterFunc func(string) (string, error)
+
+func (f FilterFunc) Filter(text string) (string, error) { return f(text) }
+
+// Nop lets everything through.
+var Nop Filter = FilterFunc(func(s string) (string, error) { return s, nil })
+
+// WordFilter masks blocked words (case-insensitive, whole words) with '*'.
+type WordFilter struct {
+	blocked map[string]bool
+}
+
+func NewWordFilter(words ...string) *WordFilter {
+	f := &WordFilter{blocked: make(map[string]bool, len(words))}
+	for _, w := range words {
+		f.blocked[strings.ToLower(w)] = true
+	}
+	return f
+}
+
+func (f *WordFilter) Filter(text string) (string, error) {
+	var b strings.Builder
+	word := []rune{}
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		if f.blocked[strings.ToLower(string(word))] {
+			b.WriteString(strings.Repeat("*", len(word)))
+		} else {
+			b.WriteString(string(word))
+		}
+		word = word[:0]
+	}
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		b.WriteRune(r)
+	}
+	flush()
+	return b.String(), nil
+}
+
+// Clean trims text, enforces maxLen (in characters) and strips control
+// characters, then runs it through f.
+func Clean(text string, maxLen int, f Filter) (string, error) {
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(text))
+	if text == "" {
+		return "", ErrEmpty
+	}
+	if maxLen > 0 && utf8.RuneCountInString(text) > maxLen {
+		return "", ErrTooLong
+	}
+	if f == nil {
+		f = Nop
+	}
+	return f.Filter(text)
+}
+
+func ValidEmote(e string) bool {
+	for _, x := range Emotes {
+		if x == e {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+// Package cluster lets several game servers act as one. A Broker records
+// which node owns a key (a room code, the match queue) and carries messages
+// between nodes; the hub forwards each player to the node that owns their
+// room (see hub.Config.Cluster).
+package cluster
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrClosed  = errors.New("broker closed")
+	ErrBacklog = errors.New("subscriber too far behind; message dropped")
+	ErrDenied  = errors.New("broker refused the cluster secret")
+	// ErrDisconnected: the node lost the broker and is dialing it again.
+	ErrDisconnected = errors.New("broker connection lost; reconnecting")
+)
+
+// Broker is one node's connection to the cluster.
+type Broker interface {
+	PubSub
+	Ownership
+	// Ping reports whether the node can reach the rest of the cluster.
+	Ping(ctx context.Context) error
+	// Close drops the node's subscriptions and the keys it owns.
+	Close() error
+}
+
+// PubSub carries messages between nodes.
+type PubSub interface {
+	// Publish sends msg to every subscriber of topic, on any node, without
+	// waiting for delivery. Messages from one publisher to one topic arrive
+	// in order. ErrBacklog: some subscriber had too many messages waiting
+	// and did not get this one.
+	Publish(topic string, msg []byte) error
+	// Subscribe calls fn with each message published to topic until cancel
+	// is called. Calls for one subscription never overlap.
+	Subscribe(topic string, fn func(msg []byte)) (cancel func(), err error)
+}
+
+// Ownership gives each key at most one owning node.
+type Ownership interface {
+	// Claim makes node the owner of key unless another node already is, and
+	// returns the owner.
+	Claim(key, node string) (owner string, err error)
+	// Release ends node's ownership of key; a no-op if node does not own it.
+	Release(key, node string) error
+}
@@ -0,0 +1,180 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+)
+
+// NewMemory returns a Broker for nodes in one process: every hub given it
+// joins the same cluster. Close ends it for all of them.
+func NewMemory() Broker {
+	return &memory{subs: make(map[string]map[*queue]bool), owners: make(map[string]string)}
+}
+
+type memory struct {
+	mu     sync.Mutex
+	subs   map[string]map[*queue]bool // topic => subscriptions
+	owners map[string]string          // key => node
+	closed bool
+}
+
+func (m *memory) Publish(topic string, msg []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	var err error
+	for q := range m.subs[topic] {
+		if !q.push(msg) {
+			err = ErrBacklog
+		}
+	}
+	return err
+}
+
+func (m *memory) Subscribe(topic string, fn func([]byte)) (func(), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+	q := newQueue(fn)
+	if m.subs[topic] == nil {
+		m.subs[topic] = make(map[*queue]bool)
+	}
+	m.subs[topic][q] = true
+	return func() {
+		m.mu.Lock()
+		delete(m.subs[topic], q)
+		if len(m.subs[topic]) == 0 {
+			delete(m.subs, topic)
+		}
+		m.mu.Unlock()
+		q.stop()
+	}, nil
+}
+
+func (m *memory) Claim(key, node string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return "", ErrClosed
+	}
+	if owner, ok := m.owners[key]; ok {
+		return owner, nil
+	}
+	m.owners[key] = node
+	return node, nil
+}
+
+func (m *memory) Release(key, node string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.owners[key] == node {
+		delete(m.owners, key)
+	}
+	return nil
+}
+
+func (m *memory) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// releaseAll frees every key node owns.
+func (m *memory) releaseAll(node string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, owner := range m.owners {
+		if owner == node {
+			delete(m.owners, k)
+		}
+	}
+}
+
+func (m *memory) Close() error {
+	m.mu.Lock()
+	subs := m.subs
+	m.subs, m.closed = nil, true
+	m.mu.Unlock()
+	for _, qs := range subs {
+		for q := range qs {
+			q.stop()
+		}
+	}
+	return nil
+}
+
+// maxQueued is how many messages a queue holds for a subscriber that has
+// fallen behind; later ones are refused.
+const maxQueued = 4096
+
+// queue delivers one subscription's messages in order on its own
+// goroutine, so that publishers never wait for subscribers.
+type queue struct {
+	fn   func([]byte)
+	mu   sync.Mutex
+	msgs [][]byte
+	wake chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func newQueue(fn func([]byte)) *queue {
+	q := &queue{fn: fn, wake: make(chan struct{}, 1), done: make(chan struct{})}
+	go q.run()
+	return q
+}
+
+// push queues msg; false if the queue is full.
+func (q *queue) push(msg []byte) bool {
+	q.mu.Lock()
+	if len(q.msgs) >= maxQueued {
+		q.mu.Unlock()
+		return false
+	}
+	q.msgs = append(q.msgs, msg)
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (q *queue) stop() { q.once.Do(func() { close(q.done) }) }
+
+func (q *queue) run() {
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-q.wake:
+		}
+		for {
+			q.mu.Lock()
+			batch := q.msgs
+			q.msgs = nil
+			q.mu.Unlock()
+			if len(batch) == 0 {
+				break
+			}
+			for _, msg := range batch {
+				select {
+				case <-q.done:
+					return
+				default:
+				}
+				q.fn(msg)
+			}
+		}
+	}
+}
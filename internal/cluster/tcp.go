@@ -0,0 +1,550 @@
+package cluster
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// The TCP broker lets server processes on one host (or a trusted network)
+// form a cluster: one runs a Server, every node Dials it. Frames are JSON
+// lines; keys a node claimed are freed when its connection drops. A node
+// first proves it knows the cluster secret: the server sends a random
+// challenge, the node answers with its HMAC-SHA256 under the secret. The
+// secret itself never crosses the wire, but frames after it are not
+// encrypted.
+type frame struct {
+	Op    string `json:"op"`              // hello, sub, unsub, pub, claim, release; from the server: challenge, welcome, msg, owner
+	ID    uint64 `json:"id,omitempty"`    // claim and its owner reply
+	Topic string `json:"topic,omitempty"` // or the key, for claim and release
+	Node  string `json:"node,omitempty"`
+	Data  []byte `json:"data,omitempty"`
+}
+
+const (
+	maxFrameBytes    = 1 << 20
+	handshakeTimeout = 5 * time.Second
+)
+
+// Server is a broker for nodes in other processes (see Dial).
+type Server interface {
+	// Serve accepts nodes on ln until it is closed.
+	Serve(ln net.Listener) error
+	// Close disconnects every node and stops the listeners.
+	Close() error
+}
+
+type server struct {
+	mem    *memory
+	secret []byte
+
+	mu     sync.Mutex
+	lns    map[net.Listener]bool
+	conns  map[net.Conn]bool
+	closed bool
+}
+
+// NewServer returns a broker that admits the nodes that know secret.
+func NewServer(secret string) Server {
+	return &server{
+		mem:    NewMemory().(*memory),
+		secret: []byte(secret),
+		lns:    make(map[net.Listener]bool),
+		conns:  make(map[net.Conn]bool),
+	}
+}
+
+func (s *server) Serve(ln net.Listener) error {
+	if !s.track(func() { s.lns[ln] = true }) {
+		_ = ln.Close()
+		return ErrClosed
+	}
+	defer s.track(func() { delete(s.lns, ln) })
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if !s.track(func() { s.conns[nc] = true }) {
+			_ = nc.Close()
+			return nil
+		}
+		go s.handle(nc)
+	}
+}
+
+// track runs fn under s.mu unless the server is closed.
+func (s *server) track(fn func()) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	fn()
+	return true
+}
+
+func (s *server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for ln := range s.lns {
+		_ = ln.Close()
+	}
+	for nc := range s.conns {
+		_ = nc.Close()
+	}
+	s.mu.Unlock()
+	return s.mem.Close()
+}
+
+// handle serves one node until its connection drops.
+func (s *server) handle(nc net.Conn) {
+	sc := bufio.NewScanner(nc)
+	sc.Buffer(make([]byte, 4096), maxFrameBytes)
+	if err := s.admit(nc, sc); err != nil {
+		log.Printf("cluster: node at %s refused: %v", nc.RemoteAddr(), err)
+		_ = nc.Close()
+		s.track(func() { delete(s.conns, nc) })
+		return
+	}
+
+	out := newQueue(func(b []byte) {
+		_ = nc.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if _, err := nc.Write(b); err != nil {
+			_ = nc.Close()
+		}
+	})
+	send := func(f frame) {
+		b, _ := json.Marshal(f)
+		if !out.push(append(b, '\n')) {
+			// Too far behind to catch up: drop the node, which frees its keys.
+			_ = nc.Close()
+		}
+	}
+	subs := make(map[string]func())
+	nodes := make(map[string]bool)
+	defer func() {
+		for _, cancel := range subs {
+			cancel()
+		}
+		for node := range nodes {
+			s.mem.releaseAll(node)
+		}
+		out.stop()
+		_ = nc.Close()
+		s.track(func() { delete(s.conns, nc) })
+	}()
+
+	for sc.Scan() {
+		var f frame
+		if err := json.Unmarshal(sc.Bytes(), &f); err != nil {
+			log.Printf("cluster: bad frame from %s: %v", nc.RemoteAddr(), err)
+			return
+		}
+		switch f.Op {
+		case "sub":
+			if subs[f.Topic] != nil {
+				continue
+			}
+			topic := f.Topic
+			cancel, err := s.mem.Subscribe(topic, func(msg []byte) { send(frame{Op: "msg", Topic: topic, Data: msg}) })
+			if err != nil {
+				return
+			}
+			subs[topic] = cancel
+		case "unsub":
+			if cancel := subs[f.Topic]; cancel != nil {
+				cancel()
+				delete(subs, f.Topic)
+			}
+		case "pub":
+			if err := s.mem.Publish(f.Topic, f.Data); errors.Is(err, ErrBacklog) {
+				log.Printf("cluster: message to %s dropped: %v", f.Topic, err)
+			}
+		case "claim":
+			nodes[f.Node] = true
+			owner, _ := s.mem.Claim(f.Topic, f.Node)
+			send(frame{Op: "owner", ID: f.ID, Node: owner})
+		case "release":
+			_ = s.mem.Release(f.Topic, f.Node)
+		}
+	}
+}
+
+// admit challenges a new node to prove it knows the secret.
+func (s *server) admit(nc net.Conn, sc *bufio.Scanner) error {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	_ = nc.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer func() { _ = nc.SetDeadline(time.Time{}) }()
+	if err := writeFrame(nc, frame{Op: "challenge", Data: nonce}); err != nil {
+		return err
+	}
+	f, err := readFrame(sc)
+	if err != nil {
+		return err
+	}
+	if f.Op != "hello" || !hmac.Equal(f.Data, prove(s.secret, nonce)) {
+		return ErrDenied
+	}
+	return writeFrame(nc, frame{Op: "welcome"})
+}
+
+// prove is a node's answer to a challenge.
+func prove(secret, nonce []byte) []byte {
+	m := hmac.New(sha256.New, secret)
+	m.Write(nonce)
+	return m.Sum(nil)
+}
+
+func writeFrame(w io.Writer, f frame) error {
+	b, _ := json.Marshal(f)
+	_, err := w.Write(append(b, '\n'))
+	return err
+}
+
+func readFrame(sc *bufio.Scanner) (frame, error) {
+	var f frame
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return f, err
+		}
+		return f, io.EOF
+	}
+	err := json.Unmarshal(sc.Bytes(), &f)
+	return f, err
+}
+
+// Dial connects a node to the Server at addr; ErrDenied if secret is not
+// the server's. A dropped connection is dialed again, with backoff, and
+// the node's subscriptions and claims are made again on it.
+func Dial(addr, secret string) (Broker, error) {
+	c := &client{
+		addr:    addr,
+		secret:  []byte(secret),
+		subs:    make(map[string]map[*queue]bool),
+		claims:  make(map[string]string),
+		pending: make(map[uint64]func(string)),
+		done:    make(chan struct{}),
+	}
+	l, sc, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	c.link = l
+	go c.read(l, sc)
+	return c, nil
+}
+
+// dial connects and answers the server's challenge.
+func (c *client) dial() (*link, *bufio.Scanner, error) {
+	nc, err := net.DialTimeout("tcp", c.addr, 5*time.Second)
+	if err != nil {
+		return nil, nil, err
+	}
+	sc := bufio.NewScanner(nc)
+	sc.Buffer(make([]byte, 4096), maxFrameBytes)
+	if err := join(nc, sc, c.secret); err != nil {
+		_ = nc.Close()
+		return nil, nil, err
+	}
+	l := &link{nc: nc, lost: make(chan struct{})}
+	l.out = newQueue(func(b []byte) {
+		if _, err := nc.Write(b); err != nil {
+			_ = nc.Close() // read notices and dials again
+		}
+	})
+	return l, sc, nil
+}
+
+// join answers the server's challenge.
+func join(nc net.Conn, sc *bufio.Scanner, secret []byte) error {
+	_ = nc.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer func() { _ = nc.SetDeadline(time.Time{}) }()
+	f, err := readFrame(sc)
+	if err != nil {
+		return err
+	}
+	if f.Op != "challenge" {
+		return fmt.Errorf("cluster: broker sent %q before its challenge", f.Op)
+	}
+	if err := writeFrame(nc, frame{Op: "hello", Data: prove(secret, f.Data)}); err != nil {
+		return err
+	}
+	// A server that rejects the answer hangs up.
+	if f, err := readFrame(sc); err != nil || f.Op != "welcome" {
+		return ErrDenied
+	}
+	return nil
+}
+
+// Backoff between attempts to reach a lost server.
+const (
+	minRedial = 100 * time.Millisecond
+	maxRedial = 5 * time.Second
+)
+
+type client struct {
+	addr   string
+	secret []byte
+
+	mu      sync.Mutex
+	link    *link                      // nil while reconnecting
+	subs    map[string]map[*queue]bool // topic => local subscriptions
+	claims  map[string]string          // key => node, as claimed through this client
+	pending map[uint64]func(string)    // claim id => gets the owner
+	nextID  uint64
+	done    chan struct{}
+	closed  bool
+}
+
+// link is one connection to the server.
+type link struct {
+	nc   net.Conn
+	out  *queue
+	lost chan struct{} // closed when the connection drops
+}
+
+// send queues f for the server; false while there is no connection.
+// Caller holds c.mu.
+func (c *client) send(f frame) bool {
+	if c.closed || c.link == nil {
+		return false
+	}
+	b, _ := json.Marshal(f)
+	if !c.link.out.push(append(b, '\n')) {
+		// The server is not keeping up: hang up, and read dials again.
+		_ = c.link.nc.Close()
+		return false
+	}
+	return true
+}
+
+// Publish fails with ErrDisconnected while the server is being dialed
+// again: messages are not kept for later.
+func (c *client) Publish(topic string, msg []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	if !c.send(frame{Op: "pub", Topic: topic, Data: msg}) {
+		return ErrDisconnected
+	}
+	return nil
+}
+
+func (c *client) Subscribe(topic string, fn func([]byte)) (func(), error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrClosed
+	}
+	q := newQueue(fn)
+	if c.subs[topic] == nil {
+		c.subs[topic] = make(map[*queue]bool)
+		c.send(frame{Op: "sub", Topic: topic}) // or on the next connection
+	}
+	c.subs[topic][q] = true
+	return func() {
+		c.mu.Lock()
+		if c.subs[topic][q] {
+			delete(c.subs[topic], q)
+			if len(c.subs[topic]) == 0 {
+				delete(c.subs, topic)
+				c.send(frame{Op: "unsub", Topic: topic})
+			}
+		}
+		c.mu.Unlock()
+		q.stop()
+	}, nil
+}
+
+func (c *client) Claim(key, node string) (string, error) {
+	reply := make(chan string, 1)
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return "", ErrClosed
+	}
+	l := c.link
+	c.nextID++
+	id := c.nextID
+	if !c.send(frame{Op: "claim", ID: id, Topic: key, Node: node}) {
+		c.mu.Unlock()
+		return "", ErrDisconnected
+	}
+	c.pending[id] = func(owner string) {
+		if owner == node {
+			c.claims[key] = node
+		}
+		reply <- owner
+	}
+	c.mu.Unlock()
+
+	select {
+	case owner := <-reply:
+		return owner, nil
+	case <-l.lost:
+		return "", ErrDisconnected
+	case <-c.done:
+		return "", ErrClosed
+	}
+}
+
+func (c *client) Release(key, node string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	if c.claims[key] == node {
+		delete(c.claims, key)
+	}
+	// A key released while disconnected was freed by the server already.
+	c.send(frame{Op: "release", Topic: key, Node: node})
+	return nil
+}
+
+// Ping reports whether the node is connected to the server.
+func (c *client) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case c.closed:
+		return ErrClosed
+	case c.link == nil:
+		return ErrDisconnected
+	}
+	return nil
+}
+
+func (c *client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	l, subs := c.link, c.subs
+	c.link, c.subs = nil, nil
+	close(c.done)
+	c.mu.Unlock()
+
+	if l != nil {
+		l.hangUp()
+	}
+	for _, qs := range subs {
+		for q := range qs {
+			q.stop()
+		}
+	}
+	return nil
+}
+
+func (l *link) hangUp() {
+	_ = l.nc.Close()
+	l.out.stop()
+}
+
+// read serves l until it drops, then dials again.
+func (c *client) read(l *link, sc *bufio.Scanner) {
+	for sc.Scan() {
+		var f frame
+		if err := json.Unmarshal(sc.Bytes(), &f); err != nil {
+			log.Printf("cluster: bad frame from broker: %v", err)
+			break
+		}
+		c.mu.Lock()
+		switch f.Op {
+		case "msg":
+			for q := range c.subs[f.Topic] {
+				if !q.push(f.Data) {
+					log.Printf("cluster: message to %s dropped: %v", f.Topic, ErrBacklog)
+				}
+			}
+		case "owner":
+			if reply := c.pending[f.ID]; reply != nil {
+				delete(c.pending, f.ID)
+				reply(f.Node)
+			}
+		}
+		c.mu.Unlock()
+	}
+	l.hangUp()
+
+	// Claims waiting on l fail; the server freed this node's keys.
+	c.mu.Lock()
+	if c.link == l {
+		c.link = nil
+	}
+	clear(c.pending)
+	close(l.lost)
+	closed := c.closed
+	c.mu.Unlock()
+	if !closed {
+		c.redial()
+	}
+}
+
+// redial connects again, then subscribes and claims again what the node
+// had before the connection dropped.
+func (c *client) redial() {
+	wait := minRedial
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-time.After(wait):
+		}
+		l, sc, err := c.dial()
+		if err != nil {
+			log.Printf("cluster: broker %s: %v", c.addr, err)
+			wait = min(2*wait, maxRedial)
+			continue
+		}
+
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			l.hangUp()
+			return
+		}
+		c.link = l
+		for topic := range c.subs {
+			c.send(frame{Op: "sub", Topic: topic})
+		}
+		for key, node := range c.claims {
+			c.nextID++
+			c.pending[c.nextID] = func(owner string) {
+				if owner != node {
+					log.Printf("cluster: %s lost %s to %s while away", node, key, owner)
+					delete(c.claims, key)
+				}
+			}
+			c.send(frame{Op: "claim", ID: c.nextID, Topic: key, Node: node})
+		}
+		c.mu.Unlock()
+		log.Printf("cluster: back on broker %s", c.addr)
+		go c.read(l, sc)
+		return
+	}
+}
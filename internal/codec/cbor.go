@@ -0,0 +1,263 @@
+package codec
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// A minimal RFC 8949 CBOR implementation covering the JSON data model:
+// integers, floats, text, arrays, string-keyed maps, booleans and null.
+// Maps are written with sorted keys so encodings are deterministic.
+
+var (
+	ErrTruncated   = errors.New("cbor: truncated input")
+	ErrTrailing    = errors.New("cbor: trailing bytes")
+	ErrUnsupported = errors.New("cbor: unsupported item")
+	ErrTooDeep     = errors.New("cbor: nesting too deep")
+)
+
+const maxDepth = 32
+
+const (
+	majorUint  = 0
+	majorNeg   = 1
+	majorBytes = 2
+	majorText  = 3
+	majorArray = 4
+	majorMap   = 5
+	majorTag   = 6
+	majorOther = 7
+)
+
+type encoder struct{ buf []byte }
+
+func (e *encoder) head(major byte, n uint64) {
+	m := major << 5
+	switch {
+	case n < 24:
+		e.buf = append(e.buf, m|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, m|24, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, m|25), uint16(n))
+	case n <= math.MaxUint32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, m|26), uint32(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, m|27), n)
+	}
+}
+
+func (e *encoder) value(v any) error {
+	switch x := v.(type) {
+	case nil:
+		e.buf = append(e.buf, 0xf6)
+	case bool:
+		if x {
+			e.buf = append(e.buf, 0xf5)
+		} else {
+			e.buf = append(e.buf, 0xf4)
+		}
+	case json.Number:
+		return e.number(string(x))
+	case string:
+		e.head(majorText, uint64(len(x)))
+		e.buf = append(e.buf, x...)
+	case []any:
+		e.head(majorArray, uint64(len(x)))
+		for _, item := range x {
+			if err := e.value(item); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		e.head(majorMap, uint64(len(x)))
+		for _, k := range keys {
+			e.head(majorText, uint64(len(k)))
+			e.buf = append(e.buf, k...)
+			if err := e.value(x[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupported, v)
+	}
+	return nil
+}
+
+func (e *encoder) number(s string) error {
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		e.head(majorUint, u)
+		return nil
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil && i < 0 {
+		e.head(majorNeg, uint64(-(i + 1)))
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xfb), math.Float64bits(f))
+	return nil
+}
+
+type decoder struct {
+	buf []byte
+	off int
+}
+
+func (d *decoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.buf)-d.off) {
+		return nil, ErrTruncated
+	}
+	b := d.buf[d.off : d.off+int(n)]
+	d.off += int(n)
+	return b, nil
+}
+
+// head reads an initial byte and its argument. Indefinite lengths are refused.
+func (d *decoder) head() (major byte, info byte, arg uint64, err error) {
+	b, err := d.take(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = b[0]>>5, b[0]&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		ext, err := d.take(1 << (info - 24))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		for _, c := range ext {
+			arg = arg<<8 | uint64(c)
+		}
+		return major, info, arg, nil
+	default:
+		return 0, 0, 0, ErrUnsupported
+	}
+}
+
+func (d *decoder) value(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, ErrTooDeep
+	}
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case majorUint:
+		return json.Number(strconv.FormatUint(arg, 10)), nil
+	case majorNeg:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer overflow", ErrUnsupported)
+		}
+		return json.Number(strconv.FormatInt(-1-int64(arg), 10)), nil
+	case majorBytes, majorText:
+		b, err := d.take(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(b) {
+			return nil, fmt.Errorf("%w: invalid utf-8", ErrUnsupported)
+		}
+		return string(b), nil
+	case majorArray:
+		if arg > uint64(len(d.buf)-d.off) {
+			return nil, ErrTruncated
+		}
+		out := make([]any, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	case majorMap:
+		if arg > uint64(len(d.buf)-d.off)/2 {
+			return nil, ErrTruncated
+		}
+		out := make(map[string]any, arg)
+		for i := uint64(0); i < arg; i++ {
+			k, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			ks, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: non-text map key", ErrUnsupported)
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			out[ks] = v
+		}
+		return out, nil
+	case majorTag:
+		return d.value(depth + 1) // tags carry no meaning in our messages
+	default:
+		return d.simple(info, arg)
+	}
+}
+
+func (d *decoder) simple(info byte, arg uint64) (any, error) {
+	var f float64
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		f = halfToFloat(uint16(arg))
+	case 26:
+		f = float64(math.Float32frombits(uint32(arg)))
+	case 27:
+		f = math.Float64frombits(arg)
+	default:
+		return nil, fmt.Errorf("%w: simple value %d", ErrUnsupported, arg)
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("%w: non-finite float", ErrUnsupported)
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+}
+
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
@@ -0,0 +1,98 @@
+// Package codec encodes proto messages for the wire. Every codec carries the
+// JSON data model of the proto structs, so a message means the same thing
+// whichever encoding a client negotiated.
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+type Codec interface {
+	// Name is the websocket subprotocol that selects this codec.
+	Name() string
+	// Binary reports whether frames must be sent as binary messages.
+	Binary() bool
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+	// ToJSON transcodes one inbound frame into its JSON form for the hub.
+	ToJSON(data []byte) ([]byte, error)
+}
+
+const (
+	JSONProtocol = "ttt.json"
+	CBORProtocol = "ttt.cbor"
+)
+
+var (
+	JSON Codec = jsonCodec{}
+	CBOR Codec = cborCodec{}
+)
+
+// Subprotocols lists the negotiable names, preferred first.
+func Subprotocols() []string { return []string{JSONProtocol, CBORProtocol} }
+
+// ForProtocol maps a negotiated subprotocol to its codec. Clients that
+// negotiated nothing speak the original JSON text protocol.
+func ForProtocol(name string) Codec {
+	if name == CBORProtocol {
+		return CBOR
+	}
+	return JSON
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                       { return JSONProtocol }
+func (jsonCodec) Binary() bool                       { return false }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (jsonCodec) ToJSON(data []byte) ([]byte, error) { return data, nil }
+
+type cborCodec struct{}
+
+func (cborCodec) Name() string { return CBORProtocol }
+func (cborCodec) Binary() bool { return true }
+
+func (cborCodec) Marshal(v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return FromJSON(b)
+}
+
+func (c cborCodec) Unmarshal(data []byte, v any) error {
+	b, err := c.ToJSON(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func (cborCodec) ToJSON(data []byte) ([]byte, error) {
+	d := decoder{buf: data}
+	val, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.off != len(d.buf) {
+		return nil, ErrTrailing
+	}
+	return json.Marshal(val)
+}
+
+// FromJSON re-encodes a JSON document as CBOR.
+func FromJSON(b []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var val any
+	if err := dec.Decode(&val); err != nil {
+		return nil, err
+	}
+	var e encoder
+	if err := e.value(val); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
@@ -25,6 +25,7 @@ var (
 	ErrCellTaken       = errors.New("cell already taken")
 	ErrOutOfOrder      = errors.New("out of order client seq")
 	ErrTerminal        = errors.New("game already finished")
+	ErrInvalidOutcome  = errors.New("invalid outcome")
 )
 
 type Board [9]Mark
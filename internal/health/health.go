@@ -0,0 +1,96 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/httpx"
+)
+
+type Check func(ctx context.Context) error
+
+// Checker aggregates named readiness checks. Liveness never runs them: a
+// process that can answer HTTP is alive.
+type Checker struct {
+	timeout time.Duration
+
+	mu     sync.Mutex
+	names  []string
+	checks map[string]Check
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &Checker{timeout: timeout, checks: make(map[string]Check)}
+}
+
+func (c *Checker) Register(name string, fn Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = fn
+}
+
+type Report struct {
+	Status string            `json:"status"` // "ok" | "unavailable"
+	Checks map[string]string `json:"checks"` // name => "ok" or error text
+}
+
+// Run executes every check concurrently under the checker's timeout.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	names := append([]string(nil), c.names...)
+	checks := make([]Check, len(names))
+	for i, n := range names {
+		checks[i] = c.checks[n]
+	}
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = checks[i](ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	rep := Report{Status: "ok", Checks: make(map[string]string, len(names))}
+	for i, n := range names {
+		if errs[i] != nil {
+			rep.Status = "unavailable"
+			rep.Checks[n] = errs[i].Error()
+			continue
+		}
+		rep.Checks[n] = "ok"
+	}
+	return rep
+}
+
+func (c *Checker) Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpx.JSON(w, http.StatusOK, Report{Status: "ok", Checks: map[string]string{}})
+	})
+}
+
+func (c *Checker) Readiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rep := c.Run(r.Context())
+		code := http.StatusOK
+		if rep.Status != "ok" {
+			code = http.StatusServiceUnavailable
+		}
+		httpx.JSON(w, code, rep)
+	})
+}
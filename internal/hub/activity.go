@@ -0,0 +1,44 @@
+package hub
+
+import (
+	"sort"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+)
+
+// Activity is what the lobby shows beside presence.
+type Activity struct {
+	Open    []proto.OpenRoom // public rooms waiting for an opponent, oldest first
+	Waiting map[string]bool  // player ids holding a room or queued for auto-match
+	Playing map[string]bool  // player ids seated in a running game
+}
+
+func (h *hub) Activity() Activity {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	a := Activity{Open: []proto.OpenRoom{}, Waiting: make(map[string]bool), Playing: make(map[string]bool)}
+	for _, c := range h.all {
+		switch {
+		case c.room != nil && c.room.State().Status == engine.InProgress:
+			a.Playing[c.player] = true
+		case c.parked, h.queued[c.id] != nil:
+			a.Waiting[c.player] = true
+		}
+	}
+	for code, slot := range h.rooms {
+		if w := slot.waiting; w != nil && slot.public && slot.booked == nil {
+			a.Open = append(a.Open, proto.OpenRoom{Code: code, Host: w.player, Rated: slot.rated, BestOf: slot.opts.BestOf, Since: w.since})
+		}
+	}
+	sort.Slice(a.Open, func(i, j int) bool { return a.Open[i].Since.Before(a.Open[j].Since) })
+	return a
+}
+
+// changed tells Config.OnActivity that Activity may differ.
+func (h *hub) changed() {
+	if h.cfg.OnActivity != nil {
+		h.cfg.OnActivity()
+	}
+}
@@ -0,0 +1,179 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+)
+
+var ErrNotFound = errors.New("not found")
+
+type ConnInfo struct {
+	ID     string      `json:"id"`
+	Player string      `json:"player"`
+	Addr   string      `json:"addr"`
+	Code   string      `json:"code,omitempty"`
+	RoomID string      `json:"roomId,omitempty"`
+	Mark   engine.Mark `json:"mark,omitempty"`
+	Since  time.Time   `json:"since"`
+
+	Version int    `json:"version"`
+	Client  string `json:"client,omitempty"` // name sent in "hello"
+}
+
+// Ban blocks a player id and/or a remote address until Until. Player bans
+// only match signed-in players (see Config.Auth): a guest names themselves,
+// so guests can only be banned by address.
+type Ban struct {
+	Player string    `json:"player,omitempty"`
+	Addr   string    `json:"addr,omitempty"`
+	Until  time.Time `json:"until"`
+}
+
+func (h *hub) Conns() []ConnInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	out := make([]ConnInfo, 0, len(h.all))
+	for _, c := range h.all {
+		ci := ConnInfo{ID: c.id, Player: c.player, Addr: c.addr, Code: c.code, Mark: c.mark, Since: c.since, Version: c.version, Client: c.clientName}
+		if c.room != nil {
+			ci.RoomID = c.room.ID()
+		}
+		out = append(out, ci)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Since.Before(out[j].Since) })
+	return out
+}
+
+// EndRoom force-finishes a live game and tells both players.
+func (h *hub) EndRoom(roomID string, o engine.Outcome) error {
+	h.mu.Lock()
+	slot := h.live[roomID]
+	var players []*conn
+	var rm match.Room
+	if slot != nil {
+		players, rm = []*conn{slot.x, slot.o}, slot.room
+	}
+	h.mu.Unlock()
+	if slot == nil {
+		return ErrNotFound
+	}
+
+	if err := rm.End(context.Background(), o); err != nil {
+		return err
+	}
+	res := proto.Result{Type: "result", Status: outcomeText(o)}
+	for _, c := range players {
+		if c != nil {
+			_ = c.send(res)
+		}
+	}
+	h.seriesNext(rm, nil)
+	return nil
+}
+
+// Kick disconnects a connection; if it was playing, it forfeits.
+func (h *hub) Kick(connID, reason string) error {
+	h.mu.Lock()
+	c := h.all[connID]
+	h.mu.Unlock()
+	if c == nil {
+		return ErrNotFound
+	}
+	c.evict(reason)
+	return nil
+}
+
+// Ban records b and evicts matching connections; it returns how many.
+func (h *hub) Ban(b Ban) int {
+	h.mu.Lock()
+	if b.Player != "" {
+		h.bans["player:"+b.Player] = b.Until
+	}
+	if b.Addr != "" {
+		h.bans["addr:"+b.Addr] = b.Until
+	}
+	var hit []*conn
+	for _, c := range h.all {
+		if (b.Player != "" && c.authed && c.player == b.Player) || (b.Addr != "" && c.addr == b.Addr) {
+			hit = append(hit, c)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, c := range hit {
+		c.evict("banned")
+	}
+	return len(hit)
+}
+
+func (h *hub) Bans() []Ban {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	out := []Ban{}
+	for key, until := range h.bans {
+		if now.After(until) {
+			delete(h.bans, key)
+			continue
+		}
+		kind, val, _ := strings.Cut(key, ":")
+		if kind == "player" {
+			out = append(out, Ban{Player: val, Until: until})
+		} else {
+			out = append(out, Ban{Addr: val, Until: until})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Until.Before(out[j].Until) })
+	return out
+}
+
+// Broadcast sends a system message to every open connection.
+func (h *hub) Broadcast(text string) int {
+	h.mu.Lock()
+	all := make([]*conn, 0, len(h.all))
+	for _, c := range h.all {
+		all = append(all, c)
+	}
+	h.mu.Unlock()
+
+	msg := proto.System{Type: "system", Text: text}
+	n := 0
+	for _, c := range all {
+		if c.send(msg) == nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (h *hub) banned(player, addr string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range []string{"player:" + player, "addr:" + addr} {
+		if until, ok := h.bans[key]; ok {
+			if now.Before(until) {
+				return true
+			}
+			delete(h.bans, key)
+		}
+	}
+	return false
+}
+
+// evict tells the client why, then runs the normal disconnect path; the
+// writer flushes the notice before closing the socket.
+func (c *conn) evict(reason string) {
+	_ = c.send(proto.Error{Type: "error", Code: "KICKED", Detail: reason})
+	c.Close()
+}
@@ -0,0 +1,60 @@
+package hub
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kushgupta-hiver/TTT/internal/chat"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+)
+
+// say validates a chat line or emote, records it on the room and relays it to
+// the opponent unless they muted this player or opted out of chat. Exactly one of text/emote is set.
+func (c *conn) say(text, emote string) {
+	rm, peer, mark := c.session()
+	if rm == nil {
+		_ = c.send(proto.Error{Type: "error", Code: "NOT_PAIRED", Detail: "waiting for opponent"})
+		return
+	}
+	if ok, wait := c.chat.Allow(); !ok {
+		_ = c.send(proto.Error{Type: "error", Code: "RATE_LIMITED", Detail: "chat", RetryAfterMs: int(wait.Milliseconds()) + 1})
+		return
+	}
+
+	if emote != "" {
+		if !chat.ValidEmote(emote) {
+			_ = c.send(proto.Error{Type: "error", Code: "BAD_EMOTE", Detail: emote})
+			return
+		}
+	} else {
+		clean, err := chat.Clean(text, c.hub.cfg.MaxChatLen, c.hub.cfg.ChatFilter)
+		if err != nil {
+			_ = c.send(proto.Error{Type: "error", Code: chatErrCode(err), Detail: err.Error()})
+			return
+		}
+		text = clean
+	}
+
+	if err := rm.Say(context.Background(), match.ChatLine{PlayerID: c.id, Text: text, Emote: emote}); err != nil {
+		_ = c.send(proto.Error{Type: "error", Code: "INVALID", Detail: err.Error()})
+		return
+	}
+
+	msg := proto.Chat{Type: "chat", From: mark, Text: text, Emote: emote}
+	_ = c.send(msg) // echo, so the sender sees the filtered text
+	if peer != nil && !peer.muted.Load() && peer.has(featChat) {
+		_ = peer.send(msg)
+	}
+}
+
+func chatErrCode(err error) string {
+	switch {
+	case errors.Is(err, chat.ErrTooLong):
+		return "CHAT_TOO_LONG"
+	case errors.Is(err, chat.ErrRejected):
+		return "CHAT_REJECTED"
+	default:
+		return "INVALID"
+	}
+}
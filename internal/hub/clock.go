@@ -0,0 +1,50 @@
+package hub
+
+import (
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+)
+
+// clock is the time control of the slot's games; reservations set it.
+func (s *roomSlot) clock() match.TimeControl {
+	if s.booked == nil {
+		return match.TimeControl{}
+	}
+	return s.booked.Clock
+}
+
+// sendClock tells players where rm's clocks stand, if it is timed.
+func sendClock(rm match.Room, to ...*conn) {
+	c, ok := rm.Clock()
+	if !ok {
+		return
+	}
+	msg := proto.Clock{Type: "clock", XMs: int(c.X.Milliseconds()), OMs: int(c.O.Milliseconds()), Running: c.Running}
+	for _, p := range to {
+		if p != nil {
+			_ = p.send(msg)
+		}
+	}
+}
+
+// timeUp ends the game of a player whose clock ran out.
+func (h *hub) timeUp(playerID string) {
+	h.mu.Lock()
+	c := h.all[playerID]
+	var rm match.Room
+	var peer *conn
+	if c != nil {
+		rm, peer = c.room, c.peer
+	}
+	h.mu.Unlock()
+	if rm == nil {
+		return
+	}
+	res := proto.Result{Type: "result", Status: outcomeText(rm.State().Status)}
+	sendClock(rm, c, peer)
+	_ = c.send(res)
+	if peer != nil {
+		_ = peer.send(res)
+	}
+	h.seriesNext(rm, nil)
+}
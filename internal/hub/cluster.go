@@ -0,0 +1,371 @@
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/kushgupta-hiver/TTT/internal/cluster"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+)
+
+// A clustered hub (Config.Cluster) runs the rooms whose codes it claimed,
+// the match queues it claimed and the seats whose resume tokens it minted.
+// A player who connects to another node is relayed: that node forwards
+// their frames to the owner's inbox, and the owner's messages come back on
+// the player's node's inbox.
+
+const (
+	keyCode  = "code/"  // + room code
+	keyQueue = "queue/" // + casual or rated
+)
+
+// envelope is one message between nodes.
+type envelope struct {
+	Kind    string  `json:"kind"` // attach, frame, close to the owner; send, closed back
+	From    string  `json:"from"`
+	Session string  `json:"session"` // the relay's id on the player's node
+	Attach  *Attach `json:"attach,omitempty"`
+	Data    []byte  `json:"data,omitempty"`
+}
+
+type node struct {
+	h    *hub
+	b    cluster.Broker
+	name string
+	stop func()
+
+	mu     sync.Mutex
+	relays map[string]*relay  // session id => player here, seated elsewhere
+	guests map[string]*remote // node/session => player elsewhere, seated here
+	freed  []string           // codes to give up once h.mu is released
+
+	flushing sync.Mutex // held while freed codes are released; see flush
+}
+
+func inbox(node string) string { return "node/" + node }
+
+// join subscribes the hub to its inbox; nil if it cannot.
+func (h *hub) join() *node {
+	n := &node{
+		h:      h,
+		b:      h.cfg.Cluster,
+		name:   h.cfg.Node,
+		relays: make(map[string]*relay),
+		guests: make(map[string]*remote),
+	}
+	if n.name == "" {
+		n.name = newToken()[:8]
+	}
+	stop, err := n.b.Subscribe(inbox(n.name), n.deliver)
+	if err != nil {
+		log.Printf("cluster: node %s not joined: %v", n.name, err)
+		return nil
+	}
+	n.stop = stop
+	return n
+}
+
+// route attaches cl here if this node owns what it asks for, or relays it
+// to the owner.
+func (n *node) route(cl Client, a Attach) (Session, error) {
+	h := n.h
+	var owner string
+	var err error
+	switch {
+	case a.Resume != "":
+		owner = n.name
+		if name, _, ok := strings.Cut(a.Resume, "."); ok {
+			owner = name
+		}
+	case a.Code != "":
+		h.mu.Lock()
+		h.claims[a.Code]++
+		h.mu.Unlock()
+		defer func() {
+			h.mu.Lock()
+			h.unholdCode(a.Code)
+			h.mu.Unlock()
+			n.flush()
+		}()
+		n.flush()
+		owner, err = n.b.Claim(keyCode+a.Code, n.name)
+	default:
+		queue := "casual"
+		if a.Rated {
+			queue = "rated"
+		}
+		n.flush()
+		owner, err = n.b.Claim(keyQueue+queue, n.name)
+	}
+	if err != nil {
+		_ = cl.Send(proto.Error{Type: "error", Code: "UNAVAILABLE", Detail: err.Error()})
+		cl.Close()
+		h.conns.Release(a.Addr)
+		return nil, ErrRejected
+	}
+	if owner == n.name {
+		return h.attach(cl, a)
+	}
+
+	r := &relay{n: n, id: "p" + itoa64(h.seq.Add(1)), owner: owner, cl: cl, addr: a.Addr}
+	n.mu.Lock()
+	n.relays[r.id] = r
+	n.mu.Unlock()
+	if err := n.post(owner, envelope{Kind: "attach", Session: r.id, Attach: &a}); err != nil {
+		_ = cl.Send(proto.Error{Type: "error", Code: "UNAVAILABLE", Detail: err.Error()})
+		r.Close()
+		return nil, ErrRejected
+	}
+	return r, nil
+}
+
+func (n *node) post(to string, e envelope) error {
+	e.From = n.name
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return n.b.Publish(inbox(to), b)
+}
+
+// deliver handles one message from the inbox.
+func (n *node) deliver(msg []byte) {
+	var e envelope
+	if err := json.Unmarshal(msg, &e); err != nil {
+		log.Printf("cluster: bad envelope: %v", err)
+		return
+	}
+	key := e.From + "/" + e.Session
+	n.mu.Lock()
+	g, r := n.guests[key], n.relays[e.Session]
+	n.mu.Unlock()
+
+	switch e.Kind {
+	case "attach":
+		if e.Attach != nil && g == nil {
+			n.admit(e.From, e.Session, *e.Attach)
+		}
+	case "frame":
+		if g != nil && g.sess != nil {
+			g.sess.Handle(e.Data)
+		}
+	case "close":
+		if g != nil && n.forgetGuest(g) && g.sess != nil {
+			g.sess.Close()
+		}
+	case "send":
+		if r != nil && r.owner == e.From {
+			if v, err := decodeServerMsg(e.Data); err == nil {
+				_ = r.cl.Send(v)
+			}
+		}
+	case "closed":
+		if r != nil && r.owner == e.From && n.forgetRelay(r) {
+			r.end()
+		}
+	}
+}
+
+// admit attaches a player relayed from another node. A signed-in player is
+// verified again from their token rather than on the other node's word.
+func (n *node) admit(from, session string, a Attach) {
+	g := &remote{n: n, to: from, session: session}
+	a.Authenticated = false
+	if a.Token != "" {
+		player, err := n.h.Identify(a.Token)
+		if err != nil {
+			_ = g.Send(proto.Error{Type: "error", Code: "AUTH_REQUIRED", Detail: err.Error()})
+			g.Close()
+			return
+		}
+		a.Player, a.Authenticated = player, true
+	}
+	player := a.Player
+	if !a.Authenticated {
+		player = ""
+	}
+	if err := n.h.Admit(player, a.Addr); err != nil {
+		_ = g.Send(proto.Error{Type: "error", Code: "UNAVAILABLE", Detail: err.Error()})
+		g.Close()
+		return
+	}
+	n.mu.Lock()
+	n.guests[g.key()] = g
+	n.mu.Unlock()
+	sess, err := n.route(g, a)
+	if err != nil {
+		return
+	}
+	n.mu.Lock()
+	if n.guests[g.key()] == g {
+		g.sess = sess
+	}
+	n.mu.Unlock()
+}
+
+func (n *node) forgetRelay(r *relay) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.relays[r.id] != r {
+		return false
+	}
+	delete(n.relays, r.id)
+	return true
+}
+
+func (n *node) forgetGuest(g *remote) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.guests[g.key()] != g {
+		return false
+	}
+	delete(n.guests, g.key())
+	return true
+}
+
+// free queues a room code no room here uses, to be given up by flush.
+// Caller holds h.mu.
+func (n *node) free(code string) {
+	n.mu.Lock()
+	n.freed = append(n.freed, code)
+	n.mu.Unlock()
+}
+
+// flush gives up the codes free queued. Call it without h.mu after freeing
+// codes, and before each claim: a claim must not reach the broker ahead of
+// an earlier release of the same code, or the release would undo it.
+func (n *node) flush() {
+	n.flushing.Lock()
+	defer n.flushing.Unlock()
+	n.mu.Lock()
+	codes := n.freed
+	n.freed = nil
+	n.mu.Unlock()
+	for _, code := range codes {
+		// A closed broker has freed the node's keys already.
+		if err := n.b.Release(keyCode+code, n.name); err != nil && !errors.Is(err, cluster.ErrClosed) {
+			log.Printf("cluster: releasing code %s: %v", code, err)
+		}
+	}
+}
+
+// relay is the Session of a player connected here whose seat is on the
+// owner node.
+type relay struct {
+	n     *node
+	id    string
+	owner string
+	cl    Client
+	addr  string
+	once  sync.Once
+}
+
+func (r *relay) ID() string { return r.id }
+
+func (r *relay) Handle(data []byte) {
+	_ = r.n.post(r.owner, envelope{Kind: "frame", Session: r.id, Data: data})
+}
+
+func (r *relay) Close() {
+	if r.n.forgetRelay(r) {
+		_ = r.n.post(r.owner, envelope{Kind: "close", Session: r.id})
+		r.end()
+	}
+}
+
+// end closes the client and gives back its address slot.
+func (r *relay) end() {
+	r.once.Do(func() {
+		r.cl.Close()
+		r.n.h.conns.Release(r.addr)
+	})
+}
+
+// remote is the Client of a player seated here who is connected to another
+// node.
+type remote struct {
+	n       *node
+	to      string
+	session string
+	sess    Session // set on the inbox goroutine once attached
+	once    sync.Once
+}
+
+func (g *remote) key() string { return g.to + "/" + g.session }
+
+func (g *remote) Send(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return g.n.post(g.to, envelope{Kind: "send", Session: g.session, Data: b})
+}
+
+func (g *remote) Close() {
+	g.once.Do(func() {
+		g.n.forgetGuest(g)
+		_ = g.n.post(g.to, envelope{Kind: "closed", Session: g.session})
+	})
+}
+
+// decodeServerMsg turns a relayed message back into its proto type, which
+// transports switch on.
+func decodeServerMsg(b []byte) (any, error) {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(b, &head); err != nil {
+		return nil, err
+	}
+	for _, m := range proto.ServerMessages {
+		if m.Type == head.Type {
+			v := reflect.New(reflect.TypeOf(m.Go))
+			if err := json.Unmarshal(b, v.Interface()); err != nil {
+				return nil, err
+			}
+			return v.Elem().Interface(), nil
+		}
+	}
+	return json.RawMessage(b), nil
+}
+
+// unholdCode ends an attach's or reservation's hold on code, freeing the
+// code if no room here uses it. Caller holds h.mu; flushCodes after.
+func (h *hub) unholdCode(code string) {
+	if h.claims[code]--; h.claims[code] > 0 {
+		return
+	}
+	delete(h.claims, code)
+	if h.node != nil && h.rooms[code] == nil {
+		h.node.free(code)
+	}
+}
+
+// dropCode frees a code's slot. Caller holds h.mu; flushCodes after.
+func (h *hub) dropCode(code string) {
+	delete(h.rooms, code)
+	if h.node != nil && h.claims[code] == 0 {
+		h.node.free(code)
+	}
+}
+
+// flushCodes gives up the codes freed in the cluster. Call without h.mu.
+func (h *hub) flushCodes() {
+	if h.node != nil {
+		h.node.flush()
+	}
+}
+
+// claimCode takes code across the cluster; true on a single node.
+func (h *hub) claimCode(code string) (bool, error) {
+	if h.node == nil {
+		return true, nil
+	}
+	h.node.flush()
+	owner, err := h.node.b.Claim(keyCode+code, h.node.name)
+	return owner == h.node.name, err
+}
@@ -0,0 +1,74 @@
+package hub
+
+import (
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+)
+
+// features is a per-connection set of proto.Feature* switches.
+type features uint32
+
+const (
+	featLastMove features = 1 << iota
+	featDigitMoves
+	featChat
+)
+
+var featureBits = map[string]features{
+	proto.FeatureLastMove:   featLastMove,
+	proto.FeatureDigitMoves: featDigitMoves,
+	proto.FeatureChat:       featChat,
+}
+
+func featuresOf(names []string) features {
+	var f features
+	for _, n := range names {
+		f |= featureBits[n]
+	}
+	return f
+}
+
+func (f features) names() []string {
+	out := []string{}
+	for _, n := range proto.Features {
+		if f&featureBits[n] != 0 {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+var legacyFeatures = featuresOf(proto.LegacyFeatures)
+
+func (c *conn) has(f features) bool { return features(c.feats.Load())&f != 0 }
+
+// hello negotiates the protocol version and switches on the requested
+// features. Version1 keeps the legacy switches; later versions get exactly
+// what they ask for. Unknown feature names are ignored.
+func (c *conn) hello(msg proto.ClientMsg) {
+	v := msg.Version
+	if v < 0 {
+		_ = c.send(proto.Error{Type: "error", Code: "UNSUPPORTED_VERSION", Detail: "bad version"})
+		return
+	}
+	if v == 0 || v > proto.CurrentVersion {
+		v = proto.CurrentVersion
+	}
+	f := featuresOf(msg.Features)
+	if v == proto.Version1 {
+		f |= legacyFeatures
+	}
+	c.feats.Store(uint32(f))
+
+	c.hub.mu.Lock()
+	c.version, c.clientName = v, msg.Client
+	c.hub.mu.Unlock()
+
+	_ = c.send(proto.Welcome{
+		Type:     "welcome",
+		Version:  v,
+		Versions: proto.SupportedVersions,
+		Variants: proto.Variants,
+		Features: proto.Features,
+		Enabled:  f.names(),
+	})
+}
@@ -0,0 +1,671 @@
+package hub
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/auth"
+	"github.com/kushgupta-hiver/TTT/internal/chat"
+	"github.com/kushgupta-hiver/TTT/internal/cluster"
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ratelimit"
+)
+
+// Config is the transport-independent part of the game server.
+type Config struct {
+	// Abuse protection. Inbound messages are token-bucket limited per
+	// connection; connections and parked waiting rooms are capped per remote address.
+	MsgRate         float64 // inbound messages/second per connection (default 10)
+	MsgBurst        int     // default 20
+	MaxConnsPerIP   int     // default 16
+	MaxWaitingPerIP int     // room codes one address may hold open while waiting (default 4)
+
+	// Chat between seated players, limited separately from moves.
+	ChatRate   float64     // chat+emote messages/second per connection (default 1)
+	ChatBurst  int         // default 5
+	MaxChatLen int         // characters (default 200)
+	ChatFilter chat.Filter // default chat.Nop
+
+	// ResumeGrace keeps a dropped player's seat for this long; they reclaim
+	// it by reconnecting with the token from "resumable". 0 = forfeit at once.
+	ResumeGrace time.Duration
+	// Rooms logs running games so that NewHub can rebuild them after a
+	// crash; players reclaim their seats with their resume tokens, within
+	// ResumeGrace of the restart, or 30s if that is 0 (see recover.go).
+	// Players get resume tokens whenever Rooms is set.
+	Rooms RoomLog
+
+	// Cluster joins this hub to the others sharing the broker (see
+	// cluster.go): room codes are unique across them, and players connected
+	// to different nodes meet on the node that owns their room. Nil = a
+	// single node.
+	Cluster cluster.Broker
+	// Node names this hub in the cluster; it must be stable across restarts
+	// for resume tokens to find their seats, and must not contain ".".
+	// Default random.
+	Node string
+
+	// Auth verifies player tokens; nil disables sign-in and rated games.
+	Auth auth.Verifier
+	// Sides picks who plays X in every pairing path (room codes, auto-match,
+	// rematches). Default match.FirstComeX.
+	Sides match.SidePolicy
+	// Series makes every pairing a best-of-N series unless a room's opener
+	// asks otherwise (Attach.Series). Zero = single games.
+	Series match.SeriesOptions
+
+	// RatingOf looks up a player's rating for rated auto-match; nil rates
+	// everyone the same.
+	RatingOf func(player string) float64
+	// OnGameOver runs once per finished game, rated or not, outside hub locks.
+	OnGameOver func(GameOver)
+	// OnActivity is called whenever open rooms or who is waiting or playing
+	// may have changed (see Activity). It may run under hub locks, so it must
+	// not block or call back into the hub.
+	OnActivity func()
+}
+
+// GameOver reports a finished game with the players' ids, in the Record and
+// its chat too.
+type GameOver struct {
+	Record match.Record
+	X, O   string
+	// XGuest and OGuest report that X or O is a name the player declared,
+	// not a verified id.
+	XGuest, OGuest bool
+}
+
+// Client is a transport's end of one player connection.
+type Client interface {
+	// Send queues a server message (a proto value). It must not block; a
+	// client that cannot keep up should drop itself and report Close back.
+	Send(msg any) error
+	// Close flushes what is queued and ends the connection. Idempotent.
+	Close()
+}
+
+// Session is the hub's handle for one attached client.
+type Session interface {
+	ID() string
+	// Handle processes one inbound frame: a bare digit "0".."8" or a JSON
+	// proto.ClientMsg.
+	Handle(data []byte)
+	// Close is called by the transport when the client goes away. With
+	// Config.ResumeGrace a seated player's game is held for them.
+	Close()
+}
+
+// Attach describes a client joining the hub.
+type Attach struct {
+	Player string // declared player id; "" = use the session id
+	Addr   string // remote host
+	Code   string // 4-digit room code; "" = auto-match
+	Resume string // token from "resumable"; reclaims a held seat
+
+	Authenticated bool   // Player came from a verified token (see Identify)
+	Token         string // that token; a cluster node re-verifies it for players relayed to it
+	Rated         bool   // wants a rated game; needs Authenticated
+
+	Side engine.Mark // side the room's opener asks for (match.HostChooses)
+	// Series the room's opener asks for; zero = Config.Series.
+	Series match.SeriesOptions
+	// Public lists the opener's waiting room in the lobby (see Activity).
+	Public bool
+}
+
+// Hub pairs players from any transport into rooms and runs their games.
+type Hub interface {
+	// Admit reserves a connection slot for player@addr before the transport
+	// commits (e.g. before a websocket upgrade). player is the verified
+	// player id, "" for guests. Undo with Release if Attach never follows.
+	Admit(player, addr string) error
+	Release(addr string)
+	// Reserve books a room code for two named players (see reserve.go).
+	Reserve(r Reservation) (code string, err error)
+	// Attach starts a session for c. On error c has already been sent the
+	// reason and closed.
+	Attach(c Client, a Attach) (Session, error)
+	// Identify verifies a sign-in token and returns its player id.
+	Identify(token string) (string, error)
+	// Activity lists open public rooms and who is waiting or playing.
+	Activity() Activity
+
+	// Snapshot describes live rooms and queued players, for introspection.
+	Snapshot() Snapshot
+	// Ready reports whether new players can be served.
+	Ready(ctx context.Context) error
+	// Drain refuses new connections and new games; games in progress
+	// continue.
+	Drain()
+	// WaitIdle returns once no game is in progress, or with ctx's error.
+	WaitIdle(ctx context.Context) error
+	Close() error
+
+	// Operator controls (see admin.go).
+	Conns() []ConnInfo
+	EndRoom(roomID string, o engine.Outcome) error
+	Kick(connID, reason string) error
+	Ban(b Ban) int
+	Bans() []Ban
+	Broadcast(text string) int
+}
+
+var (
+	ErrDraining     = errors.New("server draining")
+	ErrBanned       = errors.New("banned")
+	ErrTooManyConns = errors.New("too many connections")
+	ErrRejected     = errors.New("connection rejected")
+	ErrNoAuth       = errors.New("sign-in not configured")
+)
+
+type hub struct {
+	cfg    Config
+	eng    engine.Engine
+	mm     match.Matchmaker      // auto-match (no room code)
+	ranked match.SkillMatchmaker // auto-match for rated games, by rating
+
+	mu     sync.Mutex
+	all    map[string]*conn     // conn id => every open conn
+	queued map[string]*conn     // conn id => conn waiting in mm
+	bans   map[string]time.Time // "player:<id>" / "addr:<host>" => expiry
+
+	seq   atomic.Int64
+	rooms map[string]*roomSlot // 4-digit code => room slot
+	live  map[string]*roomSlot // room id => every paired slot, coded or not
+
+	resumable map[string]*conn // resume token => seated conn
+	opening   []*roomLog       // new rooms' logs, for openLogs
+
+	node   *node          // nil unless clustered
+	claims map[string]int // room code => attaches and reservations about to use it
+
+	draining atomic.Bool
+
+	conns   *ratelimit.Counter // remote addr => open connections
+	waiting *ratelimit.Counter // remote addr => parked waiting slots
+}
+
+type roomSlot struct {
+	code    string     // "" for auto-matched rooms
+	waiting *conn      // one waiting player
+	x, o    *conn      // active players once paired
+	room    match.Room // created when second joins
+	rated   bool       // chosen by whoever opened the slot
+	host    *conn      // first to arrive; Pairing.First on rematches too
+
+	public bool                // listed in Activity while waiting
+	opts   match.SeriesOptions // chosen by whoever opened the slot
+	series *match.Series       // nil for single games
+	scored string              // room id of the last game counted in series
+
+	booked *Reservation // set for reserved codes (see reserve.go)
+	noShow *time.Timer
+}
+
+func NewHub(cfg Config, eng engine.Engine) Hub {
+	if cfg.MsgRate == 0 {
+		cfg.MsgRate = 10
+	}
+	if cfg.MsgBurst == 0 {
+		cfg.MsgBurst = 20
+	}
+	if cfg.MaxConnsPerIP == 0 {
+		cfg.MaxConnsPerIP = 16
+	}
+	if cfg.MaxWaitingPerIP == 0 {
+		cfg.MaxWaitingPerIP = 4
+	}
+	if cfg.ChatRate == 0 {
+		cfg.ChatRate = 1
+	}
+	if cfg.ChatBurst == 0 {
+		cfg.ChatBurst = 5
+	}
+	if cfg.MaxChatLen == 0 {
+		cfg.MaxChatLen = 200
+	}
+	if cfg.ChatFilter == nil {
+		cfg.ChatFilter = chat.Nop
+	}
+	if cfg.Sides == nil {
+		cfg.Sides = match.FirstComeX()
+	}
+	h := &hub{
+		cfg:    cfg,
+		eng:    eng,
+		all:    make(map[string]*conn),
+		queued: make(map[string]*conn),
+		bans:   make(map[string]time.Time),
+		rooms:  make(map[string]*roomSlot),
+		live:   make(map[string]*roomSlot),
+
+		resumable: make(map[string]*conn),
+		claims:    make(map[string]int),
+		conns:     ratelimit.NewCounter(cfg.MaxConnsPerIP),
+		waiting:   ratelimit.NewCounter(cfg.MaxWaitingPerIP),
+	}
+	// Ids start at random so that they stay unique across restarts: saved
+	// games and room logs are keyed by room id.
+	var seed [8]byte
+	_, _ = rand.Read(seed[:])
+	h.seq.Store(int64(binary.BigEndian.Uint64(seed[:]) >> 24))
+	h.mm = match.NewMatchmaker(func(ev match.RoomCreatedEvent) { h.onMatched(ev, false) })
+	h.ranked = match.NewSkillMatchmaker(match.SkillOptions{}, func(ev match.RoomCreatedEvent) { h.onMatched(ev, true) })
+	if cfg.Cluster != nil {
+		h.node = h.join()
+	}
+	if cfg.Rooms != nil {
+		h.recover()
+	}
+	return h
+}
+
+func (h *hub) Ready(ctx context.Context) error {
+	if h.draining.Load() {
+		return ErrDraining
+	}
+	if err := h.mm.Ping(ctx); err != nil {
+		return err
+	}
+	return h.ranked.Ping(ctx)
+}
+
+func (h *hub) Drain() { h.draining.Store(true) }
+
+func (h *hub) WaitIdle(ctx context.Context) error {
+	tick := time.NewTicker(100 * time.Millisecond)
+	defer tick.Stop()
+	for h.playing() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+	}
+	return nil
+}
+
+// playing counts the games in progress.
+func (h *hub) playing() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for _, slot := range h.live {
+		if slot.room.State().Status == engine.InProgress {
+			n++
+		}
+	}
+	return n
+}
+
+func (h *hub) Close() error {
+	h.Drain()
+	if h.node != nil {
+		h.node.stop()
+	}
+	return errors.Join(h.mm.Close(), h.ranked.Close())
+}
+
+func (h *hub) Admit(player, addr string) error {
+	if h.draining.Load() {
+		return ErrDraining
+	}
+	if h.banned(player, addr) {
+		return ErrBanned
+	}
+	if !h.conns.Acquire(addr) {
+		return ErrTooManyConns
+	}
+	return nil
+}
+
+func (h *hub) Release(addr string) { h.conns.Release(addr) }
+
+func (h *hub) Identify(token string) (string, error) {
+	if h.cfg.Auth == nil {
+		return "", ErrNoAuth
+	}
+	return h.cfg.Auth.Verify(token)
+}
+
+func (h *hub) Attach(cl Client, a Attach) (Session, error) {
+	if h.node != nil {
+		return h.node.route(cl, a)
+	}
+	return h.attach(cl, a)
+}
+
+// attach seats cl on this node.
+func (h *hub) attach(cl Client, a Attach) (Session, error) {
+	if a.Resume != "" {
+		return h.resume(cl, a)
+	}
+	c := &conn{
+		id:     "p" + itoa64(h.seq.Add(1)),
+		player: a.Player,
+		addr:   a.Addr,
+		code:   a.Code,
+		since:  time.Now(),
+		hub:    h,
+		cl:     cl,
+		bucket: ratelimit.NewBucket(h.cfg.MsgRate, h.cfg.MsgBurst, nil),
+		chat:   ratelimit.NewBucket(h.cfg.ChatRate, h.cfg.ChatBurst, nil),
+		authed: a.Authenticated,
+		rated:  a.Rated,
+		side:   a.Side,
+		series: a.Series,
+		public: a.Public,
+	}
+	if c.series == (match.SeriesOptions{}) {
+		c.series = h.cfg.Series
+	}
+	if c.player == "" {
+		c.player = c.id
+	}
+	c.version = proto.Version1
+	c.feats.Store(uint32(legacyFeatures))
+
+	h.mu.Lock()
+	if c.rated && !c.authed {
+		c.reject(errAuthRequired)
+		h.mu.Unlock()
+		return nil, ErrRejected
+	}
+	if !validSeries(c.series) {
+		c.reject(errBadSeries)
+		h.mu.Unlock()
+		return nil, ErrRejected
+	}
+	h.all[c.id] = c
+	h.mu.Unlock()
+
+	// Room code (if empty -> auto-match)
+	if c.code != "" {
+		if !h.pairInRoom(c, c.code) {
+			return nil, ErrRejected
+		}
+	} else if !h.pairLegacy(c) {
+		return nil, ErrRejected
+	}
+	return &attachment{c: c, cl: cl}, nil
+}
+
+// ValidCode reports whether s is a room code (4 digits).
+func ValidCode(s string) bool {
+	if len(s) != 4 {
+		return false
+	}
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// pairInRoom returns false if c2 was turned away (and already closed).
+func (h *hub) pairInRoom(c2 *conn, code string) bool {
+	h.mu.Lock()
+	defer h.openLogs() // the lock is gone by then
+	defer h.mu.Unlock()
+
+	slot := h.rooms[code]
+	if slot != nil && slot.booked != nil {
+		return h.seatBooked(slot, c2)
+	}
+	if slot == nil {
+		slot = &roomSlot{code: code}
+		h.rooms[code] = slot
+	}
+
+	// If already 2 players active -> reject (room full)
+	if slot.x != nil && slot.o != nil {
+		c2.reject(proto.Error{Type: "error", Code: "ROOM_FULL"})
+		return false
+	}
+
+	// If no one waiting, park this conn; it decides whether the room is rated
+	if slot.waiting == nil && slot.x == nil && slot.o == nil {
+		slot.rated, slot.opts, slot.public = c2.rated, c2.series, c2.public
+		return h.park(slot, code, c2)
+	}
+	if slot.rated && !c2.authed {
+		c2.reject(errAuthRequired)
+		return false
+	}
+
+	// Someone waiting -> pair now
+	var c1 *conn
+	if slot.waiting != nil {
+		c1 = slot.waiting
+		slot.waiting = nil
+		h.unpark(c1)
+	} else {
+		// corrupt state: unexpected, but fallback to wait
+		return h.park(slot, code, c2)
+	}
+
+	// Create a fresh match.Room for this code
+	h.startRoom("room-"+code+"-"+itoa64(h.seq.Add(1)), slot, c1, c2, "")
+	return true
+}
+
+// startRoom creates the match.Room for a pair and sends assigned + start.
+// first arrived before second; on a rematch prevX is the last game's X.
+// Caller holds h.mu; openLogs after.
+func (h *hub) startRoom(roomID string, slot *roomSlot, first, second *conn, prevX string) {
+	c1, c2 := first, second
+	if slot.series == nil && slot.opts.BestOf > 1 {
+		slot.series = match.NewSeries(slot.opts.BestOf)
+	}
+	switch {
+	case slot.series != nil && slot.series.Games > 0:
+		// mid-series: the caller already swapped sides
+	case slot.booked != nil && !slot.booked.Open:
+		if first.player != slot.booked.X {
+			c1, c2 = second, first
+		}
+	case !h.cfg.Sides.FirstIsX(match.Pairing{First: first.asPlayer(), Second: second.asPlayer(), PrevX: prevX}):
+		c1, c2 = second, first
+	}
+	rm := match.NewRoom(roomID, h.eng, match.Options{
+		GracePeriod:    h.cfg.ResumeGrace,
+		OnGraceExpired: h.graceExpired,
+		OnFinish:       h.gameOver(slot, c1, c2),
+		Rated:          slot.rated,
+		TimeControl:    slot.clock(),
+		OnFlag:         h.timeUp,
+		Log:            h.openLog(roomID, slot),
+	})
+	if slot.room != nil {
+		delete(h.live, slot.room.ID()) // code reused after a finished game
+	}
+
+	c1.mark, c2.mark = engine.X, engine.O
+	c1.peer, c2.peer = c2, c1
+	c1.room, c2.room = rm, rm
+	c1.slot, c2.slot = slot, slot
+	slot.x, slot.o, slot.room, slot.host = c1, c2, rm, first
+	h.live[roomID] = slot
+
+	for _, c := range []*conn{c1, c2} {
+		p := match.Player{ID: c.id, Mark: c.mark, Name: c.player, Verified: c.authed}
+		if h.tokens() {
+			p.Key = h.resumeToken(c)
+		}
+		_ = rm.Join(context.Background(), p)
+	}
+
+	if s := slot.series; s != nil && s.Games == 0 {
+		sendSeries(s, c1, c2.id)
+		sendSeries(s, c2, c1.id)
+	}
+	// Assigned + start
+	_ = c1.send(proto.Assigned{Type: "assigned", You: c1.mark})
+	_ = c2.send(proto.Assigned{Type: "assigned", You: c2.mark})
+
+	st := rm.State()
+	_ = c1.send(proto.Start{Type: "start", Board: boardToStrings(st.Board), YourTurn: st.NextTurn == c1.mark})
+	_ = c2.send(proto.Start{Type: "start", Board: boardToStrings(st.Board), YourTurn: st.NextTurn == c2.mark})
+	sendClock(rm, c1, c2)
+
+	if h.tokens() {
+		h.offerResume(c1)
+		h.offerResume(c2)
+	}
+	h.changed()
+}
+
+// park holds c as the waiting player of slot, within the per-address cap.
+// Caller holds h.mu.
+func (h *hub) park(slot *roomSlot, code string, c *conn) bool {
+	if !h.waiting.Acquire(c.addr) {
+		if slot.waiting == nil && slot.x == nil && slot.o == nil {
+			h.dropCode(code)
+		}
+		c.reject(proto.Error{Type: "error", Code: "RATE_LIMITED", Detail: "too many open rooms", RetryAfterMs: 5000})
+		return false
+	}
+	c.parked = true
+	slot.waiting = c
+	h.changed()
+	return true
+}
+
+// Caller holds h.mu.
+func (h *hub) unpark(c *conn) {
+	if c.parked {
+		c.parked = false
+		h.waiting.Release(c.addr)
+	}
+}
+
+// pairLegacy queues c for auto-match; false if c was turned away.
+func (h *hub) pairLegacy(c *conn) bool {
+	h.mu.Lock()
+	h.queued[c.id] = c
+	c.queued = time.Now()
+	h.changed()
+	h.mu.Unlock()
+
+	if c.rated {
+		h.announceSearch(c)
+	}
+	if err := h.pool(c).Enqueue(context.Background(), h.entry(c)); err != nil {
+		h.mu.Lock()
+		delete(h.queued, c.id)
+		c.reject(proto.Error{Type: "error", Code: "UNAVAILABLE", Detail: err.Error()})
+		h.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+// pool is the auto-match queue for c: rated players only meet each other.
+func (h *hub) pool(c *conn) match.Matchmaker {
+	if c.rated {
+		return h.ranked
+	}
+	return h.mm
+}
+
+// entry is c's place in its auto-match queue.
+func (h *hub) entry(c *conn) match.Player {
+	p := match.Player{ID: c.id}
+	if c.rated {
+		p.Name = c.player
+		if h.cfg.RatingOf != nil {
+			p.Rating = h.cfg.RatingOf(c.player)
+		}
+	}
+	return p
+}
+
+// announceSearch tells a rated player their rating and expected wait.
+func (h *hub) announceSearch(c *conn) {
+	rating := h.entry(c).Rating
+	msg := proto.Queued{Type: "queued", Rating: int(math.Round(rating))}
+	if d, ok := h.ranked.ExpectedWait(rating); ok {
+		msg.WaitMs = int(d.Milliseconds())
+	}
+	_ = c.send(msg)
+}
+
+// requeue puts c back in its auto-match queue, keeping the wait it had.
+func (h *hub) requeue(c *conn, since time.Time) {
+	if !c.rated {
+		_ = h.mm.Enqueue(context.Background(), h.entry(c))
+		return
+	}
+	_ = h.ranked.Requeue(context.Background(), h.entry(c), since)
+	// c may have gone while it was out of the queue.
+	h.mu.Lock()
+	if h.queued[c.id] != c {
+		h.ranked.Remove(c.id)
+	}
+	h.mu.Unlock()
+}
+
+// onMatched runs on a matchmaker loop. A player who left while queued is
+// dropped and the survivor goes back in the queue.
+func (h *hub) onMatched(ev match.RoomCreatedEvent, rated bool) {
+	h.mu.Lock()
+	defer h.openLogs() // the lock is gone by then
+	defer h.mu.Unlock()
+
+	c1, c2 := h.queued[ev.X.ID], h.queued[ev.O.ID]
+	delete(h.queued, ev.X.ID)
+	delete(h.queued, ev.O.ID)
+	if c1 == nil || c2 == nil {
+		for _, c := range []*conn{c1, c2} {
+			if c != nil {
+				h.queued[c.id] = c
+				go h.requeue(c, c.queued)
+			}
+		}
+		return
+	}
+	// The queues number rooms from 1 on every start, so ids come from the hub.
+	roomID := "room-" + itoa64(h.seq.Add(1))
+	if rated {
+		roomID = "rated-" + itoa64(h.seq.Add(1))
+	}
+	h.startRoom(roomID, &roomSlot{rated: rated, opts: h.cfg.Series}, c1, c2, "")
+}
+
+var errAuthRequired = proto.Error{Type: "error", Code: "AUTH_REQUIRED", Detail: "rated games need a signed-in player"}
+
+// gameOver builds a room's OnFinish hook, translating connection ids back
+// to player ids.
+func (h *hub) gameOver(slot *roomSlot, x, o *conn) func(match.Record) {
+	g := GameOver{X: x.player, O: o.player, XGuest: !x.authed, OGuest: !o.authed}
+	ids := map[string]string{x.id: x.player, o.id: o.player}
+	return func(rec match.Record) {
+		rec.X, rec.O = ids[rec.X], ids[rec.O]
+		for i := range rec.Chat {
+			rec.Chat[i].PlayerID = ids[rec.Chat[i].PlayerID]
+		}
+		g := g
+		g.Record = rec
+		h.report(slot, g)
+		h.dropLog(rec.RoomID)
+	}
+}
+
+func (h *hub) report(slot *roomSlot, g GameOver) {
+	h.changed()
+	if h.cfg.OnGameOver != nil {
+		h.cfg.OnGameOver(g)
+	}
+	if b := slot.booked; b != nil && b.OnDone != nil {
+		b.OnDone(g)
+	}
+}
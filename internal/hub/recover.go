@@ -0,0 +1,291 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ratelimit"
+)
+
+// RoomLog keeps running games across restarts (see Config.Rooms).
+type RoomLog interface {
+	match.Log
+	// Load returns the events of every room not yet dropped.
+	Load() (map[string][]match.Event, error)
+	// Drop forgets a room's events. The hub drops a finished room once
+	// OnGameOver has returned, so a game that ended just before a crash is
+	// still there to be saved.
+	Drop(roomID string) error
+}
+
+// restartGrace is how long players of a rebuilt game have to come back
+// when Config.ResumeGrace is 0: nobody stays connected through a restart.
+const restartGrace = 30 * time.Second
+
+// tokens reports whether players get resume tokens: to reclaim a dropped
+// seat, or a game rebuilt after a crash.
+func (h *hub) tokens() bool { return h.cfg.ResumeGrace > 0 || h.cfg.Rooms != nil }
+
+// openLog starts roomID's log with what the hub needs to rebuild the slot;
+// nil (no logging) if there is no log. The room's first events wait in
+// h.opening until openLogs writes them, so that pairing does no disk I/O
+// under h.mu. Caller holds h.mu.
+func (h *hub) openLog(roomID string, slot *roomSlot) match.Log {
+	if h.cfg.Rooms == nil {
+		return nil
+	}
+	l := &roomLog{rooms: h.cfg.Rooms, id: roomID, held: []match.Event{{Kind: match.EventOpen, At: time.Now(), Code: slot.code, Rated: slot.rated, Clock: slot.clock().String()}}}
+	h.opening = append(h.opening, l)
+	return l
+}
+
+// openLogs writes the logs of the rooms started since the last call. Call
+// without h.mu.
+func (h *hub) openLogs() {
+	h.mu.Lock()
+	opening := h.opening
+	h.opening = nil
+	h.mu.Unlock()
+	for _, l := range opening {
+		l.write()
+	}
+}
+
+// dropLog forgets a room's log. Call without h.mu.
+func (h *hub) dropLog(roomID string) {
+	if h.cfg.Rooms == nil {
+		return
+	}
+	if err := h.cfg.Rooms.Drop(roomID); err != nil {
+		log.Printf("dropping the log of room %s: %v", roomID, err)
+	}
+}
+
+// roomLog is one new room's log. It holds the events logged before
+// openLogs gets to it; a crash before then loses the room as if it had
+// never started.
+type roomLog struct {
+	rooms RoomLog
+	id    string
+
+	mu   sync.Mutex
+	held []match.Event // nil once written
+	off  bool          // writing failed: the room goes unlogged
+}
+
+func (l *roomLog) Append(roomID string, e match.Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case l.off:
+		return nil
+	case l.held != nil:
+		l.held = append(l.held, e)
+		return nil
+	}
+	return l.rooms.Append(roomID, e)
+}
+
+func (l *roomLog) write() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	held := l.held
+	l.held = nil
+	if held[len(held)-1].Outcome != engine.InProgress {
+		l.off = true // over already: nothing to rebuild
+		return
+	}
+	for _, e := range held {
+		if err := l.rooms.Append(l.id, e); err != nil {
+			log.Printf("room %s will not survive a restart: %v", l.id, err)
+			l.off = true
+			return
+		}
+	}
+}
+
+// recover rebuilds the games Config.Rooms holds. Their players are away
+// until they resume with their old tokens; a series carries on as a single
+// game.
+func (h *hub) recover() {
+	rooms, err := h.cfg.Rooms.Load()
+	if err != nil {
+		log.Printf("recovering rooms: %v", err)
+		return
+	}
+	// A coded room comes back only if its code is still this node's: in a
+	// cluster another node may have handed it out meanwhile.
+	codes := make(map[string]error) // code => why it is not ours; nil if it is
+	h.mu.Lock()
+	for _, events := range rooms {
+		if code := openedCode(events); code != "" {
+			if _, ok := codes[code]; !ok {
+				codes[code] = nil
+				h.claims[code]++
+			}
+		}
+	}
+	h.mu.Unlock()
+	for code := range codes {
+		if mine, err := h.claimCode(code); err != nil {
+			codes[code] = fmt.Errorf("%w: %v", errNoClaim, err)
+		} else if !mine {
+			codes[code] = errCodeTaken
+		}
+	}
+
+	var (
+		over    []func()
+		skipped []string
+	)
+	h.mu.Lock()
+	for id, events := range rooms {
+		done, err := h.restore(id, events, codes)
+		switch {
+		case errors.Is(err, errNoClaim):
+			log.Printf("recovering room %s: %v; keeping its log", id, err) // the broker may answer next time
+		case err != nil:
+			log.Printf("recovering room %s: %v", id, err)
+			skipped = append(skipped, id)
+		case done != nil:
+			over = append(over, done)
+		}
+	}
+	for code := range codes {
+		h.unholdCode(code) // frees the codes no recovered room took
+	}
+	h.mu.Unlock()
+	h.flushCodes()
+	for _, done := range over {
+		done() // a game that ended before it was saved; saving drops its log
+	}
+	for _, id := range skipped {
+		h.dropLog(id)
+	}
+}
+
+// restore rebuilds a running room, or returns the report of one that had
+// finished; a running coded room needs its code claimed (see recover).
+// Caller holds h.mu.
+func (h *hub) restore(roomID string, events []match.Event, codes map[string]error) (func(), error) {
+	if len(events) == 0 || events[0].Kind != match.EventOpen {
+		return nil, errNoOpen
+	}
+	open := events[0]
+	slot := &roomSlot{code: open.Code, rated: open.Rated}
+	seats := map[engine.Mark]*conn{}
+	for _, e := range events {
+		if e.Kind != match.EventJoin {
+			continue
+		}
+		seats[e.Mark] = &conn{
+			id:      e.Player,
+			player:  e.Name,
+			code:    open.Code,
+			since:   e.At,
+			hub:     h,
+			bucket:  ratelimit.NewBucket(h.cfg.MsgRate, h.cfg.MsgBurst, nil),
+			chat:    ratelimit.NewBucket(h.cfg.ChatRate, h.cfg.ChatBurst, nil),
+			authed:  e.Verified,
+			rated:   open.Rated,
+			mark:    e.Mark,
+			token:   e.Key,
+			version: proto.Version1,
+		}
+	}
+	x, o := seats[engine.X], seats[engine.O]
+	if x == nil || o == nil {
+		return nil, errNoSeats
+	}
+
+	var tc match.TimeControl
+	if open.Clock != "" {
+		var err error
+		if tc, err = match.ParseTimeControl(open.Clock); err != nil {
+			return nil, err
+		}
+	}
+	grace := h.cfg.ResumeGrace
+	if grace == 0 {
+		grace = restartGrace
+	}
+	rm, err := match.Restore(roomID, h.eng, match.Options{
+		GracePeriod:    grace,
+		OnGraceExpired: h.graceExpired,
+		OnFinish:       h.gameOver(slot, x, o),
+		Rated:          slot.rated,
+		TimeControl:    tc,
+		OnFlag:         h.timeUp,
+		Log:            h.cfg.Rooms,
+	}, events)
+	if err != nil {
+		return nil, err
+	}
+	if rm.State().Status != engine.InProgress {
+		rec, report := rm.Record(), h.gameOver(slot, x, o)
+		return func() { report(rec) }, nil
+	}
+	if x.token == "" || o.token == "" {
+		return nil, errNoSeats
+	}
+	if slot.code != "" {
+		if err := codes[slot.code]; err != nil {
+			return nil, err
+		}
+		if h.rooms[slot.code] != nil {
+			return nil, errCodeTaken
+		}
+	}
+
+	for _, c := range []*conn{x, o} {
+		c.msgSeq.Store(lastAutoMsgID(c, events))
+		c.feats.Store(uint32(legacyFeatures))
+		c.room, c.slot = rm, slot
+		h.all[c.id] = c
+		h.resumable[c.token] = c
+	}
+	x.peer, o.peer = o, x
+	slot.x, slot.o, slot.room, slot.host = x, o, rm, x
+	h.live[roomID] = slot
+	if slot.code != "" {
+		h.rooms[slot.code] = slot
+	}
+	return nil, nil
+}
+
+// openedCode is the room code a log was opened with.
+func openedCode(events []match.Event) string {
+	if len(events) == 0 || events[0].Kind != match.EventOpen {
+		return ""
+	}
+	return events[0].Code
+}
+
+// lastAutoMsgID is the highest autoMsgID number c's logged moves used, so
+// that new ones do not replay as duplicates.
+func lastAutoMsgID(c *conn, events []match.Event) int64 {
+	var last int64
+	for _, e := range events {
+		if rest, ok := strings.CutPrefix(e.MsgID, c.id+"-"); ok && e.Kind == match.EventMove {
+			if n, err := strconv.ParseInt(rest, 10, 64); err == nil {
+				last = max(last, n)
+			}
+		}
+	}
+	return last
+}
+
+var (
+	errNoOpen    = errors.New("log does not start with open")
+	errNoSeats   = errors.New("log lacks two resumable seats")
+	errCodeTaken = errors.New("room code already in use")
+	errNoClaim   = errors.New("room code could not be claimed")
+)
@@ -0,0 +1,146 @@
+package hub
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+)
+
+var ErrNoCodes = errors.New("no free room codes")
+
+// Reservation books a room code for two named players, for games arranged
+// elsewhere (e.g. tournaments). Only X and O may take the seats, and only
+// with a verified identity when Config.Auth is set.
+type Reservation struct {
+	X, O   string        // player ids
+	Open   bool          // X and O only name the players; Config.Sides picks who plays X
+	NoShow time.Duration // a player not seated by then forfeits (default 2m)
+	Rated  bool
+	Series match.SeriesOptions
+	Clock  match.TimeControl // each game of it; untimed if zero
+
+	// OnDone runs once, outside hub locks, when the game ends. A no-show
+	// ends it with Reason match.ReasonNoShow: the player present wins, or a
+	// Draw if neither came.
+	OnDone func(GameOver)
+}
+
+// Reserve books a fresh room code for r and returns it.
+func (h *hub) Reserve(r Reservation) (string, error) {
+	if h.draining.Load() {
+		return "", ErrDraining
+	}
+	if r.X == "" || r.O == "" || r.X == r.O {
+		return "", errors.New("reservation needs two different players")
+	}
+	if !validSeries(r.Series) {
+		return "", errors.New(errBadSeries.Detail)
+	}
+	if r.NoShow <= 0 {
+		r.NoShow = 2 * time.Minute
+	}
+	// In a cluster a code free here may be taken on another node; try others.
+	for i := 0; i < 100; i++ {
+		h.mu.Lock()
+		code, ok := h.freeCode()
+		if ok {
+			h.claims[code]++
+		}
+		h.mu.Unlock()
+		if !ok {
+			return "", ErrNoCodes
+		}
+		mine, err := h.claimCode(code)
+
+		h.mu.Lock()
+		booked := err == nil && mine && h.rooms[code] == nil
+		if booked {
+			slot := &roomSlot{code: code, rated: r.Rated, opts: r.Series, booked: &r}
+			h.rooms[code] = slot
+			slot.noShow = time.AfterFunc(r.NoShow, func() { h.noShow(slot) })
+		}
+		h.unholdCode(code)
+		h.mu.Unlock()
+		h.flushCodes()
+		if err != nil {
+			return "", err
+		}
+		if booked {
+			return code, nil
+		}
+	}
+	return "", ErrNoCodes
+}
+
+// freeCode picks an unused room code at random. Caller holds h.mu.
+func (h *hub) freeCode() (string, bool) {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	start := int(binary.BigEndian.Uint32(b[:]) % 10000)
+	for i := 0; i < 10000; i++ {
+		code := fmt.Sprintf("%04d", (start+i)%10000)
+		if h.rooms[code] == nil {
+			return code, true
+		}
+	}
+	return "", false
+}
+
+// seatBooked admits c to a reserved slot if it is one of the two players.
+// Caller holds h.mu.
+func (h *hub) seatBooked(slot *roomSlot, c *conn) bool {
+	b := slot.booked
+	switch {
+	case c.player != b.X && c.player != b.O, h.cfg.Auth != nil && !c.authed:
+		c.reject(proto.Error{Type: "error", Code: "ROOM_RESERVED", Detail: "this room is booked for other players"})
+		return false
+	case slot.room != nil || slot.x != nil:
+		c.reject(proto.Error{Type: "error", Code: "ROOM_FULL"})
+		return false
+	case slot.waiting == nil:
+		return h.park(slot, slot.code, c)
+	case slot.waiting.player == c.player:
+		c.reject(proto.Error{Type: "error", Code: "ALREADY_SEATED"})
+		return false
+	}
+	slot.noShow.Stop()
+	first := slot.waiting
+	slot.waiting = nil
+	h.unpark(first)
+	h.startRoom("room-"+slot.code+"-"+itoa64(h.seq.Add(1)), slot, first, c, "")
+	return true
+}
+
+// noShow ends a reservation whose players did not both arrive in time.
+func (h *hub) noShow(slot *roomSlot) {
+	h.mu.Lock()
+	if slot.room != nil || h.rooms[slot.code] != slot {
+		h.mu.Unlock()
+		return
+	}
+	h.dropCode(slot.code)
+	present := slot.waiting
+	h.mu.Unlock()
+	h.flushCodes()
+
+	b := slot.booked
+	now := time.Now()
+	rec := match.Record{RoomID: "room-" + slot.code + "-noshow-" + itoa64(h.seq.Add(1)), X: b.X, O: b.O, Outcome: engine.Draw, Reason: match.ReasonNoShow, Rated: b.Rated, Started: now, Ended: now}
+	if present != nil {
+		rec.Outcome = engine.XWins
+		if present.player == b.O {
+			rec.Outcome = engine.OWins
+		}
+		_ = present.send(proto.System{Type: "system", Text: "your opponent did not show up"})
+		_ = present.send(proto.Result{Type: "result", Status: outcomeText(rec.Outcome)})
+		present.Close()
+	}
+	guests := h.cfg.Auth == nil // else only verified players are seated
+	h.report(slot, GameOver{Record: rec, X: b.X, O: b.O, XGuest: guests, OGuest: guests})
+}
@@ -0,0 +1,154 @@
+package hub
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+)
+
+var errAway = errors.New("player away")
+
+// attachment is the Session handed to a transport. It is bound to the
+// Client it was attached with, so a transport whose client has since been
+// replaced by a resume can no longer act on the seat.
+type attachment struct {
+	c  *conn
+	cl Client
+}
+
+func (a *attachment) ID() string { return a.c.id }
+
+func (a *attachment) Handle(data []byte) {
+	if a.c.client() == a.cl {
+		a.c.Handle(data)
+	}
+}
+
+func (a *attachment) Close() { a.c.drop(a.cl) }
+
+func (c *conn) client() Client {
+	c.clMu.Lock()
+	defer c.clMu.Unlock()
+	return c.cl
+}
+
+func (c *conn) swapClient(cl Client) Client {
+	c.clMu.Lock()
+	defer c.clMu.Unlock()
+	old := c.cl
+	c.cl = cl
+	return old
+}
+
+// replaceClient swaps old for cl only if old is still current.
+func (c *conn) replaceClient(old, cl Client) bool {
+	c.clMu.Lock()
+	defer c.clMu.Unlock()
+	if c.cl != old {
+		return false
+	}
+	c.cl = cl
+	return true
+}
+
+// drop handles a transport losing cl. A player in a running game keeps the
+// seat for Config.ResumeGrace; otherwise this is a normal Close.
+func (c *conn) drop(cl Client) {
+	h := c.hub
+	h.mu.Lock()
+	rm, peer, addr := c.room, c.peer, c.addr
+	hold := h.cfg.ResumeGrace > 0 && rm != nil && peer != nil && !peer.closed.Load() &&
+		rm.State().Status == engine.InProgress
+	h.mu.Unlock()
+
+	if !hold {
+		if c.client() == cl {
+			c.Close()
+		}
+		return
+	}
+	if c.closed.Load() || !c.replaceClient(cl, nil) {
+		return // stale transport, or already gone
+	}
+	h.conns.Release(addr)
+	cl.Close()
+
+	_ = rm.Leave(context.Background(), c.id) // starts the room's grace timer
+	_ = peer.send(proto.Opponent{Type: "opponent", Status: "away", GraceMs: int(h.cfg.ResumeGrace.Milliseconds())})
+}
+
+// graceExpired finishes off a player who did not come back in time.
+func (h *hub) graceExpired(playerID string) {
+	h.mu.Lock()
+	c := h.all[playerID]
+	h.mu.Unlock()
+	if c != nil && c.client() == nil && !h.holdSeat(c) {
+		c.Close()
+	}
+}
+
+// offerResume hands c its resume token. Caller holds h.mu.
+func (h *hub) offerResume(c *conn) {
+	_ = c.send(proto.Resumable{Type: "resumable", Token: h.resumeToken(c), GraceMs: int(h.cfg.ResumeGrace.Milliseconds())})
+}
+
+// resumeToken returns c's resume token, minting it on first use. Caller
+// holds h.mu.
+func (h *hub) resumeToken(c *conn) string {
+	if c.token == "" {
+		c.token = newToken()
+		if h.node != nil {
+			c.token = h.node.name + "." + c.token // routes a resume to this node
+		}
+		h.resumable[c.token] = c
+	}
+	return c.token
+}
+
+// resume puts cl in the seat held for a.Resume and replays where the game is.
+func (h *hub) resume(cl Client, a Attach) (Session, error) {
+	h.mu.Lock()
+	c := h.resumable[a.Resume]
+	if c == nil || c.closed.Load() || !c.replaceClient(nil, cl) {
+		h.mu.Unlock()
+		_ = cl.Send(proto.Error{Type: "error", Code: "RESUME_FAILED", Detail: "no seat held for this token"})
+		cl.Close()
+		h.conns.Release(a.Addr)
+		return nil, ErrRejected
+	}
+	c.addr = a.Addr
+	rm, peer, mark, slot := c.room, c.peer, c.mark, c.slot
+	h.mu.Unlock()
+
+	_ = rm.Join(context.Background(), match.Player{ID: c.id, Mark: mark}) // cancels the forfeit
+	st := rm.State()
+	_ = c.send(proto.Assigned{Type: "assigned", You: mark})
+	_ = c.send(proto.Start{Type: "start", Board: boardToStrings(st.Board), YourTurn: st.NextTurn == mark})
+	if st.ServerSeq > 0 {
+		_ = c.sendState(st)
+	}
+	sendClock(rm, c)
+	_ = c.send(proto.Resumable{Type: "resumable", Token: a.Resume, GraceMs: int(h.cfg.ResumeGrace.Milliseconds())})
+	h.mu.Lock()
+	if slot.series != nil && peer != nil {
+		sendSeries(slot.series, c, peer.id)
+	}
+	h.mu.Unlock()
+	if st.Status != engine.InProgress {
+		_ = c.send(proto.Result{Type: "result", Status: outcomeText(st.Status)})
+	} else if peer != nil {
+		_ = peer.send(proto.Opponent{Type: "opponent", Status: "back"})
+	}
+	return &attachment{c: c, cl: cl}, nil
+}
+
+func newToken() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
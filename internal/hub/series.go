@@ -0,0 +1,130 @@
+package hub
+
+import (
+	"context"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+)
+
+// MaxBestOf caps the length of a series.
+const MaxBestOf = 15
+
+var errBadSeries = proto.Error{Type: "error", Code: "INVALID", Detail: "bestOf must be odd, 1..15, and forfeit \"game\" or \"series\""}
+
+// ValidBestOf reports whether a series may be n games long: an odd number
+// up to MaxBestOf, so that someone always wins it. 0 means not asked.
+func ValidBestOf(n int) bool {
+	return n == 0 || n >= 1 && n <= MaxBestOf && n%2 == 1
+}
+
+func validSeries(o match.SeriesOptions) bool {
+	return ValidBestOf(o.BestOf) &&
+		(o.Forfeit == "" || o.Forfeit == match.ForfeitGame || o.Forfeit == match.ForfeitSeries)
+}
+
+// seriesNext scores rm's finished game in its slot's series, tells both
+// players the score and starts the next game with sides swapped, unless the
+// series is over. gone has left for good and concedes the rest. Call once
+// the game's "result" has been sent.
+func (h *hub) seriesNext(rm match.Room, gone *conn) {
+	h.mu.Lock()
+	defer h.openLogs() // the lock is gone by then
+	defer h.mu.Unlock()
+
+	slot := h.live[rm.ID()]
+	if slot == nil || slot.series == nil || slot.room != rm {
+		return
+	}
+	rec := rm.Record()
+	if rec.Outcome == engine.InProgress {
+		return
+	}
+	s := slot.series
+	if slot.scored != rm.ID() {
+		slot.scored = rm.ID()
+		s.Record(rec.X, rec.O, rec.Outcome)
+	} else if _, over := s.Over(); over || gone == nil {
+		return // already reported
+	}
+	if _, over := s.Over(); !over && gone != nil {
+		winner := rec.X
+		if gone.id == rec.X {
+			winner = rec.O
+		}
+		s.Concede(winner)
+	}
+
+	x, o := h.all[rec.X], h.all[rec.O]
+	sendSeries(s, x, rec.O)
+	sendSeries(s, o, rec.X)
+	if _, over := s.Over(); over || x == nil || o == nil {
+		return
+	}
+
+	h.startRoom(rematchID(slot)+itoa64(h.seq.Add(1)), slot, o, x, rec.X)
+	// A player still away in a ForfeitGame series gets a fresh grace period.
+	for _, c := range []*conn{x, o} {
+		if c.client() == nil {
+			_ = slot.room.Leave(context.Background(), c.id)
+			_ = c.peer.send(proto.Opponent{Type: "opponent", Status: "away", GraceMs: int(h.cfg.ResumeGrace.Milliseconds())})
+		}
+	}
+}
+
+// holdSeat keeps an away player whose grace ran out in a ForfeitGame series:
+// they lose the game, and the next one starts without them. False means the
+// player is gone (their series is over or not held).
+func (h *hub) holdSeat(c *conn) bool {
+	h.mu.Lock()
+	rm, peer, slot := c.room, c.peer, c.slot
+	if slot == nil || slot.series == nil || slot.opts.Forfeit != match.ForfeitGame ||
+		rm == nil || peer == nil || peer.closed.Load() {
+		h.mu.Unlock()
+		return false
+	}
+	rec := rm.Record()
+	if rec.Outcome == engine.InProgress {
+		h.mu.Unlock()
+		return true // a timer from an earlier game; the current one has its own
+	}
+	s := slot.series.Copy()
+	s.Record(rec.X, rec.O, rec.Outcome)
+	_, over := s.Over()
+	h.mu.Unlock()
+	if over {
+		return false
+	}
+
+	_ = peer.send(proto.Result{Type: "result", Status: outcomeText(rec.Outcome)})
+	h.seriesNext(rm, nil)
+	return true
+}
+
+// sendSeries tells c the score against opponent; c may be nil.
+func sendSeries(s *match.Series, c *conn, opponent string) {
+	if c == nil {
+		return
+	}
+	msg := proto.Series{
+		Type:     "series",
+		BestOf:   s.BestOf,
+		Game:     s.Games,
+		You:      s.Wins(c.id),
+		Opponent: s.Wins(opponent),
+		Draws:    s.Draws,
+	}
+	if winner, over := s.Over(); over {
+		msg.Over = true
+		switch winner {
+		case "":
+			msg.Outcome = "drawn"
+		case c.id:
+			msg.Outcome = "won"
+		default:
+			msg.Outcome = "lost"
+		}
+	}
+	_ = c.send(msg)
+}
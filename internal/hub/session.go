@@ -0,0 +1,402 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ratelimit"
+)
+
+// conn is the hub's state for one attached client; it implements Session.
+type conn struct {
+	id     string
+	player string // declared player id, defaults to id
+	addr   string // remote host, for per-address limits
+	since  time.Time
+	code   string // room code, "" for auto-match
+	hub    *hub
+	clMu   sync.Mutex
+	cl     Client // nil while away (dropped, seat held for resume)
+	bucket *ratelimit.Bucket
+	chat   *ratelimit.Bucket
+	muted  atomic.Bool // stop relaying the opponent's chat to this conn
+	closed atomic.Bool
+	feats  atomic.Uint32 // negotiated features, see hello.go
+	authed bool          // player id was verified from a token
+	rated  bool          // asked for a rated game
+	side   engine.Mark   // asked for, as a room's opener
+	series match.SeriesOptions
+	public bool // list the room in the lobby while waiting
+
+	// guarded by hub.mu; set once paired
+	mark   engine.Mark
+	peer   *conn
+	room   match.Room
+	slot   *roomSlot
+	parked bool      // holds a waiting slot
+	queued time.Time // when it joined the auto-match queue
+	encore bool      // asked for a rematch of the finished game
+
+	// guarded by hub.mu; set by "hello"
+	version    int
+	clientName string
+
+	token string // resume token, guarded by hub.mu
+
+	msgSeq atomic.Int64 // for auto MsgIDs
+}
+
+func (c *conn) ID() string { return c.id }
+
+func (c *conn) asPlayer() match.Player {
+	return match.Player{ID: c.id, Name: c.player, Side: c.side, Verified: c.authed}
+}
+
+func (c *conn) session() (match.Room, *conn, engine.Mark) {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	return c.room, c.peer, c.mark
+}
+
+func (c *conn) send(v any) error {
+	cl := c.client()
+	if cl == nil {
+		return errAway
+	}
+	return cl.Send(v)
+}
+
+// reject sends a final error and closes a connection that was never seated.
+// Caller holds hub.mu.
+func (c *conn) reject(e proto.Error) {
+	c.closed.Store(true)
+	delete(c.hub.all, c.id)
+	_ = c.send(e)
+	c.client().Close()
+	c.hub.conns.Release(c.addr)
+}
+
+func (c *conn) Handle(data []byte) {
+	if c.closed.Load() {
+		return
+	}
+	if ok, wait := c.bucket.Allow(); !ok {
+		_ = c.send(proto.Error{Type: "error", Code: "RATE_LIMITED", RetryAfterMs: int(wait.Milliseconds()) + 1})
+		return
+	}
+
+	// --- Human-friendly: a single digit "0..8" is a move ---
+	if pos, ok := parseSingleDigit(trimWS(string(data))); ok && c.has(featDigitMoves) {
+		c.applyMove(pos, "", 0)
+		return
+	}
+
+	// --- JSON fallback (original protocol) ---
+	var msg proto.ClientMsg
+	if err := json.Unmarshal(data, &msg); err != nil {
+		_ = c.send(proto.Error{Type: "error", Code: "BAD_JSON", Detail: err.Error()})
+		return
+	}
+	switch strings.ToLower(msg.Type) {
+	case "hello":
+		c.hello(msg)
+	case "move":
+		if msg.Position == nil {
+			_ = c.send(proto.Error{Type: "error", Code: "INVALID", Detail: "missing position"})
+			return
+		}
+		c.applyMove(*msg.Position, msg.MsgID, msg.ClientSeq)
+	case "chat":
+		c.say(msg.Text, "")
+	case "emote":
+		c.say("", msg.Emote)
+	case "resign":
+		c.resign()
+	case "rematch":
+		c.rematch()
+	case "mute":
+		c.muted.Store(true)
+	case "unmute":
+		c.muted.Store(false)
+	case "leave":
+		c.Close()
+	case "ping":
+		// no-op
+	default:
+		_ = c.send(proto.Error{Type: "error", Code: "UNKNOWN_TYPE"})
+	}
+}
+
+// applyMove submits a move; empty msgID / zero clientSeq are filled in.
+func (c *conn) applyMove(pos int, msgID string, clientSeq int) {
+	rm, peer, mark := c.session()
+	if rm == nil {
+		_ = c.send(proto.Error{Type: "error", Code: "NOT_PAIRED", Detail: "waiting for opponent"})
+		return
+	}
+	if clientSeq == 0 {
+		clientSeq = autoClientSeq(rm)
+	}
+	if msgID == "" {
+		msgID = autoMsgID(c)
+	}
+
+	ctx := context.Background()
+	mv := engine.Move{
+		PlayerID:  c.id,
+		Position:  pos,
+		MsgID:     msgID,
+		ClientSeq: clientSeq,
+		Mark:      mark,
+	}
+	ns, err := rm.Submit(ctx, mv)
+	if err != nil {
+		_ = c.send(proto.Error{Type: "error", Code: engineErrCode(err), Detail: err.Error()})
+		return
+	}
+	_ = c.sendState(ns)
+	_ = peer.sendState(ns)
+	sendClock(rm, c, peer)
+
+	if ns.Status != engine.InProgress {
+		res := proto.Result{Type: "result", Status: outcomeText(ns.Status)}
+		_ = c.send(res)
+		_ = peer.send(res)
+		c.hub.seriesNext(rm, nil)
+	}
+}
+
+// sendState shapes a "state" for this connection's negotiated features.
+func (c *conn) sendState(ns engine.State) error {
+	msg := proto.State{
+		Type:      "state",
+		Board:     boardToStrings(ns.Board),
+		NextTurn:  ns.NextTurn,
+		ServerSeq: ns.ServerSeq,
+	}
+	if ns.LastMove != nil && c.has(featLastMove) {
+		msg.LastMove = &proto.MoveInfo{By: ns.LastMove.By, Pos: ns.LastMove.Pos}
+	}
+	return c.send(msg)
+}
+
+func (c *conn) resign() {
+	rm, peer, _ := c.session()
+	if rm == nil {
+		_ = c.send(proto.Error{Type: "error", Code: "NOT_PAIRED", Detail: "waiting for opponent"})
+		return
+	}
+	if err := rm.Resign(context.Background(), c.id); err != nil {
+		_ = c.send(proto.Error{Type: "error", Code: engineErrCode(err), Detail: err.Error()})
+		return
+	}
+	res := proto.Result{Type: "result", Status: outcomeText(rm.State().Status)}
+	_ = c.send(res)
+	_ = peer.send(res)
+	c.hub.seriesNext(rm, nil)
+}
+
+// rematch records the request; once both players asked, a new game starts
+// in the same slot.
+func (c *conn) rematch() {
+	h := c.hub
+	h.mu.Lock()
+	defer h.openLogs() // the lock is gone by then
+	defer h.mu.Unlock()
+
+	if c.room == nil || c.peer == nil || c.peer.closed.Load() {
+		_ = c.send(proto.Error{Type: "error", Code: "NOT_PAIRED", Detail: "no opponent"})
+		return
+	}
+	if c.room.State().Status == engine.InProgress {
+		_ = c.send(proto.Error{Type: "error", Code: "IN_PROGRESS", Detail: "game still running"})
+		return
+	}
+	if c.slot.booked != nil {
+		_ = c.send(proto.Error{Type: "error", Code: "NO_REMATCH", Detail: "this game was arranged for you"})
+		return
+	}
+	if h.draining.Load() {
+		_ = c.send(proto.Error{Type: "error", Code: "DRAINING", Detail: "server shutting down"})
+		return
+	}
+	c.encore = true
+	if !c.peer.encore {
+		_ = c.peer.send(proto.Rematch{Type: "rematch", From: c.mark})
+		return
+	}
+
+	slot := c.slot
+	x, o := slot.x, slot.o
+	x.encore, o.encore = false, false
+	first, second := x, o
+	if slot.host == o {
+		first, second = o, x
+	}
+	if slot.series != nil {
+		slot.series = match.NewSeries(slot.opts.BestOf) // a fresh series
+	}
+	h.startRoom(rematchID(slot)+itoa64(h.seq.Add(1)), slot, first, second, x.id)
+}
+
+func rematchID(slot *roomSlot) string {
+	if slot.code != "" {
+		return "room-" + slot.code + "-"
+	}
+	return "room-r"
+}
+
+// Close forfeits a running game (and any series), frees the slot and closes
+// the client.
+func (c *conn) Close() {
+	if c.closed.Swap(true) {
+		return
+	}
+	h := c.hub
+
+	h.mu.Lock()
+	rm, peer := c.room, c.peer
+	delete(h.all, c.id)
+	if h.queued[c.id] != nil {
+		delete(h.queued, c.id)
+		if c.rated {
+			h.ranked.Remove(c.id)
+		}
+	}
+	delete(h.resumable, c.token)
+	slot := c.slot
+	if slot == nil && c.code != "" {
+		slot = h.rooms[c.code] // still waiting for an opponent
+	}
+	// Tidy the slot once both players are gone
+	if slot != nil {
+		if slot.waiting == c {
+			slot.waiting = nil
+		}
+		if slot.x == c {
+			slot.x = nil
+		}
+		if slot.o == c {
+			slot.o = nil
+		}
+		// A reservation keeps its code until played (or no-show)
+		if slot.x == nil && slot.o == nil && slot.waiting == nil && (slot.booked == nil || slot.room != nil) {
+			if slot.code != "" && h.rooms[slot.code] == slot {
+				h.dropCode(slot.code)
+			}
+			if slot.room != nil {
+				delete(h.live, slot.room.ID())
+			}
+		}
+	}
+	h.unpark(c)
+	h.changed()
+	h.mu.Unlock()
+	h.flushCodes()
+
+	// Forfeit if in a room, notify peer
+	if rm != nil && peer != nil && !peer.closed.Load() {
+		ctx := context.Background()
+		if h.cfg.ResumeGrace > 0 && rm.State().Status == engine.InProgress {
+			_ = rm.Resign(ctx, c.id) // leaving is final even when seats are held
+		}
+		_ = rm.Leave(ctx, c.id)
+		st := rm.State()
+		_ = peer.send(proto.Result{Type: "result", Status: outcomeText(st.Status)})
+		h.seriesNext(rm, c)
+	}
+
+	// An away conn already gave back its address slot when it dropped.
+	if cl := c.swapClient(nil); cl != nil {
+		h.conns.Release(c.addr)
+		cl.Close()
+	}
+}
+
+func boardToStrings(b engine.Board) [9]string {
+	var out [9]string
+	for i := 0; i < len(b); i++ {
+		out[i] = string(b[i])
+	}
+	return out
+}
+
+func outcomeText(o engine.Outcome) string {
+	switch o {
+	case engine.XWins:
+		return "X wins!"
+	case engine.OWins:
+		return "O wins!"
+	case engine.Draw:
+		return "Draw"
+	default:
+		return "In progress"
+	}
+}
+
+func engineErrCode(err error) string {
+	switch {
+	case errors.Is(err, engine.ErrNotYourTurn):
+		return "NOT_YOUR_TURN"
+	case errors.Is(err, engine.ErrInvalidPosition):
+		return "INVALID_POSITION"
+	case errors.Is(err, engine.ErrCellTaken):
+		return "CELL_TAKEN"
+	case errors.Is(err, engine.ErrOutOfOrder):
+		return "OUT_OF_ORDER"
+	case errors.Is(err, engine.ErrTerminal):
+		return "TERMINAL"
+	case errors.Is(err, match.ErrTimeUp):
+		return "TIME_UP"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func itoa64(n int64) string {
+	if n == 0 {
+		return "0"
+	}
+	var buf [20]byte
+	i := len(buf)
+	for n > 0 {
+		i--
+		buf[i] = byte('0' + (n % 10))
+		n /= 10
+	}
+	return string(buf[i:])
+}
+
+// -------- helpers for human-friendly input --------
+
+func trimWS(s string) string {
+	return strings.TrimFunc(s, unicode.IsSpace)
+}
+
+func parseSingleDigit(s string) (int, bool) {
+	if len(s) != 1 {
+		return 0, false
+	}
+	if s[0] < '0' || s[0] > '8' {
+		return 0, false
+	}
+	return int(s[0] - '0'), true
+}
+
+func autoClientSeq(r match.Room) int {
+	return r.State().ServerSeq + 1
+}
+
+func autoMsgID(c *conn) string {
+	n := c.msgSeq.Add(1)
+	return c.id + "-" + itoa64(n)
+}
@@ -0,0 +1,62 @@
+package hub
+
+import (
+	"sort"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+)
+
+type Snapshot struct {
+	Rooms   []RoomInfo `json:"rooms"`
+	Waiting []string   `json:"waiting"` // room codes with one player parked
+	Pending int        `json:"pending"` // players queued for auto-match
+}
+
+type RoomInfo struct {
+	RoomID    string       `json:"roomId"`
+	Code      string       `json:"code,omitempty"`
+	Players   []PlayerInfo `json:"players"`
+	Board     [9]string    `json:"board"`
+	NextTurn  engine.Mark  `json:"next_turn"`
+	Status    string       `json:"status"`
+	ServerSeq int          `json:"serverSeq"`
+}
+
+type PlayerInfo struct {
+	ID        string      `json:"id"`
+	Mark      engine.Mark `json:"mark"`
+	Addr      string      `json:"addr"`
+	Connected bool        `json:"connected"`
+}
+
+func (h *hub) Snapshot() Snapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	snap := Snapshot{Rooms: []RoomInfo{}, Waiting: []string{}, Pending: h.mm.Pending() + h.ranked.Pending()}
+	for id, slot := range h.live {
+		st := slot.room.State()
+		ri := RoomInfo{
+			RoomID:    id,
+			Code:      slot.code,
+			Board:     boardToStrings(st.Board),
+			NextTurn:  st.NextTurn,
+			Status:    outcomeText(st.Status),
+			ServerSeq: st.ServerSeq,
+		}
+		for _, c := range []*conn{slot.x, slot.o} {
+			if c != nil {
+				ri.Players = append(ri.Players, PlayerInfo{ID: c.id, Mark: c.mark, Addr: c.addr, Connected: !c.closed.Load() && c.client() != nil})
+			}
+		}
+		snap.Rooms = append(snap.Rooms, ri)
+	}
+	for code, slot := range h.rooms {
+		if slot.waiting != nil {
+			snap.Waiting = append(snap.Waiting, code)
+		}
+	}
+	sort.Slice(snap.Rooms, func(i, j int) bool { return snap.Rooms[i].RoomID < snap.Rooms[j].RoomID })
+	sort.Strings(snap.Waiting)
+	return snap
+}
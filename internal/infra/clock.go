@@ -5,3 +5,8 @@ import "time"
 type Clock interface {
 	Now() time.Time
 }
+
+// SystemClock is the wall clock.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time { return time.Now() }
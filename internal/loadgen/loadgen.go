@@ -0,0 +1,339 @@
+// Package loadgen drives many simulated players against a server and reports
+// latency percentiles, error counts and resource growth. It works against a
+// remote server or an in-process httptest one (see NewLocal).
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/bot"
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/pkg/client"
+)
+
+const (
+	ModeAuto = "auto" // everyone auto-matches
+	ModeCode = "code" // players pair up on room codes
+)
+
+type Config struct {
+	URL     string // http://host:port
+	Players int    // simulated players; rounded down to even
+	Mode    string // ModeAuto (default) or ModeCode
+	Games   int    // games per player, rematching in between (default 1)
+
+	// Strategy picks moves; nil plays randomly (seeded per player from Seed).
+	Strategy bot.Strategy
+	Seed     int64
+	Think    time.Duration // pause before each move
+
+	Ramp    time.Duration // spread connection attempts over this long
+	Timeout time.Duration // per player, for all its games (default 30s)
+
+	HTTPClient *http.Client
+}
+
+// Latency summarizes one measured step.
+type Latency struct {
+	Count              int
+	P50, P90, P99, Max time.Duration
+}
+
+type Report struct {
+	Players   int
+	Games     int // finished games (each counted once)
+	Duration  time.Duration
+	Connect   Latency // dial + upgrade
+	Pair      Latency // connected -> "start" of the first game
+	Move      Latency // move sent -> own "state" back
+	Errors    map[string]int
+	ErrorRate float64 // errored players / players
+
+	GoroutinesBefore, GoroutinesPeak, GoroutinesAfter int
+	HeapBefore, HeapAfter                             uint64
+}
+
+var eng = engine.NewEngine()
+
+type runner struct {
+	cfg Config
+
+	mu       sync.Mutex
+	connect  []time.Duration
+	pair     []time.Duration
+	move     []time.Duration
+	errs     map[string]int
+	failed   int
+	finished int
+}
+
+func (r *runner) fail(kind string) {
+	r.mu.Lock()
+	r.errs[kind]++
+	r.mu.Unlock()
+}
+
+func (r *runner) sample(into *[]time.Duration, d time.Duration) {
+	r.mu.Lock()
+	*into = append(*into, d)
+	r.mu.Unlock()
+}
+
+// Run plays cfg.Players players to completion (or ctx/timeout) and reports.
+func Run(ctx context.Context, cfg Config) (Report, error) {
+	if cfg.Players < 2 {
+		return Report{}, errors.New("loadgen: need at least 2 players")
+	}
+	cfg.Players -= cfg.Players % 2
+	if cfg.Mode == "" {
+		cfg.Mode = ModeAuto
+	}
+	if cfg.Mode != ModeAuto && cfg.Mode != ModeCode {
+		return Report{}, fmt.Errorf("loadgen: unknown mode %q", cfg.Mode)
+	}
+	if cfg.Mode == ModeCode && cfg.Players/2 > 10000 {
+		return Report{}, errors.New("loadgen: code mode supports at most 10000 pairs")
+	}
+	if cfg.Games <= 0 {
+		cfg.Games = 1
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+
+	rep := Report{Players: cfg.Players}
+	var ms runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	rep.HeapBefore = ms.HeapAlloc
+	rep.GoroutinesBefore = runtime.NumGoroutine()
+
+	r := &runner{cfg: cfg, errs: map[string]int{}}
+	peak := make(chan int)
+	stopPeak := make(chan struct{})
+	go func() {
+		n := 0
+		t := time.NewTicker(50 * time.Millisecond)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				n = max(n, runtime.NumGoroutine())
+			case <-stopPeak:
+				peak <- n
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Players; i++ {
+		if cfg.Ramp > 0 && i > 0 {
+			select {
+			case <-time.After(cfg.Ramp / time.Duration(cfg.Players)):
+			case <-ctx.Done():
+			}
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r.player(ctx, i)
+		}(i)
+	}
+	wg.Wait()
+	rep.Duration = time.Since(start)
+	close(stopPeak)
+	rep.GoroutinesPeak = <-peak
+
+	// Let server-side goroutines for closed sockets wind down before measuring.
+	time.Sleep(100 * time.Millisecond)
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	rep.HeapAfter = ms.HeapAlloc
+	rep.GoroutinesAfter = runtime.NumGoroutine()
+
+	rep.Games = r.finished
+	rep.Connect = summarize(r.connect)
+	rep.Pair = summarize(r.pair)
+	rep.Move = summarize(r.move)
+	rep.Errors = r.errs
+	rep.ErrorRate = float64(r.failed) / float64(cfg.Players)
+	return rep, nil
+}
+
+// player runs one simulated player through all its games.
+func (r *runner) player(ctx context.Context, i int) {
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	defer cancel()
+
+	strategy := r.cfg.Strategy
+	if strategy == nil {
+		strategy = bot.Random(rand.New(rand.NewSource(r.cfg.Seed + int64(i))))
+	}
+	opts := client.Options{HTTPClient: r.cfg.HTTPClient}
+	if r.cfg.Mode == ModeCode {
+		opts.Code = fmt.Sprintf("%04d", i/2)
+	}
+
+	t0 := time.Now()
+	c, err := client.Dial(ctx, r.cfg.URL, opts)
+	if err != nil {
+		r.fail("dial")
+		r.failFinal()
+		return
+	}
+	r.sample(&r.connect, time.Since(t0))
+	defer c.Close()
+
+	if !r.play(ctx, c, strategy) {
+		r.failFinal()
+	}
+}
+
+func (r *runner) failFinal() {
+	r.mu.Lock()
+	r.failed++
+	r.mu.Unlock()
+}
+
+// play answers events until every game is done; false on any failure.
+func (r *runner) play(ctx context.Context, c *client.Client, strategy bot.Strategy) bool {
+	connected := time.Now()
+	paired := false
+	left := r.cfg.Games
+
+	var board [9]string
+	var mark client.Mark
+	var sentAt time.Time
+	var sentSeq int
+
+	myTurn := func(next client.Mark) bool {
+		var b engine.Board
+		for i, s := range board {
+			b[i] = engine.Mark(s)
+		}
+		return next == mark && eng.Outcome(b) == engine.InProgress
+	}
+	move := func(seq int) bool {
+		if r.cfg.Think > 0 {
+			select {
+			case <-time.After(r.cfg.Think):
+			case <-ctx.Done():
+				return false
+			}
+		}
+		sentAt, sentSeq = time.Now(), seq+1
+		return c.Move(ctx, strategy.Move(board, mark)) == nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.fail("timeout")
+			return false
+		case ev, open := <-c.Events():
+			if !open {
+				r.fail("closed")
+				return false
+			}
+			switch e := ev.(type) {
+			case client.Assigned:
+				mark = e.You
+			case client.Start:
+				if !paired {
+					paired = true
+					r.sample(&r.pair, time.Since(connected))
+				}
+				board = e.Board
+				if e.YourTurn && !move(0) {
+					r.fail("send")
+					return false
+				}
+			case client.State:
+				board = e.Board
+				if !sentAt.IsZero() && e.ServerSeq == sentSeq {
+					r.sample(&r.move, time.Since(sentAt))
+					sentAt = time.Time{}
+				}
+				if myTurn(e.NextTurn) && !move(e.ServerSeq) {
+					r.fail("send")
+					return false
+				}
+			case client.Result:
+				if mark == client.X {
+					r.mu.Lock()
+					r.finished++
+					r.mu.Unlock()
+				}
+				left--
+				if left == 0 {
+					_ = c.Leave(ctx)
+					return true
+				}
+				_ = c.Rematch(ctx)
+			case client.Error:
+				r.fail(e.Code)
+				return false
+			case client.Disconnected:
+				r.fail("disconnected")
+				return false
+			}
+		}
+	}
+}
+
+func summarize(ds []time.Duration) Latency {
+	if len(ds) == 0 {
+		return Latency{}
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	at := func(p float64) time.Duration {
+		return ds[min(len(ds)-1, int(p*float64(len(ds))))]
+	}
+	return Latency{Count: len(ds), P50: at(0.50), P90: at(0.90), P99: at(0.99), Max: ds[len(ds)-1]}
+}
+
+func (l Latency) String() string {
+	return fmt.Sprintf("n=%d p50=%v p90=%v p99=%v max=%v", l.Count, round(l.P50), round(l.P90), round(l.P99), round(l.Max))
+}
+
+func round(d time.Duration) time.Duration {
+	if d > time.Millisecond {
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+func (rep Report) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "players    %d\n", rep.Players)
+	fmt.Fprintf(&sb, "games      %d in %v\n", rep.Games, rep.Duration.Round(time.Millisecond))
+	fmt.Fprintf(&sb, "connect    %v\n", rep.Connect)
+	fmt.Fprintf(&sb, "pair       %v\n", rep.Pair)
+	fmt.Fprintf(&sb, "move       %v\n", rep.Move)
+	fmt.Fprintf(&sb, "errors     %.2f%% of players", 100*rep.ErrorRate)
+	keys := make([]string, 0, len(rep.Errors))
+	for k := range rep.Errors {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&sb, " %s=%d", k, rep.Errors[k])
+	}
+	sb.WriteString("\n")
+	fmt.Fprintf(&sb, "goroutines %d -> peak %d -> %d\n", rep.GoroutinesBefore, rep.GoroutinesPeak, rep.GoroutinesAfter)
+	fmt.Fprintf(&sb, "heap       %.1f MiB -> %.1f MiB\n", mib(rep.HeapBefore), mib(rep.HeapAfter))
+	return sb.String()
+}
+
+func mib(b uint64) float64 { return float64(b) / (1 << 20) }
@@ -0,0 +1,38 @@
+package loadgen
+
+import (
+	"math"
+	"net/http/httptest"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ws"
+)
+
+// Local is an in-process websocket server for load runs and benchmarks.
+// Every simulated player comes from 127.0.0.1, so the per-address limits
+// are opened up unless cfg sets them.
+type Local struct {
+	URL string
+	Hub hub.Hub
+
+	srv *httptest.Server
+}
+
+func NewLocal(cfg hub.Config) *Local {
+	if cfg.MaxConnsPerIP == 0 {
+		cfg.MaxConnsPerIP = math.MaxInt32
+	}
+	if cfg.MaxWaitingPerIP == 0 {
+		cfg.MaxWaitingPerIP = math.MaxInt32
+	}
+	eng := engine.NewEngine()
+	h := hub.NewHub(cfg, eng)
+	srv := httptest.NewServer(ws.NewServer(ws.Config{Hub: h}, eng))
+	return &Local{URL: srv.URL, Hub: h, srv: srv}
+}
+
+func (l *Local) Close() {
+	l.srv.Close()
+	_ = l.Hub.Close()
+}
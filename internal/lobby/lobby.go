@@ -0,0 +1,493 @@
+// Package lobby shows who is online and what they are doing, lists public
+// rooms waiting for an opponent, and lets players challenge each other to a
+// game in a room booked for the two of them.
+package lobby
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/auth"
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ratelimit"
+)
+
+// Player statuses.
+const (
+	Idle    = "idle"
+	Waiting = "waiting"
+	Playing = "playing"
+	Offline = "offline"
+)
+
+// Challenge statuses.
+const (
+	Pending   = "pending"
+	Accepted  = "accepted"
+	Declined  = "declined"
+	Cancelled = "cancelled"
+	Expired   = "expired"
+)
+
+var ErrClosed = errors.New("lobby closed")
+
+type Config struct {
+	Hub hub.Hub // required; games and statuses come from it
+
+	ChallengeTTL time.Duration // an unanswered challenge expires (default 60s)
+	NoShow       time.Duration // a booked room is forfeited after (default 1m)
+	MaxPending   int           // open challenges per challenger (default 5)
+
+	MsgRate  float64 // inbound messages per second per session (default 5)
+	MsgBurst int     // default 10
+}
+
+// Member is who is joining, as the transport identified them. A guest goes
+// by auth.GuestPrefix and their name in the lobby, so that nobody can pass
+// for a signed-in player by declaring their id.
+type Member struct {
+	Player        string // "" = a guest name is made up
+	Addr          string // the slot taken with Hub.Admit, given back on leaving
+	Authenticated bool
+}
+
+// Lobby keeps the lobby's sessions.
+type Lobby interface {
+	// Join sends cl the whole lobby and then every change to it.
+	Join(cl hub.Client, m Member) (hub.Session, error)
+	// Changed asks for statuses and open rooms to be refreshed from the hub;
+	// wire it to hub.Config.OnActivity. It never blocks.
+	Changed()
+	// Close ends every session; Join fails afterwards.
+	Close()
+}
+
+type lobby struct {
+	cfg  Config
+	seq  atomic.Int64
+	kick chan struct{}
+	done chan struct{}
+
+	mu         sync.Mutex
+	closed     bool
+	online     map[string][]*member // lobby name => sessions
+	status     map[string]string    // lobby name => status last sent
+	rooms      []proto.OpenRoom     // last sent
+	challenges map[string]*challenge
+}
+
+type member struct {
+	id     string
+	l      *lobby
+	cl     hub.Client
+	player string // lobby name
+	addr   string
+	authed bool
+	bucket *ratelimit.Bucket
+	closed atomic.Bool
+}
+
+type challenge struct {
+	proto.Challenge
+	timer *time.Timer
+}
+
+func NewLobby(cfg Config) Lobby {
+	if cfg.ChallengeTTL <= 0 {
+		cfg.ChallengeTTL = 60 * time.Second
+	}
+	if cfg.NoShow <= 0 {
+		cfg.NoShow = time.Minute
+	}
+	if cfg.MaxPending <= 0 {
+		cfg.MaxPending = 5
+	}
+	if cfg.MsgRate <= 0 {
+		cfg.MsgRate = 5
+	}
+	if cfg.MsgBurst <= 0 {
+		cfg.MsgBurst = 10
+	}
+	l := &lobby{
+		cfg:        cfg,
+		kick:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		online:     make(map[string][]*member),
+		status:     make(map[string]string),
+		rooms:      []proto.OpenRoom{},
+		challenges: make(map[string]*challenge),
+	}
+	go l.loop()
+	return l
+}
+
+func (l *lobby) Changed() {
+	select {
+	case l.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (l *lobby) loop() {
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-l.kick:
+			l.mu.Lock()
+			if !l.closed {
+				l.refresh(l.cfg.Hub.Activity())
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+func (l *lobby) Join(cl hub.Client, m Member) (hub.Session, error) {
+	s := &member{
+		id:     "l" + strconv.FormatInt(l.seq.Add(1), 10),
+		l:      l,
+		cl:     cl,
+		player: m.Player,
+		addr:   m.Addr,
+		authed: m.Authenticated,
+		bucket: ratelimit.NewBucket(l.cfg.MsgRate, l.cfg.MsgBurst, nil),
+	}
+	if s.player == "" {
+		s.player = "guest-" + s.id[1:]
+	}
+	if !s.authed {
+		s.player = auth.GuestPrefix + s.player
+	}
+
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		_ = cl.Send(proto.Error{Type: "error", Code: "UNAVAILABLE", Detail: ErrClosed.Error()})
+		cl.Close()
+		l.cfg.Hub.Release(m.Addr)
+		return nil, ErrClosed
+	}
+	// Bring everyone else up to date first, so the snapshot sent below and
+	// the changes sent after it agree.
+	l.refresh(l.cfg.Hub.Activity())
+	first := len(l.online[s.player]) == 0
+	l.online[s.player] = append(l.online[s.player], s)
+	if first {
+		st := l.status[s.player]
+		if st == "" {
+			st = Idle
+			l.status[s.player] = st
+		}
+		l.broadcast(proto.Presence{Type: "presence", Player: s.player, Status: st}, s.player)
+	}
+
+	state := proto.LobbyState{Type: "lobby", You: s.player, Players: make([]proto.PlayerStatus, 0, len(l.online)), Rooms: l.rooms}
+	for p := range l.online {
+		state.Players = append(state.Players, proto.PlayerStatus{Player: p, Status: l.status[p]})
+	}
+	sort.Slice(state.Players, func(i, j int) bool { return state.Players[i].Player < state.Players[j].Player })
+	_ = cl.Send(state)
+	for _, ch := range l.challenges {
+		if ch.From == s.player || ch.To == s.player {
+			_ = cl.Send(ch.Challenge)
+		}
+	}
+	l.mu.Unlock()
+	return s, nil
+}
+
+// refresh sends what changed since the last call. Caller holds l.mu.
+func (l *lobby) refresh(a hub.Activity) {
+	for p := range l.online {
+		st := Idle
+		switch {
+		case a.Playing[hubName(p)]:
+			st = Playing
+		case a.Waiting[hubName(p)]:
+			st = Waiting
+		}
+		if l.status[p] != st {
+			l.status[p] = st
+			l.broadcast(proto.Presence{Type: "presence", Player: p, Status: st}, "")
+		}
+	}
+	if !slices.Equal(l.rooms, a.Open) {
+		l.rooms = a.Open
+		l.broadcast(proto.Rooms{Type: "rooms", Rooms: a.Open}, "")
+	}
+}
+
+// hubName is the player id a lobby name plays games under: a guest's
+// declared name.
+func hubName(player string) string {
+	return strings.TrimPrefix(player, auth.GuestPrefix)
+}
+
+func guest(player string) bool { return strings.HasPrefix(player, auth.GuestPrefix) }
+
+// broadcast sends v to every session but those of except. Caller holds l.mu.
+func (l *lobby) broadcast(v any, except string) {
+	for p, ss := range l.online {
+		if p == except {
+			continue
+		}
+		for _, s := range ss {
+			_ = s.cl.Send(v)
+		}
+	}
+}
+
+// tell sends v to every session of player. Caller holds l.mu.
+func (l *lobby) tell(player string, v any) {
+	for _, s := range l.online[player] {
+		_ = s.cl.Send(v)
+	}
+}
+
+// settle ends a challenge with status and tells both players. Caller holds l.mu.
+func (l *lobby) settle(ch *challenge, status, code string) {
+	delete(l.challenges, ch.ID)
+	ch.timer.Stop()
+	ch.Status, ch.Code, ch.ExpiresMs = status, code, 0
+	l.tell(ch.From, ch.Challenge)
+	l.tell(ch.To, ch.Challenge)
+}
+
+func (l *lobby) expire(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ch := l.challenges[id]; ch != nil {
+		l.settle(ch, Expired, "")
+	}
+}
+
+func (l *lobby) Close() {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return
+	}
+	l.closed = true
+	close(l.done)
+	for _, ch := range l.challenges {
+		ch.timer.Stop()
+	}
+	var all []*member
+	for _, ss := range l.online {
+		all = append(all, ss...)
+	}
+	l.mu.Unlock()
+	// The transports' readers see the sockets close and call Session.Close.
+	for _, s := range all {
+		s.cl.Close()
+	}
+}
+
+func (s *member) ID() string { return s.id }
+
+func (s *member) Handle(data []byte) {
+	if s.closed.Load() {
+		return
+	}
+	if ok, wait := s.bucket.Allow(); !ok {
+		s.fail("RATE_LIMITED", "", int(wait.Milliseconds())+1)
+		return
+	}
+	var msg proto.LobbyMsg
+	if err := json.Unmarshal(data, &msg); err != nil {
+		s.fail("BAD_JSON", err.Error(), 0)
+		return
+	}
+	switch strings.ToLower(msg.Type) {
+	case "challenge":
+		s.l.challenge(s, msg)
+	case "accept", "decline", "cancel":
+		s.l.answer(s, strings.ToLower(msg.Type), msg.Challenge)
+	case "ping":
+	default:
+		s.fail("UNKNOWN_TYPE", msg.Type, 0)
+	}
+}
+
+func (s *member) fail(code, detail string, retryMs int) {
+	_ = s.cl.Send(proto.Error{Type: "error", Code: code, Detail: detail, RetryAfterMs: retryMs})
+}
+
+// Close leaves the lobby. A player's last session going takes them offline
+// and calls off their open challenges.
+func (s *member) Close() {
+	if s.closed.Swap(true) {
+		return
+	}
+	l := s.l
+	l.mu.Lock()
+	ss := slices.DeleteFunc(l.online[s.player], func(o *member) bool { return o == s })
+	if len(ss) > 0 {
+		l.online[s.player] = ss
+	} else {
+		delete(l.online, s.player)
+		delete(l.status, s.player)
+		for _, ch := range l.challenges {
+			if ch.From == s.player || ch.To == s.player {
+				l.settle(ch, Cancelled, "")
+			}
+		}
+		if !l.closed {
+			l.broadcast(proto.Presence{Type: "presence", Player: s.player, Status: Offline}, "")
+		}
+	}
+	l.mu.Unlock()
+	s.cl.Close()
+	l.cfg.Hub.Release(s.addr)
+}
+
+func (l *lobby) challenge(s *member, msg proto.LobbyMsg) {
+	var set proto.ChallengeSettings
+	if msg.Settings != nil {
+		set = *msg.Settings
+	}
+	if set.Variant == "" {
+		set.Variant = proto.Variants[0]
+	}
+	var badClock error
+	if set.TimeControl != "" {
+		_, badClock = match.ParseTimeControl(set.TimeControl)
+	}
+	switch {
+	case msg.To == "" || msg.To == s.player:
+		s.fail("INVALID", "challenge another player", 0)
+		return
+	case !slices.Contains(proto.Variants, set.Variant):
+		s.fail("UNSUPPORTED", "unknown variant "+set.Variant, 0)
+		return
+	case badClock != nil:
+		s.fail("INVALID", badClock.Error(), 0)
+		return
+	case !hub.ValidBestOf(set.BestOf):
+		s.fail("INVALID", "bestOf must be odd, 1.."+strconv.Itoa(hub.MaxBestOf), 0)
+		return
+	case set.Side != engine.Empty && set.Side != engine.X && set.Side != engine.O:
+		s.fail("INVALID", "side must be X or O", 0)
+		return
+	case set.Rated && !s.authed:
+		s.fail("AUTH_REQUIRED", "rated games need you to sign in", 0)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	target := l.online[msg.To]
+	if len(target) == 0 {
+		s.fail("NOT_ONLINE", msg.To+" is not in the lobby", 0)
+		return
+	}
+	if set.Rated && !slices.ContainsFunc(target, func(m *member) bool { return m.authed }) {
+		s.fail("AUTH_REQUIRED", msg.To+" is not signed in, so the game cannot be rated", 0)
+		return
+	}
+	if l.status[msg.To] == Playing {
+		s.fail("BUSY", msg.To+" is playing", 0)
+		return
+	}
+	open := 0
+	for _, ch := range l.challenges {
+		if ch.From != s.player {
+			continue
+		}
+		if ch.To == msg.To {
+			s.fail("DUPLICATE", "you already challenged "+msg.To, 0)
+			return
+		}
+		open++
+	}
+	if open >= l.cfg.MaxPending {
+		s.fail("RATE_LIMITED", "too many open challenges", 0)
+		return
+	}
+
+	id := "c" + strconv.FormatInt(l.seq.Add(1), 10)
+	ch := &challenge{Challenge: proto.Challenge{
+		Type: "challenge", ID: id, From: s.player, To: msg.To, Settings: set,
+		Status: Pending, ExpiresMs: int(l.cfg.ChallengeTTL.Milliseconds()),
+	}}
+	ch.timer = time.AfterFunc(l.cfg.ChallengeTTL, func() { l.expire(id) })
+	l.challenges[id] = ch
+	l.tell(ch.From, ch.Challenge)
+	l.tell(ch.To, ch.Challenge)
+}
+
+func (l *lobby) answer(s *member, kind, id string) {
+	l.mu.Lock()
+	ch := l.challenges[id]
+	if ch == nil {
+		l.mu.Unlock()
+		s.fail("NOT_FOUND", "no open challenge "+id, 0)
+		return
+	}
+	mine := ch.To
+	if kind == "cancel" {
+		mine = ch.From
+	}
+	if s.player != mine {
+		l.mu.Unlock()
+		s.fail("FORBIDDEN", "not your challenge to "+kind, 0)
+		return
+	}
+	// Only signed-in sessions answer for a signed-in player, or book a game
+	// with one.
+	if !s.authed && (!guest(mine) || kind == "accept" && !(guest(ch.From) && guest(ch.To))) {
+		l.mu.Unlock()
+		s.fail("AUTH_REQUIRED", "sign in to "+kind+" a challenge with a signed-in player", 0)
+		return
+	}
+	switch kind {
+	case "decline":
+		l.settle(ch, Declined, "")
+		l.mu.Unlock()
+		return
+	case "cancel":
+		l.settle(ch, Cancelled, "")
+		l.mu.Unlock()
+		return
+	}
+	// Taken off the list, so nobody else answers it while the room is booked.
+	delete(l.challenges, ch.ID)
+	ch.timer.Stop()
+	l.mu.Unlock()
+
+	set := ch.Settings
+	r := hub.Reservation{
+		X: hubName(ch.From), O: hubName(ch.To),
+		Open:   set.Side == engine.Empty, // the hub's side policy decides
+		NoShow: l.cfg.NoShow,
+		Rated:  set.Rated,
+		Series: match.SeriesOptions{BestOf: set.BestOf},
+	}
+	if set.Side == engine.O {
+		r.X, r.O = r.O, r.X
+	}
+	if set.TimeControl != "" {
+		r.Clock, _ = match.ParseTimeControl(set.TimeControl) // checked by challenge
+	}
+	code, err := l.cfg.Hub.Reserve(r)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err != nil {
+		s.fail("UNAVAILABLE", err.Error(), 0)
+		l.settle(ch, Cancelled, "")
+		return
+	}
+	l.settle(ch, Accepted, code)
+}
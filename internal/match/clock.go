@@ -0,0 +1,154 @@
+package match
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+)
+
+// ErrTimeUp refuses a move made after the mover's clock ran out; the game
+// is lost on time (ReasonFlag).
+var ErrTimeUp = errors.New("out of time")
+
+var errTimeControl = errors.New(`time control must be "minutes+seconds", e.g. "5+0", with 1..60 minutes and 0..60 seconds`)
+
+// TimeControl is a chess clock: each player has Base for the whole game and
+// gains Increment after each of their moves. The zero value is untimed.
+type TimeControl struct {
+	Base, Increment time.Duration
+}
+
+// ParseTimeControl reads "minutes+seconds", e.g. "5+0" or "3+2".
+func ParseTimeControl(s string) (TimeControl, error) {
+	base, inc, ok := strings.Cut(s, "+")
+	if !ok {
+		return TimeControl{}, errTimeControl
+	}
+	m, err1 := strconv.Atoi(base)
+	sec, err2 := strconv.Atoi(inc)
+	if err1 != nil || err2 != nil || m < 1 || m > 60 || sec < 0 || sec > 60 {
+		return TimeControl{}, errTimeControl
+	}
+	return TimeControl{Base: time.Duration(m) * time.Minute, Increment: time.Duration(sec) * time.Second}, nil
+}
+
+// String is the ParseTimeControl form; "" when untimed.
+func (tc TimeControl) String() string {
+	if tc.Base <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d+%d", int(tc.Base/time.Minute), int(tc.Increment/time.Second))
+}
+
+// Clock is where a timed game's clocks stand.
+type Clock struct {
+	X, O    time.Duration // time left
+	Running engine.Mark   // whose time is running; Empty before the start and after the end
+}
+
+func (r *room) timed() bool { return r.opts.TimeControl.Base > 0 }
+
+// startClock starts X's time once both seats are taken. Caller holds r.mu.
+func (r *room) startClock(at time.Time) {
+	if !r.timed() || !r.turnFrom.IsZero() || len(r.marks) < 2 {
+		return
+	}
+	r.left = map[engine.Mark]time.Duration{engine.X: r.opts.TimeControl.Base, engine.O: r.opts.TimeControl.Base}
+	r.turnFrom = at
+}
+
+// spent is how long the side to move has been thinking. Caller holds r.mu.
+func (r *room) spent(at time.Time) time.Duration {
+	if r.turnFrom.IsZero() {
+		return 0
+	}
+	return at.Sub(r.turnFrom)
+}
+
+// punch charges mk for a move made at at and hands the clock over. Caller
+// holds r.mu.
+func (r *room) punch(mk engine.Mark, at time.Time) {
+	if r.turnFrom.IsZero() {
+		return
+	}
+	r.left[mk] += r.opts.TimeControl.Increment - r.spent(at)
+	r.turnFrom = at
+}
+
+// armFlag sets the timer that ends the game when the side to move runs out.
+// Caller holds r.mu.
+func (r *room) armFlag() {
+	if r.flag != nil {
+		r.flag.Stop()
+		r.flag = nil
+	}
+	if r.turnFrom.IsZero() || r.state.Status != engine.InProgress {
+		return
+	}
+	mk, ply := r.state.NextTurn, len(r.moves)
+	r.flag = time.AfterFunc(r.left[mk]-r.spent(time.Now()), func() {
+		r.mu.Lock()
+		if r.state.Status != engine.InProgress || len(r.moves) != ply {
+			r.mu.Unlock()
+			return
+		}
+		done, err := r.fall(mk)
+		if err != nil {
+			// Lost on time all the same; a restart replays the clock and
+			// flags the player again.
+			log.Printf("room %s: logging flag: %v", r.id, err)
+			r.state.Status = loss(mk)
+			done = r.finish(ReasonFlag)
+		}
+		r.mu.Unlock()
+		r.flagged(done, mk)
+	})
+}
+
+// fall ends the game: mk's time ran out. Caller holds r.mu.
+func (r *room) fall(mk engine.Mark) (*Record, error) {
+	if err := r.log(Event{Kind: EventFlag, Player: r.marks[mk], Outcome: loss(mk)}); err != nil {
+		return nil, err
+	}
+	r.state.Status = loss(mk)
+	return r.finish(ReasonFlag), nil
+}
+
+// flagged reports a game lost on time. Call without r.mu.
+func (r *room) flagged(done *Record, mk engine.Mark) {
+	if done == nil {
+		return
+	}
+	r.report(done)
+	if r.opts.OnFlag != nil {
+		who := done.X
+		if mk == engine.O {
+			who = done.O
+		}
+		r.opts.OnFlag(who)
+	}
+}
+
+func (r *room) Clock() (Clock, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.turnFrom.IsZero() {
+		return Clock{}, false
+	}
+	c := Clock{X: r.left[engine.X], O: r.left[engine.O]}
+	if r.state.Status == engine.InProgress {
+		c.Running = r.state.NextTurn
+		if c.Running == engine.X {
+			c.X -= r.spent(time.Now())
+		} else {
+			c.O -= r.spent(time.Now())
+		}
+	}
+	c.X, c.O = max(c.X, 0), max(c.O, 0)
+	return c, true
+}
@@ -14,19 +14,26 @@ type RoomCreatedEvent struct {
 
 type Matchmaker interface {
 	Enqueue(ctx context.Context, p Player) error
+	// Ping round-trips through the pairing loop; it fails if the loop is gone.
+	Ping(ctx context.Context) error
+	// Pending is the number of players queued and not yet paired.
+	Pending() int
 	Close() error
 }
 
 type matchmaker struct {
 	q       chan Player
+	ping    chan struct{}
 	done    chan struct{}
 	onRoom  func(RoomCreatedEvent)
 	counter atomic.Int64
+	held    atomic.Int64 // players taken off q but not yet paired
 }
 
 func NewMatchmaker(onRoom func(RoomCreatedEvent)) Matchmaker {
 	m := &matchmaker{
 		q:      make(chan Player, 1024),
+		ping:   make(chan struct{}),
 		done:   make(chan struct{}),
 		onRoom: onRoom,
 	}
@@ -45,6 +52,21 @@ func (m *matchmaker) Enqueue(ctx context.Context, p Player) error {
 	}
 }
 
+func (m *matchmaker) Ping(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-m.done:
+		return context.Canceled
+	case m.ping <- struct{}{}:
+		return nil
+	}
+}
+
+func (m *matchmaker) Pending() int {
+	return len(m.q) + int(m.held.Load())
+}
+
 func (m *matchmaker) Close() error {
 	close(m.done)
 	return nil
@@ -57,11 +79,13 @@ func (m *matchmaker) loop() {
 		select {
 		case <-m.done:
 			return
+		case <-m.ping:
 		case p := <-m.q:
 			if pending == nil {
 				// keep the first player
 				pp := p
 				pending = &pp
+				m.held.Store(1)
 				continue
 			}
 			// pair pending with p
@@ -69,14 +93,15 @@ func (m *matchmaker) loop() {
 			first := *pending
 			second := p
 
-			// deterministic roles: first -> X, second -> O
+			// arrival order: first -> X, second -> O (owners may apply a SidePolicy)
 			ev := RoomCreatedEvent{
 				RoomID: roomID,
 				X:      Player{ID: first.ID, Mark: "X"},
 				O:      Player{ID: second.ID, Mark: "O"},
 			}
-			m.onRoom(ev)
 			pending = nil
+			m.held.Store(0)
+			m.onRoom(ev)
 		case <-time.After(5 * time.Millisecond):
 			// small tick to allow default case to yield
 		}
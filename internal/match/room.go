@@ -2,19 +2,89 @@ package match
 
 import (
 	"context"
+	"errors"
+	"log"
 	"sync"
 	"time"
 
 	"github.com/kushgupta-hiver/TTT/internal/engine"
 )
 
+var ErrNotSeated = errors.New("player not seated in room")
+
 type Player struct {
 	ID   string
 	Mark engine.Mark
+
+	// For NewSkillMatchmaker and SidePolicy.
+	Name   string      // identity across connections; "" = ID
+	Rating float64
+	Side   engine.Mark // side asked for, honoured by HostChooses
+
+	// Key and Verified are logged with the join (see Options.Log) so that
+	// the room's owner can give the seat back after a restart: e.g. a
+	// resume token, and whether Name was signed in rather than declared.
+	Key      string
+	Verified bool
+}
+
+// ChatLine is one relayed chat message or emote.
+type ChatLine struct {
+	At       time.Time   `json:"at"`
+	PlayerID string      `json:"player"`
+	Mark     engine.Mark `json:"mark"`
+	Text     string      `json:"text,omitempty"`
+	Emote    string      `json:"emote,omitempty"`
+}
+
+// Why a game ended.
+const (
+	ReasonPlay    = "play"    // a move won or filled the board
+	ReasonResign  = "resign"  // a player conceded
+	ReasonForfeit = "forfeit" // a player left
+	ReasonTimeout = "timeout" // a player did not return within the grace period
+	ReasonAdmin   = "admin"   // an operator declared the outcome
+	ReasonNoShow  = "noshow"  // a player never arrived for an arranged game
+	ReasonFlag    = "flag"    // a player's clock ran out (Options.TimeControl)
+)
+
+// Record is what a room keeps about its game, for persistence.
+type Record struct {
+	RoomID  string            `json:"roomId"`
+	X       string            `json:"x"` // the room's ids; player ids once saved
+	O       string            `json:"o"`
+	Moves   []engine.MoveInfo `json:"moves"`
+	Chat    []ChatLine        `json:"chat,omitempty"`
+	Outcome engine.Outcome    `json:"outcome"`
+	Reason  string            `json:"reason"` // Reason*; "" while in progress
+	Rated   bool              `json:"rated"`
+
+	Started time.Time `json:"started"`
+	Ended   time.Time `json:"ended"`
 }
 
 type Options struct {
 	GracePeriod time.Duration // 0 = immediate forfeit on leave
+
+	// OnGraceExpired runs (outside the room lock) when a player who left did
+	// not rejoin within GracePeriod. A running game has been forfeited by then.
+	OnGraceExpired func(playerID string)
+
+	// OnFinish runs once, outside the room lock, when the game reaches a
+	// terminal outcome by any path.
+	OnFinish func(Record)
+
+	Rated bool // copied to the Record
+
+	// TimeControl, when set, starts X's clock once both players are seated.
+	// OnFlag runs (outside the room lock) after the game was lost on time
+	// by playerID, whether by the clock or by a late move (ErrTimeUp).
+	TimeControl TimeControl
+	OnFlag      func(playerID string)
+
+	// Log, when set, gets every accepted command before it takes effect;
+	// a command the log refuses fails. See Restore.
+	Log Log
 }
 
 type Room interface {
@@ -22,7 +92,16 @@ type Room interface {
 	Join(ctx context.Context, p Player) error
 	Submit(ctx context.Context, m engine.Move) (engine.State, error)
 	Leave(ctx context.Context, playerID string) error
+	// Resign concedes a running game to the opponent.
+	Resign(ctx context.Context, playerID string) error
+	// End declares the outcome of a running game (operator intervention).
+	End(ctx context.Context, o engine.Outcome) error
 	State() engine.State
+	// Say appends a chat line from a seated player to the game record.
+	Say(ctx context.Context, line ChatLine) error
+	Record() Record
+	// Clock reports a timed game's clocks; false if untimed or not started.
+	Clock() (Clock, bool)
 }
 
 type room struct {
@@ -38,6 +117,17 @@ type room struct {
 	hist      map[string]engine.State    // msgID -> state (idempotency)
 	connected map[string]bool            // playerID -> currently connected
 	timers    map[string]*time.Timer     // playerID -> grace timer
+
+	// Options.TimeControl; see clock.go. turnFrom is zero until the clock starts.
+	left     map[engine.Mark]time.Duration
+	turnFrom time.Time
+	flag     *time.Timer
+
+	moves []engine.MoveInfo
+	chat  []ChatLine
+
+	started, ended time.Time
+	reason         string
 }
 
 func NewRoom(id string, eng engine.Engine, opts Options) Room {
@@ -51,6 +141,30 @@ func NewRoom(id string, eng engine.Engine, opts Options) Room {
 		hist:      make(map[string]engine.State, 8),
 		connected: make(map[string]bool, 2),
 		timers:    make(map[string]*time.Timer, 2),
+		started:   time.Now(),
+	}
+}
+
+// finish stamps a game that just became terminal and returns its record
+// for OnFinish. Caller holds r.mu.
+func (r *room) finish(reason string) *Record {
+	if r.state.Status == engine.InProgress || r.reason != "" {
+		return nil
+	}
+	r.reason = reason
+	r.ended = time.Now()
+	if r.flag != nil {
+		r.flag.Stop()
+	}
+	// Grace timers keep running: OnGraceExpired still tells the owner that
+	// a player who left is gone for good.
+	rec := r.record()
+	return &rec
+}
+
+func (r *room) report(rec *Record) {
+	if rec != nil && r.opts.OnFinish != nil {
+		r.opts.OnFinish(*rec)
 	}
 }
 
@@ -85,13 +199,23 @@ func (r *room) Join(_ context.Context, p Player) error {
 		// reject silently
 		return nil
 	}
+	if err := r.log(Event{Kind: EventJoin, Player: p.ID, Name: p.Name, Key: p.Key, Verified: p.Verified, Mark: p.Mark}); err != nil {
+		return err
+	}
 	r.players[p.ID] = p.Mark
 	r.marks[p.Mark] = p.ID
 	r.connected[p.ID] = true
+	r.startClock(time.Now())
+	r.armFlag()
 	return nil
 }
 
 func (r *room) Submit(_ context.Context, m engine.Move) (engine.State, error) {
+	var done, flagged *Record
+	defer func() {
+		r.report(done)
+		r.flagged(flagged, m.Mark)
+	}()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -111,14 +235,30 @@ func (r *room) Submit(_ context.Context, m engine.Move) (engine.State, error) {
 	if err != nil {
 		return r.state, err
 	}
+	now := time.Now()
+	if !r.turnFrom.IsZero() && r.spent(now) >= r.left[mk] {
+		if flagged, err = r.fall(mk); err != nil {
+			return r.state, err
+		}
+		return r.state, ErrTimeUp
+	}
+	if err := r.log(Event{Kind: EventMove, At: now, Player: m.PlayerID, Mark: m.Mark, Pos: m.Position, MsgID: m.MsgID, Seq: m.ClientSeq, Outcome: ns.Status}); err != nil {
+		return r.state, err
+	}
 
 	// Commit + record
 	r.state = ns
 	r.hist[m.MsgID] = ns
+	r.moves = append(r.moves, *ns.LastMove)
+	r.punch(mk, now)
+	done = r.finish(ReasonPlay)
+	r.armFlag()
 	return ns, nil
 }
 
 func (r *room) Leave(_ context.Context, playerID string) error {
+	var done *Record
+	defer func() { r.report(done) }()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -133,38 +273,147 @@ func (r *room) Leave(_ context.Context, playerID string) error {
 		return nil
 	}
 
-	// Mark as disconnected
-	r.connected[playerID] = false
-
 	// Immediate forfeit if grace is zero
 	if r.opts.GracePeriod == 0 {
-		if leaverMark == engine.X {
-			r.state.Status = engine.OWins
-		} else if leaverMark == engine.O {
-			r.state.Status = engine.XWins
+		if err := r.log(Event{Kind: EventLeave, Player: playerID, Outcome: loss(leaverMark)}); err != nil {
+			return err
 		}
+		r.connected[playerID] = false
+		r.state.Status = loss(leaverMark)
+		done = r.finish(ReasonForfeit)
 		return nil
 	}
 
 	// With grace: schedule a forfeit if player doesn't return
-	if r.timers[playerID] == nil {
-		r.timers[playerID] = time.AfterFunc(r.opts.GracePeriod, func() {
-			r.mu.Lock()
-			defer r.mu.Unlock()
-			// If still disconnected and game is still running, award win to opponent
-			if !r.connected[playerID] && r.state.Status == engine.InProgress {
-				if leaverMark == engine.X {
-					r.state.Status = engine.OWins
-				} else {
-					r.state.Status = engine.XWins
-				}
+	if err := r.log(Event{Kind: EventLeave, Player: playerID}); err != nil {
+		return err
+	}
+	r.connected[playerID] = false
+	r.startGrace(playerID, leaverMark)
+	return nil
+}
+
+// startGrace forfeits playerID's game unless they rejoin within the grace
+// period. Caller holds r.mu.
+func (r *room) startGrace(playerID string, leaverMark engine.Mark) {
+	if r.timers[playerID] != nil {
+		return
+	}
+	r.timers[playerID] = time.AfterFunc(r.opts.GracePeriod, func() {
+		r.mu.Lock()
+		gone := !r.connected[playerID]
+		// If still disconnected and game is still running, award win to opponent
+		if gone && r.state.Status == engine.InProgress {
+			// Forfeited all the same: if the write failed, a restart just
+			// gives the player another grace period.
+			if err := r.log(Event{Kind: EventTimeout, Player: playerID, Outcome: loss(leaverMark)}); err != nil {
+				log.Printf("room %s: logging timeout: %v", r.id, err)
 			}
-			delete(r.timers, playerID)
-		})
+			r.state.Status = loss(leaverMark)
+		}
+		delete(r.timers, playerID)
+		done := r.finish(ReasonTimeout)
+		r.mu.Unlock()
+
+		r.report(done)
+		if gone && r.opts.OnGraceExpired != nil {
+			r.opts.OnGraceExpired(playerID)
+		}
+	})
+}
+
+// loss is the outcome when mark's player concedes.
+func loss(mark engine.Mark) engine.Outcome {
+	if mark == engine.X {
+		return engine.OWins
+	}
+	return engine.XWins
+}
+
+func (r *room) Resign(_ context.Context, playerID string) error {
+	var done *Record
+	defer func() { r.report(done) }()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	mk, ok := r.players[playerID]
+	if !ok {
+		return ErrNotSeated
+	}
+	if r.state.Status != engine.InProgress {
+		return engine.ErrTerminal
+	}
+	if err := r.log(Event{Kind: EventResign, Player: playerID, Outcome: loss(mk)}); err != nil {
+		return err
+	}
+	r.state.Status = loss(mk)
+	done = r.finish(ReasonResign)
+	return nil
+}
+
+func (r *room) End(_ context.Context, o engine.Outcome) error {
+	var done *Record
+	defer func() { r.report(done) }()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if o == engine.InProgress {
+		return engine.ErrInvalidOutcome
 	}
+	if r.state.Status != engine.InProgress {
+		return engine.ErrTerminal
+	}
+	if err := r.log(Event{Kind: EventEnd, Outcome: o}); err != nil {
+		return err
+	}
+	r.state.Status = o
+	done = r.finish(ReasonAdmin)
 	return nil
 }
 
+func (r *room) Say(_ context.Context, line ChatLine) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	mk, ok := r.players[line.PlayerID]
+	if !ok {
+		return ErrNotSeated
+	}
+	line.Mark = mk
+	if line.At.IsZero() {
+		line.At = time.Now()
+	}
+	if r.state.Status == engine.InProgress { // the log is done with finished rooms
+		if err := r.log(Event{Kind: EventSay, At: line.At, Player: line.PlayerID, Text: line.Text, Emote: line.Emote}); err != nil {
+			return err
+		}
+	}
+	r.chat = append(r.chat, line)
+	return nil
+}
+
+func (r *room) Record() Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.record()
+}
+
+// Caller holds r.mu.
+func (r *room) record() Record {
+	return Record{
+		RoomID:  r.id,
+		X:       r.marks[engine.X],
+		O:       r.marks[engine.O],
+		Moves:   append([]engine.MoveInfo(nil), r.moves...),
+		Chat:    append([]ChatLine(nil), r.chat...),
+		Outcome: r.state.Status,
+		Reason:  r.reason,
+		Rated:   r.opts.Rated,
+		Started: r.started,
+		Ended:   r.ended,
+	}
+}
+
 func (r *room) State() engine.State {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -0,0 +1,82 @@
+package match
+
+import "github.com/kushgupta-hiver/TTT/internal/engine"
+
+// SeriesForfeit is what a player loses when they drop out of a series and
+// do not return within the grace period.
+type SeriesForfeit string
+
+const (
+	ForfeitSeries SeriesForfeit = "series" // the whole series (default)
+	ForfeitGame   SeriesForfeit = "game"   // the game in progress; the seat is held for the next one
+)
+
+// SeriesOptions make a room play up to BestOf games between the same two
+// players, who swap sides each game so the first move alternates.
+type SeriesOptions struct {
+	BestOf  int // odd; 0 or 1 = a single game
+	Forfeit SeriesForfeit
+}
+
+// Series scores a best-of-N set by player ID. It ends once a player leads
+// by more than the games left, or after BestOf games (level = drawn).
+// Not safe for concurrent use.
+type Series struct {
+	BestOf int
+	Games  int
+	Draws  int
+	wins   map[string]int
+	winner string
+	over   bool
+}
+
+func NewSeries(bestOf int) *Series {
+	return &Series{BestOf: bestOf, wins: make(map[string]int, 2)}
+}
+
+// Record scores one finished game between x and o.
+func (s *Series) Record(x, o string, outcome engine.Outcome) {
+	if s.over || outcome == engine.InProgress {
+		return
+	}
+	s.Games++
+	switch outcome {
+	case engine.XWins:
+		s.wins[x]++
+	case engine.OWins:
+		s.wins[o]++
+	default:
+		s.Draws++
+	}
+	left := s.BestOf - s.Games
+	switch {
+	case s.wins[x]-s.wins[o] > left:
+		s.winner, s.over = x, true
+	case s.wins[o]-s.wins[x] > left:
+		s.winner, s.over = o, true
+	case left <= 0:
+		s.over = true
+	}
+}
+
+// Concede ends the series in favour of winner, whose opponent walked away.
+func (s *Series) Concede(winner string) {
+	if !s.over {
+		s.winner, s.over = winner, true
+	}
+}
+
+func (s *Series) Wins(player string) int { return s.wins[player] }
+
+// Over reports whether the series is decided, and by whom ("" = drawn).
+func (s *Series) Over() (winner string, over bool) { return s.winner, s.over }
+
+// Copy returns an independent copy, for trying out a result.
+func (s *Series) Copy() *Series {
+	c := *s
+	c.wins = make(map[string]int, 2)
+	for k, v := range s.wins {
+		c.wins[k] = v
+	}
+	return &c
+}
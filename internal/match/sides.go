@@ -0,0 +1,153 @@
+package match
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/infra"
+)
+
+// Pairing is two players about to start a game.
+type Pairing struct {
+	First, Second Player // arrival order; First opened the room
+	PrevX         string // on a rematch, the ID of the previous game's X; "" otherwise
+}
+
+// SidePolicy decides who plays X, and so moves first.
+type SidePolicy interface {
+	FirstIsX(p Pairing) bool
+}
+
+type SideFunc func(p Pairing) bool
+
+func (f SideFunc) FirstIsX(p Pairing) bool { return f(p) }
+
+// FirstComeX gives X to whoever arrived first (the original behaviour).
+func FirstComeX() SidePolicy { return SideFunc(func(Pairing) bool { return true }) }
+
+// RandomSides tosses a coin; a fixed seed makes it reproducible.
+func RandomSides(seed int64) SidePolicy {
+	var mu sync.Mutex
+	r := rand.New(rand.NewSource(seed))
+	return SideFunc(func(Pairing) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return r.Intn(2) == 0
+	})
+}
+
+// Alternate swaps sides on every rematch and defers to first for new pairings.
+func Alternate(first SidePolicy) SidePolicy {
+	return SideFunc(func(p Pairing) bool {
+		if p.PrevX != "" {
+			return p.PrevX != p.First.ID
+		}
+		return first.FirstIsX(p)
+	})
+}
+
+// SideCount is a player's side record for Balance.
+type SideCount struct {
+	XMinusO int       // games as X minus games as O
+	Last    time.Time // their latest game
+}
+
+type BalanceOptions struct {
+	Clock infra.Clock
+	// Idle forgets a player who has not played for this long (default 30
+	// days); they start even again.
+	Idle time.Duration
+	// Seed is the record so far of signed-in players, by Name, e.g. from
+	// the stored games.
+	Seed map[string]SideCount
+}
+
+// Balance gives X to whichever signed-in player (Player.Verified, counted by
+// Name) has had it less often; even records, and guests, defer to tie.
+func Balance(tie SidePolicy, opts BalanceOptions) SidePolicy {
+	if opts.Clock == nil {
+		opts.Clock = infra.SystemClock{}
+	}
+	if opts.Idle <= 0 {
+		opts.Idle = 30 * 24 * time.Hour
+	}
+	b := &balance{tie: tie, opts: opts, counts: make(map[string]SideCount, len(opts.Seed))}
+	for who, c := range opts.Seed {
+		b.counts[who] = c
+	}
+	b.swept = opts.Clock.Now()
+	b.prune(b.swept)
+	return SideFunc(b.firstIsX)
+}
+
+type balance struct {
+	tie  SidePolicy
+	opts BalanceOptions
+
+	mu     sync.Mutex
+	counts map[string]SideCount // signed-in player name => record
+	swept  time.Time
+}
+
+func (b *balance) firstIsX(p Pairing) bool {
+	// One lock for read and update, so concurrent pairings see each other.
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.opts.Clock.Now()
+	if now.Sub(b.swept) >= time.Hour {
+		b.prune(now)
+		b.swept = now
+	}
+	da, okA := b.count(p.First)
+	dc, okC := b.count(p.Second)
+
+	firstX := da < dc
+	if da == dc {
+		firstX = b.tie.FirstIsX(p)
+	}
+	step := 1
+	if !firstX {
+		step = -1
+	}
+	if okA {
+		b.counts[p.First.Name] = SideCount{XMinusO: da + step, Last: now}
+	}
+	if okC {
+		b.counts[p.Second.Name] = SideCount{XMinusO: dc - step, Last: now}
+	}
+	return firstX
+}
+
+// count is p's X-minus-O; ok is false for guests, who are not counted.
+// Caller holds b.mu.
+func (b *balance) count(p Player) (int, bool) {
+	if !p.Verified || p.Name == "" {
+		return 0, false
+	}
+	return b.counts[p.Name].XMinusO, true
+}
+
+// prune forgets idle players. Caller holds b.mu.
+func (b *balance) prune(now time.Time) {
+	for who, c := range b.counts {
+		if now.Sub(c.Last) >= b.opts.Idle {
+			delete(b.counts, who)
+		}
+	}
+}
+
+// HostChooses honours the side the room's opener asked for (Player.Side) and
+// defers to otherwise when they did not ask.
+func HostChooses(otherwise SidePolicy) SidePolicy {
+	return SideFunc(func(p Pairing) bool {
+		switch p.First.Side {
+		case engine.X:
+			return true
+		case engine.O:
+			return false
+		}
+		return otherwise.FirstIsX(p)
+	})
+}
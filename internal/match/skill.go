@@ -0,0 +1,314 @@
+package match
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/infra"
+)
+
+type SkillOptions struct {
+	Clock infra.Clock
+
+	// Two players may meet when their rating gap is within the window of
+	// whichever has waited longer: Window, plus Widen per second waited, up
+	// to MaxWindow.
+	Window    float64 // default 100
+	Widen     float64 // default 25
+	MaxWindow float64 // default 1000
+
+	// AvoidRepeat keeps two players who just met apart for this long after
+	// their pairing (default 30s), so a rematch is a choice, not the queue's.
+	AvoidRepeat time.Duration
+
+	// Rescan re-checks the queue so windows widen without new arrivals
+	// (default 500ms). Negative disables it; Ping and Enqueue still scan.
+	Rescan time.Duration
+}
+
+// SkillMatchmaker pairs players by Player.Rating (see NewSkillMatchmaker).
+type SkillMatchmaker interface {
+	Matchmaker
+	// ExpectedWait estimates how long a player with this rating will queue,
+	// from recent pairings near that rating; ok is false with no history.
+	ExpectedWait(rating float64) (d time.Duration, ok bool)
+	// Requeue puts p back as if they had queued at since, e.g. a player
+	// whose opponent left before their room opened, so their window keeps
+	// its width.
+	Requeue(ctx context.Context, p Player, since time.Time) error
+	// Remove takes a player who gave up out of the queue; false if they
+	// were not in it.
+	Remove(id string) bool
+}
+
+type skill struct {
+	opts   SkillOptions
+	onRoom func(RoomCreatedEvent)
+	done   chan struct{}
+
+	mu      sync.Mutex
+	queue   []waiter // arrival order
+	met     map[string]pairing
+	waits   []waitSample // most recent last
+	counter int64
+	closed  bool
+}
+
+type waiter struct {
+	p     Player
+	since time.Time
+}
+
+type pairing struct {
+	opponent string
+	at       time.Time
+}
+
+type waitSample struct {
+	rating float64
+	wait   time.Duration
+}
+
+const waitSamples = 64
+
+// NewSkillMatchmaker queues players and pairs the closest ratings within a
+// window that widens as they wait. Unlike NewMatchmaker it pairs on the
+// caller's goroutine: onRoom runs inside Enqueue, Ping or the rescan timer.
+func NewSkillMatchmaker(opts SkillOptions, onRoom func(RoomCreatedEvent)) SkillMatchmaker {
+	if opts.Clock == nil {
+		opts.Clock = infra.SystemClock{}
+	}
+	if opts.Window <= 0 {
+		opts.Window = 100
+	}
+	if opts.Widen <= 0 {
+		opts.Widen = 25
+	}
+	if opts.MaxWindow <= 0 {
+		opts.MaxWindow = 1000
+	}
+	if opts.AvoidRepeat == 0 {
+		opts.AvoidRepeat = 30 * time.Second
+	}
+	if opts.Rescan == 0 {
+		opts.Rescan = 500 * time.Millisecond
+	}
+	m := &skill{opts: opts, onRoom: onRoom, done: make(chan struct{}), met: make(map[string]pairing)}
+	if opts.Rescan > 0 {
+		go m.rescan()
+	}
+	return m
+}
+
+func (m *skill) rescan() {
+	t := time.NewTicker(m.opts.Rescan)
+	defer t.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-t.C:
+			_ = m.Ping(context.Background())
+		}
+	}
+}
+
+func (m *skill) Enqueue(ctx context.Context, p Player) error {
+	return m.Requeue(ctx, p, time.Time{})
+}
+
+func (m *skill) Requeue(ctx context.Context, p Player, since time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return context.Canceled
+	}
+	if now := m.opts.Clock.Now(); since.IsZero() || since.After(now) {
+		since = now
+	}
+	m.queue = append(m.queue, waiter{p: p, since: since})
+	rooms := m.scan()
+	m.mu.Unlock()
+	m.emit(rooms)
+	return nil
+}
+
+func (m *skill) Remove(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, w := range m.queue {
+		if w.p.ID == id {
+			m.queue = slices.Delete(m.queue, i, i+1)
+			return true
+		}
+	}
+	return false
+}
+
+// Ping pairs whoever has become compatible since the last scan.
+func (m *skill) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return context.Canceled
+	}
+	rooms := m.scan()
+	m.mu.Unlock()
+	m.emit(rooms)
+	return nil
+}
+
+func (m *skill) Pending() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.queue)
+}
+
+func (m *skill) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.closed {
+		m.closed = true
+		close(m.done)
+	}
+	return nil
+}
+
+func (m *skill) emit(rooms []RoomCreatedEvent) {
+	for _, ev := range rooms {
+		m.onRoom(ev)
+	}
+}
+
+// window is how far from w's rating an opponent may be at now.
+func (m *skill) window(w waiter, now time.Time) float64 {
+	return math.Min(m.opts.Window+m.opts.Widen*now.Sub(w.since).Seconds(), m.opts.MaxWindow)
+}
+
+func name(p Player) string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.ID
+}
+
+// compatible reports whether a and b may be paired at now. Caller holds m.mu.
+func (m *skill) compatible(a, b waiter, now time.Time) bool {
+	na, nb := name(a.p), name(b.p)
+	if na == nb {
+		return false // two connections of one player
+	}
+	if last, ok := m.met[na]; ok && last.opponent == nb && now.Sub(last.at) < m.opts.AvoidRepeat {
+		return false
+	}
+	return math.Abs(a.p.Rating-b.p.Rating) <= math.Max(m.window(a, now), m.window(b, now))
+}
+
+// scan pairs compatible players, longest-waiting first, each with the
+// closest rating available. Caller holds m.mu.
+func (m *skill) scan() []RoomCreatedEvent {
+	now := m.opts.Clock.Now()
+	taken := make([]bool, len(m.queue))
+	var rooms []RoomCreatedEvent
+	for i, a := range m.queue {
+		if taken[i] {
+			continue
+		}
+		best, gap := -1, math.Inf(1)
+		for j := i + 1; j < len(m.queue); j++ {
+			b := m.queue[j]
+			if taken[j] || !m.compatible(a, b, now) {
+				continue
+			}
+			if d := math.Abs(a.p.Rating - b.p.Rating); d < gap {
+				best, gap = j, d
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		taken[i], taken[best] = true, true
+		b := m.queue[best]
+		m.counter++
+		rooms = append(rooms, RoomCreatedEvent{
+			RoomID: "room-" + itoa64(m.counter),
+			X:      Player{ID: a.p.ID, Mark: "X", Name: a.p.Name, Rating: a.p.Rating},
+			O:      Player{ID: b.p.ID, Mark: "O", Name: b.p.Name, Rating: b.p.Rating},
+		})
+		m.met[name(a.p)] = pairing{opponent: name(b.p), at: now}
+		m.met[name(b.p)] = pairing{opponent: name(a.p), at: now}
+		m.sample(a, now)
+		m.sample(b, now)
+	}
+	if len(rooms) == 0 {
+		return nil
+	}
+	rest := m.queue[:0]
+	for i, w := range m.queue {
+		if !taken[i] {
+			rest = append(rest, w)
+		}
+	}
+	clear(m.queue[len(rest):])
+	m.queue = rest
+	m.prune(now)
+	return rooms
+}
+
+// Caller holds m.mu.
+func (m *skill) sample(w waiter, now time.Time) {
+	m.waits = append(m.waits, waitSample{rating: w.p.Rating, wait: now.Sub(w.since)})
+	if len(m.waits) > waitSamples {
+		m.waits = m.waits[len(m.waits)-waitSamples:]
+	}
+}
+
+// prune forgets pairings too old to matter. Caller holds m.mu.
+func (m *skill) prune(now time.Time) {
+	if len(m.met) < 1024 {
+		return
+	}
+	for k, v := range m.met {
+		if now.Sub(v.at) >= m.opts.AvoidRepeat {
+			delete(m.met, k)
+		}
+	}
+}
+
+func (m *skill) ExpectedWait(rating float64) (time.Duration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.opts.Clock.Now()
+	for _, w := range m.queue {
+		if math.Abs(w.p.Rating-rating) <= math.Max(m.opts.Window, m.window(w, now)) {
+			return 0, true // someone is already waiting for a player like this
+		}
+	}
+
+	// Median wait of recent players near this rating, or of everyone.
+	var near, all []time.Duration
+	for _, s := range m.waits {
+		all = append(all, s.wait)
+		if math.Abs(s.rating-rating) <= m.opts.Window {
+			near = append(near, s.wait)
+		}
+	}
+	if len(near) == 0 {
+		near = all
+	}
+	if len(near) == 0 {
+		return 0, false
+	}
+	sort.Slice(near, func(i, j int) bool { return near[i] < near[j] })
+	return near[len(near)/2], true
+}
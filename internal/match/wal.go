@@ -0,0 +1,129 @@
+package match
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+)
+
+// Event kinds, as a room's log holds them.
+const (
+	EventOpen    = "open" // written by the room's owner before the first join
+	EventJoin    = "join" // a player took a seat
+	EventMove    = "move"
+	EventLeave   = "leave"
+	EventResign  = "resign"
+	EventTimeout = "timeout" // a grace period ran out
+	EventEnd     = "end"     // an operator declared the outcome
+	EventFlag    = "flag"    // a player's clock ran out
+	EventSay     = "say"     // a chat line or emote
+)
+
+// Event is one accepted room command.
+type Event struct {
+	Kind     string         `json:"kind"`
+	At       time.Time      `json:"at"`
+	Player   string         `json:"player,omitempty"`   // room player id
+	Name     string         `json:"name,omitempty"`     // join
+	Key      string         `json:"key,omitempty"`      // join: see Player.Key
+	Verified bool           `json:"verified,omitempty"` // join: see Player.Verified
+	Mark     engine.Mark    `json:"mark,omitempty"`
+	Pos      int            `json:"pos,omitempty"` // move
+	MsgID    string         `json:"msgId,omitempty"`
+	Seq      int            `json:"seq,omitempty"`     // move: client seq
+	Outcome  engine.Outcome `json:"outcome,omitempty"` // the game's status after the event
+	Code     string         `json:"code,omitempty"`    // open
+	Rated    bool           `json:"rated,omitempty"`   // open
+	Clock    string         `json:"clock,omitempty"`   // open: TimeControl.String()
+	Text     string         `json:"text,omitempty"`    // say
+	Emote    string         `json:"emote,omitempty"`   // say
+}
+
+// Log is a write-ahead log of room events (see Options.Log).
+type Log interface {
+	// Append must make e durable before returning. A room stops logging
+	// after its terminal event; whoever saves the game forgets the room.
+	Append(roomID string, e Event) error
+}
+
+// log writes e ahead of the change it describes. Caller holds r.mu.
+func (r *room) log(e Event) error {
+	if r.opts.Log == nil {
+		return nil
+	}
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	return r.opts.Log.Append(r.id, e)
+}
+
+// Restore rebuilds a room from its log, replaying moves through the engine.
+// Players come back disconnected, each with opts.GracePeriod to rejoin;
+// new events go to opts.Log as usual.
+func Restore(id string, eng engine.Engine, opts Options, events []Event) (Room, error) {
+	r := NewRoom(id, eng, opts).(*room)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, e := range events {
+		if err := r.replay(e); err != nil {
+			return nil, fmt.Errorf("room %s event %d (%s): %w", id, i, e.Kind, err)
+		}
+	}
+	for p, mk := range r.players {
+		r.connected[p] = false
+		if r.state.Status == engine.InProgress && opts.GracePeriod > 0 {
+			r.startGrace(p, mk)
+		}
+	}
+	r.armFlag() // time kept running while the room was down
+	return r, nil
+}
+
+// replay applies a logged event without logging it again. Caller holds r.mu.
+func (r *room) replay(e Event) error {
+	switch e.Kind {
+	case EventOpen:
+		r.started = e.At
+	case EventJoin:
+		r.players[e.Player] = e.Mark
+		r.marks[e.Mark] = e.Player
+		r.startClock(e.At)
+	case EventMove:
+		ns, err := r.eng.ApplyMove(r.state, engine.Move{PlayerID: e.Player, Position: e.Pos, MsgID: e.MsgID, ClientSeq: e.Seq, Mark: e.Mark})
+		if err != nil {
+			return err
+		}
+		r.state = ns
+		if e.MsgID != "" {
+			r.hist[e.MsgID] = ns
+		}
+		r.moves = append(r.moves, *ns.LastMove)
+		r.punch(e.Mark, e.At)
+		r.replayEnd(e, ReasonPlay)
+	case EventLeave:
+		r.replayEnd(e, ReasonForfeit)
+	case EventResign:
+		r.replayEnd(e, ReasonResign)
+	case EventTimeout:
+		r.replayEnd(e, ReasonTimeout)
+	case EventEnd:
+		r.replayEnd(e, ReasonAdmin)
+	case EventFlag:
+		r.replayEnd(e, ReasonFlag)
+	case EventSay:
+		r.chat = append(r.chat, ChatLine{At: e.At, PlayerID: e.Player, Mark: r.players[e.Player], Text: e.Text, Emote: e.Emote})
+	default:
+		return fmt.Errorf("unknown event kind %q", e.Kind)
+	}
+	return nil
+}
+
+// Caller holds r.mu.
+func (r *room) replayEnd(e Event, reason string) {
+	if e.Outcome == engine.InProgress || r.reason != "" {
+		return
+	}
+	r.state.Status = e.Outcome
+	r.reason, r.ended = reason, e.At
+}
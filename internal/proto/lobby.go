@@ -0,0 +1,74 @@
+package proto
+
+import (
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+)
+
+// ---- Lobby (/lobby) ----
+
+// LobbyMsg is sent by lobby clients.
+type LobbyMsg struct {
+	Type      string             `json:"type"`                // "challenge" | "accept" | "decline" | "cancel" | "ping"
+	To        string             `json:"to,omitempty"`        // "challenge": the player challenged
+	Challenge string             `json:"challenge,omitempty"` // "accept" | "decline" | "cancel": its id
+	Settings  *ChallengeSettings `json:"settings,omitempty"`  // "challenge"
+}
+
+// ChallengeSettings are the terms a challenge proposes.
+type ChallengeSettings struct {
+	Variant     string      `json:"variant,omitempty"`     // one of Variants; default the first
+	TimeControl string      `json:"timeControl,omitempty"` // "minutes+seconds" per player, e.g. "5+0"; "" = untimed
+	BestOf      int         `json:"bestOf,omitempty"`      // a series, as ?bestOf= on /ws
+	Rated       bool        `json:"rated,omitempty"`       // both players must be signed in
+	Side        engine.Mark `json:"side,omitempty"`        // the challenger's side; "" = the server's side policy picks
+}
+
+// LobbyState is the whole lobby, sent on joining it.
+type LobbyState struct {
+	Type    string         `json:"type"` // "lobby"
+	You     string         `json:"you"`  // a guest's name starts with "~"; games use it without
+	Players []PlayerStatus `json:"players"`
+	Rooms   []OpenRoom     `json:"rooms"`
+}
+
+// PlayerStatus is what an online player is doing.
+type PlayerStatus struct {
+	Player string `json:"player"`
+	Status string `json:"status"` // "idle" | "waiting" | "playing"
+}
+
+// Presence reports a change in one player's status.
+type Presence struct {
+	Type   string `json:"type"` // "presence"
+	Player string `json:"player"`
+	Status string `json:"status"` // "idle" | "waiting" | "playing" | "offline"
+}
+
+// OpenRoom is a public room code waiting for an opponent.
+type OpenRoom struct {
+	Code   string    `json:"code"`
+	Host   string    `json:"host"`
+	Rated  bool      `json:"rated,omitempty"`
+	BestOf int       `json:"bestOf,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// Rooms replaces the list of open rooms.
+type Rooms struct {
+	Type  string     `json:"type"` // "rooms"
+	Rooms []OpenRoom `json:"rooms"`
+}
+
+// Challenge is sent to both players whenever a challenge changes state.
+type Challenge struct {
+	Type      string            `json:"type"` // "challenge"
+	ID        string            `json:"id"`
+	From      string            `json:"from"`
+	To        string            `json:"to"`
+	Settings  ChallengeSettings `json:"settings"`
+	Status    string            `json:"status"`              // "pending" | "accepted" | "declined" | "cancelled" | "expired"
+	Code      string            `json:"code,omitempty"`      // "accepted": the room, booked for the two players
+	ExpiresMs int               `json:"expiresMs,omitempty"` // "pending"
+}
@@ -4,10 +4,17 @@ import "github.com/kushgupta-hiver/TTT/internal/engine"
 
 // ---- Client -> Server ----
 type ClientMsg struct {
-	Type     string `json:"type"`                // "join" | "move" | "leave" | "ping"
+	Type     string `json:"type"`                // "hello" | "join" | "move" | "leave" | "ping" | "chat" | "emote" | "mute" | "unmute" | "resign" | "rematch"
 	Position *int   `json:"position,omitempty"`  // for "move"
 	MsgID    string `json:"msgId,omitempty"`     // idempotency
 	ClientSeq int   `json:"clientSeq,omitempty"` // ordering
+	Text     string `json:"text,omitempty"`      // for "chat"
+	Emote    string `json:"emote,omitempty"`     // for "emote"
+
+	// for "hello"
+	Version  int      `json:"version,omitempty"`
+	Client   string   `json:"client,omitempty"`
+	Features []string `json:"features,omitempty"`
 }
 
 // ---- Server -> Client ----
@@ -40,8 +47,116 @@ type Result struct {
 	Status string `json:"status"`
 }
 
+// Rematch tells a player the opponent wants another game.
+type Rematch struct {
+	Type string      `json:"type"` // "rematch"
+	From engine.Mark `json:"from"`
+}
+
+// Welcome answers "hello" with what was negotiated and what else is on offer.
+type Welcome struct {
+	Type     string   `json:"type"` // "welcome"
+	Version  int      `json:"version"`
+	Versions []int    `json:"versions"`
+	Variants []string `json:"variants"`
+	Features []string `json:"features"` // supported
+	Enabled  []string `json:"enabled"`  // on for this connection
+}
+
+// Resumable carries the token that reclaims this seat after a dropped
+// connection: reconnect with ?resume=<token> within GraceMs.
+type Resumable struct {
+	Type    string `json:"type"` // "resumable"
+	Token   string `json:"token"`
+	GraceMs int    `json:"graceMs"`
+}
+
+// Clock is where a timed game's clocks stand, sent when it starts and after
+// each move. The running clock keeps counting down until the next one.
+type Clock struct {
+	Type    string      `json:"type"` // "clock"
+	XMs     int         `json:"xMs"`
+	OMs     int         `json:"oMs"`
+	Running engine.Mark `json:"running,omitempty"` // whose time is running
+}
+
+// Opponent reports the other player's connection status during a game.
+type Opponent struct {
+	Type    string `json:"type"`   // "opponent"
+	Status  string `json:"status"` // "away" | "back"
+	GraceMs int    `json:"graceMs,omitempty"`
+}
+
+// Queued tells a rated auto-match player that the search has begun.
+type Queued struct {
+	Type   string `json:"type"` // "queued"
+	Rating int    `json:"rating"`
+	WaitMs int    `json:"waitMs,omitempty"` // estimate from recent pairings; absent if unknown
+}
+
+// Series reports the score of a best-of-N series: once as it begins
+// (Game 0), then after each game's "result".
+type Series struct {
+	Type     string `json:"type"` // "series"
+	BestOf   int    `json:"bestOf"`
+	Game     int    `json:"game"` // games played
+	You      int    `json:"you"`  // games won
+	Opponent int    `json:"opponent"`
+	Draws    int    `json:"draws"`
+	Over     bool   `json:"over"`
+	Outcome  string `json:"outcome,omitempty"` // when over: "won" | "lost" | "drawn"
+}
+
+// Tournament is pushed to a tournament's subscribers as it progresses.
+type Tournament struct {
+	Type       string     `json:"type"` // "tournament"
+	Tournament string     `json:"tournament"`
+	Event      string     `json:"event"` // "started" | "game" | "result" | "round" | "finished"
+	Round      int        `json:"round,omitempty"`
+	Match      string     `json:"match,omitempty"`
+	Code       string     `json:"code,omitempty"` // "game": the room to join
+	X          string     `json:"x,omitempty"`
+	O          string     `json:"o,omitempty"`
+	Winner     string     `json:"winner,omitempty"`    // "result"; "" for a draw
+	Standings  []Standing `json:"standings,omitempty"` // "round" and "finished"
+}
+
+// Standing is one row of a tournament table.
+type Standing struct {
+	Rank     int     `json:"rank"`
+	Player   string  `json:"player"`
+	Played   int     `json:"played"`
+	Wins     int     `json:"wins"`
+	Draws    int     `json:"draws"`
+	Losses   int     `json:"losses"`
+	Byes     int     `json:"byes,omitempty"`
+	Points   float64 `json:"points"`
+	Buchholz float64 `json:"buchholz"`      // sum of opponents' points
+	SB       float64 `json:"sb"`            // Sonneborn-Berger: points of opponents beaten, half for draws
+	Out      bool    `json:"out,omitempty"` // knocked out
+}
+
+// Session is the first event on an SSE stream; moves are POSTed with it.
+type Session struct {
+	Type    string `json:"type"` // "session"
+	Session string `json:"session"`
+}
+
+type Chat struct {
+	Type  string      `json:"type"` // "chat"
+	From  engine.Mark `json:"from"`
+	Text  string      `json:"text,omitempty"`
+	Emote string      `json:"emote,omitempty"`
+}
+
+type System struct {
+	Type string `json:"type"` // "system"
+	Text string `json:"text"`
+}
+
 type Error struct {
-	Type   string `json:"type"` // "error"
-	Code   string `json:"code"`
-	Detail string `json:"detail,omitempty"`
+	Type         string `json:"type"` // "error"
+	Code         string `json:"code"`
+	Detail       string `json:"detail,omitempty"`
+	RetryAfterMs int    `json:"retryAfterMs,omitempty"` // for "RATE_LIMITED"
 }
@@ -0,0 +1,66 @@
+package proto
+
+//go:generate go run ../../cmd/schemagen -out ../../schema
+
+// Message describes one message on the wire. Go is a zero value of the
+// struct that carries it; the schema generator reflects over it.
+type Message struct {
+	Type     string
+	Go       any
+	Doc      string
+	Fields   []string // for ClientMsg: the fields this type uses (besides "type")
+	Required []string
+}
+
+// ClientMessages are sent by players. They all decode into ClientMsg.
+var ClientMessages = []Message{
+	{Type: "hello", Go: ClientMsg{}, Doc: "Negotiate protocol version and features.", Fields: []string{"version", "client", "features"}},
+	{Type: "join", Go: ClientMsg{}, Doc: "Accepted for compatibility; pairing happens on connect."},
+	{Type: "move", Go: ClientMsg{}, Doc: "Place your mark at position 0..8.", Fields: []string{"position", "msgId", "clientSeq"}, Required: []string{"position"}},
+	{Type: "leave", Go: ClientMsg{}, Doc: "Leave the game; a running game is forfeited."},
+	{Type: "ping", Go: ClientMsg{}, Doc: "Keepalive; no reply."},
+	{Type: "chat", Go: ClientMsg{}, Doc: "Say something to the opponent.", Fields: []string{"text"}, Required: []string{"text"}},
+	{Type: "emote", Go: ClientMsg{}, Doc: "Send a quick emote.", Fields: []string{"emote"}, Required: []string{"emote"}},
+	{Type: "mute", Go: ClientMsg{}, Doc: "Stop receiving the opponent's chat."},
+	{Type: "unmute", Go: ClientMsg{}, Doc: "Receive the opponent's chat again."},
+	{Type: "resign", Go: ClientMsg{}, Doc: "Concede the running game."},
+	{Type: "rematch", Go: ClientMsg{}, Doc: "Ask for another game once the current one is over."},
+}
+
+// ServerMessages are sent to players.
+var ServerMessages = []Message{
+	{Type: "welcome", Go: Welcome{}, Doc: "Reply to hello."},
+	{Type: "session", Go: Session{}, Doc: "First SSE event; identifies the stream for POSTs."},
+	{Type: "assigned", Go: Assigned{}, Doc: "Your mark for the game."},
+	{Type: "start", Go: Start{}, Doc: "A game has started."},
+	{Type: "state", Go: State{}, Doc: "Board after an accepted move."},
+	{Type: "result", Go: Result{}, Doc: "The game is over."},
+	{Type: "series", Go: Series{}, Doc: "Score of a best-of-N series; the next game follows until it is over."},
+	{Type: "clock", Go: Clock{}, Doc: "Time left in a timed game; sent at the start and after each move."},
+	{Type: "resumable", Go: Resumable{}, Doc: "Token for reclaiming the seat after a dropped connection."},
+	{Type: "opponent", Go: Opponent{}, Doc: "The opponent dropped or came back."},
+	{Type: "queued", Go: Queued{}, Doc: "Searching for a rated opponent near your rating."},
+	{Type: "rematch", Go: Rematch{}, Doc: "The opponent wants another game."},
+	{Type: "chat", Go: Chat{}, Doc: "A chat line or emote."},
+	{Type: "system", Go: System{}, Doc: "Operator announcement."},
+	{Type: "tournament", Go: Tournament{}, Doc: "Tournament progress, on /api/tournaments/{id}/events."},
+	{Type: "error", Go: Error{}, Doc: "A request was refused."},
+}
+
+// LobbyClientMessages are sent on /lobby. They all decode into LobbyMsg.
+var LobbyClientMessages = []Message{
+	{Type: "challenge", Go: LobbyMsg{}, Doc: "Challenge an online player.", Fields: []string{"to", "settings"}, Required: []string{"to"}},
+	{Type: "accept", Go: LobbyMsg{}, Doc: "Accept a challenge; both players get the room code.", Fields: []string{"challenge"}, Required: []string{"challenge"}},
+	{Type: "decline", Go: LobbyMsg{}, Doc: "Turn a challenge down.", Fields: []string{"challenge"}, Required: []string{"challenge"}},
+	{Type: "cancel", Go: LobbyMsg{}, Doc: "Withdraw a challenge you sent.", Fields: []string{"challenge"}, Required: []string{"challenge"}},
+	{Type: "ping", Go: LobbyMsg{}, Doc: "Keepalive; no reply.", Fields: []string{}},
+}
+
+// LobbyServerMessages are sent to lobby clients.
+var LobbyServerMessages = []Message{
+	{Type: "lobby", Go: LobbyState{}, Doc: "Who is online and which rooms are open; sent on joining."},
+	{Type: "presence", Go: Presence{}, Doc: "A player came, went, or started or finished a game."},
+	{Type: "rooms", Go: Rooms{}, Doc: "The open public rooms changed."},
+	{Type: "challenge", Go: Challenge{}, Doc: "A challenge to or from you changed state."},
+	{Type: "error", Go: Error{}, Doc: "A request was refused."},
+}
@@ -0,0 +1,28 @@
+package proto
+
+// Protocol versions. A client that never sends "hello" speaks Version1 and
+// gets the original behavior.
+const (
+	Version1       = 1
+	Version2       = 2
+	CurrentVersion = Version2
+)
+
+// SupportedVersions is advertised in "welcome", oldest first.
+var SupportedVersions = []int{Version1, Version2}
+
+// Variants the server can host.
+var Variants = []string{"classic"}
+
+// Features a client may switch on with "hello".
+const (
+	FeatureLastMove   = "last_move"   // "state" carries the move that produced it
+	FeatureDigitMoves = "digit_moves" // a bare "0".."8" frame is a move
+	FeatureChat       = "chat"        // receive the opponent's chat and emotes
+)
+
+// Features lists every feature the server understands.
+var Features = []string{FeatureLastMove, FeatureDigitMoves, FeatureChat}
+
+// LegacyFeatures are on for Version1 clients.
+var LegacyFeatures = []string{FeatureDigitMoves, FeatureChat}
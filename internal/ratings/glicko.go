@@ -0,0 +1,80 @@
+package ratings
+
+import "math"
+
+// Glicko-2 (Glickman, "Example of the Glicko-2 system"), one game per
+// rating period.
+
+const (
+	DefaultRating     = 1500.0
+	DefaultRD         = 350.0
+	DefaultVolatility = 0.06
+
+	scale   = 173.7178
+	epsilon = 0.000001
+)
+
+type glicko struct{ mu, phi, sigma float64 }
+
+func toGlicko(r Rating) glicko {
+	return glicko{mu: (r.Rating - DefaultRating) / scale, phi: r.RD / scale, sigma: r.Volatility}
+}
+
+func (g glicko) apply(r *Rating) {
+	r.Rating = g.mu*scale + DefaultRating
+	r.RD = g.phi * scale
+	r.Volatility = g.sigma
+}
+
+func gFactor(phi float64) float64 { return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi)) }
+
+// idle widens phi for periods without games, capped at a new player's RD.
+func (g glicko) idle(periods float64) glicko {
+	if periods > 0 {
+		g.phi = math.Min(math.Sqrt(g.phi*g.phi+periods*g.sigma*g.sigma), DefaultRD/scale)
+	}
+	return g
+}
+
+// update rates g after one game against opp with score 1, 0.5 or 0.
+func (g glicko) update(opp glicko, score, tau float64) glicko {
+	gf := gFactor(opp.phi)
+	e := 1 / (1 + math.Exp(-gf*(g.mu-opp.mu)))
+	v := 1 / (gf * gf * e * (1 - e))
+	delta := v * gf * (score - e)
+
+	// New volatility: solve f(x) = 0 by the Illinois method.
+	a := math.Log(g.sigma * g.sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := g.phi*g.phi + v + ex
+		return ex*(delta*delta-g.phi*g.phi-v-ex)/(2*d*d) - (x-a)/(tau*tau)
+	}
+	A := a
+	var B float64
+	if delta*delta > g.phi*g.phi+v {
+		B = math.Log(delta*delta - g.phi*g.phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+	fA, fB := f(A), f(B)
+	for i := 0; math.Abs(B-A) > epsilon && i < 100; i++ {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	sigma := math.Exp(A / 2)
+
+	phiStar := math.Sqrt(g.phi*g.phi + sigma*sigma)
+	phi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	return glicko{mu: g.mu + phi*phi*gf*(score-e), phi: phi, sigma: sigma}
+}
@@ -0,0 +1,31 @@
+package ratings
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/kushgupta-hiver/TTT/internal/httpx"
+)
+
+// NewHandler serves ratings under /api/ratings/:
+//
+//	GET /api/ratings/{player}          rating and the last 10 changes
+//	GET /api/ratings/{player}/history  ?limit=N (default 50)
+func NewHandler(b Book) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/ratings/{player}", func(w http.ResponseWriter, r *http.Request) {
+		p := r.PathValue("player")
+		httpx.JSON(w, http.StatusOK, struct {
+			Rating
+			Recent []Change `json:"recent"`
+		}{b.Get(p), b.History(p, 10)})
+	})
+	mux.HandleFunc("GET /api/ratings/{player}/history", func(w http.ResponseWriter, r *http.Request) {
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = 50
+		}
+		httpx.JSON(w, http.StatusOK, b.History(r.PathValue("player"), limit))
+	})
+	return mux
+}
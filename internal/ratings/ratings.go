@@ -0,0 +1,224 @@
+// Package ratings keeps a Glicko-2 rating per player, updated from the
+// outcomes of rated games.
+package ratings
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/infra"
+	"github.com/kushgupta-hiver/TTT/internal/store"
+)
+
+// Buckets in Config.Store.
+const (
+	RatingsBucket = "ratings"        // Rating by player
+	HistoryBucket = "rating-history" // []Change by player, oldest first
+	RatedBucket   = "rated-games"    // game ids already rated
+)
+
+var (
+	ErrDuplicate  = errors.New("game already rated")
+	ErrUnfinished = errors.New("game has no outcome")
+	ErrSelfPlay   = errors.New("a player cannot be rated against themselves")
+)
+
+type Rating struct {
+	Player     string    `json:"player"`
+	Rating     float64   `json:"rating"`
+	RD         float64   `json:"rd"` // rating deviation; lower = more certain
+	Volatility float64   `json:"volatility"`
+	Games      int       `json:"games"`
+	Updated    time.Time `json:"updated,omitempty"`
+}
+
+// Change is one player's rating movement from one game.
+type Change struct {
+	GameID   string    `json:"gameId"`
+	At       time.Time `json:"at"`
+	Player   string    `json:"player"`
+	Opponent string    `json:"opponent"`
+	Score    float64   `json:"score"` // 1 win, 0.5 draw, 0 loss
+	Before   float64   `json:"before"`
+	After    float64   `json:"after"`
+	RD       float64   `json:"rd"` // after
+}
+
+// Game is a finished rated game between two players.
+type Game struct {
+	ID      string
+	X, O    string
+	Outcome engine.Outcome
+	At      time.Time // default now
+}
+
+type Config struct {
+	Tau     float64       // volatility constraint (default 0.5)
+	Period  time.Duration // idle time that widens RD by one step (default 24h)
+	History int           // changes kept per player (default 100)
+	Clock   infra.Clock
+	Store   store.Store // default in memory
+}
+
+// Book holds every player's rating.
+type Book interface {
+	// Get returns the player's rating; unknown players have the defaults.
+	Get(player string) Rating
+	// History returns up to limit most recent changes, newest first.
+	History(player string, limit int) []Change
+	// Apply rates a game, updating both players together. A game ID is
+	// rated at most once.
+	Apply(g Game) (x, o Change, err error)
+	// Rate is Apply within the caller's transaction, so that a game's result
+	// and the rating changes it causes are saved together or not at all.
+	Rate(tx store.Tx, g Game) (x, o Change, err error)
+}
+
+type book struct {
+	cfg Config
+}
+
+func NewBook(cfg Config) Book {
+	if cfg.Tau <= 0 {
+		cfg.Tau = 0.5
+	}
+	if cfg.Period <= 0 {
+		cfg.Period = 24 * time.Hour
+	}
+	if cfg.History <= 0 {
+		cfg.History = 100
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = infra.SystemClock{}
+	}
+	if cfg.Store == nil {
+		cfg.Store = store.NewMemory()
+	}
+	return &book{cfg: cfg}
+}
+
+func newRating(player string) Rating {
+	return Rating{Player: player, Rating: DefaultRating, RD: DefaultRD, Volatility: DefaultVolatility}
+}
+
+func (b *book) Get(player string) Rating {
+	r := newRating(player)
+	_ = b.cfg.Store.View(func(tx store.Tx) (err error) {
+		r, err = b.get(tx, player, b.cfg.Clock.Now())
+		return err
+	})
+	return r
+}
+
+// get returns the rating with idle-time RD growth applied.
+func (b *book) get(tx store.Tx, player string, now time.Time) (Rating, error) {
+	r := newRating(player)
+	if ok, err := store.GetJSON(tx, RatingsBucket, player, &r); !ok || err != nil {
+		return r, err
+	}
+	if !r.Updated.IsZero() {
+		g := toGlicko(r).idle(float64(now.Sub(r.Updated)) / float64(b.cfg.Period))
+		g.apply(&r)
+	}
+	return r, nil
+}
+
+func (b *book) History(player string, limit int) []Change {
+	var h []Change
+	_ = b.cfg.Store.View(func(tx store.Tx) error {
+		_, err := store.GetJSON(tx, HistoryBucket, player, &h)
+		return err
+	})
+	if limit <= 0 || limit > len(h) {
+		limit = len(h)
+	}
+	out := make([]Change, 0, limit)
+	for i := len(h) - 1; i >= len(h)-limit; i-- {
+		out = append(out, h[i])
+	}
+	return out
+}
+
+func (b *book) Apply(g Game) (x, o Change, err error) {
+	err = b.cfg.Store.Update(func(tx store.Tx) error {
+		x, o, err = b.Rate(tx, g)
+		return err
+	})
+	return x, o, err
+}
+
+func (b *book) Rate(tx store.Tx, g Game) (Change, Change, error) {
+	var sx float64
+	switch g.Outcome {
+	case engine.XWins:
+		sx = 1
+	case engine.OWins:
+		sx = 0
+	case engine.Draw:
+		sx = 0.5
+	default:
+		return Change{}, Change{}, ErrUnfinished
+	}
+	if g.X == g.O {
+		return Change{}, Change{}, ErrSelfPlay
+	}
+
+	if g.ID != "" {
+		if _, ok := tx.Get(RatedBucket, g.ID); ok {
+			return Change{}, Change{}, ErrDuplicate
+		}
+	}
+	now := b.cfg.Clock.Now()
+	if g.At.IsZero() {
+		g.At = now
+	}
+
+	rx, err := b.get(tx, g.X, now)
+	if err != nil {
+		return Change{}, Change{}, err
+	}
+	ro, err := b.get(tx, g.O, now)
+	if err != nil {
+		return Change{}, Change{}, err
+	}
+	gx, gox := toGlicko(rx), toGlicko(ro)
+	nx, no := gx.update(gox, sx, b.cfg.Tau), gox.update(gx, 1-sx, b.cfg.Tau)
+
+	cx := Change{GameID: g.ID, At: g.At, Player: g.X, Opponent: g.O, Score: sx, Before: rx.Rating}
+	co := Change{GameID: g.ID, At: g.At, Player: g.O, Opponent: g.X, Score: 1 - sx, Before: ro.Rating}
+	nx.apply(&rx)
+	no.apply(&ro)
+	for _, r := range []*Rating{&rx, &ro} {
+		r.Games++
+		r.Updated = now
+		if err := store.PutJSON(tx, RatingsBucket, r.Player, r); err != nil {
+			return Change{}, Change{}, err
+		}
+	}
+	cx.After, cx.RD = rx.Rating, rx.RD
+	co.After, co.RD = ro.Rating, ro.RD
+	for _, c := range []Change{cx, co} {
+		if err := b.push(tx, c); err != nil {
+			return Change{}, Change{}, err
+		}
+	}
+	if g.ID != "" {
+		if err := tx.Put(RatedBucket, g.ID, nil); err != nil {
+			return Change{}, Change{}, err
+		}
+	}
+	return cx, co, nil
+}
+
+func (b *book) push(tx store.Tx, c Change) error {
+	var h []Change
+	if _, err := store.GetJSON(tx, HistoryBucket, c.Player, &h); err != nil {
+		return err
+	}
+	h = append(h, c)
+	if len(h) > b.cfg.History {
+		h = h[len(h)-b.cfg.History:]
+	}
+	return store.PutJSON(tx, HistoryBucket, c.Player, h)
+}
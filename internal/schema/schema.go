@@ -0,0 +1,301 @@
+// Package schema derives JSON Schema and AsyncAPI documents from the proto
+// message registry, so the published contract follows the Go structs.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+)
+
+const (
+	SchemaFile   = "protocol.schema.json"
+	AsyncAPIFile = "asyncapi.json"
+)
+
+type obj = map[string]any
+
+// Files renders every document, keyed by file name.
+func Files() (map[string][]byte, error) {
+	js, err := JSONSchema()
+	if err != nil {
+		return nil, err
+	}
+	aa, err := AsyncAPI()
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{SchemaFile: js, AsyncAPIFile: aa}, nil
+}
+
+// JSONSchema has one definition per message ("client.move", "server.state",
+// "lobby.client.challenge", ...) plus ClientMessage/ServerMessage and
+// LobbyClientMessage/LobbyServerMessage unions keyed on "type".
+func JSONSchema() ([]byte, error) {
+	defs, err := definitions()
+	if err != nil {
+		return nil, err
+	}
+	doc := obj{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id":     "https://ttt.local/schema/protocol.schema.json",
+		"title":   "TTT game protocol",
+		"$defs":   defs,
+		// anyOf: a server "chat" also satisfies the looser client "chat"
+		"anyOf": []any{
+			obj{"$ref": "#/$defs/ClientMessage"},
+			obj{"$ref": "#/$defs/ServerMessage"},
+			obj{"$ref": "#/$defs/LobbyClientMessage"},
+			obj{"$ref": "#/$defs/LobbyServerMessage"},
+		},
+	}
+	return render(doc)
+}
+
+// AsyncAPI describes the websocket channels. Message payloads point into the
+// JSON Schema document.
+func AsyncAPI() ([]byte, error) {
+	msgs := obj{}
+	var pub, sub, lobbyPub, lobbySub []any
+	add := func(dir string, m proto.Message, into *[]any) {
+		name := dir + "." + m.Type
+		msgs[name] = obj{
+			"name":         m.Type,
+			"summary":      m.Doc,
+			"schemaFormat": "application/schema+json;version=2020-12",
+			"contentType":  "application/json",
+			"payload":      obj{"$ref": SchemaFile + "#/$defs/" + name},
+		}
+		*into = append(*into, obj{"$ref": "#/components/messages/" + name})
+	}
+	for _, m := range proto.ClientMessages {
+		add("client", m, &pub)
+	}
+	for _, m := range proto.ServerMessages {
+		add("server", m, &sub)
+	}
+	for _, m := range proto.LobbyClientMessages {
+		add("lobby.client", m, &lobbyPub)
+	}
+	for _, m := range proto.LobbyServerMessages {
+		add("lobby.server", m, &lobbySub)
+	}
+	ops := obj{
+		"publish":   obj{"summary": "Client to server.", "message": obj{"oneOf": pub}},
+		"subscribe": obj{"summary": "Server to client.", "message": obj{"oneOf": sub}},
+	}
+	doc := obj{
+		"asyncapi": "2.6.0",
+		"info": obj{
+			"title":   "TTT game protocol",
+			"version": fmt.Sprint(proto.CurrentVersion),
+			"description": "Frames are JSON text, or CBOR binary when the ttt.cbor " +
+				"subprotocol is negotiated. A bare digit 0..8 is a move while the " +
+				"digit_moves feature is on.",
+		},
+		"defaultContentType": "application/json",
+		"servers": obj{
+			"local": obj{"url": "localhost:8000", "protocol": "ws"},
+		},
+		"channels": obj{
+			"/ws": mergeObj(obj{"description": "Auto-match with the next waiting player."}, ops),
+			"/ws/{code}": mergeObj(obj{
+				"description": "Meet the other player holding the same 4-digit room code.",
+				"parameters": obj{
+					"code": obj{"schema": obj{"type": "string", "pattern": "^[0-9]{4}$"}},
+				},
+			}, ops),
+			"/lobby": obj{
+				"description": "Presence, open public rooms and direct challenges.",
+				"publish":     obj{"summary": "Client to server.", "message": obj{"oneOf": lobbyPub}},
+				"subscribe":   obj{"summary": "Server to client.", "message": obj{"oneOf": lobbySub}},
+			},
+		},
+		"components": obj{"messages": msgs},
+	}
+	return render(doc)
+}
+
+func mergeObj(a, b obj) obj {
+	out := obj{}
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		out[k] = v
+	}
+	return out
+}
+
+func render(doc any) ([]byte, error) {
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func definitions() (obj, error) {
+	g := &gen{defs: obj{}}
+	for _, set := range []struct {
+		prefix, union string
+		msgs          []proto.Message
+	}{
+		{"client.", "ClientMessage", proto.ClientMessages},
+		{"server.", "ServerMessage", proto.ServerMessages},
+		{"lobby.client.", "LobbyClientMessage", proto.LobbyClientMessages},
+		{"lobby.server.", "LobbyServerMessage", proto.LobbyServerMessages},
+	} {
+		var refs []any
+		for _, m := range set.msgs {
+			s, err := g.message(m)
+			if err != nil {
+				return nil, err
+			}
+			g.defs[set.prefix+m.Type] = s
+			refs = append(refs, obj{"$ref": "#/$defs/" + set.prefix + m.Type})
+		}
+		g.defs[set.union] = obj{"oneOf": refs}
+	}
+	return g.defs, nil
+}
+
+type gen struct{ defs obj }
+
+// message builds the object schema for one registry entry. For ClientMsg
+// only the listed fields are kept, since the struct is shared by all types.
+func (g *gen) message(m proto.Message) (obj, error) {
+	t := reflect.TypeOf(m.Go)
+	props, required, err := g.fields(t)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", m.Type, err)
+	}
+	if _, ok := props["type"]; !ok {
+		return nil, fmt.Errorf("%s: %s has no type field", m.Type, t.Name())
+	}
+	props["type"] = obj{"const": m.Type}
+
+	if m.Fields != nil || t == reflect.TypeOf(proto.ClientMsg{}) {
+		keep := map[string]bool{"type": true}
+		for _, f := range m.Fields {
+			if _, ok := props[f]; !ok {
+				return nil, fmt.Errorf("%s: unknown field %q", m.Type, f)
+			}
+			keep[f] = true
+		}
+		for k := range props {
+			if !keep[k] {
+				delete(props, k)
+			}
+		}
+	}
+	for _, r := range m.Required {
+		if _, ok := props[r]; !ok {
+			return nil, fmt.Errorf("%s: required field %q not present", m.Type, r)
+		}
+		required = append(required, r)
+	}
+	s := obj{
+		"title":       t.Name(),
+		"description": m.Doc,
+		"type":        "object",
+		"properties":  props,
+		"required":    dedupe(required),
+	}
+	return s, nil
+}
+
+func (g *gen) fields(t reflect.Type) (obj, []string, error) {
+	props := obj{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s, err := g.typ(f.Type)
+		if err != nil {
+			return nil, nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		props[name] = s
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			required = append(required, name)
+		}
+	}
+	return props, required, nil
+}
+
+var (
+	markType = reflect.TypeOf(engine.Mark(""))
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+func (g *gen) typ(t reflect.Type) (obj, error) {
+	switch t {
+	case markType:
+		return obj{"type": "string", "enum": []string{string(engine.Empty), string(engine.X), string(engine.O)}}, nil
+	case timeType:
+		return obj{"type": "string", "format": "date-time"}, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return obj{"type": "string"}, nil
+	case reflect.Bool:
+		return obj{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return obj{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return obj{"type": "number"}, nil
+	case reflect.Pointer:
+		return g.typ(t.Elem())
+	case reflect.Slice:
+		items, err := g.typ(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return obj{"type": "array", "items": items}, nil
+	case reflect.Array:
+		items, err := g.typ(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return obj{"type": "array", "items": items, "minItems": t.Len(), "maxItems": t.Len()}, nil
+	case reflect.Struct:
+		if _, ok := g.defs[t.Name()]; !ok {
+			g.defs[t.Name()] = obj{} // reserve against recursion
+			props, required, err := g.fields(t)
+			if err != nil {
+				return nil, err
+			}
+			g.defs[t.Name()] = obj{"type": "object", "properties": props, "required": required}
+		}
+		return obj{"$ref": "#/$defs/" + t.Name()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported kind %s", t.Kind())
+	}
+}
+
+func dedupe(in []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, s := range in {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,198 @@
+package stats
+
+import "time"
+
+// Leaderboard periods.
+const (
+	AllTime = "all"
+	Weekly  = "week" // from Monday 00:00 UTC
+	Daily   = "day"  // from 00:00 UTC
+)
+
+// Query selects a page of a leaderboard for the current period.
+type Query struct {
+	Period  string // default AllTime
+	Variant string // "" = every variant
+	Offset  int
+	Limit   int // default 20, at most 100
+}
+
+type Entry struct {
+	Rank   int     `json:"rank"`
+	Player string  `json:"player"`
+	Points float64 `json:"points"` // 1 per win, ½ per draw
+	Played int     `json:"played"`
+	Wins   int     `json:"wins"`
+	Draws  int     `json:"draws"`
+	Losses int     `json:"losses"`
+}
+
+type Page struct {
+	Period  string    `json:"period"`
+	Variant string    `json:"variant,omitempty"`
+	Since   time.Time `json:"since,omitempty"`
+	Total   int       `json:"total"`
+	Offset  int       `json:"offset"`
+	Entries []Entry   `json:"entries"`
+}
+
+type boardKey struct {
+	period  string
+	start   time.Time // zero for AllTime
+	variant string
+}
+
+// board keeps its rows in rank order. Each game moves a row by a few
+// places at most, so it is re-ranked in place instead of sorted.
+type board struct {
+	key   boardKey
+	rows  map[string]*row
+	order []*row // best first
+}
+
+type row struct {
+	Entry
+	half int // points × 2
+	pos  int // index in order
+}
+
+func newBoard(k boardKey) *board { return &board{key: k, rows: make(map[string]*row)} }
+
+// add counts a game in which player scored s half points.
+func (b *board) add(player string, s int) {
+	r := b.rows[player]
+	if r == nil {
+		r = &row{Entry: Entry{Player: player}, pos: len(b.order)}
+		b.rows[player] = r
+		b.order = append(b.order, r)
+	}
+	r.Played++
+	r.half += s
+	switch s {
+	case 2:
+		r.Wins++
+	case 1:
+		r.Draws++
+	default:
+		r.Losses++
+	}
+	b.fix(r.pos)
+}
+
+// fix moves the row at i to its place.
+func (b *board) fix(i int) {
+	for i > 0 && ahead(b.order[i], b.order[i-1]) {
+		b.swap(i, i-1)
+		i--
+	}
+	for i+1 < len(b.order) && ahead(b.order[i+1], b.order[i]) {
+		b.swap(i, i+1)
+		i++
+	}
+}
+
+func (b *board) swap(i, j int) {
+	b.order[i], b.order[j] = b.order[j], b.order[i]
+	b.order[i].pos, b.order[j].pos = i, j
+}
+
+// ahead ranks by points, then fewer games for them, then name.
+func ahead(a, b *row) bool {
+	if a.half != b.half {
+		return a.half > b.half
+	}
+	if a.Played != b.Played {
+		return a.Played < b.Played
+	}
+	return a.Player < b.Player
+}
+
+func (b *board) page(offset, limit int) []Entry {
+	if offset >= len(b.order) {
+		return []Entry{}
+	}
+	end := min(offset+limit, len(b.order))
+	out := make([]Entry, 0, end-offset)
+	for i, r := range b.order[offset:end] {
+		e := r.Entry
+		e.Rank = offset + i + 1
+		e.Points = float64(r.half) / 2
+		out = append(out, e)
+	}
+	return out
+}
+
+func dayStart(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func weekStart(t time.Time) time.Time {
+	d := dayStart(t)
+	return d.AddDate(0, 0, -((int(d.Weekday()) + 6) % 7))
+}
+
+func periodKey(period string, at time.Time, variant string) (boardKey, bool) {
+	switch period {
+	case AllTime, "":
+		return boardKey{period: AllTime, variant: variant}, true
+	case Weekly:
+		return boardKey{period: Weekly, start: weekStart(at), variant: variant}, true
+	case Daily:
+		return boardKey{period: Daily, start: dayStart(at), variant: variant}, true
+	}
+	return boardKey{}, false
+}
+
+// keysFor lists the boards a game played at at counts towards.
+func keysFor(at time.Time, variant string) []boardKey {
+	out := make([]boardKey, 0, 6)
+	for _, v := range []string{"", variant} {
+		for _, p := range []string{AllTime, Weekly, Daily} {
+			k, _ := periodKey(p, at, v)
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// prune drops daily and weekly boards past their retention, and game ids
+// counted before the oldest weekly board. Caller holds t.mu.
+func (t *tracker) prune(now time.Time) {
+	oldestDay := dayStart(now).AddDate(0, 0, -(t.cfg.KeepDays - 1))
+	oldestWeek := weekStart(now).AddDate(0, 0, -7*(t.cfg.KeepWeeks-1))
+	for k := range t.boards {
+		if (k.period == Daily && k.start.Before(oldestDay)) || (k.period == Weekly && k.start.Before(oldestWeek)) {
+			delete(t.boards, k)
+		}
+	}
+	if oldestWeek.After(t.swept) {
+		for id, at := range t.seen {
+			if at.Before(oldestWeek) {
+				delete(t.seen, id)
+			}
+		}
+		t.swept = oldestWeek
+	}
+}
+
+func (t *tracker) Leaderboard(q Query) (Page, error) {
+	if q.Limit <= 0 {
+		q.Limit = 20
+	}
+	q.Limit = min(q.Limit, 100)
+	q.Offset = max(q.Offset, 0)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	k, ok := periodKey(q.Period, t.cfg.Clock.Now(), q.Variant)
+	if !ok {
+		return Page{}, ErrPeriod
+	}
+	p := Page{Period: k.period, Variant: q.Variant, Since: k.start, Offset: q.Offset, Entries: []Entry{}}
+	if b := t.boards[k]; b != nil {
+		p.Total = len(b.order)
+		p.Entries = b.page(q.Offset, q.Limit)
+	}
+	return p, nil
+}
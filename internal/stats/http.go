@@ -0,0 +1,36 @@
+package stats
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/kushgupta-hiver/TTT/internal/httpx"
+)
+
+// NewHandler serves player statistics and leaderboards:
+//
+//	GET /api/stats/{player}
+//	GET /api/leaderboard   ?period=all|week|day&variant=&offset=&limit=
+func NewHandler(t Tracker) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/stats/{player}", func(w http.ResponseWriter, r *http.Request) {
+		p, ok := t.Player(r.PathValue("player"))
+		if !ok {
+			httpx.JSON(w, http.StatusNotFound, map[string]string{"error": "no games recorded"})
+			return
+		}
+		httpx.JSON(w, http.StatusOK, p)
+	})
+	mux.HandleFunc("GET /api/leaderboard", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		offset, _ := strconv.Atoi(q.Get("offset"))
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		page, err := t.Leaderboard(Query{Period: q.Get("period"), Variant: q.Get("variant"), Offset: offset, Limit: limit})
+		if err != nil {
+			httpx.JSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		httpx.JSON(w, http.StatusOK, page)
+	})
+	return mux
+}
@@ -0,0 +1,329 @@
+// Package stats keeps per-player aggregates and leaderboards, updated one
+// finished game at a time so that reads never scan game history.
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/infra"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/store"
+)
+
+// DefaultVariant is assumed for games that do not name one.
+const DefaultVariant = "classic"
+
+// GamesBucket holds the Games counted, by id, in Config.Store.
+const GamesBucket = "stats-games"
+
+var (
+	ErrDuplicate  = errors.New("game already counted")
+	ErrUnfinished = errors.New("game has no outcome")
+	ErrSelfPlay   = errors.New("a player cannot play themselves")
+	ErrPeriod     = errors.New("period must be all, week or day")
+)
+
+// Game is a finished game between two players.
+type Game struct {
+	ID      string         `json:"id"`
+	X       string         `json:"x"`
+	O       string         `json:"o"`
+	Outcome engine.Outcome `json:"outcome"`
+	Reason  string         `json:"reason"`  // match.Reason*
+	Moves   int            `json:"moves"`   // moves made on the board, both sides
+	Variant string         `json:"variant"` // default DefaultVariant
+	At      time.Time      `json:"at"`
+
+	// XGuest and OGuest mark names the players declared rather than signed
+	// in with. Anyone can declare any name, so guests are not counted: no
+	// player stats, no leaderboards.
+	XGuest bool `json:"xGuest,omitempty"`
+	OGuest bool `json:"oGuest,omitempty"`
+}
+
+type SideStats struct {
+	Played int `json:"played"`
+	Wins   int `json:"wins"`
+	Draws  int `json:"draws"`
+	Losses int `json:"losses"`
+}
+
+type PlayerStats struct {
+	Player string `json:"player"`
+	SideStats
+	AsX SideStats `json:"asX"`
+	AsO SideStats `json:"asO"`
+
+	AvgMovesToWin float64   `json:"avgMovesToWin"` // own moves, over games won on the board
+	Forfeits      int       `json:"forfeits"`      // losses by leaving, timing out or not showing up
+	ForfeitRate   float64   `json:"forfeitRate"`
+	Streak        int       `json:"streak"` // consecutive wins, current
+	BestStreak    int       `json:"bestStreak"`
+	LastPlayed    time.Time `json:"lastPlayed"`
+
+	boardWins, winMoves int
+}
+
+type Config struct {
+	KeepDays  int // daily boards kept, including today (default 8)
+	KeepWeeks int // weekly boards kept, including this week (default 5)
+	Clock     infra.Clock
+	// Store holds the games Save kept; NewTracker counts them again, so the
+	// stats outlive the process. Default none.
+	Store store.Store
+}
+
+// Tracker aggregates finished games.
+type Tracker interface {
+	// Record counts a game once per ID; an ID is remembered for as long as
+	// the weekly boards are kept. A double no-show (nobody played) is
+	// ignored.
+	Record(g Game) error
+	Player(id string) (PlayerStats, bool)
+	// Leaderboard returns one page of a board; see Query.
+	Leaderboard(q Query) (Page, error)
+}
+
+type tracker struct {
+	cfg Config
+
+	mu      sync.Mutex
+	players map[string]*PlayerStats
+	boards  map[boardKey]*board
+	seen    map[string]time.Time // game id => when counted
+	swept   time.Time            // seen holds nothing counted before this
+}
+
+func NewTracker(cfg Config) Tracker {
+	if cfg.KeepDays <= 0 {
+		cfg.KeepDays = 8
+	}
+	if cfg.KeepWeeks <= 0 {
+		cfg.KeepWeeks = 5
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = infra.SystemClock{}
+	}
+	t := &tracker{
+		cfg:     cfg,
+		players: make(map[string]*PlayerStats),
+		boards:  make(map[boardKey]*board),
+		seen:    make(map[string]time.Time),
+	}
+	if cfg.Store != nil {
+		t.load()
+	}
+	return t
+}
+
+// load counts the games kept in Config.Store.
+func (t *tracker) load() {
+	games, err := stored(t.cfg.Store)
+	if err != nil {
+		log.Printf("stats: loading games: %v", err)
+	}
+	for _, g := range games {
+		_ = t.Record(g) // streaks need the games in order
+	}
+}
+
+// stored is the games Save kept in s, oldest first.
+func stored(s store.Store) ([]Game, error) {
+	var games []Game
+	err := s.View(func(tx store.Tx) error {
+		return tx.Each(GamesBucket, "", func(_ string, v []byte) error {
+			var g Game
+			if err := json.Unmarshal(v, &g); err != nil {
+				return err
+			}
+			games = append(games, g)
+			return nil
+		})
+	})
+	sort.SliceStable(games, func(i, j int) bool { return games[i].At.Before(games[j].At) })
+	return games, err
+}
+
+// Sides is each signed-in player's side record over the games Save kept
+// in s, to seed match.Balance.
+func Sides(s store.Store) (map[string]match.SideCount, error) {
+	games, err := stored(s)
+	counts := make(map[string]match.SideCount)
+	count := func(player string, d int, at time.Time) {
+		c := counts[player]
+		c.XMinusO += d
+		if at.After(c.Last) {
+			c.Last = at
+		}
+		counts[player] = c
+	}
+	for _, g := range games {
+		if !g.XGuest {
+			count(g.X, 1, g.At)
+		}
+		if !g.OGuest {
+			count(g.O, -1, g.At)
+		}
+	}
+	return counts, err
+}
+
+// Save keeps g in Config.Store within the caller's transaction, so that
+// the game and its stats are saved together; Record it once tx commits. A
+// game ID is saved once; again it is ErrDuplicate.
+func Save(tx store.Tx, g Game) error {
+	if err := check(g); err != nil || ignored(g) {
+		return err
+	}
+	if _, ok := tx.Get(GamesBucket, g.ID); ok {
+		return ErrDuplicate
+	}
+	return store.PutJSON(tx, GamesBucket, g.ID, g)
+}
+
+func check(g Game) error {
+	if g.Outcome == engine.InProgress {
+		return ErrUnfinished
+	}
+	if g.X == g.O {
+		return ErrSelfPlay
+	}
+	return nil
+}
+
+// ignored reports a double no-show: nobody played.
+func ignored(g Game) bool {
+	return g.Reason == match.ReasonNoShow && g.Outcome == engine.Draw
+}
+
+func (t *tracker) Record(g Game) error {
+	if err := check(g); err != nil || ignored(g) {
+		return err
+	}
+	if g.Variant == "" {
+		g.Variant = DefaultVariant
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.seen[g.ID]; g.ID != "" && ok {
+		return ErrDuplicate
+	}
+	now := t.cfg.Clock.Now()
+	if g.At.IsZero() {
+		g.At = now
+	}
+	if g.ID != "" {
+		t.seen[g.ID] = now
+	}
+
+	sx := score(g.Outcome)
+	if !g.XGuest {
+		t.player(g.X).add(g, engine.X, sx)
+	}
+	if !g.OGuest {
+		t.player(g.O).add(g, engine.O, 2-sx)
+	}
+	for _, k := range keysFor(g.At, g.Variant) {
+		b := t.boards[k]
+		if b == nil {
+			b = newBoard(k)
+			t.boards[k] = b
+		}
+		if !g.XGuest {
+			b.add(g.X, sx)
+		}
+		if !g.OGuest {
+			b.add(g.O, 2-sx)
+		}
+	}
+	t.prune(now)
+	return nil
+}
+
+// score is X's result in half points: 2 win, 1 draw, 0 loss.
+func score(o engine.Outcome) int {
+	switch o {
+	case engine.XWins:
+		return 2
+	case engine.OWins:
+		return 0
+	}
+	return 1
+}
+
+// Caller holds t.mu.
+func (t *tracker) player(id string) *PlayerStats {
+	p := t.players[id]
+	if p == nil {
+		p = &PlayerStats{Player: id}
+		t.players[id] = p
+	}
+	return p
+}
+
+// add counts one game for p, who played side and scored s half points.
+func (p *PlayerStats) add(g Game, side engine.Mark, s int) {
+	as := &p.AsX
+	if side == engine.O {
+		as = &p.AsO
+	}
+	for _, c := range []*SideStats{&p.SideStats, as} {
+		c.Played++
+		switch s {
+		case 2:
+			c.Wins++
+		case 1:
+			c.Draws++
+		default:
+			c.Losses++
+		}
+	}
+
+	switch s {
+	case 2:
+		p.Streak++
+		p.BestStreak = max(p.BestStreak, p.Streak)
+		if g.Reason == match.ReasonPlay {
+			// X moves first, so X made the odd move out.
+			own := g.Moves / 2
+			if side == engine.X {
+				own = (g.Moves + 1) / 2
+			}
+			p.boardWins++
+			p.winMoves += own
+		}
+	case 0:
+		p.Streak = 0
+		switch g.Reason {
+		case match.ReasonForfeit, match.ReasonTimeout, match.ReasonNoShow:
+			p.Forfeits++
+		}
+	default:
+		p.Streak = 0
+	}
+
+	if p.boardWins > 0 {
+		p.AvgMovesToWin = float64(p.winMoves) / float64(p.boardWins)
+	}
+	p.ForfeitRate = float64(p.Forfeits) / float64(p.Played)
+	if g.At.After(p.LastPlayed) {
+		p.LastPlayed = g.At
+	}
+}
+
+func (t *tracker) Player(id string) (PlayerStats, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.players[id]
+	if !ok {
+		return PlayerStats{}, false
+	}
+	return *p, true
+}
@@ -0,0 +1,280 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// The file starts with a "ttt-store <format>\n" line, then one record per
+// committed transaction: a 4-byte big-endian length, the CRC-32 (IEEE) of
+// the payload, and the payload, a JSON array of ops. A record cut short by a
+// crash is dropped on the next Open.
+const (
+	fileFormat = 1
+	fileMagic  = "ttt-store"
+
+	maxRecord    = 64 << 20
+	compactAfter = 4096 // ops in the log before it may be rewritten
+	snapshotOps  = 512  // ops per record when rewriting
+)
+
+// Open opens the store at path, creating it if needed, and runs any
+// migrations it lacks. The data is held in memory; the file is a log of
+// committed transactions, rewritten compactly once mostly superseded.
+func Open(path string, cfg Config) (Store, error) {
+	if cfg.Migrations == nil {
+		cfg.Migrations = Migrations
+	}
+	fh, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	s := &file{db: newDB(), path: path, f: fh, cfg: cfg}
+	s.persist = s.append
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err = s.load()
+	if err == nil {
+		err = s.migrate(cfg.Migrations)
+	}
+	if err == nil && s.garbage() {
+		err = s.compact()
+	}
+	if err != nil {
+		_ = s.f.Close()
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	return s, nil
+}
+
+type file struct {
+	*db
+	path string
+	f    *os.File
+	cfg  Config
+	ops  int // ops in the log, superseded or not
+}
+
+// load reads the log into memory. Caller holds s.mu.
+func (s *file) load() error {
+	info, err := s.f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		if _, err := fmt.Fprintf(s.f, "%s %d\n", fileMagic, fileFormat); err != nil {
+			return err
+		}
+		return s.sync()
+	}
+
+	r := bufio.NewReader(s.f)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return ErrCorrupt
+	}
+	var format int
+	if _, err := fmt.Sscanf(line, fileMagic+" %d\n", &format); err != nil {
+		return ErrCorrupt
+	}
+	if format > fileFormat {
+		return ErrVersion
+	}
+	if format != fileFormat {
+		return ErrCorrupt
+	}
+
+	off := int64(len(line))
+	for {
+		ops, n, err := readRecord(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) || (errors.Is(err, ErrCorrupt) && off+n == info.Size()) {
+			log.Printf("store %s: dropping %d bytes of an unfinished write", s.path, info.Size()-off)
+			if err := s.f.Truncate(off); err != nil {
+				return err
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		s.apply(ops)
+		s.ops += len(ops)
+		off += n
+	}
+	_, err = s.f.Seek(off, io.SeekStart)
+	return err
+}
+
+// readRecord returns the next record's ops and its size on disk.
+func readRecord(r io.Reader) ([]op, int64, error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, 0, err
+	}
+	n := binary.BigEndian.Uint32(hdr[:4])
+	if n > maxRecord {
+		return nil, 0, ErrCorrupt
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	size := int64(len(hdr)) + int64(n)
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(hdr[4:]) {
+		return nil, size, ErrCorrupt
+	}
+	var ops []op
+	if err := json.Unmarshal(payload, &ops); err != nil {
+		return nil, size, ErrCorrupt
+	}
+	return ops, size, nil
+}
+
+func writeRecord(w io.Writer, ops []op) error {
+	payload, err := json.Marshal(ops)
+	if err != nil {
+		return err
+	}
+	rec := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(rec[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(rec[4:], crc32.ChecksumIEEE(payload))
+	_, err = w.Write(append(rec, payload...))
+	return err
+}
+
+// append logs a transaction before it is applied. Caller holds s.mu.
+func (s *file) append(ops []op) error {
+	if err := writeRecord(s.f, ops); err != nil {
+		return err
+	}
+	s.ops += len(ops)
+	return s.sync()
+}
+
+func (s *file) sync() error {
+	if s.cfg.NoSync {
+		return nil
+	}
+	return s.f.Sync()
+}
+
+func (s *file) Update(fn func(Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.update(fn); err != nil {
+		return err
+	}
+	if s.garbage() {
+		// The transaction is already safe in the old log.
+		if err := s.compact(); err != nil {
+			log.Printf("store %s: compaction failed: %v", s.path, err)
+		}
+	}
+	return nil
+}
+
+// garbage reports whether most of the log is superseded. Caller holds s.mu.
+func (s *file) garbage() bool {
+	live := 0
+	for _, b := range s.data {
+		live += len(b)
+	}
+	return s.ops > compactAfter && s.ops > 2*live
+}
+
+// compact rewrites the log as a snapshot of the current data and swaps it
+// in. Caller holds s.mu.
+func (s *file) compact() error {
+	tmp := s.path + ".tmp"
+	nf, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		_ = nf.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	w := bufio.NewWriter(nf)
+	if _, err := fmt.Fprintf(w, "%s %d\n", fileMagic, fileFormat); err != nil {
+		return fail(err)
+	}
+	buckets := make([]string, 0, len(s.data))
+	for b := range s.data {
+		buckets = append(buckets, b)
+	}
+	sort.Strings(buckets)
+	var chunk []op
+	live := 0
+	for _, b := range buckets {
+		keys := make([]string, 0, len(s.data[b]))
+		for k := range s.data[b] {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			chunk = append(chunk, op{Bucket: b, Key: k, Value: s.data[b][k]})
+			if len(chunk) == snapshotOps {
+				if err := writeRecord(w, chunk); err != nil {
+					return fail(err)
+				}
+				chunk = chunk[:0]
+			}
+		}
+		live += len(keys)
+	}
+	if len(chunk) > 0 {
+		if err := writeRecord(w, chunk); err != nil {
+			return fail(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fail(err)
+	}
+	if err := nf.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fail(err)
+	}
+	syncDir(filepath.Dir(s.path))
+	_ = s.f.Close()
+	s.f, s.ops = nf, live
+	return nil
+}
+
+// syncDir makes a rename durable where the platform allows it.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+}
+
+func (s *file) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	err := s.sync()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"net/http"
+
+	"github.com/kushgupta-hiver/TTT/internal/httpx"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+)
+
+// NewHandler serves saved games and player profiles:
+//
+//	GET /api/games/{id}
+//	GET /api/players/{player}
+//
+// It is public, so a game is served without its chat.
+func NewHandler(s Store) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/games/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var (
+			rec match.Record
+			ok  bool
+		)
+		err := s.View(func(tx Tx) (err error) {
+			rec, ok, err = Game(tx, r.PathValue("id"))
+			return err
+		})
+		rec.Chat = nil
+		reply(w, rec, ok, err)
+	})
+	mux.HandleFunc("GET /api/players/{player}", func(w http.ResponseWriter, r *http.Request) {
+		var (
+			p  any
+			ok bool
+		)
+		err := s.View(func(tx Tx) (err error) {
+			p, ok, err = Player(tx, r.PathValue("player"))
+			return err
+		})
+		reply(w, p, ok, err)
+	})
+	return mux
+}
+
+func reply(w http.ResponseWriter, v any, ok bool, err error) {
+	switch {
+	case err != nil:
+		httpx.JSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+	case !ok:
+		httpx.JSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	default:
+		httpx.JSON(w, http.StatusOK, v)
+	}
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/match"
+)
+
+// Buckets. Ratings keeps its own (see package ratings).
+const (
+	GamesBucket   = "games"   // match.Record by room id
+	PlayersBucket = "players" // Profile by player id
+
+	metaBucket = "meta"
+	versionKey = "version"
+)
+
+var ErrDuplicate = errors.New("game already saved")
+
+// Migrations is the history of the data layout, oldest first. Append to it,
+// never edit it: stores written by older builds replay what they missed.
+var Migrations = []Migration{
+	{To: 1, Name: "games, players and ratings buckets"},
+}
+
+// Profile is what the server remembers about a player between games.
+type Profile struct {
+	Player    string    `json:"player"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Games     int       `json:"games"`
+	Rated     int       `json:"rated"`
+}
+
+// SaveGame stores a finished game and counts it on both players' profiles.
+// A room id is saved once; again it is ErrDuplicate.
+func SaveGame(tx Tx, x, o string, rec match.Record) error {
+	if _, ok := tx.Get(GamesBucket, rec.RoomID); ok {
+		return ErrDuplicate
+	}
+	if err := PutJSON(tx, GamesBucket, rec.RoomID, rec); err != nil {
+		return err
+	}
+	at := rec.Ended
+	if at.IsZero() {
+		at = time.Now()
+	}
+	for _, id := range []string{x, o} {
+		p, _, err := Player(tx, id)
+		if err != nil {
+			return err
+		}
+		if p.FirstSeen.IsZero() {
+			p.FirstSeen = at
+		}
+		if at.After(p.LastSeen) {
+			p.LastSeen = at
+		}
+		p.Games++
+		if rec.Rated {
+			p.Rated++
+		}
+		if err := PutJSON(tx, PlayersBucket, id, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Game(tx Tx, id string) (match.Record, bool, error) {
+	var rec match.Record
+	ok, err := GetJSON(tx, GamesBucket, id, &rec)
+	return rec, ok, err
+}
+
+// Player returns id's profile, or a new one if they have not played.
+func Player(tx Tx, id string) (Profile, bool, error) {
+	p := Profile{Player: id}
+	ok, err := GetJSON(tx, PlayersBucket, id, &p)
+	return p, ok, err
+}
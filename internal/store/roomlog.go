@@ -0,0 +1,120 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+)
+
+// RoomLogBucket holds the events of running games, keyed
+// "<room id>/<8-digit sequence>".
+const RoomLogBucket = "room-log"
+
+// RoomLog is a match.Log kept in a Store, each event in its own
+// transaction. A room's events stay, its terminal event too, until Drop:
+// the hub drops them once the finished game has been saved.
+type RoomLog struct {
+	s Store
+
+	mu   sync.Mutex
+	next map[string]int // room id => sequence of its next event
+}
+
+func NewRoomLog(s Store) *RoomLog { return &RoomLog{s: s, next: make(map[string]int)} }
+
+func (l *RoomLog) Append(roomID string, e match.Event) error {
+	if strings.Contains(roomID, "/") {
+		return fmt.Errorf("room id %q contains /", roomID)
+	}
+	// A room appends one event at a time, so only the map needs the lock.
+	l.mu.Lock()
+	n, ok := l.next[roomID]
+	l.mu.Unlock()
+
+	prefix := roomID + "/"
+	err := l.s.Update(func(tx Tx) error {
+		if !ok && e.Kind != match.EventOpen {
+			n = count(tx, prefix) // logged before this process saw the room
+		}
+		return PutJSON(tx, RoomLogBucket, key(prefix, n), e)
+	})
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e.Outcome == engine.InProgress {
+		l.next[roomID] = n + 1
+	} else {
+		delete(l.next, roomID)
+	}
+	return nil
+}
+
+// Drop forgets roomID's events.
+func (l *RoomLog) Drop(roomID string) error {
+	l.mu.Lock()
+	delete(l.next, roomID)
+	l.mu.Unlock()
+	return l.s.Update(func(tx Tx) error {
+		var keys []string
+		_ = tx.Each(RoomLogBucket, roomID+"/", func(k string, _ []byte) error {
+			keys = append(keys, k)
+			return nil
+		})
+		for _, k := range keys {
+			if err := tx.Delete(RoomLogBucket, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func key(prefix string, seq int) string { return fmt.Sprintf("%s%08d", prefix, seq) }
+
+// count is the next sequence under prefix: one past the highest.
+func count(tx Tx, prefix string) int {
+	n := 0
+	_ = tx.Each(RoomLogBucket, prefix, func(k string, _ []byte) error {
+		if seq, err := strconv.Atoi(strings.TrimPrefix(k, prefix)); err == nil {
+			n = max(n, seq+1)
+		}
+		return nil
+	})
+	return n
+}
+
+// Load returns the events of every room not yet dropped, oldest first.
+func (l *RoomLog) Load() (map[string][]match.Event, error) {
+	out := make(map[string][]match.Event)
+	next := make(map[string]int)
+	err := l.s.View(func(tx Tx) error {
+		return tx.Each(RoomLogBucket, "", func(k string, v []byte) error {
+			id, seq, _ := strings.Cut(k, "/")
+			var e match.Event
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+			out[id] = append(out[id], e)
+			if n, err := strconv.Atoi(seq); err == nil {
+				next[id] = max(next[id], n+1)
+			}
+			return nil
+		})
+	})
+	if err == nil {
+		l.mu.Lock()
+		for id, n := range next {
+			l.next[id] = n
+		}
+		l.mu.Unlock()
+	}
+	return out, err
+}
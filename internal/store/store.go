@@ -0,0 +1,304 @@
+// Package store persists game records, player profiles and ratings. Data is
+// kept in named buckets of key/value pairs and changed in transactions; an
+// in-memory store serves tests and single runs, a file-backed one survives
+// restarts.
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrClosed   = errors.New("store closed")
+	ErrReadOnly = errors.New("write in a read-only transaction")
+	ErrVersion  = errors.New("store was written by a newer version")
+	ErrCorrupt  = errors.New("store file is corrupt")
+)
+
+// Store holds the server's durable state.
+type Store interface {
+	// View runs fn against a consistent, read-only view.
+	View(fn func(Tx) error) error
+	// Update runs fn in a transaction: its writes are saved together if fn
+	// returns nil and discarded otherwise. Updates run one at a time.
+	Update(fn func(Tx) error) error
+	// Version is the data version the migrations brought the store to.
+	Version() int
+	// Ping fails once the store cannot take writes; for /readyz.
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// Tx reads and writes within View or Update. It must not be kept after fn
+// returns. Values passed in and out are copies.
+type Tx interface {
+	Get(bucket, key string) ([]byte, bool)
+	Put(bucket, key string, value []byte) error
+	Delete(bucket, key string) error
+	// Each calls fn for the keys of bucket starting with prefix, in key
+	// order, until fn returns an error.
+	Each(bucket, prefix string, fn func(key string, value []byte) error) error
+}
+
+// Migration brings data written at version To-1 up to To.
+type Migration struct {
+	To   int
+	Name string
+	Up   func(Tx) error
+}
+
+type Config struct {
+	// Migrations run in order at Open on data older than their To (default
+	// Migrations). Data newer than the last one is refused with ErrVersion.
+	Migrations []Migration
+	// NoSync skips the fsync after each commit: faster, but a power cut may
+	// lose the last transactions. For tests.
+	NoSync bool
+}
+
+// GetJSON decodes the value at bucket/key into v.
+func GetJSON(tx Tx, bucket, key string, v any) (bool, error) {
+	b, ok := tx.Get(bucket, key)
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(b, v)
+}
+
+func PutJSON(tx Tx, bucket, key string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return tx.Put(bucket, key, b)
+}
+
+// op is one write; Del drops the key.
+type op struct {
+	Bucket string `json:"b"`
+	Key    string `json:"k"`
+	Value  []byte `json:"v,omitempty"`
+	Del    bool   `json:"d,omitempty"`
+}
+
+// db is the in-memory state both stores share. persist, when set, saves a
+// transaction's writes before they are applied.
+type db struct {
+	mu      sync.RWMutex
+	data    map[string]map[string][]byte
+	version int
+	closed  bool
+	broken  error // a failed write; no more updates until reopened
+	persist func(ops []op) error
+}
+
+func newDB() *db { return &db{data: make(map[string]map[string][]byte)} }
+
+// NewMemory returns a store that lives only as long as the process.
+func NewMemory() Store {
+	d := newDB()
+	d.version = latest(Migrations)
+	return &memory{d}
+}
+
+type memory struct{ *db }
+
+func (m *memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+func (d *db) View(fn func(Tx) error) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return ErrClosed
+	}
+	return fn(&tx{d: d})
+}
+
+func (d *db) Update(fn func(Tx) error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.update(fn)
+}
+
+// update runs fn and commits it. Caller holds d.mu.
+func (d *db) update(fn func(Tx) error) error {
+	if d.closed {
+		return ErrClosed
+	}
+	if d.broken != nil {
+		return d.broken
+	}
+	t := &tx{d: d, write: true, pending: make(map[string]int)}
+	if err := fn(t); err != nil {
+		return err
+	}
+	if len(t.ops) == 0 {
+		return nil
+	}
+	if d.persist != nil {
+		if err := d.persist(t.ops); err != nil {
+			d.broken = err
+			return err
+		}
+	}
+	d.apply(t.ops)
+	return nil
+}
+
+// Caller holds d.mu.
+func (d *db) apply(ops []op) {
+	for _, o := range ops {
+		b := d.data[o.Bucket]
+		if o.Del {
+			delete(b, o.Key)
+			continue
+		}
+		if b == nil {
+			b = make(map[string][]byte)
+			d.data[o.Bucket] = b
+		}
+		b[o.Key] = o.Value
+	}
+}
+
+func (d *db) Version() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.version
+}
+
+func (d *db) Ping(ctx context.Context) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return ErrClosed
+	}
+	return d.broken
+}
+
+type tx struct {
+	d       *db
+	write   bool
+	ops     []op
+	pending map[string]int // bucket+"\x00"+key => index in ops
+}
+
+func pendingKey(bucket, key string) string { return bucket + "\x00" + key }
+
+func (t *tx) Get(bucket, key string) ([]byte, bool) {
+	if i, ok := t.pending[pendingKey(bucket, key)]; ok {
+		o := t.ops[i]
+		return clone(o.Value), !o.Del
+	}
+	v, ok := t.d.data[bucket][key]
+	return clone(v), ok
+}
+
+func (t *tx) Put(bucket, key string, value []byte) error {
+	return t.set(op{Bucket: bucket, Key: key, Value: clone(value)})
+}
+
+func (t *tx) Delete(bucket, key string) error {
+	return t.set(op{Bucket: bucket, Key: key, Del: true})
+}
+
+func (t *tx) set(o op) error {
+	if !t.write {
+		return ErrReadOnly
+	}
+	if o.Bucket == "" || o.Key == "" {
+		return errors.New("store: empty bucket or key")
+	}
+	k := pendingKey(o.Bucket, o.Key)
+	if i, ok := t.pending[k]; ok {
+		t.ops[i] = o
+		return nil
+	}
+	t.pending[k] = len(t.ops)
+	t.ops = append(t.ops, o)
+	return nil
+}
+
+func (t *tx) Each(bucket, prefix string, fn func(key string, value []byte) error) error {
+	var keys []string
+	for k := range t.d.data[bucket] {
+		if strings.HasPrefix(k, prefix) {
+			if _, ok := t.pending[pendingKey(bucket, k)]; !ok {
+				keys = append(keys, k)
+			}
+		}
+	}
+	for _, o := range t.ops {
+		if o.Bucket == bucket && !o.Del && strings.HasPrefix(o.Key, prefix) {
+			keys = append(keys, o.Key)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, _ := t.Get(bucket, k)
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func clone(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// migrate runs the migrations newer than the stored version, each in its
+// own transaction. Caller holds d.mu.
+func (d *db) migrate(ms []Migration) error {
+	var at int
+	if v, ok := d.data[metaBucket][versionKey]; ok {
+		n, err := strconv.Atoi(string(v))
+		if err != nil {
+			return ErrCorrupt
+		}
+		at = n
+	}
+	if at > latest(ms) {
+		return ErrVersion
+	}
+	for _, m := range ms {
+		if m.To <= at {
+			continue
+		}
+		err := d.update(func(t Tx) error {
+			if m.Up != nil {
+				if err := m.Up(t); err != nil {
+					return err
+				}
+			}
+			return t.Put(metaBucket, versionKey, []byte(strconv.Itoa(m.To)))
+		})
+		if err != nil {
+			return errors.New("store: migration " + strconv.Itoa(m.To) + " (" + m.Name + "): " + err.Error())
+		}
+		at = m.To
+	}
+	d.version = at
+	return nil
+}
+
+func latest(ms []Migration) int {
+	if len(ms) == 0 {
+		return 0
+	}
+	return ms[len(ms)-1].To
+}
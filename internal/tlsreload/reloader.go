@@ -0,0 +1,117 @@
+package tlsreload
+
+import (
+	"crypto/tls"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader serves a certificate/key pair from disk and picks up replacements
+// (e.g. from certbot) without a restart. Files are polled by mtime and size;
+// a pair that fails to load keeps the previous certificate in service.
+type Reloader struct {
+	certFile, keyFile string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	seen [2]fileStamp
+
+	done chan struct{}
+	once sync.Once
+}
+
+type fileStamp struct {
+	mod  time.Time
+	size int64
+}
+
+func NewReloader(certFile, keyFile string, interval time.Duration) (*Reloader, error) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	r := &Reloader{certFile: certFile, keyFile: keyFile, done: make(chan struct{})}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	go r.loop(interval)
+	return r, nil
+}
+
+// GetCertificate is meant for tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+func (r *Reloader) Close() error {
+	r.once.Do(func() { close(r.done) })
+	return nil
+}
+
+func (r *Reloader) loop(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-t.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.load(); err != nil {
+				log.Printf("tls reload failed, keeping previous certificate: %v", err)
+			} else {
+				log.Printf("tls certificate reloaded from %s", r.certFile)
+			}
+		}
+	}
+}
+
+func (r *Reloader) changed() bool {
+	now, err := r.stamps()
+	if err != nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return now != r.seen
+}
+
+func (r *Reloader) load() error {
+	st, err := r.stamps()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.seen = st
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Reloader) stamps() ([2]fileStamp, error) {
+	var out [2]fileStamp
+	for i, f := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return out, err
+		}
+		out[i] = fileStamp{mod: fi.ModTime(), size: fi.Size()}
+	}
+	return out, nil
+}
@@ -0,0 +1,144 @@
+package tournament
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/httpx"
+)
+
+// NewHandler serves tournaments under /api/tournaments. Reads are public;
+// changes go through guard (e.g. httpx.RequireToken):
+//
+//	GET  /api/tournaments                  all, with standings
+//	GET  /api/tournaments/{id}             schedule/bracket and standings
+//	GET  /api/tournaments/{id}/events      text/event-stream of "tournament" messages;
+//	                                       ?player= keeps only that player's games
+//	POST /api/tournaments                  {"name","format","rounds","bestOf","noShowSeconds","rated"}
+//	POST /api/tournaments/{id}/players     {"player"}
+//	POST /api/tournaments/{id}/start
+func NewHandler(m Manager, guard func(http.Handler) http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/tournaments", func(w http.ResponseWriter, r *http.Request) {
+		httpx.JSON(w, http.StatusOK, m.List())
+	})
+	mux.HandleFunc("GET /api/tournaments/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if t, ok := lookup(w, r, m); ok {
+			httpx.JSON(w, http.StatusOK, t.View())
+		}
+	})
+	mux.HandleFunc("GET /api/tournaments/{id}/events", func(w http.ResponseWriter, r *http.Request) {
+		if t, ok := lookup(w, r, m); ok {
+			stream(w, r, t)
+		}
+	})
+	mux.Handle("POST /api/tournaments", guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Config
+			NoShowSeconds int `json:"noShowSeconds"`
+		}
+		if !decode(w, r, &req) {
+			return
+		}
+		req.Config.NoShow = time.Duration(req.NoShowSeconds) * time.Second
+		t, err := m.Create(req.Config)
+		if err != nil {
+			httpx.JSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		httpx.JSON(w, http.StatusCreated, t.View())
+	})))
+	mux.Handle("POST /api/tournaments/{id}/players", guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Player string `json:"player"`
+		}
+		t, ok := lookup(w, r, m)
+		if !ok || !decode(w, r, &req) {
+			return
+		}
+		if err := t.Register(req.Player); err != nil {
+			httpx.JSON(w, statusFor(err), map[string]string{"error": err.Error()})
+			return
+		}
+		httpx.JSON(w, http.StatusOK, t.View())
+	})))
+	mux.Handle("POST /api/tournaments/{id}/start", guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t, ok := lookup(w, r, m)
+		if !ok {
+			return
+		}
+		if err := t.Start(); err != nil {
+			httpx.JSON(w, statusFor(err), map[string]string{"error": err.Error()})
+			return
+		}
+		httpx.JSON(w, http.StatusOK, t.View())
+	})))
+	return mux
+}
+
+func lookup(w http.ResponseWriter, r *http.Request, m Manager) (Tournament, bool) {
+	t, ok := m.Get(r.PathValue("id"))
+	if !ok {
+		httpx.JSON(w, http.StatusNotFound, map[string]string{"error": ErrNotFound.Error()})
+	}
+	return t, ok
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(v); err != nil {
+		httpx.JSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, ErrStarted), errors.Is(err, ErrDuplicate):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// stream pushes t's events until the client goes away.
+func stream(w http.ResponseWriter, r *http.Request, t Tournament) {
+	player := r.URL.Query().Get("player")
+	events, cancel := t.Subscribe()
+	defer cancel()
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	_ = rc.Flush()
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			_, err = io.WriteString(w, ": keepalive\n\n")
+		case ev := <-events:
+			if player != "" && (ev.Event == "game" || ev.Event == "result") && ev.X != player && ev.O != player {
+				continue
+			}
+			b, _ := json.Marshal(ev)
+			_, err = io.WriteString(w, "data: "+string(b)+"\n\n")
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
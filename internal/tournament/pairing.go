@@ -0,0 +1,138 @@
+package tournament
+
+import "github.com/kushgupta-hiver/TTT/internal/proto"
+
+// history is what Swiss pairing needs to know about a player's past rounds.
+type history struct {
+	byes  int
+	sides int // games as X minus games as O
+}
+
+func log2ceil(n int) int {
+	r := 0
+	for 1<<r < n {
+		r++
+	}
+	return r
+}
+
+// roundRobin schedules every pairing once with the circle method. With an
+// odd field each player sits out one round (paired with "").
+func roundRobin(players []string) [][][2]string {
+	ps := append([]string{}, players...)
+	if len(ps)%2 == 1 {
+		ps = append(ps, "")
+	}
+	n := len(ps)
+	rounds := make([][][2]string, 0, n-1)
+	for r := 0; r < n-1; r++ {
+		var pairs [][2]string
+		for i := 0; i < n/2; i++ {
+			a, b := ps[i], ps[n-1-i]
+			if (r+i)%2 == 1 {
+				a, b = b, a // spread X fairly
+			}
+			if a == "" {
+				a, b = b, a
+			}
+			pairs = append(pairs, [2]string{a, b})
+		}
+		rounds = append(rounds, pairs)
+		// Keep ps[0] fixed; rotate the rest one place.
+		last := ps[n-1]
+		copy(ps[2:], ps[1:n-1])
+		ps[1] = last
+	}
+	return rounds
+}
+
+// swissPairs pairs round r from the current standings: a bye for the
+// lowest-ranked player without one, then top-down pairing that avoids
+// rematches where possible. X goes to whoever has had it less.
+func swissPairs(ranked []proto.Standing, played map[[2]string]bool, hist map[string]history, r int) [][2]string {
+	order := make([]string, 0, len(ranked))
+	for _, s := range ranked {
+		order = append(order, s.Player)
+	}
+	var pairs [][2]string
+	if len(order)%2 == 1 {
+		bye := len(order) - 1
+		for i := len(order) - 1; i >= 0; i-- {
+			if hist[order[i]].byes == 0 {
+				bye = i
+				break
+			}
+		}
+		pairs = append(pairs, [2]string{order[bye], ""})
+		order = append(order[:bye:bye], order[bye+1:]...)
+	}
+
+	budget := 100000
+	matched, ok := pairUp(order, played, &budget)
+	if !ok {
+		matched = nil // give up on avoiding rematches: pair neighbours
+		for i := 0; i+1 < len(order); i += 2 {
+			matched = append(matched, [2]string{order[i], order[i+1]})
+		}
+	}
+	for _, p := range matched {
+		a, b := p[0], p[1]
+		sa, sb := hist[a].sides, hist[b].sides
+		if sb < sa || (sa == sb && r%2 == 0) {
+			a, b = b, a
+		}
+		pairs = append(pairs, [2]string{a, b})
+	}
+	return pairs
+}
+
+// pairUp pairs the first player with the best-ranked opponent they have not
+// met, backtracking when that leaves the rest unpairable.
+func pairUp(order []string, played map[[2]string]bool, budget *int) ([][2]string, bool) {
+	if len(order) == 0 {
+		return nil, true
+	}
+	if *budget--; *budget < 0 {
+		return nil, false
+	}
+	first := order[0]
+	for i := 1; i < len(order); i++ {
+		if played[[2]string{first, order[i]}] {
+			continue
+		}
+		rest := make([]string, 0, len(order)-2)
+		rest = append(rest, order[1:i]...)
+		rest = append(rest, order[i+1:]...)
+		if more, ok := pairUp(rest, played, budget); ok {
+			return append([][2]string{{first, order[i]}}, more...), true
+		}
+	}
+	return nil, false
+}
+
+// bracket is the first round of a single-elimination draw in seed order:
+// 1 meets the lowest seed, and the top seeds take the byes.
+func bracket(players []string) [][2]string {
+	size := 1 << log2ceil(len(players))
+	order := []int{1}
+	for len(order) < size {
+		next := make([]int, 0, 2*len(order))
+		for _, s := range order {
+			next = append(next, s, 2*len(order)+1-s)
+		}
+		order = next
+	}
+	pairs := make([][2]string, 0, size/2)
+	for i := 0; i < size; i += 2 {
+		a, b := order[i], order[i+1]
+		var pa, pb string
+		if a <= len(players) {
+			pa = players[a-1]
+		}
+		if b <= len(players) {
+			pb = players[b-1]
+		}
+		pairs = append(pairs, [2]string{pa, pb})
+	}
+	return pairs
+}
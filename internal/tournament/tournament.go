@@ -0,0 +1,585 @@
+// Package tournament runs round-robin, Swiss and knockout events on top of
+// the hub: each pairing gets a reserved room, results are collected from the
+// rooms as games finish, and players who do not show up forfeit.
+package tournament
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+)
+
+type Format string
+
+const (
+	RoundRobin Format = "round_robin"
+	Swiss      Format = "swiss"
+	Knockout   Format = "knockout"
+)
+
+// Tournament status.
+const (
+	Registering = "registering"
+	Running     = "running"
+	Finished    = "finished"
+)
+
+var (
+	ErrNotFound  = errors.New("tournament not found")
+	ErrStarted   = errors.New("tournament already started")
+	ErrDuplicate = errors.New("player already registered")
+	ErrTooFew    = errors.New("need at least two players")
+)
+
+type Config struct {
+	Name   string `json:"name"`
+	Format Format `json:"format"`
+	Rounds int    `json:"rounds,omitempty"` // Swiss only (default log2 of the field, rounded up)
+	BestOf int    `json:"bestOf,omitempty"` // knockout games per match, odd (default 1)
+	Rated  bool   `json:"rated,omitempty"`
+
+	NoShow time.Duration `json:"-"` // per game (default: the hub's)
+}
+
+// Host runs the games; hub.Hub implements it.
+type Host interface {
+	Reserve(r hub.Reservation) (code string, err error)
+}
+
+type Game struct {
+	Code    string `json:"code,omitempty"`
+	X       string `json:"x"`
+	O       string `json:"o"`
+	Outcome string `json:"outcome,omitempty"` // "X" | "O" | "draw"; "" while pending
+	Reason  string `json:"reason,omitempty"`  // match.Reason*
+}
+
+// Match is one pairing. Round-robin and Swiss matches are a single game
+// with A as X; knockout matches are best-of-N with A the higher seed.
+type Match struct {
+	ID     string `json:"id"`
+	Round  int    `json:"round"`
+	A      string `json:"a"`
+	B      string `json:"b,omitempty"` // "" = bye
+	Games  []Game `json:"games"`
+	WinsA  int    `json:"winsA"`
+	WinsB  int    `json:"winsB"`
+	Winner string `json:"winner,omitempty"` // "" once Done = drawn
+	Done   bool   `json:"done"`
+
+	// Neither player showed up: both score nothing.
+	Forfeited bool `json:"forfeited,omitempty"`
+}
+
+type View struct {
+	ID        string           `json:"id"`
+	Config    Config           `json:"config"`
+	Status    string           `json:"status"`
+	Rounds    int              `json:"rounds"`   // planned
+	Players   []string         `json:"players"`  // seed order
+	Schedule  [][]Match        `json:"schedule"` // by round
+	Standings []proto.Standing `json:"standings"`
+	Champion  string           `json:"champion,omitempty"`
+}
+
+type Tournament interface {
+	ID() string
+	Register(player string) error
+	Start() error
+	View() View
+	// Subscribe delivers progress events until cancel is called. A
+	// subscriber that falls behind misses events; it never stalls play.
+	Subscribe() (events <-chan proto.Tournament, cancel func())
+}
+
+type tournament struct {
+	id   string
+	cfg  Config
+	host Host
+
+	mu       sync.Mutex
+	status   string
+	players  []string
+	rounds   [][]*Match
+	planned  int
+	schedule [][][2]string // round-robin, fixed at Start
+	champion string
+	subs     map[chan proto.Tournament]struct{}
+}
+
+func newTournament(id string, cfg Config, host Host) (*tournament, error) {
+	switch cfg.Format {
+	case RoundRobin, Swiss, Knockout:
+	default:
+		return nil, fmt.Errorf("unknown format %q", cfg.Format)
+	}
+	if cfg.BestOf == 0 {
+		cfg.BestOf = 1
+	}
+	if cfg.BestOf < 0 || cfg.BestOf%2 == 0 {
+		return nil, errors.New("bestOf must be odd")
+	}
+	if cfg.Format != Knockout {
+		cfg.BestOf = 1
+	}
+	if cfg.Name == "" {
+		cfg.Name = id
+	}
+	return &tournament{id: id, cfg: cfg, host: host, status: Registering, subs: make(map[chan proto.Tournament]struct{})}, nil
+}
+
+func (t *tournament) ID() string { return t.id }
+
+func (t *tournament) Register(player string) error {
+	if player == "" {
+		return errors.New("player required")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.status != Registering {
+		return ErrStarted
+	}
+	for _, p := range t.players {
+		if p == player {
+			return ErrDuplicate
+		}
+	}
+	t.players = append(t.players, player)
+	return nil
+}
+
+func (t *tournament) Start() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.status != Registering {
+		return ErrStarted
+	}
+	n := len(t.players)
+	if n < 2 {
+		return ErrTooFew
+	}
+	t.status = Running
+	switch t.cfg.Format {
+	case RoundRobin:
+		t.schedule = roundRobin(t.players)
+		t.planned = len(t.schedule)
+	case Swiss:
+		t.planned = t.cfg.Rounds
+		if t.planned <= 0 {
+			t.planned = log2ceil(n)
+		}
+		t.planned = min(t.planned, n-1+n%2)
+	case Knockout:
+		t.planned = log2ceil(n)
+	}
+	t.publish(proto.Tournament{Event: "started"})
+	t.nextRound()
+	return nil
+}
+
+// nextRound pairs and starts the next round. Caller holds t.mu.
+func (t *tournament) nextRound() {
+	r := len(t.rounds) + 1
+	var pairs [][2]string
+	switch t.cfg.Format {
+	case RoundRobin:
+		pairs = t.schedule[r-1]
+	case Swiss:
+		pairs = swissPairs(t.standings(), t.played(), t.byes(), r)
+	case Knockout:
+		pairs = t.bracketPairs(r)
+	}
+	round := make([]*Match, 0, len(pairs))
+	for i, p := range pairs {
+		m := &Match{ID: fmt.Sprintf("r%dm%d", r, i+1), Round: r, A: p[0], B: p[1], Games: []Game{}}
+		if m.B == "" {
+			m.Done, m.Winner = true, m.A
+		}
+		round = append(round, m)
+	}
+	t.rounds = append(t.rounds, round)
+	for _, m := range round {
+		if !m.Done {
+			t.play(m)
+		}
+	}
+	t.advance() // a round of byes only (never in practice) completes at once
+}
+
+// play books the next game of m. Caller holds t.mu.
+func (t *tournament) play(m *Match) {
+	x, o := m.A, m.B
+	if len(m.Games)%2 == 1 {
+		x, o = o, x // sides alternate within a knockout match
+	}
+	idx := len(m.Games)
+	m.Games = append(m.Games, Game{X: x, O: o})
+	code, err := t.host.Reserve(hub.Reservation{
+		X: x, O: o, NoShow: t.cfg.NoShow, Rated: t.cfg.Rated,
+		OnDone: func(g hub.GameOver) { t.gameDone(m, idx, g.Record.Outcome, g.Record.Reason) },
+	})
+	if err != nil {
+		// No room to play in: score it as if neither came.
+		log.Printf("tournament %s: reserve %s: %v", t.id, m.ID, err)
+		t.record(m, idx, engine.Draw, match.ReasonNoShow)
+		return
+	}
+	m.Games[idx].Code = code
+	t.publish(proto.Tournament{Event: "game", Round: m.Round, Match: m.ID, Code: code, X: x, O: o})
+}
+
+func (t *tournament) gameDone(m *Match, idx int, o engine.Outcome, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record(m, idx, o, reason)
+	t.advance()
+}
+
+// record scores one game and books the next if the match goes on. Caller
+// holds t.mu.
+func (t *tournament) record(m *Match, idx int, o engine.Outcome, reason string) {
+	g := &m.Games[idx]
+	if g.Outcome != "" {
+		return
+	}
+	g.Reason = reason
+	var winner string
+	switch o {
+	case engine.XWins:
+		g.Outcome, winner = "X", g.X
+	case engine.OWins:
+		g.Outcome, winner = "O", g.O
+	default:
+		g.Outcome = "draw"
+	}
+	switch winner {
+	case m.A:
+		m.WinsA++
+	case m.B:
+		m.WinsB++
+	}
+	bothAbsent := winner == "" && reason == match.ReasonNoShow
+
+	if t.cfg.Format != Knockout {
+		m.Done, m.Winner, m.Forfeited = true, winner, bothAbsent
+	} else {
+		need := t.cfg.BestOf/2 + 1
+		switch {
+		case m.WinsA >= need:
+			m.Done, m.Winner = true, m.A
+		case m.WinsB >= need:
+			m.Done, m.Winner = true, m.B
+		case bothAbsent || len(m.Games) >= 2*t.cfg.BestOf+1:
+			// Draws replay, but not forever: the higher seed goes through.
+			m.Done, m.Winner, m.Forfeited = true, m.A, bothAbsent
+		}
+	}
+	if !m.Done {
+		t.play(m)
+		return
+	}
+	t.publish(proto.Tournament{Event: "result", Round: m.Round, Match: m.ID, X: m.A, O: m.B, Winner: m.Winner})
+}
+
+// advance moves on once every match of the current round is done. Caller
+// holds t.mu.
+func (t *tournament) advance() {
+	if t.status != Running || len(t.rounds) == 0 {
+		return
+	}
+	cur := t.rounds[len(t.rounds)-1]
+	for _, m := range cur {
+		if !m.Done {
+			return
+		}
+	}
+	r := len(t.rounds)
+	last := r >= t.planned
+	if t.cfg.Format == Knockout {
+		last = len(cur) == 1
+	}
+	if !last {
+		t.publish(proto.Tournament{Event: "round", Round: r, Standings: t.standings()})
+		t.nextRound()
+		return
+	}
+	t.status = Finished
+	st := t.standings()
+	if t.cfg.Format == Knockout {
+		t.champion = cur[0].Winner
+	} else if len(st) > 0 {
+		t.champion = st[0].Player
+	}
+	t.publish(proto.Tournament{Event: "finished", Round: r, Winner: t.champion, Standings: st})
+}
+
+func (t *tournament) View() View {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	v := View{
+		ID:        t.id,
+		Config:    t.cfg,
+		Status:    t.status,
+		Rounds:    t.planned,
+		Players:   append([]string{}, t.players...),
+		Schedule:  make([][]Match, 0, len(t.rounds)),
+		Standings: t.standings(),
+		Champion:  t.champion,
+	}
+	for _, round := range t.rounds {
+		ms := make([]Match, 0, len(round))
+		for _, m := range round {
+			cp := *m
+			cp.Games = append([]Game{}, m.Games...)
+			ms = append(ms, cp)
+		}
+		v.Schedule = append(v.Schedule, ms)
+	}
+	return v
+}
+
+func (t *tournament) Subscribe() (<-chan proto.Tournament, func()) {
+	ch := make(chan proto.Tournament, 32)
+	t.mu.Lock()
+	t.subs[ch] = struct{}{}
+	t.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			t.mu.Lock()
+			delete(t.subs, ch)
+			t.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Caller holds t.mu.
+func (t *tournament) publish(ev proto.Tournament) {
+	ev.Type, ev.Tournament = "tournament", t.id
+	for ch := range t.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// standings ranks players on finished matches. Caller holds t.mu.
+func (t *tournament) standings() []proto.Standing {
+	seed := make(map[string]int, len(t.players))
+	rows := make(map[string]*proto.Standing, len(t.players))
+	for i, p := range t.players {
+		seed[p] = i
+		rows[p] = &proto.Standing{Player: p}
+	}
+	byePoints := 0.0
+	if t.cfg.Format == Swiss {
+		byePoints = 1
+	}
+	points := func(m *Match, p string) float64 {
+		switch {
+		case t.cfg.Format == Knockout:
+			if m.Winner == p {
+				return 1 // even on a double no-show: the higher seed went through
+			}
+			return 0
+		case m.Forfeited:
+			return 0
+		case m.Winner == p:
+			return 1
+		case m.Winner == "":
+			return 0.5
+		}
+		return 0
+	}
+	each := func(f func(m *Match)) {
+		for _, round := range t.rounds {
+			for _, m := range round {
+				if m.Done {
+					f(m)
+				}
+			}
+		}
+	}
+	each(func(m *Match) {
+		a := rows[m.A]
+		if m.B == "" {
+			a.Byes++
+			a.Points += byePoints
+			if t.cfg.Format == Knockout {
+				a.Points++
+			}
+			return
+		}
+		b := rows[m.B]
+		for _, r := range []*proto.Standing{a, b} {
+			r.Played++
+			switch {
+			case m.Winner == r.Player && (!m.Forfeited || t.cfg.Format == Knockout):
+				r.Wins++
+			case m.Winner == "" && !m.Forfeited:
+				r.Draws++
+			default:
+				r.Losses++
+				if t.cfg.Format == Knockout {
+					r.Out = true
+				}
+			}
+		}
+		a.Points += points(m, m.A)
+		b.Points += points(m, m.B)
+	})
+	each(func(m *Match) {
+		if m.B == "" {
+			return
+		}
+		a, b := rows[m.A], rows[m.B]
+		a.Buchholz += b.Points
+		b.Buchholz += a.Points
+		a.SB += points(m, m.A) * b.Points
+		b.SB += points(m, m.B) * a.Points
+	})
+
+	out := make([]proto.Standing, 0, len(rows))
+	for _, p := range t.players {
+		out = append(out, *rows[p])
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		switch {
+		case a.Out != b.Out:
+			return !a.Out
+		case a.Points != b.Points:
+			return a.Points > b.Points
+		case a.Buchholz != b.Buchholz:
+			return a.Buchholz > b.Buchholz
+		case a.SB != b.SB:
+			return a.SB > b.SB
+		case a.Wins != b.Wins:
+			return a.Wins > b.Wins
+		}
+		return seed[a.Player] < seed[b.Player]
+	})
+	for i := range out {
+		out[i].Rank = i + 1
+	}
+	return out
+}
+
+// played lists pairings so far, both ways round. Caller holds t.mu.
+func (t *tournament) played() map[[2]string]bool {
+	seen := make(map[[2]string]bool)
+	for _, round := range t.rounds {
+		for _, m := range round {
+			if m.B != "" {
+				seen[[2]string{m.A, m.B}] = true
+				seen[[2]string{m.B, m.A}] = true
+			}
+		}
+	}
+	return seen
+}
+
+// byes counts byes and X-minus-O games per player. Caller holds t.mu.
+func (t *tournament) byes() map[string]history {
+	h := make(map[string]history)
+	for _, round := range t.rounds {
+		for _, m := range round {
+			if m.B == "" {
+				e := h[m.A]
+				e.byes++
+				h[m.A] = e
+				continue
+			}
+			a, b := h[m.A], h[m.B]
+			a.sides++
+			b.sides--
+			h[m.A], h[m.B] = a, b
+		}
+	}
+	return h
+}
+
+// bracketPairs is round r of a single-elimination bracket. Caller holds t.mu.
+func (t *tournament) bracketPairs(r int) [][2]string {
+	if r == 1 {
+		return bracket(t.players)
+	}
+	prev := t.rounds[r-2]
+	seed := make(map[string]int, len(t.players))
+	for i, p := range t.players {
+		seed[p] = i
+	}
+	pairs := make([][2]string, 0, len(prev)/2)
+	for i := 0; i+1 < len(prev); i += 2 {
+		a, b := prev[i].Winner, prev[i+1].Winner
+		if seed[b] < seed[a] {
+			a, b = b, a
+		}
+		pairs = append(pairs, [2]string{a, b})
+	}
+	return pairs
+}
+
+type Manager interface {
+	Create(cfg Config) (Tournament, error)
+	Get(id string) (Tournament, bool)
+	List() []View
+}
+
+type manager struct {
+	host Host
+
+	mu  sync.Mutex
+	seq int
+	all map[string]*tournament
+	ids []string // creation order
+}
+
+func NewManager(host Host) Manager {
+	return &manager{host: host, all: make(map[string]*tournament)}
+}
+
+func (m *manager) Create(cfg Config) (Tournament, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := fmt.Sprintf("t%d", m.seq+1)
+	t, err := newTournament(id, cfg, m.host)
+	if err != nil {
+		return nil, err
+	}
+	m.seq++
+	m.all[id] = t
+	m.ids = append(m.ids, id)
+	return t, nil
+}
+
+func (m *manager) Get(id string) (Tournament, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.all[id]
+	return t, ok
+}
+
+func (m *manager) List() []View {
+	m.mu.Lock()
+	ts := make([]*tournament, 0, len(m.ids))
+	for _, id := range m.ids {
+		ts = append(ts, m.all[id])
+	}
+	m.mu.Unlock()
+	out := make([]View, 0, len(ts))
+	for _, t := range ts {
+		out = append(out, t.View())
+	}
+	return out
+}
@@ -0,0 +1,126 @@
+package outbox
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrFull    = errors.New("outbound queue full")
+	ErrLagging = errors.New("consumer lagging behind")
+	ErrClosed  = errors.New("outbound queue closed")
+)
+
+type Options struct {
+	Size     int           // max queued frames (default 32)
+	MaxLag   time.Duration // max age of the oldest queued frame; 0 = unlimited
+	Coalesce bool          // a newer frame with the same Key replaces the queued one
+}
+
+type Frame struct {
+	Data []byte
+	Key  string // coalescing key; empty = never coalesced
+
+	at time.Time
+}
+
+// Outbox is a bounded, single-consumer queue of encoded frames. Producers never
+// block: Push fails fast when the consumer falls behind, and the caller decides
+// what to do with the slow connection.
+type Outbox struct {
+	opts Options
+
+	mu     sync.Mutex
+	frames []Frame
+	closed bool
+	ready  chan struct{} // signalled on push/close
+}
+
+func New(opts Options) *Outbox {
+	if opts.Size <= 0 {
+		opts.Size = 32
+	}
+	return &Outbox{
+		opts:   opts,
+		frames: make([]Frame, 0, opts.Size),
+		ready:  make(chan struct{}, 1),
+	}
+}
+
+func (o *Outbox) Push(f Frame) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.closed {
+		return ErrClosed
+	}
+	now := time.Now()
+	if o.opts.MaxLag > 0 && len(o.frames) > 0 && now.Sub(o.frames[0].at) > o.opts.MaxLag {
+		return ErrLagging
+	}
+
+	// Drop a superseded frame so only the latest one goes out (at the tail,
+	// keeping it ordered after anything queued in between).
+	if o.opts.Coalesce && f.Key != "" {
+		for i := range o.frames {
+			if o.frames[i].Key == f.Key {
+				o.frames = append(o.frames[:i], o.frames[i+1:]...)
+				break
+			}
+		}
+	}
+	if len(o.frames) >= o.opts.Size {
+		return ErrFull
+	}
+
+	f.at = now
+	o.frames = append(o.frames, f)
+	o.signal()
+	return nil
+}
+
+// Next blocks until a frame is available. It returns false once the outbox is
+// closed and fully drained.
+func (o *Outbox) Next() (Frame, bool) {
+	for {
+		o.mu.Lock()
+		if len(o.frames) > 0 {
+			f := o.frames[0]
+			o.frames[0] = Frame{}
+			o.frames = o.frames[1:]
+			o.mu.Unlock()
+			return f, true
+		}
+		if o.closed {
+			o.mu.Unlock()
+			return Frame{}, false
+		}
+		o.mu.Unlock()
+		<-o.ready
+	}
+}
+
+// Close rejects further pushes; frames already queued are still delivered.
+func (o *Outbox) Close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return
+	}
+	o.closed = true
+	o.signal()
+}
+
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.frames)
+}
+
+func (o *Outbox) signal() {
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+}
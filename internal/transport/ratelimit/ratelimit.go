@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/infra"
+)
+
+// Bucket is a token bucket: it refills at rate tokens/second up to burst.
+type Bucket struct {
+	clock infra.Clock
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func NewBucket(rate float64, burst int, clock infra.Clock) *Bucket {
+	if clock == nil {
+		clock = infra.SystemClock{}
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &Bucket{
+		clock:  clock,
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   clock.Now(),
+	}
+}
+
+// Allow takes one token. When the bucket is empty it reports how long until
+// the next token is available.
+func (b *Bucket) Allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	if el := now.Sub(b.last).Seconds(); el > 0 {
+		b.tokens += el * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if b.rate <= 0 {
+		return false, time.Hour
+	}
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	return false, wait
+}
+
+// Counter caps concurrent holders per key (e.g. remote address). max <= 0
+// disables the cap.
+type Counter struct {
+	max int
+
+	mu sync.Mutex
+	n  map[string]int
+}
+
+func NewCounter(max int) *Counter {
+	return &Counter{max: max, n: make(map[string]int)}
+}
+
+func (c *Counter) Acquire(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.max > 0 && c.n[key] >= c.max {
+		return false
+	}
+	c.n[key]++
+	return true
+}
+
+func (c *Counter) Release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.n[key] <= 1 {
+		delete(c.n, key)
+		return
+	}
+	c.n[key]--
+}
+
+func (c *Counter) Count(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n[key]
+}
@@ -0,0 +1,273 @@
+package sse
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+	"github.com/kushgupta-hiver/TTT/internal/transport"
+	"github.com/kushgupta-hiver/TTT/internal/transport/outbox"
+)
+
+// Config for the Server-Sent Events transport: server messages stream on
+//
+//	GET  /sse[/<code>]             (text/event-stream, one JSON message per event)
+//
+// and client messages are posted, one frame per request, to
+//
+//	POST /sse/send?session=<id>    (same body as a websocket frame)
+//
+// where <id> comes from the first event on the stream ({"type":"session"}).
+type Config struct {
+	WriteTimeout    time.Duration // per event (default 2s)
+	KeepAlive       time.Duration // comment line interval for idle streams (default 15s)
+	SendQueue       int           // default 32
+	MaxSendLag      time.Duration // default 5s
+	KeepAllStates   bool
+	MaxMessageBytes int64 // POST body limit (default 4096)
+	Hub             hub.Hub
+	Game            hub.Config // used when Hub is nil
+}
+
+type Server interface {
+	http.Handler
+	hub.Hub
+}
+
+type server struct {
+	hub.Hub
+	cfg Config
+
+	mu      sync.Mutex
+	streams map[string]*conn // session id => stream
+}
+
+func NewServer(cfg Config, eng engine.Engine) Server {
+	if cfg.WriteTimeout == 0 {
+		cfg.WriteTimeout = 2 * time.Second
+	}
+	if cfg.KeepAlive == 0 {
+		cfg.KeepAlive = 15 * time.Second
+	}
+	if cfg.SendQueue <= 0 {
+		cfg.SendQueue = 32
+	}
+	if cfg.MaxSendLag == 0 {
+		cfg.MaxSendLag = 5 * time.Second
+	}
+	if cfg.MaxMessageBytes == 0 {
+		cfg.MaxMessageBytes = 4096
+	}
+	if cfg.Hub == nil {
+		cfg.Hub = hub.NewHub(cfg.Game, eng)
+	}
+	return &server{Hub: cfg.Hub, cfg: cfg, streams: make(map[string]*conn)}
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/send"):
+		s.post(w, r)
+	case r.Method == http.MethodGet:
+		s.stream(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *server) stream(w http.ResponseWriter, r *http.Request) {
+	code := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/sse"), "/")
+	if code != "" && !hub.ValidCode(code) {
+		http.Error(w, "bad room code", http.StatusNotFound)
+		return
+	}
+	addr := transport.RemoteHost(r.RemoteAddr)
+	player, authed, ok := transport.Identify(w, r, s.Hub)
+	if !ok {
+		return
+	}
+	if err := s.Admit(transport.Verified(player, authed), addr); err != nil {
+		transport.AdmitError(w, err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	c := &conn{
+		id:     newID(),
+		addr:   addr,
+		cancel: cancel,
+		out: outbox.New(outbox.Options{
+			Size:     s.cfg.SendQueue,
+			MaxLag:   s.cfg.MaxSendLag,
+			Coalesce: !s.cfg.KeepAllStates,
+		}),
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no") // nginx: don't buffer the stream
+	w.WriteHeader(http.StatusOK)
+
+	_ = c.Send(proto.Session{Type: "session", Session: c.id})
+	sess, err := s.Attach(c, hub.Attach{
+		Player: player,
+		Addr:   addr,
+		Code:   code,
+		Resume: r.URL.Query().Get("resume"),
+
+		Authenticated: authed,
+		Token:         transport.Token(r),
+		Rated:         transport.Rated(r),
+		Side:          transport.Side(r),
+		Series:        transport.Series(r),
+		Public:        transport.Public(r),
+	})
+	if err == nil {
+		c.sess.Store(&sess)
+		s.mu.Lock()
+		s.streams[c.id] = c
+		s.mu.Unlock()
+
+		// Client gone (or dropped as slow): leave the hub, which closes c.out.
+		go func() {
+			<-ctx.Done()
+			s.mu.Lock()
+			delete(s.streams, c.id)
+			s.mu.Unlock()
+			sess.Close()
+		}()
+		go c.keepAlive(ctx, s.cfg.KeepAlive)
+	}
+
+	s.write(w, c)
+}
+
+// write is the only writer of the response.
+func (s *server) write(w http.ResponseWriter, c *conn) {
+	rc := http.NewResponseController(w)
+	for {
+		f, ok := c.out.Next()
+		if !ok {
+			return
+		}
+		if c.kicked.Load() {
+			continue // drain without writing
+		}
+		_ = rc.SetWriteDeadline(time.Now().Add(s.cfg.WriteTimeout))
+		var err error
+		if f.Data == nil {
+			_, err = io.WriteString(w, ": keepalive\n\n")
+		} else {
+			_, err = io.WriteString(w, "data: "+string(f.Data)+"\n\n")
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			c.kick("write failed")
+		}
+	}
+}
+
+func (s *server) post(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("session")
+	if id == "" {
+		id = r.Header.Get("X-Session")
+	}
+	s.mu.Lock()
+	c := s.streams[id]
+	s.mu.Unlock()
+	sess := c.session()
+	if sess == nil {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.cfg.MaxMessageBytes))
+	if err != nil {
+		http.Error(w, "message too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	sess.Handle(body)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// conn is one event stream; it implements hub.Client.
+type conn struct {
+	id     string
+	addr   string
+	out    *outbox.Outbox
+	cancel context.CancelFunc
+	kicked atomic.Bool
+	sess   atomic.Pointer[hub.Session]
+}
+
+func (c *conn) session() hub.Session {
+	if c == nil {
+		return nil
+	}
+	if p := c.sess.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// Send never blocks; see ws.conn.Send.
+func (c *conn) Send(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f := outbox.Frame{Data: b}
+	if _, ok := v.(proto.State); ok {
+		f.Key = "state"
+	}
+	err = c.out.Push(f)
+	if errors.Is(err, outbox.ErrFull) || errors.Is(err, outbox.ErrLagging) {
+		c.kick("slow consumer")
+	}
+	return err
+}
+
+func (c *conn) Close() { c.out.Close() }
+
+func (c *conn) kick(reason string) {
+	if c.kicked.Swap(true) {
+		return
+	}
+	log.Printf("dropping sse stream from %s: %s", c.addr, reason)
+	c.cancel()
+}
+
+func (c *conn) keepAlive(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			_ = c.out.Push(outbox.Frame{Key: "keepalive"})
+		}
+	}
+}
+
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,103 @@
+package tcp
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+)
+
+const helpText = `Commands:
+  0-8            play that cell (numbers are shown on the board)
+  say <text>     chat with your opponent
+  resign         concede the game
+  rematch        ask for another game once this one is over
+  help           this text
+  quit           leave
+`
+
+// renderBoard draws the board; empty cells show their move number.
+//
+//	 X | 1 | 2
+//	---+---+---
+//	 3 | O | 5
+//	---+---+---
+//	 6 | 7 | X
+func renderBoard(b [9]string) string {
+	var sb strings.Builder
+	for row := 0; row < 3; row++ {
+		if row > 0 {
+			sb.WriteString("---+---+---\n")
+		}
+		for col := 0; col < 3; col++ {
+			i := row*3 + col
+			cell := b[i]
+			if cell == "" {
+				cell = string(rune('0' + i))
+			}
+			if col > 0 {
+				sb.WriteString("|")
+			}
+			sb.WriteString(" " + cell + " ")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// render turns a server message into terminal text for a player holding mark
+// (empty until assigned). Unknown messages render as nothing.
+func render(v any, mark engine.Mark) string {
+	switch m := v.(type) {
+	case proto.Assigned:
+		return "Opponent found. You are " + string(m.You) + ".\n"
+	case proto.Start:
+		return "\n" + renderBoard(m.Board) + turnLine(m.YourTurn)
+	case proto.State:
+		s := "\n" + renderBoard(m.Board)
+		if m.NextTurn != "" {
+			s += turnLine(m.NextTurn == mark)
+		}
+		return s
+	case proto.Clock:
+		return "Clock: X " + clockText(m.XMs) + ", O " + clockText(m.OMs) + "\n"
+	case proto.Result:
+		return "Game over: " + m.Status + "\nType 'rematch' to play again or 'quit' to leave.\n"
+	case proto.Rematch:
+		return "Opponent (" + string(m.From) + ") wants a rematch. Type 'rematch' to accept.\n"
+	case proto.Chat:
+		if m.Emote != "" {
+			return "[" + string(m.From) + "] *" + m.Emote + "*\n"
+		}
+		return "[" + string(m.From) + "] " + m.Text + "\n"
+	case proto.Opponent:
+		if m.Status == "away" {
+			return "Opponent disconnected; their seat is held for " + strconv.Itoa(m.GraceMs/1000) + "s.\n"
+		}
+		return "Opponent is back.\n"
+	case proto.System:
+		return "*** " + m.Text + "\n"
+	case proto.Error:
+		s := "! " + m.Code
+		if m.Detail != "" {
+			s += ": " + m.Detail
+		}
+		return s + "\n"
+	default:
+		return ""
+	}
+}
+
+// clockText shows milliseconds as m:ss.
+func clockText(ms int) string {
+	sec := ms / 1000
+	return strconv.Itoa(sec/60) + ":" + strconv.Itoa(sec%60/10) + strconv.Itoa(sec%10)
+}
+
+func turnLine(yours bool) string {
+	if yours {
+		return "Your move (0-8):\n"
+	}
+	return "Waiting for opponent...\n"
+}
@@ -0,0 +1,224 @@
+package tcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+	"github.com/kushgupta-hiver/TTT/internal/transport/outbox"
+)
+
+// Config for the line-oriented TCP transport (`nc host port` / telnet). The
+// first line a player types is a room code, or empty to auto-match; after
+// that each line is a move digit or a command (see help).
+type Config struct {
+	WriteTimeout time.Duration // per write (default 2s)
+	IdleTimeout  time.Duration // drop players silent this long (default 10m)
+	SendQueue    int           // default 64 (boards are several lines each)
+	MaxSendLag   time.Duration // default 5s
+	MaxLineBytes int           // default 512
+	Hub          hub.Hub
+	Game         hub.Config // used when Hub is nil
+}
+
+type Server interface {
+	hub.Hub
+	// Serve accepts players on ln until it is closed.
+	Serve(ln net.Listener) error
+}
+
+type server struct {
+	hub.Hub
+	cfg Config
+}
+
+func NewServer(cfg Config, eng engine.Engine) Server {
+	if cfg.WriteTimeout == 0 {
+		cfg.WriteTimeout = 2 * time.Second
+	}
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = 10 * time.Minute
+	}
+	if cfg.SendQueue <= 0 {
+		cfg.SendQueue = 64
+	}
+	if cfg.MaxSendLag == 0 {
+		cfg.MaxSendLag = 5 * time.Second
+	}
+	if cfg.MaxLineBytes <= 0 {
+		cfg.MaxLineBytes = 512
+	}
+	if cfg.Hub == nil {
+		cfg.Hub = hub.NewHub(cfg.Game, eng)
+	}
+	return &server{Hub: cfg.Hub, cfg: cfg}
+}
+
+func (s *server) Serve(ln net.Listener) error {
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.handle(nc)
+	}
+}
+
+func (s *server) handle(nc net.Conn) {
+	addr := nc.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if err := s.Admit("", addr); err != nil {
+		_, _ = io.WriteString(nc, "! "+err.Error()+"\n")
+		_ = nc.Close()
+		return
+	}
+
+	c := &conn{
+		nc:  nc,
+		srv: s,
+		out: outbox.New(outbox.Options{
+			Size:   s.cfg.SendQueue,
+			MaxLag: s.cfg.MaxSendLag,
+		}),
+	}
+	go c.writer()
+
+	sc := bufio.NewScanner(nc)
+	sc.Buffer(make([]byte, 0, 128), s.cfg.MaxLineBytes)
+
+	c.print("Tic-tac-toe. Room code (4 digits), or Enter to auto-match:\n")
+	code, ok := c.readLine(sc)
+	if !ok {
+		s.Release(addr)
+		c.Close()
+		return
+	}
+	if code != "" && !hub.ValidCode(code) {
+		s.Release(addr)
+		c.print("! bad room code\n")
+		c.Close()
+		return
+	}
+	c.print("Waiting for an opponent... (type 'help' for commands)\n")
+
+	sess, err := s.Attach(c, hub.Attach{Addr: addr, Code: code})
+	if err != nil {
+		return
+	}
+	c.reader(sc, sess)
+}
+
+// conn is one TCP player; it implements hub.Client.
+type conn struct {
+	nc     net.Conn
+	srv    *server
+	out    *outbox.Outbox
+	kicked atomic.Bool
+
+	mu   sync.Mutex
+	mark engine.Mark
+}
+
+func (c *conn) readLine(sc *bufio.Scanner) (string, bool) {
+	_ = c.nc.SetReadDeadline(time.Now().Add(c.srv.cfg.IdleTimeout))
+	if !sc.Scan() {
+		return "", false
+	}
+	return strings.TrimSpace(sc.Text()), true
+}
+
+func (c *conn) reader(sc *bufio.Scanner, sess hub.Session) {
+	defer sess.Close()
+	for {
+		line, ok := c.readLine(sc)
+		if !ok {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToLower(cmd) {
+		case "":
+			continue
+		case "help", "?":
+			c.print(helpText)
+		case "quit", "exit", "leave":
+			return
+		case "resign", "rematch":
+			sess.Handle(clientMsg(proto.ClientMsg{Type: strings.ToLower(cmd)}))
+		case "say":
+			sess.Handle(clientMsg(proto.ClientMsg{Type: "chat", Text: arg}))
+		default:
+			if len(line) == 1 || strings.HasPrefix(line, "{") {
+				sess.Handle([]byte(line)) // move digits (and raw JSON) go straight through
+				continue
+			}
+			c.print("! unknown command " + cmd + " (type 'help')\n")
+		}
+	}
+}
+
+func clientMsg(m proto.ClientMsg) []byte {
+	b, _ := json.Marshal(m)
+	return b
+}
+
+func (c *conn) writer() {
+	for {
+		f, ok := c.out.Next()
+		if !ok {
+			break
+		}
+		if c.kicked.Load() {
+			continue
+		}
+		_ = c.nc.SetWriteDeadline(time.Now().Add(c.srv.cfg.WriteTimeout))
+		if _, err := c.nc.Write(f.Data); err != nil {
+			c.kick("write failed")
+		}
+	}
+	_ = c.nc.Close()
+}
+
+func (c *conn) print(s string) {
+	if err := c.out.Push(outbox.Frame{Data: []byte(s)}); errors.Is(err, outbox.ErrFull) || errors.Is(err, outbox.ErrLagging) {
+		c.kick("slow consumer")
+	}
+}
+
+func (c *conn) Send(v any) error {
+	c.mu.Lock()
+	if a, ok := v.(proto.Assigned); ok {
+		c.mark = a.You
+	}
+	mark := c.mark
+	c.mu.Unlock()
+
+	if s := render(v, mark); s != "" {
+		c.print(s)
+	}
+	return nil
+}
+
+func (c *conn) Close() { c.out.Close() }
+
+func (c *conn) kick(reason string) {
+	if c.kicked.Swap(true) {
+		return
+	}
+	log.Printf("dropping tcp player %s: %s", c.nc.RemoteAddr(), reason)
+	_ = c.nc.Close() // unblocks the reader, which leaves the hub
+}
@@ -0,0 +1,117 @@
+// Package transport holds helpers shared by the hub's network front-ends.
+package transport
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+)
+
+// RemoteHost strips the port from an http.Request.RemoteAddr.
+func RemoteHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// AdmitError writes the HTTP response for a hub.Admit refusal.
+func AdmitError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, hub.ErrDraining):
+		http.Error(w, "server draining", http.StatusServiceUnavailable)
+	case errors.Is(err, hub.ErrBanned):
+		http.Error(w, "banned", http.StatusForbidden)
+	case errors.Is(err, hub.ErrTooManyConns):
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "too many connections", http.StatusTooManyRequests)
+	default:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	}
+}
+
+// Identify works out who is connecting. A sign-in token (Authorization:
+// Bearer or ?token=, for browsers) is verified by the hub and names the
+// player; without one the self-declared ?player= is used, unverified. On a
+// bad token it writes 401 and returns ok=false.
+func Identify(w http.ResponseWriter, r *http.Request, h hub.Hub) (player string, authed, ok bool) {
+	token := Token(r)
+	if token == "" {
+		return r.URL.Query().Get("player"), false, true
+	}
+	player, err := h.Identify(token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return "", false, false
+	}
+	return player, true, true
+}
+
+// Token is the request's sign-in token, if any.
+func Token(r *http.Request) string {
+	if v, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		return v
+	}
+	return r.URL.Query().Get("token")
+}
+
+// Verified is player if it came from a sign-in token, else "": what
+// hub.Admit checks for player bans.
+func Verified(player string, authed bool) string {
+	if !authed {
+		return ""
+	}
+	return player
+}
+
+// Side is the side a room's opener asked for (?side=X or O), if any.
+func Side(r *http.Request) engine.Mark {
+	switch strings.ToUpper(r.URL.Query().Get("side")) {
+	case "X":
+		return engine.X
+	case "O":
+		return engine.O
+	}
+	return engine.Empty
+}
+
+// Rated reports whether the request asked for a rated game (?rated=1).
+func Rated(r *http.Request) bool {
+	switch r.URL.Query().Get("rated") {
+	case "1", "true":
+		return true
+	}
+	return false
+}
+
+// Public reports whether a room's opener wants it listed in the lobby
+// (?public=1).
+func Public(r *http.Request) bool {
+	switch r.URL.Query().Get("public") {
+	case "1", "true":
+		return true
+	}
+	return false
+}
+
+// Series is the best-of-N series a room's opener asked for
+// (?bestOf=3&forfeit=game|series). A malformed bestOf comes back negative so
+// the hub turns it down.
+func Series(r *http.Request) match.SeriesOptions {
+	q := r.URL.Query()
+	o := match.SeriesOptions{Forfeit: match.SeriesForfeit(q.Get("forfeit"))}
+	if v := q.Get("bestOf"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			n = -1
+		}
+		o.BestOf = n
+	}
+	return o
+}
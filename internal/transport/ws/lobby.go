@@ -0,0 +1,32 @@
+package ws
+
+import (
+	"net/http"
+
+	"github.com/kushgupta-hiver/TTT/internal/lobby"
+)
+
+// NewLobbyServer serves the lobby (/lobby) over websockets. cfg.Hub is
+// required and should be the lobby's: callers are identified and admitted
+// as for games.
+func NewLobbyServer(cfg Config, l lobby.Lobby) http.Handler {
+	cfg.defaults()
+	return &lobbyServer{server: &server{Hub: cfg.Hub, cfg: cfg}, lobby: l}
+}
+
+type lobbyServer struct {
+	*server
+	lobby lobby.Lobby
+}
+
+func (s *lobbyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c, player, authed, ok := s.accept(w, r)
+	if !ok {
+		return
+	}
+	sess, err := s.lobby.Join(c, lobby.Member{Player: player, Addr: c.addr, Authenticated: authed})
+	if err != nil {
+		return
+	}
+	go c.reader(sess)
+}
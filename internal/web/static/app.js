@@ -0,0 +1,239 @@
+// Browser client for the /ws protocol. No build step, no dependencies.
+(() => {
+  "use strict";
+
+  const $ = (id) => document.getElementById(id);
+  const el = {
+    lobby: $("lobby"), game: $("game"), code: $("code"), where: $("where"),
+    share: $("share"), link: $("link"), status: $("status"), board: $("board"),
+    opponent: $("opponent"), resign: $("resign"), rematch: $("rematch"),
+    lines: $("lines"), text: $("text"), notice: $("notice"), clock: $("clock"),
+  };
+
+  const cells = [];
+  for (let i = 0; i < 9; i++) {
+    const b = document.createElement("button");
+    b.setAttribute("aria-label", "cell " + i);
+    b.addEventListener("click", () => move(i));
+    el.board.appendChild(b);
+    cells.push(b);
+  }
+
+  let ws = null;
+  let room = "";
+  let game = null;      // {mark, board, next, seq, over, last, clock}
+  let token = "";       // resume token for the current seat
+  let leaving = false;
+  let retries = 0;
+  let msgN = 0;
+
+  function wsURL(code, resume) {
+    const scheme = location.protocol === "https:" ? "wss" : "ws";
+    let url = `${scheme}://${location.host}/ws` + (code ? "/" + code : "");
+    if (resume) url += "?resume=" + encodeURIComponent(resume);
+    return url;
+  }
+
+  function connect(code, resume) {
+    leaving = false;
+    room = code;
+    el.lobby.hidden = true;
+    el.game.hidden = false;
+    el.where.textContent = code ? "Room " + code : "Auto-match";
+    showShare(code);
+    if (!resume) {
+      game = null;
+      setStatus("Waiting for an opponent…");
+      render();
+    }
+
+    ws = new WebSocket(wsURL(code, resume), "ttt.json");
+    ws.onopen = () => {
+      retries = 0;
+      send({ type: "hello", version: 2, client: "web", features: ["last_move", "chat"] });
+    };
+    ws.onmessage = (e) => {
+      let msg;
+      try { msg = JSON.parse(e.data); } catch { return; }
+      handle(msg);
+    };
+    ws.onclose = () => {
+      ws = null;
+      if (leaving) return;
+      if (token && game && !game.over && retries < 5) {
+        retries++;
+        setStatus("Connection lost, reconnecting…");
+        setTimeout(() => connect(room, token), 250 * 2 ** retries);
+        return;
+      }
+      if (!game || !game.over) setStatus("Disconnected.");
+    };
+  }
+
+  function send(msg) {
+    if (ws && ws.readyState === WebSocket.OPEN) ws.send(JSON.stringify(msg));
+  }
+
+  function handle(msg) {
+    switch (msg.type) {
+      case "assigned":
+        game = { mark: msg.you, board: Array(9).fill(""), next: "X", seq: 0, over: false, last: -1 };
+        el.opponent.textContent = "Opponent connected.";
+        break;
+      case "start":
+        game = game || { mark: "", seq: 0 };
+        Object.assign(game, { board: msg.board, next: msg.your_turn ? game.mark : other(game.mark), seq: 0, over: false, last: -1 });
+        el.rematch.hidden = true;
+        el.rematch.textContent = "Rematch";
+        notice("");
+        break;
+      case "state":
+        if (!game) return;
+        Object.assign(game, { board: msg.board, next: msg.next_turn, seq: msg.serverSeq });
+        game.last = msg.last_move ? msg.last_move.pos : -1;
+        break;
+      case "clock":
+        if (!game) return;
+        game.clock = { X: msg.xMs, O: msg.oMs, running: msg.running || "", at: Date.now() };
+        break;
+      case "result":
+        if (!game) return;
+        game.over = true;
+        game.result = msg.status;
+        el.rematch.hidden = false;
+        break;
+      case "series":
+        chatLine(msg.over
+          ? `*** Series ${msg.outcome} ${msg.you}–${msg.opponent}`
+          : `*** Best of ${msg.bestOf}: you ${msg.you}, opponent ${msg.opponent}`);
+        break;
+      case "rematch":
+        el.rematch.textContent = "Accept rematch";
+        chatLine(`${msg.from} wants a rematch`);
+        break;
+      case "resumable":
+        token = msg.token;
+        break;
+      case "opponent":
+        el.opponent.textContent = msg.status === "away"
+          ? `Opponent disconnected; waiting ${Math.round(msg.graceMs / 1000)}s for them.`
+          : "Opponent connected.";
+        break;
+      case "chat":
+        chatLine(`${msg.from}: ${msg.emote ? "*" + msg.emote + "*" : msg.text}`);
+        break;
+      case "system":
+        chatLine("*** " + msg.text);
+        break;
+      case "error":
+        notice(msg.code === "ROOM_FULL" ? "That room is full." : msg.code + (msg.detail ? ": " + msg.detail : ""));
+        break;
+    }
+    render();
+  }
+
+  function render() {
+    const mine = !!game && !game.over && game.mark !== "" && game.next === game.mark;
+    el.board.classList.toggle("mine", mine);
+    cells.forEach((b, i) => {
+      const v = game && game.board ? game.board[i] : "";
+      b.textContent = v;
+      b.className = (v || "") + (game && game.last === i ? " last" : "");
+      b.disabled = !mine || v !== "";
+    });
+    el.resign.disabled = !game || game.over;
+    renderClock();
+    if (!game || !game.board) return;
+
+    el.status.className = "";
+    if (game.over) {
+      const won = game.result === game.mark + " wins!";
+      const lost = game.result.endsWith("wins!") && !won;
+      el.status.className = won ? "win" : lost ? "lose" : "";
+      setStatus(won ? "You win!" : lost ? "You lose." : game.result);
+    } else {
+      setStatus(mine ? `Your move (${game.mark})` : `Opponent's move (${game.next})`);
+    }
+  }
+
+  // renderClock shows a timed game's clocks, counting down the running one.
+  function renderClock() {
+    const c = game && game.clock;
+    el.clock.hidden = !c;
+    if (!c) return;
+    const left = (m) => Math.max(0, c[m] - (c.running === m && !game.over ? Date.now() - c.at : 0));
+    const fmt = (ms) => {
+      const s = Math.ceil(ms / 1000);
+      return `${Math.floor(s / 60)}:${String(s % 60).padStart(2, "0")}`;
+    };
+    el.clock.textContent = `X ${fmt(left("X"))} · O ${fmt(left("O"))}`;
+  }
+  setInterval(renderClock, 250);
+
+  function move(pos) {
+    if (!game || game.over) return;
+    msgN++;
+    send({ type: "move", position: pos, msgId: `web-${msgN}-${Date.now()}`, clientSeq: game.seq + 1 });
+  }
+
+  function other(m) { return m === "X" ? "O" : "X"; }
+  function setStatus(s) { el.status.textContent = s; }
+  function notice(s) { el.notice.textContent = s; }
+
+  function chatLine(s) {
+    const li = document.createElement("li");
+    li.textContent = s;
+    el.lines.appendChild(li);
+    el.lines.scrollTop = el.lines.scrollHeight;
+  }
+
+  function showShare(code) {
+    el.share.hidden = !code;
+    if (!code) return;
+    const url = `${location.origin}/?room=${code}`;
+    el.link.href = url;
+    el.link.textContent = url;
+    history.replaceState(null, "", "/?room=" + code);
+  }
+
+  function validCode(s) { return /^[0-9]{4}$/.test(s); }
+
+  $("quick").addEventListener("click", () => connect("", ""));
+  $("join").addEventListener("click", () => {
+    const code = el.code.value.trim();
+    if (!validCode(code)) { notice("A room code is 4 digits."); return; }
+    connect(code, "");
+  });
+  $("create").addEventListener("click", () => {
+    connect(String(Math.floor(Math.random() * 10000)).padStart(4, "0"), "");
+  });
+  $("copy").addEventListener("click", () => navigator.clipboard && navigator.clipboard.writeText(el.link.href));
+  el.resign.addEventListener("click", () => send({ type: "resign" }));
+  el.rematch.addEventListener("click", () => {
+    send({ type: "rematch" });
+    el.rematch.textContent = "Waiting for opponent…";
+  });
+  $("leave").addEventListener("click", () => {
+    leaving = true;
+    send({ type: "leave" });
+    if (ws) ws.close();
+    token = "";
+    game = null;
+    el.game.hidden = true;
+    el.lobby.hidden = false;
+    el.lines.textContent = "";
+    history.replaceState(null, "", "/");
+  });
+  $("say").addEventListener("submit", (e) => {
+    e.preventDefault();
+    const t = el.text.value.trim();
+    if (t) send({ type: "chat", text: t });
+    el.text.value = "";
+  });
+  document.querySelectorAll(".emote").forEach((b) =>
+    b.addEventListener("click", () => send({ type: "emote", emote: b.dataset.emote })));
+
+  // Shareable links: /?room=1234 joins straight away.
+  const linked = new URLSearchParams(location.search).get("room");
+  if (linked && validCode(linked)) connect(linked, "");
+})();
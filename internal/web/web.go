@@ -0,0 +1,33 @@
+// Package web serves the embedded browser client.
+package web
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// csp keeps the page to its own scripts and lets it open sockets back to us.
+const csp = "default-src 'self'; connect-src 'self' ws: wss:; img-src 'self' data:; " +
+	"style-src 'self'; script-src 'self'; frame-ancestors 'none'"
+
+// Handler serves the client: "/" is the game page (?room=1234 joins that
+// room), /static/ its assets. Other paths are 404.
+func Handler() http.Handler {
+	sub, _ := fs.Sub(static, "static")
+	files := http.FileServer(http.FS(sub))
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /static/", http.StripPrefix("/static/", files))
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeFileFS(w, r, sub, "index.html")
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", csp)
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,469 @@
+// Package client speaks the game protocol over a websocket. It is what bots,
+// tools and tests should use instead of hand-rolling frames: it decodes
+// server messages into typed events, numbers moves, and can reclaim its seat
+// after a dropped connection when the server holds seats (ResumeGrace).
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/codec"
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+	"nhooyr.io/websocket"
+)
+
+// Protocol types, re-exported so callers outside this module can name them.
+type (
+	Mark      = engine.Mark
+	ClientMsg = proto.ClientMsg
+	MoveInfo  = proto.MoveInfo
+
+	Assigned  = proto.Assigned
+	Start     = proto.Start
+	State     = proto.State
+	Result    = proto.Result
+	Series    = proto.Series
+	Clock     = proto.Clock
+	Rematch   = proto.Rematch
+	Welcome   = proto.Welcome
+	Resumable = proto.Resumable
+	Opponent  = proto.Opponent
+	Queued    = proto.Queued
+	Chat      = proto.Chat
+	System    = proto.System
+	Error     = proto.Error
+)
+
+const (
+	X = engine.X
+	O = engine.O
+)
+
+// Event is one of the server message types above, Disconnected,
+// Reconnected, or Unknown.
+type Event any
+
+// Disconnected reports a lost connection. Retrying is false when the client
+// gave up; the event channel closes right after.
+type Disconnected struct {
+	Err      error
+	Retrying bool
+}
+
+// Reconnected reports that a held seat was reclaimed.
+type Reconnected struct{}
+
+// Unknown carries a server message this client version does not decode.
+type Unknown struct {
+	Type string
+	Raw  json.RawMessage
+}
+
+var (
+	ErrClosed    = errors.New("client closed")
+	ErrNotSeated = errors.New("not seated in a game")
+)
+
+type Options struct {
+	Code   string // 4-digit room code; "" = auto-match
+	Player string // declared player id
+	Token  string // sign-in token; the server takes the player id from it
+	Rated  bool   // ask for a rated game (needs Token)
+	Side   Mark   // side to ask for when opening a room (server policy permitting)
+
+	// BestOf asks for a best-of-N series when opening a room; Forfeit is
+	// "game" or "series" (what dropping out for good costs).
+	BestOf  int
+	Forfeit string
+	Public  bool // list the room in the lobby while waiting for an opponent
+
+	// Hello is sent when Name or Features is set; otherwise the client
+	// speaks protocol version 1.
+	Name     string
+	Features []string
+
+	CBOR bool // negotiate the binary encoding
+
+	// Reconnect resumes the seat after a drop if the server offered a token.
+	Reconnect  bool
+	MaxRetries int           // default 5
+	Backoff    time.Duration // first retry delay, doubling (default 200ms)
+
+	HTTPClient *http.Client
+	Buffer     int // event channel size (default 64)
+}
+
+type Client struct {
+	base   string // ws[s]://host[:port]
+	opts   Options
+	codec  codec.Codec
+	events chan Event
+	done   chan struct{}
+	prefix string // MsgID prefix
+
+	mu      sync.Mutex
+	ws      *websocket.Conn
+	mark    Mark
+	seq     int // last ServerSeq seen
+	token   string
+	msgN    int
+	pending *ClientMsg // move not yet answered, resent after a resume
+	closed  bool
+}
+
+// Dial connects to the server at base (http://, https://, ws:// or wss://
+// host) and starts delivering events.
+func Dial(ctx context.Context, base string, opts Options) (*Client, error) {
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = 5
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 200 * time.Millisecond
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = 64
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return nil, errors.New("client: unsupported scheme " + u.Scheme)
+	}
+	c := &Client{
+		base:   u.Scheme + "://" + u.Host,
+		opts:   opts,
+		codec:  codec.JSON,
+		events: make(chan Event, opts.Buffer),
+		done:   make(chan struct{}),
+		prefix: randomHex(4),
+	}
+	if opts.CBOR {
+		c.codec = codec.CBOR
+	}
+
+	ws, err := c.dial(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	c.ws = ws
+	if opts.Name != "" || opts.Features != nil {
+		if err := c.Send(ctx, ClientMsg{Type: "hello", Version: proto.CurrentVersion, Client: opts.Name, Features: opts.Features}); err != nil {
+			_ = ws.CloseNow()
+			return nil, err
+		}
+	}
+	go c.run(ws)
+	return c, nil
+}
+
+func (c *Client) dial(ctx context.Context, resume string) (*websocket.Conn, error) {
+	path := "/ws"
+	if c.opts.Code != "" {
+		path += "/" + c.opts.Code
+	}
+	q := url.Values{}
+	if c.opts.Player != "" {
+		q.Set("player", c.opts.Player)
+	}
+	if c.opts.Rated {
+		q.Set("rated", "1")
+	}
+	if c.opts.Side != "" {
+		q.Set("side", string(c.opts.Side))
+	}
+	if c.opts.BestOf != 0 {
+		q.Set("bestOf", strconv.Itoa(c.opts.BestOf))
+	}
+	if c.opts.Forfeit != "" {
+		q.Set("forfeit", c.opts.Forfeit)
+	}
+	if c.opts.Public {
+		q.Set("public", "1")
+	}
+	if resume != "" {
+		q.Set("resume", resume)
+	}
+	target := c.base + path
+	if len(q) > 0 {
+		target += "?" + q.Encode()
+	}
+	var hdr http.Header
+	if c.opts.Token != "" {
+		hdr = http.Header{"Authorization": {"Bearer " + c.opts.Token}}
+	}
+	ws, _, err := websocket.Dial(ctx, target, &websocket.DialOptions{
+		HTTPClient:   c.opts.HTTPClient,
+		HTTPHeader:   hdr,
+		Subprotocols: []string{c.codec.Name()},
+	})
+	return ws, err
+}
+
+// Events delivers server messages in order. It is closed when the client is
+// closed or gives up reconnecting.
+func (c *Client) Events() <-chan Event { return c.events }
+
+// Mark is this player's mark in the current game ("" until assigned).
+func (c *Client) Mark() Mark {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mark
+}
+
+// Move plays pos (0..8). MsgID and ClientSeq are filled in from the last
+// state seen, so a move is never numbered out of order by the client.
+func (c *Client) Move(ctx context.Context, pos int) error {
+	c.mu.Lock()
+	if c.mark == "" {
+		c.mu.Unlock()
+		return ErrNotSeated
+	}
+	c.msgN++
+	m := ClientMsg{
+		Type:      "move",
+		Position:  &pos,
+		MsgID:     c.prefix + "-" + strconv.Itoa(c.msgN),
+		ClientSeq: c.seq + 1,
+	}
+	c.pending = &m
+	c.mu.Unlock()
+	return c.Send(ctx, m)
+}
+
+func (c *Client) Resign(ctx context.Context) error  { return c.Send(ctx, ClientMsg{Type: "resign"}) }
+func (c *Client) Rematch(ctx context.Context) error { return c.Send(ctx, ClientMsg{Type: "rematch"}) }
+
+func (c *Client) Say(ctx context.Context, text string) error {
+	return c.Send(ctx, ClientMsg{Type: "chat", Text: text})
+}
+
+func (c *Client) Emote(ctx context.Context, emote string) error {
+	return c.Send(ctx, ClientMsg{Type: "emote", Emote: emote})
+}
+
+// Leave forfeits a running game and closes the client. Close alone only
+// drops the connection, which a server holding seats treats as temporary.
+func (c *Client) Leave(ctx context.Context) error {
+	err := c.Send(ctx, ClientMsg{Type: "leave"})
+	_ = c.Close()
+	return err
+}
+
+// Send writes a raw client message.
+func (c *Client) Send(ctx context.Context, m ClientMsg) error {
+	c.mu.Lock()
+	ws, closed := c.ws, c.closed
+	c.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	b, err := c.codec.Marshal(m)
+	if err != nil {
+		return err
+	}
+	typ := websocket.MessageText
+	if c.codec.Binary() {
+		typ = websocket.MessageBinary
+	}
+	return ws.Write(ctx, typ, b)
+}
+
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	ws := c.ws
+	close(c.done)
+	c.mu.Unlock()
+	return ws.Close(websocket.StatusNormalClosure, "bye")
+}
+
+// run reads until the client is closed, reconnecting when it can.
+func (c *Client) run(ws *websocket.Conn) {
+	defer close(c.events)
+	for {
+		err := c.read(ws)
+		c.mu.Lock()
+		closed, token := c.closed, c.token
+		c.mu.Unlock()
+		if closed {
+			return
+		}
+		if !c.opts.Reconnect || token == "" {
+			c.emit(Disconnected{Err: err})
+			return
+		}
+		c.emit(Disconnected{Err: err, Retrying: true})
+		if ws = c.reconnect(token); ws == nil {
+			c.emit(Disconnected{Err: err})
+			return
+		}
+		c.emit(Reconnected{})
+	}
+}
+
+func (c *Client) reconnect(token string) *websocket.Conn {
+	wait := c.opts.Backoff
+	for i := 0; i < c.opts.MaxRetries; i++ {
+		select {
+		case <-c.done:
+			return nil
+		case <-time.After(wait):
+		}
+		wait *= 2
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ws, err := c.dial(ctx, token)
+		cancel()
+		if err != nil {
+			continue
+		}
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			_ = ws.CloseNow()
+			return nil
+		}
+		c.ws = ws
+		c.mu.Unlock()
+		return ws
+	}
+	return nil
+}
+
+func (c *Client) read(ws *websocket.Conn) error {
+	ctx := context.Background()
+	for {
+		_, data, err := ws.Read(ctx)
+		if err != nil {
+			return err
+		}
+		raw, err := c.codec.ToJSON(data)
+		if err != nil {
+			continue
+		}
+		ev := decode(raw)
+		if resend := c.track(ev); resend != nil {
+			_ = c.Send(ctx, *resend)
+		}
+		c.emit(ev)
+	}
+}
+
+// track keeps the client's view of the game current. It returns a move to
+// resend when a resumed seat shows the last move never arrived.
+func (c *Client) track(ev Event) *ClientMsg {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch e := ev.(type) {
+	case Assigned:
+		c.mark = e.You
+	case Start:
+		c.seq, c.pending = 0, nil
+	case State:
+		c.seq = e.ServerSeq
+		if c.pending != nil && e.ServerSeq >= c.pending.ClientSeq {
+			c.pending = nil
+		}
+	case Error:
+		if moveErrors[e.Code] {
+			c.pending = nil
+		}
+	case Resumable:
+		resumed := c.token == e.Token
+		c.token = e.Token
+		// A resume replays assigned, start and state before this; a move
+		// still pending was lost with the old connection.
+		if resumed && c.pending != nil && c.pending.ClientSeq == c.seq+1 {
+			m := *c.pending
+			return &m
+		}
+	}
+	return nil
+}
+
+// moveErrors answer a move, so it is no longer pending.
+var moveErrors = map[string]bool{
+	"NOT_PAIRED": true, "NOT_YOUR_TURN": true, "INVALID_POSITION": true,
+	"CELL_TAKEN": true, "OUT_OF_ORDER": true, "TERMINAL": true, "INVALID": true,
+	"TIME_UP": true,
+}
+
+func (c *Client) emit(ev Event) {
+	select {
+	case c.events <- ev:
+	case <-c.done:
+	}
+}
+
+func decode(raw []byte) Event {
+	var head struct {
+		Type string `json:"type"`
+	}
+	_ = json.Unmarshal(raw, &head)
+	switch head.Type {
+	case "assigned":
+		return as[Assigned](head.Type, raw)
+	case "start":
+		return as[Start](head.Type, raw)
+	case "state":
+		return as[State](head.Type, raw)
+	case "result":
+		return as[Result](head.Type, raw)
+	case "series":
+		return as[Series](head.Type, raw)
+	case "clock":
+		return as[Clock](head.Type, raw)
+	case "rematch":
+		return as[Rematch](head.Type, raw)
+	case "welcome":
+		return as[Welcome](head.Type, raw)
+	case "resumable":
+		return as[Resumable](head.Type, raw)
+	case "opponent":
+		return as[Opponent](head.Type, raw)
+	case "queued":
+		return as[Queued](head.Type, raw)
+	case "chat":
+		return as[Chat](head.Type, raw)
+	case "system":
+		return as[System](head.Type, raw)
+	case "error":
+		return as[Error](head.Type, raw)
+	default:
+		return Unknown{Type: head.Type, Raw: raw}
+	}
+}
+
+func as[T any](typ string, raw []byte) Event {
+	var v T
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return Unknown{Type: typ, Raw: raw}
+	}
+	return v
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
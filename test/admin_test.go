@@ -0,0 +1,193 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/admin"
+	"github.com/kushgupta-hiver/TTT/internal/auth"
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ws"
+	"nhooyr.io/websocket"
+)
+
+type adminFixture struct {
+	srv   ws.Server
+	iss   auth.Issuer
+	game  *httptest.Server
+	api   *httptest.Server
+	audit *admin.AuditLog
+	log   *bytes.Buffer
+}
+
+func newAdminFixture(t *testing.T) *adminFixture {
+	t.Helper()
+	iss, err := auth.NewSigner([]byte("0123456789abcdef"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &adminFixture{srv: ws.NewServer(ws.Config{Game: hub.Config{Auth: iss}}, engine.NewEngine()), iss: iss, log: &bytes.Buffer{}}
+	f.audit = admin.NewAuditLog(f.log, 0)
+	f.game = httptest.NewServer(f.srv)
+	f.api = httptest.NewServer(admin.NewHandler(f.srv, f.audit))
+	t.Cleanup(func() {
+		f.api.Close()
+		f.game.Close()
+		_ = f.srv.Close()
+	})
+	return f
+}
+
+func (f *adminFixture) post(t *testing.T, path, body string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, f.api.URL+path, strings.NewReader(body))
+	req.Header.Set("X-Admin-Actor", "ops@test")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+// readUntil skips frames until one of the given type arrives.
+func readUntil(ctx context.Context, t *testing.T, c *websocket.Conn, typ string) []byte {
+	t.Helper()
+	for {
+		_, data, err := c.Read(ctx)
+		if err != nil {
+			t.Fatalf("waiting for %q: %v", typ, err)
+		}
+		var head struct {
+			Type string `json:"type"`
+		}
+		_ = json.Unmarshal(data, &head)
+		if head.Type == typ {
+			return data
+		}
+	}
+}
+
+func TestAdmin_EndRoomWithDeclaredOutcome(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	f := newAdminFixture(t)
+	base := wsURLFromHTTP(f.game.URL)
+
+	c1, _, _ := websocket.Dial(ctx, base+"/ws/3141", nil)
+	defer c1.Close(websocket.StatusNormalClosure, "bye")
+	c2, _, _ := websocket.Dial(ctx, base+"/ws/3141", nil)
+	defer c2.Close(websocket.StatusNormalClosure, "bye")
+	readUntil(ctx, t, c1, "start")
+	readUntil(ctx, t, c2, "start")
+
+	rooms := f.srv.Snapshot().Rooms
+	if len(rooms) != 1 {
+		t.Fatalf("expected one room, got %d", len(rooms))
+	}
+
+	if resp := f.post(t, "/admin/rooms/"+rooms[0].RoomID+"/end", `{"outcome":"draw"}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("end room: %d", resp.StatusCode)
+	}
+	for _, c := range []*websocket.Conn{c1, c2} {
+		var res proto.Result
+		_ = json.Unmarshal(readUntil(ctx, t, c, "result"), &res)
+		if res.Status != "Draw" {
+			t.Fatalf("expected Draw, got %q", res.Status)
+		}
+	}
+
+	// ending it twice is a conflict, and both attempts are audited
+	if resp := f.post(t, "/admin/rooms/"+rooms[0].RoomID+"/end", `{"outcome":"X"}`); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", resp.StatusCode)
+	}
+	entries := f.audit.Recent(0)
+	if len(entries) != 2 || entries[0].Actor != "ops@test" || entries[0].Action != "end_room" || entries[1].Error == "" {
+		t.Fatalf("unexpected audit trail %+v", entries)
+	}
+	if strings.Count(f.log.String(), "\n") != 2 {
+		t.Fatalf("expected two audit lines, got %q", f.log.String())
+	}
+}
+
+func TestAdmin_BanKicksAndRefusesPlayer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	f := newAdminFixture(t)
+	base := wsURLFromHTTP(f.game.URL)
+
+	token, _ := f.iss.Issue("mallory", time.Hour)
+	c, _, err := websocket.Dial(ctx, base+"/ws/2718?token="+token, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close(websocket.StatusNormalClosure, "bye")
+	// A guest calling themselves mallory is someone else.
+	guest, _, err := websocket.Dial(ctx, base+"/ws/3141?player=mallory", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer guest.Close(websocket.StatusNormalClosure, "bye")
+
+	if resp := f.post(t, "/admin/bans", `{"player":"mallory","seconds":60}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("ban: %d", resp.StatusCode)
+	}
+	var e proto.Error
+	_ = json.Unmarshal(readUntil(ctx, t, c, "error"), &e)
+	if e.Code != "KICKED" {
+		t.Fatalf("expected KICKED, got %+v", e)
+	}
+
+	_, resp, err := websocket.Dial(ctx, base+"/ws/2718?token="+token, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected banned player to be refused, got %v", resp)
+	}
+	again, _, err := websocket.Dial(ctx, base+"/ws/3141?player=mallory", nil)
+	if err != nil {
+		t.Fatalf("guests are banned by address only: %v", err)
+	}
+	defer again.Close(websocket.StatusNormalClosure, "bye")
+	readUntil(ctx, t, guest, "start") // still there, and paired with the newcomer
+	if bans := f.srv.Bans(); len(bans) != 1 || bans[0].Player != "mallory" {
+		t.Fatalf("unexpected bans %+v", bans)
+	}
+}
+
+func TestAdmin_BroadcastReachesEveryone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	f := newAdminFixture(t)
+	base := wsURLFromHTTP(f.game.URL)
+
+	c1, _, _ := websocket.Dial(ctx, base+"/ws/1111", nil)
+	defer c1.Close(websocket.StatusNormalClosure, "bye")
+	c2, _, _ := websocket.Dial(ctx, base+"/ws/2222", nil)
+	defer c2.Close(websocket.StatusNormalClosure, "bye")
+
+	deadline := time.Now().Add(time.Second)
+	for len(f.srv.Conns()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 2 conns, got %d", len(f.srv.Conns()))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if resp := f.post(t, "/admin/broadcast", `{"text":"restarting in 5 minutes"}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("broadcast: %d", resp.StatusCode)
+	}
+	for _, c := range []*websocket.Conn{c1, c2} {
+		var m proto.System
+		_ = json.Unmarshal(readUntil(ctx, t, c, "system"), &m)
+		if m.Text != "restarting in 5 minutes" {
+			t.Fatalf("unexpected system message %+v", m)
+		}
+	}
+}
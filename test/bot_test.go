@@ -0,0 +1,56 @@
+package test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/kushgupta-hiver/TTT/internal/bot"
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+)
+
+func TestBotPerfect_TakesWinAndBlocks(t *testing.T) {
+	p := bot.Perfect()
+	// X to play can win on 2.
+	if got := p.Move([9]string{"X", "X", "", "O", "O", "", "", "", ""}, engine.X); got != 2 {
+		t.Fatalf("expected winning move 2, got %d", got)
+	}
+	// O must block X on 2.
+	if got := p.Move([9]string{"X", "X", "", "", "O", "", "", "", ""}, engine.O); got != 2 {
+		t.Fatalf("expected block on 2, got %d", got)
+	}
+	if got := p.Move([9]string{"X", "O", "X", "X", "O", "O", "O", "X", "X"}, engine.O); got != -1 {
+		t.Fatalf("full board should give -1, got %d", got)
+	}
+}
+
+func TestBotPerfect_NeverLosesToRandom(t *testing.T) {
+	eng := engine.NewEngine()
+	rnd := bot.Random(rand.New(rand.NewSource(7)))
+	for game := 0; game < 200; game++ {
+		perfectMark := engine.X
+		if game%2 == 1 {
+			perfectMark = engine.O
+		}
+		s := eng.NewGame()
+		for s.Status == engine.InProgress {
+			var board [9]string
+			for i, m := range s.Board {
+				board[i] = string(m)
+			}
+			strat := rnd
+			if s.NextTurn == perfectMark {
+				strat = bot.Perfect()
+			}
+			pos := strat.Move(board, s.NextTurn)
+			var err error
+			s, err = eng.ApplyMove(s, engine.Move{Position: pos, Mark: s.NextTurn, ClientSeq: s.ServerSeq + 1})
+			if err != nil {
+				t.Fatalf("game %d: %v", game, err)
+			}
+		}
+		lost := (perfectMark == engine.X && s.Status == engine.OWins) || (perfectMark == engine.O && s.Status == engine.XWins)
+		if lost {
+			t.Fatalf("game %d: perfect bot (%s) lost: %v", game, perfectMark, s.Board)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/chat"
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ws"
+	"nhooyr.io/websocket"
+)
+
+func TestChatClean_LimitsAndFilter(t *testing.T) {
+	f := chat.NewWordFilter("darn")
+
+	got, err := chat.Clean("  well DARN it\x07 ", 50, f)
+	if err != nil || got != "well **** it" {
+		t.Fatalf("expected masked text, got %q (%v)", got, err)
+	}
+	if _, err := chat.Clean("darnation", 50, f); err != nil {
+		t.Fatalf("only whole words are masked: %v", err)
+	}
+	if _, err := chat.Clean("ééééé", 4, f); !errors.Is(err, chat.ErrTooLong) {
+		t.Fatalf("expected ErrTooLong, got %v", err)
+	}
+	if _, err := chat.Clean("   ", 4, f); !errors.Is(err, chat.ErrEmpty) {
+		t.Fatalf("expected ErrEmpty, got %v", err)
+	}
+}
+
+func TestRoomRecord_KeepsMovesAndChat(t *testing.T) {
+	ctx := context.Background()
+	r := match.NewRoom("r-chat", engine.NewEngine(), match.Options{})
+	_ = r.Join(ctx, match.Player{ID: "px", Mark: engine.X})
+	_ = r.Join(ctx, match.Player{ID: "po", Mark: engine.O})
+
+	_, _ = r.Submit(ctx, engine.Move{PlayerID: "px", Position: 4, MsgID: "m1", ClientSeq: 1, Mark: engine.X})
+	_ = r.Say(ctx, match.ChatLine{PlayerID: "po", Text: "nice"})
+	if err := r.Say(ctx, match.ChatLine{PlayerID: "stranger", Text: "hi"}); !errors.Is(err, match.ErrNotSeated) {
+		t.Fatalf("expected ErrNotSeated, got %v", err)
+	}
+
+	rec := r.Record()
+	if rec.X != "px" || rec.O != "po" || len(rec.Moves) != 1 || rec.Moves[0].Pos != 4 {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	if len(rec.Chat) != 1 || rec.Chat[0].Mark != engine.O || rec.Chat[0].Text != "nice" {
+		t.Fatalf("unexpected chat history %+v", rec.Chat)
+	}
+}
+
+func TestWS_ChatRelayAndMute(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	s := ws.NewServer(ws.Config{Game: hub.Config{ChatFilter: chat.NewWordFilter("darn")}}, engine.NewEngine())
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	base := wsURLFromHTTP(ts.URL)
+
+	c1, _, _ := websocket.Dial(ctx, base+"/ws/5050", nil)
+	defer c1.Close(websocket.StatusNormalClosure, "bye")
+	c2, _, _ := websocket.Dial(ctx, base+"/ws/5050", nil)
+	defer c2.Close(websocket.StatusNormalClosure, "bye")
+	readUntil(ctx, t, c1, "start")
+	readUntil(ctx, t, c2, "start")
+
+	_ = c1.Write(ctx, websocket.MessageText, []byte(`{"type":"chat","text":"darn good move"}`))
+	var m proto.Chat
+	_ = json.Unmarshal(readUntil(ctx, t, c2, "chat"), &m)
+	if m.From != engine.X || m.Text != "**** good move" {
+		t.Fatalf("unexpected relayed chat %+v", m)
+	}
+	readUntil(ctx, t, c1, "chat") // sender echo
+
+	// c2 mutes c1: c1's emote is echoed to c1 but not relayed; c2's own chat still flows.
+	_ = c2.Write(ctx, websocket.MessageText, []byte(`{"type":"mute"}`))
+	_ = c2.Write(ctx, websocket.MessageText, []byte(`{"type":"emote","emote":"think"}`))
+	readUntil(ctx, t, c2, "chat") // mute is processed once this echo arrives
+	readUntil(ctx, t, c1, "chat")
+	_ = c1.Write(ctx, websocket.MessageText, []byte(`{"type":"emote","emote":"gg"}`))
+	readUntil(ctx, t, c1, "chat")
+	_ = c2.Write(ctx, websocket.MessageText, []byte(`{"type":"emote","emote":"wave"}`))
+	m = proto.Chat{}
+	_ = json.Unmarshal(readUntil(ctx, t, c2, "chat"), &m)
+	if m.Emote != "wave" {
+		t.Fatalf("muted player should only see own echo, got %+v", m)
+	}
+
+	_ = c1.Write(ctx, websocket.MessageText, []byte(`{"type":"emote","emote":"rickroll"}`))
+	var e proto.Error
+	_ = json.Unmarshal(readUntil(ctx, t, c1, "error"), &e)
+	if e.Code != "BAD_EMOTE" {
+		t.Fatalf("expected BAD_EMOTE, got %+v", e)
+	}
+}
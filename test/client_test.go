@@ -0,0 +1,217 @@
+package test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ws"
+	"github.com/kushgupta-hiver/TTT/pkg/client"
+)
+
+// await returns the next event of type T, failing on timeout or close.
+func await[T any](t *testing.T, c *client.Client) T {
+	t.Helper()
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case ev, ok := <-c.Events():
+			if !ok {
+				var zero T
+				t.Fatalf("events closed waiting for %T", zero)
+			}
+			if v, ok := ev.(T); ok {
+				return v
+			}
+		case <-timeout:
+			var zero T
+			t.Fatalf("timed out waiting for %T", zero)
+		}
+	}
+}
+
+// cutProxy forwards TCP to target and can sever every live connection.
+type cutProxy struct {
+	ln     net.Listener
+	target string
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func newCutProxy(t *testing.T, target string) *cutProxy {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &cutProxy{ln: ln, target: target}
+	go func() {
+		for {
+			in, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			out, err := net.Dial("tcp", target)
+			if err != nil {
+				in.Close()
+				continue
+			}
+			p.mu.Lock()
+			p.conns = append(p.conns, in, out)
+			p.mu.Unlock()
+			go func() { _, _ = io.Copy(out, in); out.Close() }()
+			go func() { _, _ = io.Copy(in, out); in.Close() }()
+		}
+	}()
+	t.Cleanup(func() { ln.Close(); p.cut() })
+	return p
+}
+
+func (p *cutProxy) URL() string { return "http://" + p.ln.Addr().String() }
+
+func (p *cutProxy) cut() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.conns {
+		c.Close()
+	}
+	p.conns = nil
+}
+
+func TestClient_PlaysFullGame(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	ts := httptest.NewServer(ws.NewServer(ws.Config{}, engine.NewEngine()))
+	defer ts.Close()
+
+	x, err := client.Dial(ctx, ts.URL, client.Options{Code: "4242", Features: []string{"last_move"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+	// await skips other events: X's welcome must come before the pairing.
+	if w := await[client.Welcome](t, x); len(w.Enabled) != 1 {
+		t.Fatalf("unexpected welcome %+v", w)
+	}
+	o, err := client.Dial(ctx, ts.URL, client.Options{Code: "4242"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	if a := await[client.Assigned](t, x); a.You != client.X || x.Mark() != client.X {
+		t.Fatalf("expected X, got %+v", a)
+	}
+	await[client.Start](t, o)
+
+	for i, step := range []struct {
+		c   *client.Client
+		pos int
+	}{{x, 0}, {o, 3}, {x, 1}, {o, 4}, {x, 2}} {
+		if err := step.c.Move(ctx, step.pos); err != nil {
+			t.Fatal(err)
+		}
+		sx, so := await[client.State](t, x), await[client.State](t, o)
+		if sx.ServerSeq != i+1 || so.ServerSeq != i+1 {
+			t.Fatalf("move %d: seq %d/%d", i, sx.ServerSeq, so.ServerSeq)
+		}
+		if sx.LastMove == nil || sx.LastMove.Pos != step.pos {
+			t.Fatalf("move %d: last_move %+v", i, sx.LastMove)
+		}
+	}
+	if r := await[client.Result](t, o); r.Status != "X wins!" {
+		t.Fatalf("unexpected result %+v", r)
+	}
+}
+
+func TestClient_ResumesSeatAfterDrop(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	h := hub.NewHub(hub.Config{ResumeGrace: 3 * time.Second}, engine.NewEngine())
+	defer h.Close()
+	ts := httptest.NewServer(ws.NewServer(ws.Config{Hub: h}, engine.NewEngine()))
+	defer ts.Close()
+	px := newCutProxy(t, ts.Listener.Addr().String())
+
+	x, err := client.Dial(ctx, px.URL(), client.Options{Code: "5151", Reconnect: true, Backoff: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+	o, err := client.Dial(ctx, ts.URL, client.Options{Code: "5151"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	await[client.Resumable](t, x)
+	await[client.Start](t, o)
+
+	_ = x.Move(ctx, 0)
+	await[client.State](t, o)
+	_ = o.Move(ctx, 4)
+	await[client.State](t, x)
+	await[client.State](t, x)
+
+	px.cut()
+	if d := await[client.Disconnected](t, x); !d.Retrying {
+		t.Fatalf("expected a retry, got %+v", d)
+	}
+	if op := await[client.Opponent](t, o); op.Status != "away" || op.GraceMs != 3000 {
+		t.Fatalf("unexpected opponent status %+v", op)
+	}
+	await[client.Reconnected](t, x)
+	if st := await[client.State](t, x); st.ServerSeq != 2 || st.Board[4] != "O" {
+		t.Fatalf("resumed client should see the game where it was, got %+v", st)
+	}
+	if op := await[client.Opponent](t, o); op.Status != "back" {
+		t.Fatalf("unexpected opponent status %+v", op)
+	}
+
+	if err := x.Move(ctx, 8); err != nil {
+		t.Fatal(err)
+	}
+	if st := await[client.State](t, o); st.Board[8] != "X" || st.ServerSeq != 3 {
+		t.Fatalf("move after resume not applied: %+v", st)
+	}
+}
+
+func TestClient_ForfeitsWhenGraceRunsOut(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	h := hub.NewHub(hub.Config{ResumeGrace: 100 * time.Millisecond}, engine.NewEngine())
+	defer h.Close()
+	ts := httptest.NewServer(ws.NewServer(ws.Config{Hub: h}, engine.NewEngine()))
+	defer ts.Close()
+	px := newCutProxy(t, ts.Listener.Addr().String())
+
+	x, err := client.Dial(ctx, px.URL(), client.Options{Code: "6161"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+	o, err := client.Dial(ctx, ts.URL, client.Options{Code: "6161"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	await[client.Start](t, x)
+	await[client.Start](t, o)
+
+	px.cut()
+	if d := await[client.Disconnected](t, x); d.Retrying {
+		t.Fatalf("client without Reconnect should give up, got %+v", d)
+	}
+	await[client.Opponent](t, o)
+	if r := await[client.Result](t, o); r.Status != "O wins!" {
+		t.Fatalf("expected forfeit after grace, got %+v", r)
+	}
+	if len(h.Conns()) != 1 {
+		t.Fatalf("forfeited seat should be released, conns=%+v", h.Conns())
+	}
+}
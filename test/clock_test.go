@@ -0,0 +1,141 @@
+package test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ws"
+	"github.com/kushgupta-hiver/TTT/pkg/client"
+)
+
+func TestTimeControl_Parse(t *testing.T) {
+	for s, want := range map[string]match.TimeControl{
+		"5+0":   {Base: 5 * time.Minute},
+		"3+2":   {Base: 3 * time.Minute, Increment: 2 * time.Second},
+		"60+60": {Base: time.Hour, Increment: time.Minute},
+	} {
+		got, err := match.ParseTimeControl(s)
+		if err != nil || got != want || got.String() != s {
+			t.Fatalf("%q: %+v %v", s, got, err)
+		}
+	}
+	for _, s := range []string{"", "5", "0+1", "61+0", "5+61", "x+y", "-1+0"} {
+		if _, err := match.ParseTimeControl(s); err == nil {
+			t.Fatalf("%q should not parse", s)
+		}
+	}
+}
+
+func TestRoom_FlagFallsWhenTimeRunsOut(t *testing.T) {
+	ctx := context.Background()
+	flagged := make(chan string, 1)
+	finished := make(chan match.Record, 1)
+	r := match.NewRoom("r1", engine.NewEngine(), match.Options{
+		TimeControl: match.TimeControl{Base: 200 * time.Millisecond, Increment: time.Second},
+		OnFlag:      func(p string) { flagged <- p },
+		OnFinish:    func(rec match.Record) { finished <- rec },
+	})
+	if _, ok := r.Clock(); ok {
+		t.Fatal("the clock waits for both players")
+	}
+	_ = r.Join(ctx, match.Player{ID: "px", Mark: engine.X})
+	_ = r.Join(ctx, match.Player{ID: "po", Mark: engine.O})
+	if c, ok := r.Clock(); !ok || c.Running != engine.X || c.O != 200*time.Millisecond {
+		t.Fatalf("clock %+v %v", c, ok)
+	}
+	if _, err := r.Submit(ctx, engine.Move{PlayerID: "px", Position: 4, MsgID: "m1", ClientSeq: 1, Mark: engine.X}); err != nil {
+		t.Fatal(err)
+	}
+	// X gained the increment; O's time is running.
+	if c, _ := r.Clock(); c.Running != engine.O || c.X < time.Second {
+		t.Fatalf("after X moved: %+v", c)
+	}
+
+	select {
+	case p := <-flagged:
+		if p != "po" {
+			t.Fatalf("flagged %s", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("O's flag never fell")
+	}
+	if rec := <-finished; rec.Outcome != engine.XWins || rec.Reason != match.ReasonFlag {
+		t.Fatalf("finished %+v", rec)
+	}
+	if _, err := r.Submit(ctx, engine.Move{PlayerID: "po", Position: 0, MsgID: "m2", ClientSeq: 2, Mark: engine.O}); err == nil {
+		t.Fatal("no moves after the flag")
+	}
+}
+
+func TestRoom_ClockSurvivesARestore(t *testing.T) {
+	start := time.Now().Add(-20 * time.Second)
+	events := []match.Event{
+		{Kind: match.EventOpen, At: start, Clock: "1+2"},
+		{Kind: match.EventJoin, At: start, Player: "px", Mark: engine.X},
+		{Kind: match.EventJoin, At: start, Player: "po", Mark: engine.O},
+		{Kind: match.EventMove, At: start.Add(10 * time.Second), Player: "px", Mark: engine.X, Pos: 4, MsgID: "m1", Seq: 1, Outcome: engine.InProgress},
+	}
+	tc, _ := match.ParseTimeControl("1+2")
+	r, err := match.Restore("r1", engine.NewEngine(), match.Options{TimeControl: tc}, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// X thought for 10s and gained 2; O has been thinking since, through
+	// the downtime.
+	c, ok := r.Clock()
+	if !ok || c.X != 52*time.Second || c.Running != engine.O || c.O > 50*time.Second || c.O < 45*time.Second {
+		t.Fatalf("restored clock %+v", c)
+	}
+
+	events = append(events, match.Event{Kind: match.EventFlag, At: start.Add(70 * time.Second), Player: "po", Outcome: engine.XWins})
+	r, err = match.Restore("r1", engine.NewEngine(), match.Options{TimeControl: tc}, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := r.Record(); rec.Reason != match.ReasonFlag || rec.Outcome != engine.XWins {
+		t.Fatalf("replayed flag: %+v", rec)
+	}
+}
+
+func TestReserve_TimedGameIsLostOnTime(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	over := make(chan hub.GameOver, 1)
+	h := hub.NewHub(hub.Config{OnGameOver: func(g hub.GameOver) { over <- g }}, engine.NewEngine())
+	t.Cleanup(func() { h.Close() })
+	ts := httptest.NewServer(ws.NewServer(ws.Config{Hub: h}, engine.NewEngine()))
+	t.Cleanup(ts.Close)
+
+	code, err := h.Reserve(hub.Reservation{X: "ann", O: "bob", Clock: match.TimeControl{Base: 300 * time.Millisecond}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ann, err := client.Dial(ctx, ts.URL, client.Options{Code: code, Player: "ann"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ann.Close()
+	bob, err := client.Dial(ctx, ts.URL, client.Options{Code: code, Player: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bob.Close()
+
+	if c := await[client.Clock](t, bob); c.Running != client.X || c.OMs != 300 {
+		t.Fatalf("clock %+v", c)
+	}
+	// ann, as X, never moves.
+	for _, c := range []*client.Client{ann, bob} {
+		if r := await[client.Result](t, c); r.Status != "O wins!" {
+			t.Fatalf("result %+v", r)
+		}
+	}
+	if g := awaitOver(t, over); g.Record.Reason != match.ReasonFlag {
+		t.Fatalf("game over %+v", g)
+	}
+}
@@ -0,0 +1,391 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/auth"
+	"github.com/kushgupta-hiver/TTT/internal/cluster"
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+	"github.com/kushgupta-hiver/TTT/internal/store"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ws"
+	"nhooyr.io/websocket"
+)
+
+// tcpBroker runs a broker server and returns a function that connects a
+// node to it, as a separate process would.
+func tcpBroker(t *testing.T) func() cluster.Broker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := cluster.NewServer("s3cret")
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	if _, err := cluster.Dial(ln.Addr().String(), "guess"); !errors.Is(err, cluster.ErrDenied) {
+		t.Fatalf("a node without the secret must be refused: %v", err)
+	}
+	return func() cluster.Broker {
+		b, err := cluster.Dial(ln.Addr().String(), "s3cret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = b.Close() })
+		return b
+	}
+}
+
+// clusterNode serves a hub that joins the cluster through b.
+func clusterNode(t *testing.T, b cluster.Broker, name string, over chan hub.GameOver) string {
+	t.Helper()
+	h := hub.NewHub(hub.Config{
+		Cluster:     b,
+		Node:        name,
+		ResumeGrace: 5 * time.Second,
+		OnGameOver:  func(g hub.GameOver) { over <- g },
+	}, engine.NewEngine())
+	ts := httptest.NewServer(ws.NewServer(ws.Config{Hub: h}, engine.NewEngine()))
+	t.Cleanup(func() {
+		ts.Close()
+		_ = h.Close()
+	})
+	return wsURLFromHTTP(ts.URL)
+}
+
+func TestBroker_DeliversInOrderAndClaimsOnce(t *testing.T) {
+	dial := tcpBroker(t)
+	mem := cluster.NewMemory()
+	t.Cleanup(func() { _ = mem.Close() })
+	for name, pair := range map[string][2]cluster.Broker{
+		"memory": {mem, mem},
+		"tcp":    {dial(), dial()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			a, b := pair[0], pair[1]
+			got := make(chan string, 100)
+			cancel, err := b.Subscribe("t", func(msg []byte) { got <- string(msg) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The subscription is in place once a later request is answered.
+			_, _ = b.Claim("sync", "b")
+			for i := 0; i < 50; i++ {
+				_ = a.Publish("t", []byte(strconvI(i)))
+			}
+			for i := 0; i < 50; i++ {
+				select {
+				case msg := <-got:
+					if msg != strconvI(i) {
+						t.Fatalf("message %d is %q", i, msg)
+					}
+				case <-time.After(2 * time.Second):
+					t.Fatalf("message %d never came", i)
+				}
+			}
+			cancel()
+
+			var wg sync.WaitGroup
+			owners := make([]string, 8)
+			for i := range owners {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					node := []string{"a", "b"}[i%2]
+					owners[i], _ = []cluster.Broker{a, b}[i%2].Claim("code/1234", node)
+				}(i)
+			}
+			wg.Wait()
+			for _, o := range owners {
+				if o != owners[0] {
+					t.Fatalf("two owners for one key: %v", owners)
+				}
+			}
+			_ = b.Release("code/1234", "someone-else")
+			if o, _ := a.Claim("code/1234", "c"); o != owners[0] {
+				t.Fatalf("only the owner can release: %s", o)
+			}
+			// Requests on one connection are handled in order.
+			owner := pair[owners[0][0]-'a']
+			_ = owner.Release("code/1234", owners[0])
+			if o, _ := owner.Claim("code/1234", "c"); o != "c" {
+				t.Fatalf("a released key is free: %s", o)
+			}
+		})
+	}
+
+	// A node that goes away gives up what it owned.
+	a, b := dial(), dial()
+	if o, _ := a.Claim("queue/casual", "a"); o != "a" {
+		t.Fatal(o)
+	}
+	_ = a.Close()
+	if _, err := a.Claim("x", "a"); err == nil {
+		t.Fatal("a closed broker refuses claims")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for o, _ := b.Claim("queue/casual", "b"); o != "b"; o, _ = b.Claim("queue/casual", "b") {
+		if time.Now().After(deadline) {
+			t.Fatalf("still owned by %s", o)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCluster_PlayersOnDifferentNodesPlayEachOther(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dial := tcpBroker(t)
+	over := make(chan hub.GameOver, 4)
+	nodeA := clusterNode(t, dial(), "a", over)
+	nodeB := clusterNode(t, dial(), "b", over)
+
+	connect := func(url string) *websocket.Conn {
+		c, _, err := websocket.Dial(ctx, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = c.CloseNow() })
+		return c
+	}
+	mark := func(c *websocket.Conn) engine.Mark {
+		var a proto.Assigned
+		_ = json.Unmarshal(readUntil(ctx, t, c, "assigned"), &a)
+		return a.You
+	}
+	move := func(c, peer *websocket.Conn, pos int) {
+		send(ctx, t, c, map[string]any{"type": "move", "position": pos})
+		readUntil(ctx, t, c, "state")
+		readUntil(ctx, t, peer, "state")
+	}
+
+	// The room code is claimed by node a; bob joins it through node b.
+	ann := connect(nodeA + "/ws/1234?player=ann")
+	time.Sleep(50 * time.Millisecond) // ann is waiting
+	bob := connect(nodeB + "/ws/1234?player=bob")
+	if mark(ann) != engine.X || mark(bob) != engine.O {
+		t.Fatal("the first to arrive plays X")
+	}
+	var r proto.Resumable
+	_ = json.Unmarshal(readUntil(ctx, t, bob, "resumable"), &r)
+	move(ann, bob, 0)
+	move(bob, ann, 4)
+
+	// bob drops and comes back through node a this time.
+	_ = bob.Close(websocket.StatusNormalClosure, "")
+	readUntil(ctx, t, ann, "opponent")
+	bob = connect(nodeA + "/ws?resume=" + r.Token)
+	var st proto.Start
+	_ = json.Unmarshal(readUntil(ctx, t, bob, "start"), &st)
+	if st.Board[0] != "X" || st.Board[4] != "O" {
+		t.Fatalf("bob resumed to %+v", st)
+	}
+	readUntil(ctx, t, bob, "state")
+
+	move(ann, bob, 1)
+	move(bob, ann, 5)
+	move(ann, bob, 2)
+	var res proto.Result
+	_ = json.Unmarshal(readUntil(ctx, t, bob, "result"), &res)
+	if res.Status != "X wins!" {
+		t.Fatalf("result %+v", res)
+	}
+	if g := awaitOver(t, over); g.X != "ann" || g.O != "bob" {
+		t.Fatalf("game over %+v", g)
+	}
+
+	// Auto-match pairs across nodes too, through the node that owns the queue.
+	cat := connect(nodeB + "/ws?player=cat")
+	dan := connect(nodeA + "/ws?player=dan")
+	if m1, m2 := mark(cat), mark(dan); m1 == m2 || m1 == "" || m2 == "" {
+		t.Fatalf("marks %q and %q", m1, m2)
+	}
+}
+
+func TestCluster_RoomCodesAreUniqueAcrossNodes(t *testing.T) {
+	b := cluster.NewMemory()
+	t.Cleanup(func() { _ = b.Close() })
+	var hubs []hub.Hub
+	for _, name := range []string{"a", "b", "c"} {
+		h := hub.NewHub(hub.Config{Cluster: b, Node: name}, engine.NewEngine())
+		t.Cleanup(func() { _ = h.Close() })
+		hubs = append(hubs, h)
+	}
+	seen := map[string]bool{}
+	for i := 0; i < 300; i++ {
+		code, err := hubs[i%3].Reserve(hub.Reservation{X: "ann", O: "bob"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[code] {
+			t.Fatalf("code %s booked twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestBroker_SlowSubscriberIsCut(t *testing.T) {
+	b := cluster.NewMemory()
+	t.Cleanup(func() { _ = b.Close() })
+	stuck := make(chan struct{})
+	t.Cleanup(func() { close(stuck) })
+	_, _ = b.Subscribe("t", func([]byte) { <-stuck })
+	var err error
+	for i := 0; i < 10000 && err == nil; i++ {
+		err = b.Publish("t", []byte("x"))
+	}
+	if !errors.Is(err, cluster.ErrBacklog) {
+		t.Fatalf("publishing to a stuck subscriber: %v", err)
+	}
+}
+
+func TestCluster_RelayedPlayersAreVerifiedAgain(t *testing.T) {
+	iss, err := auth.NewSigner([]byte("0123456789abcdef"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := cluster.NewMemory()
+	t.Cleanup(func() { _ = b.Close() })
+	h := hub.NewHub(hub.Config{Cluster: b, Node: "a", Auth: iss}, engine.NewEngine())
+	t.Cleanup(func() { _ = h.Close() })
+
+	got := make(chan proto.Error, 4)
+	_, _ = b.Subscribe("node/evil", func(msg []byte) {
+		var e struct{ Data []byte }
+		var pe proto.Error
+		if json.Unmarshal(msg, &e) == nil && json.Unmarshal(e.Data, &pe) == nil {
+			got <- pe
+		}
+	})
+	attach := func(session string, a hub.Attach) {
+		msg, _ := json.Marshal(map[string]any{"kind": "attach", "from": "evil", "session": session, "attach": a})
+		_ = b.Publish("node/a", msg)
+	}
+	expect := func(code string) {
+		t.Helper()
+		select {
+		case e := <-got:
+			if e.Code != code {
+				t.Fatalf("error %+v, want %s", e, code)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no %s", code)
+		}
+	}
+
+	// A node's say-so does not sign anyone in.
+	attach("s1", hub.Attach{Player: "ann", Addr: "10.0.0.1", Authenticated: true, Rated: true})
+	expect("AUTH_REQUIRED")
+	attach("s2", hub.Attach{Player: "ann", Addr: "10.0.0.1", Authenticated: true, Token: "forged", Rated: true})
+	expect("AUTH_REQUIRED")
+
+	// A real token does.
+	token, _ := iss.Issue("ann", time.Hour)
+	attach("s3", hub.Attach{Player: "whoever", Addr: "10.0.0.1", Token: token, Rated: true})
+	select {
+	case e := <-got:
+		if e.Type == "error" {
+			t.Fatalf("signed-in player refused: %+v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the signed-in player heard nothing")
+	}
+}
+
+func TestCluster_RecoveredRoomsClaimTheirCodes(t *testing.T) {
+	b := cluster.NewMemory()
+	t.Cleanup(func() { _ = b.Close() })
+	if _, err := b.Claim("code/4242", "other"); err != nil { // handed out while this node was down
+		t.Fatal(err)
+	}
+	wal := store.NewRoomLog(store.NewMemory())
+	for id, code := range map[string]string{"lost": "4242", "kept": "5555"} {
+		_ = wal.Append(id, match.Event{Kind: match.EventOpen, Code: code})
+		_ = wal.Append(id, match.Event{Kind: match.EventJoin, Player: "px", Name: "ann", Key: id + "x", Mark: engine.X})
+		_ = wal.Append(id, match.Event{Kind: match.EventJoin, Player: "po", Name: "bob", Key: id + "o", Mark: engine.O})
+	}
+
+	h := hub.NewHub(hub.Config{Cluster: b, Node: "me", Rooms: wal}, engine.NewEngine())
+	t.Cleanup(func() { _ = h.Close() })
+	if owner, _ := b.Claim("code/5555", "other"); owner != "me" {
+		t.Fatalf("5555 is owned by %q", owner)
+	}
+	logs, _ := wal.Load()
+	if _, ok := logs["lost"]; ok || len(logs["kept"]) != 3 {
+		t.Fatalf("logs after recovery: %+v", logs)
+	}
+}
+
+func TestBroker_NodeReconnectsAndClaimsAgain(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	srv := cluster.NewServer("s3cret")
+	go func() { _ = srv.Serve(ln) }()
+
+	b, err := cluster.Dial(addr, "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+	got := make(chan string, 10)
+	if _, err := b.Subscribe("t", func(msg []byte) { got <- string(msg) }); err != nil {
+		t.Fatal(err)
+	}
+	if owner, err := b.Claim("code/1234", "n1"); err != nil || owner != "n1" {
+		t.Fatalf("claim: %q %v", owner, err)
+	}
+
+	_ = srv.Close() // the broker restarts
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for b.Ping(ctx) == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := b.Ping(ctx); !errors.Is(err, cluster.ErrDisconnected) {
+		t.Fatalf("ping while away: %v", err)
+	}
+	if ln, err = net.Listen("tcp", addr); err != nil {
+		t.Fatal(err)
+	}
+	srv = cluster.NewServer("s3cret")
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	for b.Ping(ctx) != nil {
+		if ctx.Err() != nil {
+			t.Fatal("the node never came back")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Frames are handled in order: once a message comes back, so has the claim.
+	for len(got) == 0 {
+		_ = b.Publish("t", []byte("back"))
+		select {
+		case msg := <-got:
+			got <- msg
+		case <-time.After(50 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("subscription not renewed")
+		}
+	}
+	other, err := cluster.Dial(addr, "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = other.Close() })
+	if owner, _ := other.Claim("code/1234", "n2"); owner != "n1" {
+		t.Fatalf("code/1234 is owned by %q after the reconnect", owner)
+	}
+}
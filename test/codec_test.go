@@ -0,0 +1,168 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/codec"
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ws"
+	"nhooyr.io/websocket"
+)
+
+func intp(i int) *int { return &i }
+
+func TestCodec_RoundTripMatchesJSON(t *testing.T) {
+	msgs := []any{
+		proto.Assigned{Type: "assigned", You: engine.O},
+		proto.Start{Type: "start", Board: [9]string{"X", "", "O"}, YourTurn: true},
+		proto.State{Type: "state", Board: [9]string{4: "X"}, NextTurn: engine.O, LastMove: &proto.MoveInfo{By: engine.X, Pos: 4}, ServerSeq: 70000},
+		proto.Result{Type: "result", Status: "draw"},
+		proto.Error{Type: "error", Code: "RATE_LIMITED", Detail: "ünïcode ✓", RetryAfterMs: 1500},
+		proto.Chat{Type: "chat", From: engine.X, Text: "gg"},
+		proto.ClientMsg{Type: "move", Position: intp(8), MsgID: "m-1", ClientSeq: 1 << 40},
+	}
+	for _, m := range msgs {
+		for _, c := range []codec.Codec{codec.JSON, codec.CBOR} {
+			b, err := c.Marshal(m)
+			if err != nil {
+				t.Fatalf("%s marshal %T: %v", c.Name(), m, err)
+			}
+			out := reflect.New(reflect.TypeOf(m))
+			if err := c.Unmarshal(b, out.Interface()); err != nil {
+				t.Fatalf("%s unmarshal %T: %v", c.Name(), m, err)
+			}
+			if !reflect.DeepEqual(out.Elem().Interface(), m) {
+				t.Fatalf("%s round trip of %T:\n got %+v\nwant %+v", c.Name(), m, out.Elem().Interface(), m)
+			}
+
+			// The JSON view of a CBOR frame is the same document json.Marshal gives.
+			j, err := c.ToJSON(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := json.Marshal(m)
+			if !jsonEqual(t, j, want) {
+				t.Fatalf("%s JSON view differs:\n got %s\nwant %s", c.Name(), j, want)
+			}
+		}
+	}
+}
+
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var x, y any
+	if err := json.Unmarshal(a, &x); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &y); err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func TestCodec_CBORKnownEncodingAndErrors(t *testing.T) {
+	// {"a":1,"b":[-1,true,null]} per RFC 8949 with sorted keys.
+	b, err := codec.FromJSON([]byte(`{"b":[-1,true,null],"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0xa2, 0x61, 'a', 0x01, 0x61, 'b', 0x83, 0x20, 0xf5, 0xf6}
+	if !bytes.Equal(b, want) {
+		t.Fatalf("got % x want % x", b, want)
+	}
+
+	// Half-precision 1.5 decodes as a plain number.
+	if j, err := codec.CBOR.ToJSON([]byte{0xf9, 0x3e, 0x00}); err != nil || string(j) != "1.5" {
+		t.Fatalf("half float: %s %v", j, err)
+	}
+	for name, in := range map[string][]byte{
+		"truncated": {0x63, 'a'},
+		"trailing":  {0x01, 0x02},
+		"int key":   {0xa1, 0x01, 0x01},
+		"huge len":  {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	} {
+		if _, err := codec.CBOR.ToJSON(in); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestWS_CBORSubprotocolPlaysAgainstJSONClient(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	ts := httptest.NewServer(ws.NewServer(ws.Config{}, engine.NewEngine()))
+	defer ts.Close()
+
+	bin, _, err := websocket.Dial(ctx, wsURLFromHTTP(ts.URL)+"/ws/7070", &websocket.DialOptions{
+		Subprotocols: []string{codec.CBORProtocol},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bin.Close(websocket.StatusNormalClosure, "bye")
+	if bin.Subprotocol() != codec.CBORProtocol {
+		t.Fatalf("negotiated %q", bin.Subprotocol())
+	}
+	txt, _, err := websocket.Dial(ctx, wsURLFromHTTP(ts.URL)+"/ws/7070", &websocket.DialOptions{
+		Subprotocols: []string{codec.JSONProtocol},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer txt.Close(websocket.StatusNormalClosure, "bye")
+
+	readCBOR := func(typ string) []byte {
+		t.Helper()
+		for {
+			mt, data, err := bin.Read(ctx)
+			if err != nil {
+				t.Fatalf("waiting for %s: %v", typ, err)
+			}
+			if mt != websocket.MessageBinary {
+				t.Fatalf("expected binary frame, got %v", mt)
+			}
+			var env struct{ Type string }
+			if err := codec.CBOR.Unmarshal(data, &env); err != nil {
+				t.Fatal(err)
+			}
+			if env.Type == typ {
+				return data
+			}
+		}
+	}
+
+	var a proto.Assigned
+	_ = codec.CBOR.Unmarshal(readCBOR("assigned"), &a)
+	if a.You != engine.X {
+		t.Fatalf("first player should be X, got %+v", a)
+	}
+	readCBOR("start")
+	readUntil(ctx, t, txt, "start")
+
+	mv, _ := codec.CBOR.Marshal(proto.ClientMsg{Type: "move", Position: intp(0), MsgID: "c1", ClientSeq: 1})
+	_ = bin.Write(ctx, websocket.MessageBinary, mv)
+
+	var st proto.State
+	_ = json.Unmarshal(readUntil(ctx, t, txt, "state"), &st)
+	var stBin proto.State
+	_ = codec.CBOR.Unmarshal(readCBOR("state"), &stBin)
+	if st.Board[0] != "X" || !reflect.DeepEqual(st, stBin) {
+		t.Fatalf("clients disagree:\njson %+v\ncbor %+v", st, stBin)
+	}
+
+	// A text frame on a CBOR connection is refused, not silently dropped.
+	_ = bin.Write(ctx, websocket.MessageText, []byte(`{"type":"ping"}`))
+	var e proto.Error
+	_ = codec.CBOR.Unmarshal(readCBOR("error"), &e)
+	if e.Code != "BAD_FRAME" {
+		t.Fatalf("expected BAD_FRAME, got %+v", e)
+	}
+}
@@ -0,0 +1,183 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/health"
+	"github.com/kushgupta-hiver/TTT/internal/httpx"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ws"
+	"nhooyr.io/websocket"
+)
+
+func TestReadiness_FailsWhileDraining(t *testing.T) {
+	s := ws.NewServer(ws.Config{}, engine.NewEngine())
+	defer s.Close()
+
+	checks := health.NewChecker(time.Second)
+	checks.Register("ws", s.Ready)
+	checks.Register("store", func(context.Context) error { return nil })
+
+	ts := httptest.NewServer(checks.Readiness())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected ready, got %d", resp.StatusCode)
+	}
+
+	s.Drain()
+
+	resp, err = http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep health.Report
+	_ = json.NewDecoder(resp.Body).Decode(&rep)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while draining, got %d", resp.StatusCode)
+	}
+	if rep.Checks["ws"] != hub.ErrDraining.Error() || rep.Checks["store"] != "ok" {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+}
+
+func TestMatchmaker_PingFailsAfterClose(t *testing.T) {
+	mm := match.NewMatchmaker(func(match.RoomCreatedEvent) {})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := mm.Ping(ctx); err != nil {
+		t.Fatalf("expected live loop, got %v", err)
+	}
+	_ = mm.Enqueue(ctx, match.Player{ID: "solo"})
+	deadline := time.Now().Add(time.Second)
+	for mm.Pending() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 1 pending player, got %d", mm.Pending())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	_ = mm.Close()
+	if err := mm.Ping(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected ping to fail after close, got %v", err)
+	}
+}
+
+func TestSnapshot_ListsAutoMatchedRoomAndWaitingCode(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	s := ws.NewServer(ws.Config{}, engine.NewEngine())
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	base := wsURLFromHTTP(ts.URL)
+
+	var conns []*websocket.Conn
+	for _, path := range []string{"/ws", "/ws", "/ws/7777"} {
+		c, _, err := websocket.Dial(ctx, base+path, nil)
+		if err != nil {
+			t.Fatalf("dial %s: %v", path, err)
+		}
+		defer c.Close(websocket.StatusNormalClosure, "bye")
+		conns = append(conns, c)
+	}
+	// auto-matched pair receives assigned once the matchmaker pairs them
+	for _, c := range conns[:2] {
+		if _, _, err := c.Read(ctx); err != nil {
+			t.Fatalf("read assigned: %v", err)
+		}
+	}
+
+	snap := s.Snapshot()
+	if len(snap.Rooms) != 1 || len(snap.Rooms[0].Players) != 2 {
+		t.Fatalf("expected one live room with two players, got %+v", snap.Rooms)
+	}
+	for _, p := range snap.Rooms[0].Players {
+		if !p.Connected {
+			t.Fatalf("expected connected players, got %+v", p)
+		}
+	}
+	if len(snap.Waiting) != 1 || snap.Waiting[0] != "7777" {
+		t.Fatalf("expected waiting code 7777, got %v", snap.Waiting)
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+
+	cases := []struct {
+		token, header string
+		want          int
+	}{
+		{"", "Bearer anything", http.StatusNotFound},
+		{"s3cret", "", http.StatusUnauthorized},
+		{"s3cret", "Bearer nope", http.StatusUnauthorized},
+		{"s3cret", "Bearer s3cret", http.StatusTeapot},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/debug/state", nil)
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+		httpx.RequireToken(tc.token, ok).ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Fatalf("token=%q header=%q: expected %d, got %d", tc.token, tc.header, tc.want, rec.Code)
+		}
+	}
+}
+
+func TestDrain_WaitsForRunningGames(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s := ws.NewServer(ws.Config{}, engine.NewEngine())
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	x, _, err := websocket.Dial(ctx, wsURLFromHTTP(ts.URL)+"/ws/5150", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.CloseNow()
+	o, _, err := websocket.Dial(ctx, wsURLFromHTTP(ts.URL)+"/ws/5150", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.CloseNow()
+	readUntil(ctx, t, x, "start")
+	readUntil(ctx, t, o, "start")
+
+	s.Drain()
+	short, stop := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer stop()
+	if err := s.WaitIdle(short); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("a game is still running: %v", err)
+	}
+	send(ctx, t, o, map[string]any{"type": "resign"})
+	readUntil(ctx, t, x, "result")
+	if err := s.WaitIdle(ctx); err != nil {
+		t.Fatalf("idle once the game is over: %v", err)
+	}
+	send(ctx, t, x, map[string]any{"type": "rematch"})
+	if e := readUntil(ctx, t, x, "error"); !json.Valid(e) || !strings.Contains(string(e), "DRAINING") {
+		t.Fatalf("no new games while draining: %s", e)
+	}
+}
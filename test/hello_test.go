@@ -0,0 +1,100 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ws"
+	"nhooyr.io/websocket"
+)
+
+func TestHello_NegotiatesVersionAndFeatures(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	srv := ws.NewServer(ws.Config{}, engine.NewEngine())
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	modern, _, err := websocket.Dial(ctx, wsURLFromHTTP(ts.URL)+"/ws/3131", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer modern.Close(websocket.StatusNormalClosure, "bye")
+	legacy, _, err := websocket.Dial(ctx, wsURLFromHTTP(ts.URL)+"/ws/3131", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer legacy.Close(websocket.StatusNormalClosure, "bye")
+	readUntil(ctx, t, modern, "start")
+	readUntil(ctx, t, legacy, "start")
+
+	// A future version is negotiated down; unknown features are dropped.
+	_ = modern.Write(ctx, websocket.MessageText, []byte(`{"type":"hello","version":9,"client":"bot/1.0","features":["last_move","teleport"]}`))
+	var w proto.Welcome
+	_ = json.Unmarshal(readUntil(ctx, t, modern, "welcome"), &w)
+	if w.Version != proto.CurrentVersion || !reflect.DeepEqual(w.Enabled, []string{proto.FeatureLastMove}) {
+		t.Fatalf("unexpected welcome %+v", w)
+	}
+	if !reflect.DeepEqual(w.Versions, proto.SupportedVersions) || !reflect.DeepEqual(w.Variants, []string{"classic"}) {
+		t.Fatalf("welcome should advertise versions and variants, got %+v", w)
+	}
+
+	// digit_moves was not requested, so a bare digit is no longer a move.
+	_ = modern.Write(ctx, websocket.MessageText, []byte("4"))
+	var e proto.Error
+	_ = json.Unmarshal(readUntil(ctx, t, modern, "error"), &e)
+	if e.Code != "BAD_JSON" {
+		t.Fatalf("expected BAD_JSON for a digit, got %+v", e)
+	}
+
+	_ = modern.Write(ctx, websocket.MessageText, []byte(`{"type":"move","position":4}`))
+	var mine, theirs proto.State
+	_ = json.Unmarshal(readUntil(ctx, t, modern, "state"), &mine)
+	_ = json.Unmarshal(readUntil(ctx, t, legacy, "state"), &theirs)
+	if mine.LastMove == nil || mine.LastMove.Pos != 4 || mine.LastMove.By != engine.X {
+		t.Fatalf("last_move missing for the modern client: %+v", mine)
+	}
+	if theirs.LastMove != nil {
+		t.Fatalf("legacy client should get the original state shape: %+v", theirs)
+	}
+
+	// The legacy client still moves with a digit; chat is not relayed to a
+	// client that did not ask for it.
+	_ = legacy.Write(ctx, websocket.MessageText, []byte(`{"type":"chat","text":"hi"}`))
+	readUntil(ctx, t, legacy, "chat")
+	_ = legacy.Write(ctx, websocket.MessageText, []byte("0"))
+	for {
+		_, data, err := modern.Read(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var next map[string]any
+		_ = json.Unmarshal(data, &next)
+		if next["type"] == "chat" {
+			t.Fatalf("chat relayed without the chat feature: %s", data)
+		}
+		if next["type"] == "state" {
+			if _, ok := next["last_move"]; !ok {
+				t.Fatalf("expected last_move after legacy move, got %s", data)
+			}
+			break
+		}
+	}
+
+	var found bool
+	for _, ci := range srv.Conns() {
+		if ci.Client == "bot/1.0" && ci.Version == proto.CurrentVersion {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("admin conn list should show the negotiated client: %+v", srv.Conns())
+	}
+}
@@ -0,0 +1,82 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/bot"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/loadgen"
+)
+
+func TestLoadgen_PlaysAllGamesWithoutLeaks(t *testing.T) {
+	for _, mode := range []string{loadgen.ModeAuto, loadgen.ModeCode} {
+		t.Run(mode, func(t *testing.T) {
+			local := loadgen.NewLocal(hub.Config{})
+			defer local.Close()
+
+			rep, err := loadgen.Run(context.Background(), loadgen.Config{
+				URL:      local.URL,
+				Players:  100,
+				Mode:     mode,
+				Games:    2,
+				Strategy: bot.Scripted(4, 0, 2, 6, 8, 1, 3, 5, 7),
+				Timeout:  10 * time.Second,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rep.Errors) != 0 || rep.ErrorRate != 0 {
+				t.Fatalf("errors: %v\n%s", rep.Errors, rep)
+			}
+			if rep.Games != 100 {
+				t.Fatalf("expected 100 games, got %d\n%s", rep.Games, rep)
+			}
+			if rep.Connect.Count != 100 || rep.Pair.Count != 100 || rep.Move.Count == 0 {
+				t.Fatalf("missing samples:\n%s", rep)
+			}
+			if rep.Move.P50 > rep.Move.P99 || rep.Move.P99 > rep.Move.Max {
+				t.Fatalf("percentiles out of order: %+v", rep.Move)
+			}
+
+			deadline := time.Now().Add(2 * time.Second)
+			for {
+				snap := local.Hub.Snapshot()
+				if len(snap.Rooms) == 0 && len(snap.Waiting) == 0 && len(local.Hub.Conns()) == 0 {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("hub still holds state after all players left: %d rooms, %d conns", len(snap.Rooms), len(local.Hub.Conns()))
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestLoadgen_RejectsBadConfig(t *testing.T) {
+	if _, err := loadgen.Run(context.Background(), loadgen.Config{Players: 1}); err == nil {
+		t.Fatal("expected error for a single player")
+	}
+	if _, err := loadgen.Run(context.Background(), loadgen.Config{Players: 2, Mode: "swarm"}); err == nil {
+		t.Fatal("expected error for unknown mode")
+	}
+}
+
+// go test ./test -run '^$' -bench Loadgen -benchtime 5x
+func BenchmarkLoadgen_AutoMatch(b *testing.B) {
+	local := loadgen.NewLocal(hub.Config{MsgRate: 1000, MsgBurst: 1000})
+	defer local.Close()
+	for i := 0; i < b.N; i++ {
+		rep, err := loadgen.Run(context.Background(), loadgen.Config{URL: local.URL, Players: 500, Seed: int64(i)})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if rep.ErrorRate > 0 {
+			b.Fatalf("errors: %v", rep.Errors)
+		}
+		b.ReportMetric(float64(rep.Move.P99.Microseconds()), "move-p99-µs")
+		b.ReportMetric(float64(rep.Pair.P99.Microseconds()), "pair-p99-µs")
+	}
+}
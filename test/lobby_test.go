@@ -0,0 +1,312 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/auth"
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/lobby"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ws"
+	"nhooyr.io/websocket"
+)
+
+// lobbyServer serves /ws and /lobby from one hub and returns the ws:// base.
+func lobbyServer(t *testing.T, cfg lobby.Config, game hub.Config) string {
+	t.Helper()
+	var lob lobby.Lobby
+	game.OnActivity = func() {
+		if lob != nil {
+			lob.Changed()
+		}
+	}
+	h := hub.NewHub(game, engine.NewEngine())
+	cfg.Hub = h
+	lob = lobby.NewLobby(cfg)
+	mux := http.NewServeMux()
+	mux.Handle("/ws/", ws.NewServer(ws.Config{Hub: h}, engine.NewEngine()))
+	mux.Handle("/lobby", ws.NewLobbyServer(ws.Config{Hub: h}, lob))
+	ts := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		lob.Close()
+		_ = h.Close()
+	})
+	t.Cleanup(ts.Close)
+	return wsURLFromHTTP(ts.URL)
+}
+
+func dialLobby(ctx context.Context, t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	c, _, err := websocket.Dial(ctx, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.CloseNow() })
+	return c
+}
+
+func send(ctx context.Context, t *testing.T, c *websocket.Conn, v any) {
+	t.Helper()
+	b, _ := json.Marshal(v)
+	if err := c.Write(ctx, websocket.MessageText, b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readWhere reads messages of type typ until ok accepts one.
+func readWhere[T any](ctx context.Context, t *testing.T, c *websocket.Conn, typ string, ok func(T) bool) T {
+	t.Helper()
+	for {
+		var v T
+		if err := json.Unmarshal(readUntil(ctx, t, c, typ), &v); err != nil {
+			t.Fatal(err)
+		}
+		if ok(v) {
+			return v
+		}
+	}
+}
+
+func awaitPresence(ctx context.Context, t *testing.T, c *websocket.Conn, player, status string) {
+	t.Helper()
+	readWhere(ctx, t, c, "presence", func(p proto.Presence) bool { return p.Player == player && p.Status == status })
+}
+
+func awaitChallenge(ctx context.Context, t *testing.T, c *websocket.Conn, status string) proto.Challenge {
+	t.Helper()
+	return readWhere(ctx, t, c, "challenge", func(ch proto.Challenge) bool { return ch.Status == status })
+}
+
+func awaitLobbyError(ctx context.Context, t *testing.T, c *websocket.Conn, code string) {
+	t.Helper()
+	var e proto.Error
+	_ = json.Unmarshal(readUntil(ctx, t, c, "error"), &e)
+	if e.Code != code {
+		t.Fatalf("expected %s, got %+v", code, e)
+	}
+}
+
+func TestLobby_PresenceAndPublicRooms(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	base := lobbyServer(t, lobby.Config{}, hub.Config{})
+
+	ann := dialLobby(ctx, t, base+"/lobby?player=ann")
+	var st proto.LobbyState
+	_ = json.Unmarshal(readUntil(ctx, t, ann, "lobby"), &st)
+	if st.You != "~ann" || len(st.Players) != 1 || st.Players[0] != (proto.PlayerStatus{Player: "~ann", Status: lobby.Idle}) || len(st.Rooms) != 0 {
+		t.Fatalf("first state: %+v", st)
+	}
+
+	bob := dialLobby(ctx, t, base+"/lobby?player=bob")
+	awaitPresence(ctx, t, ann, "~bob", lobby.Idle)
+	_ = json.Unmarshal(readUntil(ctx, t, bob, "lobby"), &st)
+	if len(st.Players) != 2 || st.Players[0].Player != "~ann" || st.Players[1].Player != "~bob" {
+		t.Fatalf("bob's state: %+v", st)
+	}
+
+	// A private room is not listed; its host is still waiting.
+	priv, _, _ := websocket.Dial(ctx, base+"/ws/4321?player=bob", nil)
+	defer priv.CloseNow()
+	awaitPresence(ctx, t, ann, "~bob", lobby.Waiting)
+	_ = priv.Close(websocket.StatusNormalClosure, "bye")
+	awaitPresence(ctx, t, ann, "~bob", lobby.Idle)
+
+	host, _, _ := websocket.Dial(ctx, base+"/ws/1234?player=bob&public=1&bestOf=3", nil)
+	defer host.CloseNow()
+	rooms := readWhere(ctx, t, ann, "rooms", func(r proto.Rooms) bool { return len(r.Rooms) == 1 })
+	if r := rooms.Rooms[0]; r.Code != "1234" || r.Host != "bob" || r.BestOf != 3 || r.Since.IsZero() {
+		t.Fatalf("open room: %+v", r)
+	}
+
+	guest, _, _ := websocket.Dial(ctx, base+"/ws/1234?player=cat", nil)
+	defer guest.CloseNow()
+	awaitPresence(ctx, t, ann, "~bob", lobby.Playing)
+	readWhere(ctx, t, ann, "rooms", func(r proto.Rooms) bool { return len(r.Rooms) == 0 })
+
+	send(ctx, t, ann, proto.LobbyMsg{Type: "challenge", To: "~bob"})
+	awaitLobbyError(ctx, t, ann, "BUSY")
+
+	_ = bob.Close(websocket.StatusNormalClosure, "bye")
+	awaitPresence(ctx, t, ann, "~bob", lobby.Offline)
+}
+
+func TestLobby_AcceptedChallengeBooksARoom(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	base := lobbyServer(t, lobby.Config{}, hub.Config{})
+
+	ann := dialLobby(ctx, t, base+"/lobby?player=ann")
+	bob := dialLobby(ctx, t, base+"/lobby?player=bob")
+	awaitPresence(ctx, t, ann, "~bob", lobby.Idle)
+
+	send(ctx, t, ann, proto.LobbyMsg{Type: "challenge", To: "~bob", Settings: &proto.ChallengeSettings{Side: engine.O, BestOf: 3, TimeControl: "1+0"}})
+	ch := awaitChallenge(ctx, t, bob, lobby.Pending)
+	if ch.From != "~ann" || ch.To != "~bob" || ch.Settings.Variant != "classic" || ch.ExpiresMs <= 0 {
+		t.Fatalf("pending challenge: %+v", ch)
+	}
+	send(ctx, t, bob, proto.LobbyMsg{Type: "accept", Challenge: ch.ID})
+	done := awaitChallenge(ctx, t, ann, lobby.Accepted)
+	if done.ID != ch.ID || !hub.ValidCode(done.Code) {
+		t.Fatalf("accepted challenge: %+v", done)
+	}
+	if again := awaitChallenge(ctx, t, bob, lobby.Accepted); again.Code != done.Code {
+		t.Fatalf("both players get the same room: %+v", again)
+	}
+
+	// The room is booked for the two of them, with the sides asked for.
+	stranger, _, _ := websocket.Dial(ctx, base+"/ws/"+done.Code+"?player=cat", nil)
+	defer stranger.CloseNow()
+	readUntil(ctx, t, stranger, "error")
+
+	seats := []struct {
+		name string
+		mark engine.Mark
+		c    *websocket.Conn
+	}{{name: "ann", mark: engine.O}, {name: "bob", mark: engine.X}}
+	for i := range seats {
+		c, _, err := websocket.Dial(ctx, base+"/ws/"+done.Code+"?player="+seats[i].name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.CloseNow()
+		seats[i].c = c
+	}
+	for _, p := range seats {
+		var a proto.Assigned
+		_ = json.Unmarshal(readUntil(ctx, t, p.c, "assigned"), &a)
+		if a.You != p.mark {
+			t.Fatalf("%s plays %s, want %s", p.name, a.You, p.mark)
+		}
+		var c proto.Clock
+		_ = json.Unmarshal(readUntil(ctx, t, p.c, "clock"), &c)
+		if c.XMs <= 55000 || c.XMs > 60000 || c.OMs != 60000 || c.Running != engine.X {
+			t.Fatalf("%s sees clock %+v", p.name, c)
+		}
+	}
+	awaitPresence(ctx, t, ann, "~ann", lobby.Playing)
+}
+
+func TestLobby_NoSideLeavesItToTheHub(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	lastComeX := match.SideFunc(func(match.Pairing) bool { return false })
+	base := lobbyServer(t, lobby.Config{}, hub.Config{Sides: lastComeX})
+
+	ann := dialLobby(ctx, t, base+"/lobby?player=ann")
+	bob := dialLobby(ctx, t, base+"/lobby?player=bob")
+	awaitPresence(ctx, t, ann, "~bob", lobby.Idle)
+	send(ctx, t, ann, proto.LobbyMsg{Type: "challenge", To: "~bob"})
+	ch := awaitChallenge(ctx, t, bob, lobby.Pending)
+	send(ctx, t, bob, proto.LobbyMsg{Type: "accept", Challenge: ch.ID})
+	code := awaitChallenge(ctx, t, ann, lobby.Accepted).Code
+
+	for _, name := range []string{"bob", "ann"} {
+		c, _, err := websocket.Dial(ctx, base+"/ws/"+code+"?player="+name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.CloseNow()
+		var a proto.Assigned
+		if name == "ann" {
+			_ = json.Unmarshal(readUntil(ctx, t, c, "assigned"), &a)
+			if a.You != engine.X {
+				t.Fatalf("the policy gives X to the later arrival, ann got %s", a.You)
+			}
+		}
+		time.Sleep(50 * time.Millisecond) // bob is waiting
+	}
+}
+
+func TestLobby_ChallengeRulesDeclineAndExpiry(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	iss, err := auth.NewSigner([]byte("0123456789abcdef"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := lobbyServer(t, lobby.Config{ChallengeTTL: 150 * time.Millisecond}, hub.Config{Auth: iss})
+
+	token, _ := iss.Issue("ann", time.Hour)
+	ann := dialLobby(ctx, t, base+"/lobby?token="+token)
+	bob := dialLobby(ctx, t, base+"/lobby?player=bob")
+	awaitPresence(ctx, t, ann, "~bob", lobby.Idle)
+
+	for _, tc := range []struct {
+		msg  proto.LobbyMsg
+		code string
+	}{
+		{proto.LobbyMsg{Type: "challenge", To: "zed"}, "NOT_ONLINE"},
+		{proto.LobbyMsg{Type: "challenge", To: "ann"}, "INVALID"},
+		{proto.LobbyMsg{Type: "challenge", To: "~bob", Settings: &proto.ChallengeSettings{TimeControl: "soon"}}, "INVALID"},
+		{proto.LobbyMsg{Type: "challenge", To: "~bob", Settings: &proto.ChallengeSettings{Variant: "gomoku"}}, "UNSUPPORTED"},
+		{proto.LobbyMsg{Type: "challenge", To: "~bob", Settings: &proto.ChallengeSettings{Rated: true}}, "AUTH_REQUIRED"},
+		{proto.LobbyMsg{Type: "accept", Challenge: "c999"}, "NOT_FOUND"},
+	} {
+		send(ctx, t, ann, tc.msg)
+		awaitLobbyError(ctx, t, ann, tc.code)
+	}
+
+	send(ctx, t, ann, proto.LobbyMsg{Type: "challenge", To: "~bob"})
+	ch := awaitChallenge(ctx, t, bob, lobby.Pending)
+	send(ctx, t, ann, proto.LobbyMsg{Type: "accept", Challenge: ch.ID})
+	awaitLobbyError(ctx, t, ann, "FORBIDDEN")
+	send(ctx, t, bob, proto.LobbyMsg{Type: "decline", Challenge: ch.ID})
+	if got := awaitChallenge(ctx, t, ann, lobby.Declined); got.ID != ch.ID {
+		t.Fatalf("declined: %+v", got)
+	}
+
+	send(ctx, t, ann, proto.LobbyMsg{Type: "challenge", To: "~bob"})
+	ch = awaitChallenge(ctx, t, bob, lobby.Pending)
+	if got := awaitChallenge(ctx, t, bob, lobby.Expired); got.ID != ch.ID {
+		t.Fatalf("expired: %+v", got)
+	}
+
+	// Leaving calls off the player's challenges.
+	send(ctx, t, bob, proto.LobbyMsg{Type: "challenge", To: "ann"})
+	ch = readWhere(ctx, t, ann, "challenge", func(ch proto.Challenge) bool { return ch.From == "~bob" })
+	_ = bob.Close(websocket.StatusNormalClosure, "bye")
+	if got := awaitChallenge(ctx, t, ann, lobby.Cancelled); got.ID != ch.ID {
+		t.Fatalf("cancelled: %+v", got)
+	}
+	awaitPresence(ctx, t, ann, "~bob", lobby.Offline)
+}
+
+func TestLobby_GuestsCannotPassForSignedInPlayers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	iss, err := auth.NewSigner([]byte("0123456789abcdef"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := lobbyServer(t, lobby.Config{}, hub.Config{Auth: iss})
+
+	annToken, _ := iss.Issue("ann", time.Hour)
+	bobToken, _ := iss.Issue("bob", time.Hour)
+	ann := dialLobby(ctx, t, base+"/lobby?token="+annToken)
+	bob := dialLobby(ctx, t, base+"/lobby?token="+bobToken)
+	fake := dialLobby(ctx, t, base+"/lobby?player=bob")
+	awaitPresence(ctx, t, ann, "bob", lobby.Idle)
+	awaitPresence(ctx, t, ann, "~bob", lobby.Idle)
+
+	send(ctx, t, ann, proto.LobbyMsg{Type: "challenge", To: "bob"})
+	ch := awaitChallenge(ctx, t, bob, lobby.Pending)
+	send(ctx, t, fake, proto.LobbyMsg{Type: "accept", Challenge: ch.ID})
+	awaitLobbyError(ctx, t, fake, "FORBIDDEN")
+
+	send(ctx, t, ann, proto.LobbyMsg{Type: "challenge", To: "~bob"})
+	ch = readWhere(ctx, t, fake, "challenge", func(c proto.Challenge) bool { return c.To == "~bob" })
+	send(ctx, t, fake, proto.LobbyMsg{Type: "accept", Challenge: ch.ID})
+	awaitLobbyError(ctx, t, fake, "AUTH_REQUIRED")
+	send(ctx, t, fake, proto.LobbyMsg{Type: "decline", Challenge: ch.ID})
+	if got := readWhere(ctx, t, ann, "challenge", func(c proto.Challenge) bool { return c.ID == ch.ID && c.Status == lobby.Declined }); got.ID != ch.ID {
+		t.Fatalf("declined: %+v", got)
+	}
+}
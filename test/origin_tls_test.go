@@ -0,0 +1,153 @@
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/httpx"
+	"github.com/kushgupta-hiver/TTT/internal/tlsreload"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ws"
+	"nhooyr.io/websocket"
+)
+
+func dialWithOrigin(ctx context.Context, url, origin string) (*websocket.Conn, *http.Response, error) {
+	h := http.Header{}
+	h.Set("Origin", origin)
+	return websocket.Dial(ctx, url, &websocket.DialOptions{HTTPHeader: h})
+}
+
+func TestWS_OriginAllowList(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	s := ws.NewServer(ws.Config{AllowedOrigins: []string{"*.example.com"}}, engine.NewEngine())
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	url := wsURLFromHTTP(ts.URL) + "/ws"
+
+	_, resp, err := dialWithOrigin(ctx, url, "https://evil.test")
+	if err == nil {
+		t.Fatalf("expected foreign origin to be refused")
+	}
+	if resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403, got %v", resp)
+	}
+
+	c, _, err := dialWithOrigin(ctx, url, "https://play.example.com")
+	if err != nil {
+		t.Fatalf("expected allowed origin to connect: %v", err)
+	}
+	c.Close(websocket.StatusNormalClosure, "bye")
+}
+
+func writeSelfSigned(t *testing.T, dir, cn string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{cn},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	_ = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}), 0o600)
+
+	// make sure the reloader sees a new mtime even on coarse filesystems
+	stamp := time.Now().Add(time.Duration(len(cn)) * time.Second)
+	_ = os.Chtimes(certFile, stamp, stamp)
+	_ = os.Chtimes(keyFile, stamp, stamp)
+	return certFile, keyFile
+}
+
+func leafCN(t *testing.T, r *tlsreload.Reloader) string {
+	t.Helper()
+	c, err := r.GetCertificate(nil)
+	if err != nil || c == nil {
+		t.Fatalf("get certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(c.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestTLSReloader_PicksUpReplacedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSigned(t, dir, "one.test")
+
+	r, err := tlsreload.NewReloader(certFile, keyFile, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("new reloader: %v", err)
+	}
+	defer r.Close()
+
+	if cn := leafCN(t, r); cn != "one.test" {
+		t.Fatalf("expected one.test, got %s", cn)
+	}
+
+	writeSelfSigned(t, dir, "second.test")
+
+	deadline := time.Now().Add(time.Second)
+	for leafCN(t, r) != "second.test" {
+		if time.Now().After(deadline) {
+			t.Fatalf("certificate was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSecureHeaders_HSTSOnlyOverTLS(t *testing.T) {
+	h := httpx.SecureHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), time.Hour)
+
+	plain := httptest.NewServer(h)
+	defer plain.Close()
+	resp, err := http.Get(plain.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("expected nosniff header")
+	}
+	if resp.Header.Get("Strict-Transport-Security") != "" {
+		t.Fatalf("HSTS must not be sent over plain http")
+	}
+
+	secure := httptest.NewTLSServer(h)
+	defer secure.Close()
+	resp, err = secure.Client().Get(secure.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Strict-Transport-Security"); got != "max-age=3600; includeSubDomains" {
+		t.Fatalf("unexpected HSTS header %q", got)
+	}
+}
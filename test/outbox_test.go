@@ -0,0 +1,79 @@
+package test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/transport/outbox"
+)
+
+func TestOutbox_FullQueueRejectsWithoutBlocking(t *testing.T) {
+	o := outbox.New(outbox.Options{Size: 2})
+
+	_ = o.Push(outbox.Frame{Data: []byte("a")})
+	_ = o.Push(outbox.Frame{Data: []byte("b")})
+
+	done := make(chan error, 1)
+	go func() { done <- o.Push(outbox.Frame{Data: []byte("c")}) }()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, outbox.ErrFull) {
+			t.Fatalf("expected ErrFull, got %v", err)
+		}
+	case <-time.After(200 * time.Millisecond):
+		t.Fatalf("push blocked on a full queue")
+	}
+}
+
+func TestOutbox_CoalescesSupersededStates(t *testing.T) {
+	o := outbox.New(outbox.Options{Size: 4, Coalesce: true})
+
+	_ = o.Push(outbox.Frame{Data: []byte("state-1"), Key: "state"})
+	_ = o.Push(outbox.Frame{Data: []byte("error")})
+	_ = o.Push(outbox.Frame{Data: []byte("state-2"), Key: "state"})
+	_ = o.Push(outbox.Frame{Data: []byte("state-3"), Key: "state"})
+	o.Close()
+
+	var got []string
+	for {
+		f, ok := o.Next()
+		if !ok {
+			break
+		}
+		got = append(got, string(f.Data))
+	}
+	if len(got) != 2 || got[0] != "error" || got[1] != "state-3" {
+		t.Fatalf("expected [error state-3], got %v", got)
+	}
+}
+
+func TestOutbox_LaggingConsumerDetected(t *testing.T) {
+	o := outbox.New(outbox.Options{Size: 8, MaxLag: 50 * time.Millisecond})
+
+	if err := o.Push(outbox.Frame{Data: []byte("a")}); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	time.Sleep(80 * time.Millisecond)
+
+	if err := o.Push(outbox.Frame{Data: []byte("b")}); !errors.Is(err, outbox.ErrLagging) {
+		t.Fatalf("expected ErrLagging, got %v", err)
+	}
+}
+
+func TestOutbox_CloseDrainsThenStops(t *testing.T) {
+	o := outbox.New(outbox.Options{})
+	_ = o.Push(outbox.Frame{Data: []byte("last")})
+	o.Close()
+
+	if err := o.Push(outbox.Frame{Data: []byte("late")}); !errors.Is(err, outbox.ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+	if f, ok := o.Next(); !ok || string(f.Data) != "last" {
+		t.Fatalf("expected queued frame to be delivered after close")
+	}
+	if _, ok := o.Next(); ok {
+		t.Fatalf("expected drained outbox to stop")
+	}
+}
@@ -0,0 +1,159 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ratelimit"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ws"
+	"nhooyr.io/websocket"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock { return &fakeClock{now: time.Unix(1_700_000_000, 0)} }
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func TestBucket_BurstThenRefill(t *testing.T) {
+	clk := newFakeClock()
+	b := ratelimit.NewBucket(2, 3, clk) // 2 tokens/s, burst 3
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := b.Allow(); !ok {
+			t.Fatalf("expected burst token %d", i)
+		}
+	}
+	ok, wait := b.Allow()
+	if ok {
+		t.Fatalf("expected bucket to be empty")
+	}
+	if wait != 500*time.Millisecond {
+		t.Fatalf("expected 500ms retry-after, got %v", wait)
+	}
+
+	clk.Advance(500 * time.Millisecond)
+	if ok, _ := b.Allow(); !ok {
+		t.Fatalf("expected a refilled token")
+	}
+}
+
+func TestCounter_CapsPerKey(t *testing.T) {
+	c := ratelimit.NewCounter(2)
+	if !c.Acquire("1.2.3.4") || !c.Acquire("1.2.3.4") {
+		t.Fatalf("expected two slots")
+	}
+	if c.Acquire("1.2.3.4") {
+		t.Fatalf("expected third slot to be refused")
+	}
+	if !c.Acquire("5.6.7.8") {
+		t.Fatalf("other keys are independent")
+	}
+	c.Release("1.2.3.4")
+	if !c.Acquire("1.2.3.4") {
+		t.Fatalf("expected slot after release")
+	}
+}
+
+func TestWS_FloodGetsRateLimited(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	s := ws.NewServer(ws.Config{Game: hub.Config{MsgRate: 1, MsgBurst: 2}}, engine.NewEngine())
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	c, _, err := websocket.Dial(ctx, wsURLFromHTTP(ts.URL)+"/ws/4321", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close(websocket.StatusNormalClosure, "bye")
+
+	for i := 0; i < 3; i++ {
+		_ = c.Write(ctx, websocket.MessageText, []byte(`{"type":"ping"}`))
+	}
+
+	var e proto.Error
+	if err := readJSON(ctx, c, &e); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if e.Code != "RATE_LIMITED" || e.RetryAfterMs <= 0 {
+		t.Fatalf("expected RATE_LIMITED with retry-after, got %+v", e)
+	}
+}
+
+func TestWS_WaitingRoomsCappedPerAddress(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	s := ws.NewServer(ws.Config{Game: hub.Config{MaxWaitingPerIP: 1}}, engine.NewEngine())
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	base := wsURLFromHTTP(ts.URL)
+
+	c1, _, err := websocket.Dial(ctx, base+"/ws/1001", nil)
+	if err != nil {
+		t.Fatalf("dial c1: %v", err)
+	}
+	defer c1.Close(websocket.StatusNormalClosure, "bye")
+
+	c2, _, err := websocket.Dial(ctx, base+"/ws/1002", nil)
+	if err != nil {
+		t.Fatalf("dial c2: %v", err)
+	}
+	defer c2.Close(websocket.StatusNormalClosure, "bye")
+
+	_, data, err := c2.Read(ctx)
+	if err != nil {
+		t.Fatalf("read c2: %v", err)
+	}
+	var e proto.Error
+	_ = json.Unmarshal(data, &e)
+	if e.Code != "RATE_LIMITED" {
+		t.Fatalf("expected RATE_LIMITED for second waiting room, got %s", data)
+	}
+}
+
+func TestWS_ConnectionsCappedPerAddress(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	s := ws.NewServer(ws.Config{Game: hub.Config{MaxConnsPerIP: 1}}, engine.NewEngine())
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	c1, _, err := websocket.Dial(ctx, wsURLFromHTTP(ts.URL)+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dial c1: %v", err)
+	}
+	defer c1.Close(websocket.StatusNormalClosure, "bye")
+
+	_, resp, err := websocket.Dial(ctx, wsURLFromHTTP(ts.URL)+"/ws", nil)
+	if err == nil {
+		t.Fatalf("expected second connection to be refused")
+	}
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %v", resp)
+	}
+}
@@ -0,0 +1,347 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/auth"
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/ratings"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ws"
+	"github.com/kushgupta-hiver/TTT/pkg/client"
+)
+
+func near(a, b float64) bool { return math.Abs(a-b) < 0.01 }
+
+func TestGlicko2_NewPlayersWinAndDraw(t *testing.T) {
+	b := ratings.NewBook(ratings.Config{Clock: newFakeClock()})
+	x, o, err := b.Apply(ratings.Game{ID: "g1", X: "ann", O: "bob", Outcome: engine.XWins})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(x.After, 1662.31) || !near(o.After, 1337.69) || !near(x.RD, 290.32) {
+		t.Fatalf("unexpected first game: %+v %+v", x, o)
+	}
+	if x.Before != 1500 || o.Score != 0 {
+		t.Fatalf("unexpected change fields: %+v %+v", x, o)
+	}
+
+	// Draw against a lower-rated player costs the favourite points.
+	x, o, _ = b.Apply(ratings.Game{ID: "g2", X: "ann", O: "bob", Outcome: engine.Draw})
+	if x.After >= x.Before || o.After <= o.Before {
+		t.Fatalf("draw should pull ratings together: %+v %+v", x, o)
+	}
+	if r := b.Get("ann"); r.Games != 2 || r.RD >= 290 {
+		t.Fatalf("unexpected rating %+v", r)
+	}
+	if h := b.History("ann", 0); len(h) != 2 || h[0].GameID != "g2" {
+		t.Fatalf("history should be newest first: %+v", h)
+	}
+}
+
+func TestRatings_RejectsReplayedAndUnfinishedGames(t *testing.T) {
+	b := ratings.NewBook(ratings.Config{})
+	g := ratings.Game{ID: "room-1", X: "a", O: "b", Outcome: engine.OWins}
+	if _, _, err := b.Apply(g); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := b.Apply(g); !errors.Is(err, ratings.ErrDuplicate) {
+		t.Fatalf("expected ErrDuplicate, got %v", err)
+	}
+	if _, _, err := b.Apply(ratings.Game{ID: "room-2", X: "a", O: "b"}); !errors.Is(err, ratings.ErrUnfinished) {
+		t.Fatalf("expected ErrUnfinished, got %v", err)
+	}
+	if _, _, err := b.Apply(ratings.Game{ID: "room-3", X: "a", O: "a", Outcome: engine.Draw}); !errors.Is(err, ratings.ErrSelfPlay) {
+		t.Fatalf("expected ErrSelfPlay, got %v", err)
+	}
+	if r := b.Get("a"); r.Games != 1 {
+		t.Fatalf("rejected games must not count: %+v", r)
+	}
+}
+
+func TestRatings_IdlePlayersBecomeUncertain(t *testing.T) {
+	clk := newFakeClock()
+	b := ratings.NewBook(ratings.Config{Clock: clk, Period: time.Hour})
+	_, _, _ = b.Apply(ratings.Game{ID: "g", X: "a", O: "b", Outcome: engine.XWins})
+	before := b.Get("a")
+	clk.Advance(100 * time.Hour)
+	after := b.Get("a")
+	if after.RD <= before.RD || after.Rating != before.Rating {
+		t.Fatalf("RD should grow with idle time: %+v -> %+v", before, after)
+	}
+	clk.Advance(1e6 * time.Hour)
+	if r := b.Get("a"); r.RD > ratings.DefaultRD {
+		t.Fatalf("RD must be capped at %v, got %v", ratings.DefaultRD, r.RD)
+	}
+}
+
+func TestAuth_TokensVerifyAndExpire(t *testing.T) {
+	clk := newFakeClock()
+	s, err := auth.NewSigner([]byte("0123456789abcdef"), clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := s.Issue("ann", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := s.Verify(tok); err != nil || p != "ann" {
+		t.Fatalf("Verify = %q, %v", p, err)
+	}
+	if _, err := s.Verify(tok[:len(tok)-2] + "xx"); !errors.Is(err, auth.ErrSignature) {
+		t.Fatalf("expected ErrSignature, got %v", err)
+	}
+	other, _ := auth.NewSigner([]byte("fedcba9876543210"), clk)
+	if _, err := other.Verify(tok); !errors.Is(err, auth.ErrSignature) {
+		t.Fatalf("another key must not verify: %v", err)
+	}
+	if _, err := s.Verify("garbage"); !errors.Is(err, auth.ErrMalformed) {
+		t.Fatalf("expected ErrMalformed, got %v", err)
+	}
+	clk.Advance(time.Minute)
+	if _, err := s.Verify(tok); !errors.Is(err, auth.ErrExpired) {
+		t.Fatalf("expected ErrExpired, got %v", err)
+	}
+	if _, err := auth.NewSigner([]byte("short"), nil); err == nil {
+		t.Fatal("short secrets must be refused")
+	}
+}
+
+// ratedServer runs a hub with sign-in whose finished games feed a Book.
+func ratedServer(t *testing.T) (url string, iss auth.Issuer, book ratings.Book, over chan hub.GameOver) {
+	t.Helper()
+	iss, err := auth.NewSigner([]byte("0123456789abcdef"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	book = ratings.NewBook(ratings.Config{})
+	over = make(chan hub.GameOver, 4)
+	rating := func(player string) float64 { return book.Get(player).Rating }
+	h := hub.NewHub(hub.Config{Auth: iss, RatingOf: rating, OnGameOver: func(g hub.GameOver) {
+		if g.Record.Rated {
+			if _, _, err := book.Apply(ratings.Game{ID: g.Record.RoomID, X: g.X, O: g.O, Outcome: g.Record.Outcome}); err != nil {
+				t.Errorf("apply: %v", err)
+			}
+		}
+		over <- g
+	}}, engine.NewEngine())
+	t.Cleanup(func() { h.Close() })
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewServer(ws.Config{Hub: h}, engine.NewEngine()))
+	mux.Handle("/ws/", ws.NewServer(ws.Config{Hub: h}, engine.NewEngine()))
+	mux.Handle("/api/ratings/", ratings.NewHandler(book))
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts.URL, iss, book, over
+}
+
+func awaitOver(t *testing.T, over chan hub.GameOver) hub.GameOver {
+	t.Helper()
+	select {
+	case g := <-over:
+		return g
+	case <-time.After(3 * time.Second):
+		t.Fatal("no game over")
+		return hub.GameOver{}
+	}
+}
+
+func TestRatedRoom_ForfeitUpdatesBothPlayers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	url, iss, _, over := ratedServer(t)
+	ann, _ := iss.Issue("ann", time.Hour)
+	bob, _ := iss.Issue("bob", time.Hour)
+
+	x, err := client.Dial(ctx, url, client.Options{Code: "7070", Token: ann, Rated: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+	o, err := client.Dial(ctx, url, client.Options{Code: "7070", Token: bob})
+	if err != nil {
+		t.Fatal(err)
+	}
+	await[client.Start](t, x)
+	await[client.Start](t, o)
+	if err := x.Move(ctx, 4); err != nil {
+		t.Fatal(err)
+	}
+	await[client.State](t, o)
+	o.Close() // walks out: a forfeit, rated like any other result
+
+	g := awaitOver(t, over)
+	if !g.Record.Rated || g.Record.Reason != match.ReasonForfeit || g.Record.Outcome != engine.XWins {
+		t.Fatalf("unexpected record %+v", g.Record)
+	}
+	if g.X != "ann" || g.O != "bob" || g.XGuest || g.OGuest {
+		t.Fatalf("game over should name signed-in players, got %+v", g)
+	}
+
+	res, err := http.Get(url + "/api/ratings/ann")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var body struct {
+		ratings.Rating
+		Recent []ratings.Change `json:"recent"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Games != 1 || body.Rating.Rating <= 1500 || len(body.Recent) != 1 || body.Recent[0].Opponent != "bob" {
+		t.Fatalf("unexpected rating response %+v", body)
+	}
+}
+
+func TestRatedRoom_RequiresSignIn(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	url, iss, book, over := ratedServer(t)
+
+	// Asking for a rated game anonymously is refused.
+	anon, err := client.Dial(ctx, url, client.Options{Rated: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer anon.Close()
+	if e := await[client.Error](t, anon); e.Code != "AUTH_REQUIRED" {
+		t.Fatalf("expected AUTH_REQUIRED, got %+v", e)
+	}
+
+	// So is joining someone's rated room.
+	ann, _ := iss.Issue("ann", time.Hour)
+	x, err := client.Dial(ctx, url, client.Options{Code: "7171", Token: ann, Rated: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+	guest, err := client.Dial(ctx, url, client.Options{Code: "7171", Player: "guest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer guest.Close()
+	if e := await[client.Error](t, guest); e.Code != "AUTH_REQUIRED" {
+		t.Fatalf("expected AUTH_REQUIRED, got %+v", e)
+	}
+
+	// A bad token fails the upgrade.
+	if _, err := client.Dial(ctx, url, client.Options{Token: "nope.nope"}); err == nil {
+		t.Fatal("expected a bad token to be refused")
+	}
+
+	// Casual games report but are not rated.
+	a, _ := client.Dial(ctx, url, client.Options{Code: "7272", Token: ann})
+	defer a.Close()
+	b, _ := client.Dial(ctx, url, client.Options{Code: "7272", Player: "guest"})
+	defer b.Close()
+	await[client.Start](t, a)
+	_ = a.Resign(ctx)
+	if g := awaitOver(t, over); g.Record.Rated || g.Record.Reason != match.ReasonResign {
+		t.Fatalf("unexpected record %+v", g.Record)
+	}
+	if r := book.Get("ann"); r.Games != 0 {
+		t.Fatalf("casual game changed rating: %+v", r)
+	}
+}
+
+func TestRatedAutoMatch_PairsOnlyRatedPlayers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	url, iss, book, over := ratedServer(t)
+	ann, _ := iss.Issue("ann", time.Hour)
+	bob, _ := iss.Issue("bob", time.Hour)
+
+	x, err := client.Dial(ctx, url, client.Options{Token: ann, Rated: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+	if q := await[client.Queued](t, x); q.Rating != 1500 {
+		t.Fatalf("unexpected queued %+v", q)
+	}
+	casual, err := client.Dial(ctx, url, client.Options{Player: "casual"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer casual.Close()
+	o, err := client.Dial(ctx, url, client.Options{Token: bob, Rated: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	await[client.Start](t, x)
+	await[client.Start](t, o)
+	first, second := x, o
+	if x.Mark() != client.X {
+		first, second = o, x
+	}
+	for i, pos := range []int{0, 3, 1, 4, 2} {
+		c := first
+		if i%2 == 1 {
+			c = second
+		}
+		if err := c.Move(ctx, pos); err != nil {
+			t.Fatal(err)
+		}
+		await[client.State](t, second)
+		await[client.State](t, first)
+	}
+	if g := awaitOver(t, over); !g.Record.Rated || g.Record.Reason != match.ReasonPlay {
+		t.Fatalf("unexpected record %+v", g.Record)
+	}
+	winner := "ann"
+	if first == o {
+		winner = "bob"
+	}
+	if r := book.Get(winner); r.Games != 1 || r.Rating <= 1500 {
+		t.Fatalf("winner not rated up: %+v", r)
+	}
+}
+
+func TestRoom_OnFinishFiresOnceWithReason(t *testing.T) {
+	got := make(chan match.Record, 4)
+	newRoom := func(grace time.Duration) match.Room {
+		rm := match.NewRoom("r", engine.NewEngine(), match.Options{GracePeriod: grace, Rated: true, OnFinish: func(r match.Record) { got <- r }})
+		_ = rm.Join(context.Background(), match.Player{ID: "a", Mark: engine.X})
+		_ = rm.Join(context.Background(), match.Player{ID: "b", Mark: engine.O})
+		return rm
+	}
+	next := func() match.Record {
+		select {
+		case r := <-got:
+			return r
+		case <-time.After(time.Second):
+			t.Fatal("OnFinish not called")
+			return match.Record{}
+		}
+	}
+
+	rm := newRoom(20 * time.Millisecond)
+	_ = rm.Leave(context.Background(), "b")
+	if r := next(); r.Reason != match.ReasonTimeout || r.Outcome != engine.XWins || !r.Rated || r.Ended.Before(r.Started) {
+		t.Fatalf("unexpected record %+v", r)
+	}
+
+	rm = newRoom(0)
+	_ = rm.End(context.Background(), engine.Draw)
+	if r := next(); r.Reason != match.ReasonAdmin {
+		t.Fatalf("unexpected record %+v", r)
+	}
+	_ = rm.Resign(context.Background(), "a") // already over
+	select {
+	case r := <-got:
+		t.Fatalf("OnFinish fired twice: %+v", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,224 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+	"github.com/kushgupta-hiver/TTT/internal/store"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ws"
+	"nhooyr.io/websocket"
+)
+
+type failingLog struct{}
+
+func (failingLog) Append(string, match.Event) error { return errors.New("disk full") }
+
+func TestRoomLog_ReplayRebuildsTheGame(t *testing.T) {
+	ctx := context.Background()
+	eng := engine.NewEngine()
+	wal := store.NewRoomLog(store.NewMemory())
+	_ = wal.Append("r1", match.Event{Kind: match.EventOpen, At: time.Now(), Rated: true})
+
+	r := match.NewRoom("r1", eng, match.Options{Log: wal, GracePeriod: time.Minute})
+	_ = r.Join(ctx, match.Player{ID: "px", Mark: engine.X, Name: "ann", Key: "kx"})
+	_ = r.Join(ctx, match.Player{ID: "po", Mark: engine.O, Name: "bob", Key: "ko"})
+	for i, pos := range []int{4, 0, 8} {
+		mk := []engine.Mark{engine.X, engine.O}[i%2]
+		id := map[engine.Mark]string{engine.X: "px", engine.O: "po"}[mk]
+		if _, err := r.Submit(ctx, engine.Move{PlayerID: id, Position: pos, MsgID: "m" + strconv.Itoa(i), ClientSeq: i + 1, Mark: mk}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = r.Say(ctx, match.ChatLine{PlayerID: "po", Text: "brb"})
+	_ = r.Leave(ctx, "po")
+
+	logs, err := wal.Load()
+	if err != nil || len(logs["r1"]) != 8 {
+		t.Fatalf("expected open, 2 joins, 3 moves, a say and a leave: %v %+v", err, logs)
+	}
+	finished := make(chan match.Record, 1)
+	back, err := match.Restore("r1", eng, match.Options{Log: wal, GracePeriod: time.Minute, OnFinish: func(rec match.Record) { finished <- rec }}, logs["r1"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := back.State(), r.State(); got.Board != want.Board || got.NextTurn != want.NextTurn || got.ServerSeq != 3 {
+		t.Fatalf("restored %+v, want %+v", got, want)
+	}
+	if rec := back.Record(); rec.X != "px" || rec.O != "po" || len(rec.Moves) != 3 || len(rec.Chat) != 1 || rec.Chat[0].Text != "brb" || rec.Chat[0].Mark != engine.O {
+		t.Fatalf("restored record %+v", rec)
+	}
+	// A retried move is answered from history, not applied twice.
+	if st, err := back.Submit(ctx, engine.Move{PlayerID: "px", Position: 8, MsgID: "m2", ClientSeq: 3, Mark: engine.X}); err != nil || st.ServerSeq != 3 {
+		t.Fatalf("retry: %+v %v", st, err)
+	}
+	_ = back.Join(ctx, match.Player{ID: "po", Mark: engine.O})
+	if _, err := back.Submit(ctx, engine.Move{PlayerID: "po", Position: 2, MsgID: "m3", ClientSeq: 4, Mark: engine.O}); err != nil {
+		t.Fatal(err)
+	}
+	_ = back.Resign(ctx, "po")
+	if rec := <-finished; rec.Outcome != engine.XWins || rec.Reason != match.ReasonResign {
+		t.Fatalf("finished %+v", rec)
+	}
+	// The log keeps a finished room until whoever saves the game drops it.
+	if logs, _ := wal.Load(); len(logs["r1"]) == 0 || logs["r1"][len(logs["r1"])-1].Kind != match.EventResign {
+		t.Fatalf("a finished room's log is kept until saved: %+v", logs)
+	}
+	if err := wal.Drop("r1"); err != nil {
+		t.Fatal(err)
+	}
+	if logs, _ := wal.Load(); len(logs) != 0 {
+		t.Fatalf("a dropped room's log is gone: %+v", logs)
+	}
+
+	// Another process appending to the same store carries on the sequence.
+	db := store.NewMemory()
+	_ = store.NewRoomLog(db).Append("r3", match.Event{Kind: match.EventOpen})
+	_ = store.NewRoomLog(db).Append("r3", match.Event{Kind: match.EventJoin, Player: "px"})
+	_ = store.NewRoomLog(db).Append("r3", match.Event{Kind: match.EventJoin, Player: "po"})
+	if logs, _ := store.NewRoomLog(db).Load(); len(logs["r3"]) != 3 || logs["r3"][2].Player != "po" {
+		t.Fatalf("events overwritten: %+v", logs)
+	}
+
+	// A command the log refuses does not happen.
+	r = match.NewRoom("r2", eng, match.Options{Log: failingLog{}})
+	if err := r.Join(ctx, match.Player{ID: "px", Mark: engine.X}); err == nil {
+		t.Fatal("join must fail when it cannot be logged")
+	}
+	if rec := r.Record(); rec.X != "" {
+		t.Fatalf("unlogged join took effect: %+v", rec)
+	}
+}
+
+func TestHub_RecoverySavesFinishedGamesAndDropsTheRest(t *testing.T) {
+	wal := store.NewRoomLog(store.NewMemory())
+	for _, e := range []match.Event{
+		{Kind: match.EventOpen},
+		{Kind: match.EventJoin, Player: "px", Name: "ann", Key: "kx", Mark: engine.X},
+		{Kind: match.EventJoin, Player: "po", Name: "bob", Key: "ko", Mark: engine.O},
+		{Kind: match.EventMove, Player: "px", Mark: engine.X, Pos: 4, MsgID: "m0", Seq: 1},
+		{Kind: match.EventResign, Player: "po", Outcome: engine.XWins},
+	} {
+		_ = wal.Append("ended", e) // the process died before saving it
+	}
+	_ = wal.Append("half", match.Event{Kind: match.EventOpen})
+	_ = wal.Append("half", match.Event{Kind: match.EventJoin, Player: "px", Name: "cat", Key: "kx", Mark: engine.X})
+
+	over := make(chan hub.GameOver, 2)
+	h := hub.NewHub(hub.Config{Rooms: wal, OnGameOver: func(g hub.GameOver) { over <- g }}, engine.NewEngine())
+	defer h.Close()
+
+	g := awaitOver(t, over)
+	if g.Record.RoomID != "ended" || g.X != "ann" || g.Record.Outcome != engine.XWins || g.Record.Reason != match.ReasonResign {
+		t.Fatalf("game over %+v", g)
+	}
+	if logs, _ := wal.Load(); len(logs) != 0 {
+		t.Fatalf("logs left after recovery: %+v", logs)
+	}
+}
+
+// crashHub serves a hub whose running games are logged to a store at path.
+func crashHub(t *testing.T, path string, grace time.Duration, over chan hub.GameOver) string {
+	t.Helper()
+	db, err := store.Open(path, store.Config{NoSync: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := hub.NewHub(hub.Config{
+		ResumeGrace: grace,
+		Rooms:       store.NewRoomLog(db),
+		OnGameOver:  func(g hub.GameOver) { over <- g },
+	}, engine.NewEngine())
+	ts := httptest.NewServer(ws.NewServer(ws.Config{Hub: h}, engine.NewEngine()))
+	t.Cleanup(func() {
+		ts.Close()
+		_ = h.Close()
+		_ = db.Close()
+	})
+	return wsURLFromHTTP(ts.URL)
+}
+
+func TestHub_RunningGameSurvivesACrash(t *testing.T) {
+	for name, grace := range map[string]time.Duration{"resume grace": 2 * time.Second, "no resume grace": 0} {
+		t.Run(name, func(t *testing.T) { survivesACrash(t, grace) })
+	}
+}
+
+func survivesACrash(t *testing.T, grace time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dir := t.TempDir()
+	over := make(chan hub.GameOver, 2)
+	base := crashHub(t, filepath.Join(dir, "db"), grace, over)
+
+	dial := func(url string) *websocket.Conn {
+		c, _, err := websocket.Dial(ctx, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = c.CloseNow() })
+		return c
+	}
+	move := func(c, peer *websocket.Conn, pos int) {
+		send(ctx, t, c, map[string]any{"type": "move", "position": pos})
+		readUntil(ctx, t, c, "state")
+		readUntil(ctx, t, peer, "state")
+	}
+	token := func(c *websocket.Conn) string {
+		var r proto.Resumable
+		_ = json.Unmarshal(readUntil(ctx, t, c, "resumable"), &r)
+		return r.Token
+	}
+
+	x := dial(base + "/ws/4242?player=ann")
+	o := dial(base + "/ws/4242?player=bob")
+	tx, to := token(x), token(o)
+	move(x, o, 0)
+	move(o, x, 4)
+	send(ctx, t, o, map[string]any{"type": "chat", "text": "gl"})
+	readUntil(ctx, t, x, "chat")
+
+	// The process dies here: a new one starts from what was on disk.
+	image, err := os.ReadFile(filepath.Join(dir, "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = os.WriteFile(filepath.Join(dir, "db2"), image, 0o600)
+	base = crashHub(t, filepath.Join(dir, "db2"), grace, over)
+
+	x = dial(base + "/ws?resume=" + tx)
+	var st proto.Start
+	_ = json.Unmarshal(readUntil(ctx, t, x, "start"), &st)
+	if st.Board[0] != "X" || st.Board[4] != "O" || !st.YourTurn {
+		t.Fatalf("X finds the game where it was: %+v", st)
+	}
+	readUntil(ctx, t, x, "state") // where the game is
+	o = dial(base + "/ws?resume=" + to)
+	readUntil(ctx, t, o, "state")
+
+	move(x, o, 1)
+	move(o, x, 5)
+	move(x, o, 2) // X takes the top row
+	var res proto.Result
+	_ = json.Unmarshal(readUntil(ctx, t, o, "result"), &res)
+	if res.Status != "X wins!" {
+		t.Fatalf("result %+v", res)
+	}
+	g := awaitOver(t, over)
+	if g.X != "ann" || g.O != "bob" || !g.XGuest || !g.OGuest || len(g.Record.Moves) != 5 || len(g.Record.Chat) != 1 {
+		t.Fatalf("game over %+v", g)
+	}
+	if g.Record.X != "ann" || g.Record.O != "bob" || g.Record.Chat[0].PlayerID != "bob" {
+		t.Fatalf("the record names players, not connections: %+v", g.Record)
+	}
+}
@@ -0,0 +1,75 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+	"github.com/kushgupta-hiver/TTT/internal/schema"
+)
+
+// Regenerate with: go generate ./internal/proto
+func TestSchema_CheckedInMatchesGoStructs(t *testing.T) {
+	files, err := schema.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join("..", "schema", name))
+		if err != nil {
+			t.Fatalf("%s: %v (run go generate ./internal/proto)", name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("schema/%s is out of date with internal/proto; run go generate ./internal/proto", name)
+		}
+	}
+}
+
+func TestSchema_DescribesEveryRegisteredMessage(t *testing.T) {
+	b, err := schema.JSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Defs map[string]struct {
+			Properties map[string]map[string]any `json:"properties"`
+			Required   []string                  `json:"required"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	check := func(dir string, msgs []proto.Message) {
+		for _, m := range msgs {
+			key := dir + "." + m.Type
+			if seen[key] {
+				t.Fatalf("%s registered twice", key)
+			}
+			seen[key] = true
+			def, ok := doc.Defs[key]
+			if !ok {
+				t.Fatalf("no definition for %s", key)
+			}
+			if def.Properties["type"]["const"] != m.Type {
+				t.Fatalf("%s: type discriminator is %v", key, def.Properties["type"])
+			}
+		}
+	}
+	check("client", proto.ClientMessages)
+	check("server", proto.ServerMessages)
+	check("lobby.client", proto.LobbyClientMessages)
+	check("lobby.server", proto.LobbyServerMessages)
+
+	mv := doc.Defs["client.move"]
+	if _, ok := mv.Properties["position"]; !ok || len(mv.Properties) != 4 {
+		t.Fatalf("client.move should carry only its own fields: %v", mv.Properties)
+	}
+	if st := doc.Defs["server.state"]; st.Properties["board"]["maxItems"] != float64(9) {
+		t.Fatalf("state board should be 9 cells: %v", st.Properties["board"])
+	}
+}
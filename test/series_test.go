@@ -0,0 +1,197 @@
+package test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ws"
+	"github.com/kushgupta-hiver/TTT/pkg/client"
+)
+
+func TestSeries_Scoring(t *testing.T) {
+	s := match.NewSeries(3)
+	s.Record("a", "b", engine.XWins)
+	if _, over := s.Over(); over {
+		t.Fatal("1-0 in a best of 3 is not decided")
+	}
+	s.Record("b", "a", engine.OWins)
+	if w, over := s.Over(); !over || w != "a" || s.Games != 2 {
+		t.Fatalf("2-0 should end it for a: winner=%q over=%v", w, over)
+	}
+	s.Record("a", "b", engine.OWins)
+	if s.Games != 2 || s.Wins("b") != 0 {
+		t.Fatal("games after the end are ignored")
+	}
+
+	drawn := match.NewSeries(3)
+	drawn.Record("a", "b", engine.XWins)
+	drawn.Record("b", "a", engine.XWins)
+	drawn.Record("a", "b", engine.Draw)
+	if w, over := drawn.Over(); !over || w != "" || drawn.Draws != 1 {
+		t.Fatalf("1-1 after three games is drawn: winner=%q over=%v", w, over)
+	}
+
+	conceded := match.NewSeries(5)
+	conceded.Record("a", "b", engine.XWins)
+	conceded.Concede("b")
+	if w, _ := conceded.Over(); w != "b" {
+		t.Fatalf("concession goes to b, got %q", w)
+	}
+}
+
+func seriesServer(t *testing.T, cfg hub.Config) (string, hub.Hub) {
+	t.Helper()
+	h := hub.NewHub(cfg, engine.NewEngine())
+	t.Cleanup(func() { h.Close() })
+	ts := httptest.NewServer(ws.NewServer(ws.Config{Hub: h}, engine.NewEngine()))
+	t.Cleanup(ts.Close)
+	return ts.URL, h
+}
+
+func TestSeries_BestOfThreeInOneRoom(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	url, _ := seriesServer(t, hub.Config{})
+
+	a, err := client.Dial(ctx, url, client.Options{Code: "7171", BestOf: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := client.Dial(ctx, url, client.Options{Code: "7171"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if s := await[client.Series](t, b); s.BestOf != 3 || s.Game != 0 {
+		t.Fatalf("series should be announced at the start, got %+v", s)
+	}
+	for game, wantA := range []client.Mark{client.X, client.O} {
+		if got := await[client.Assigned](t, a).You; got != wantA {
+			t.Fatalf("game %d: a should be %s, got %s", game+1, wantA, got)
+		}
+		await[client.Start](t, b)
+		_ = b.Resign(ctx) // a wins both
+		if r := await[client.Result](t, a); r.Status == "Draw" {
+			t.Fatalf("unexpected result %+v", r)
+		}
+		sa, sb := await[client.Series](t, a), await[client.Series](t, b)
+		if sa.Game != game+1 || sa.You != game+1 || sb.Opponent != game+1 {
+			t.Fatalf("game %d: score a=%+v b=%+v", game+1, sa, sb)
+		}
+		if over := game == 1; sa.Over != over || sb.Over != over {
+			t.Fatalf("game %d: over a=%v b=%v", game+1, sa.Over, sb.Over)
+		}
+		if game == 1 && (sa.Outcome != "won" || sb.Outcome != "lost") {
+			t.Fatalf("final outcomes a=%q b=%q", sa.Outcome, sb.Outcome)
+		}
+	}
+
+	// A rematch after the series starts a new one.
+	_ = a.Rematch(ctx)
+	_ = b.Rematch(ctx)
+	if s := await[client.Series](t, a); s.Game != 0 || s.You != 0 {
+		t.Fatalf("rematch should reset the series, got %+v", s)
+	}
+}
+
+func TestSeries_LeavingConcedesTheSeries(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	url, _ := seriesServer(t, hub.Config{Series: match.SeriesOptions{BestOf: 5, Forfeit: match.ForfeitGame}})
+
+	a, err := client.Dial(ctx, url, client.Options{Code: "7272"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := client.Dial(ctx, url, client.Options{Code: "7272"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	await[client.Start](t, a)
+	await[client.Start](t, b)
+	_ = b.Leave(ctx)
+
+	if r := await[client.Result](t, a); r.Status != "X wins!" {
+		t.Fatalf("unexpected result %+v", r)
+	}
+	if s := await[client.Series](t, a); !s.Over || s.Outcome != "won" || s.Game != 1 {
+		t.Fatalf("leaving for good gives up the series, got %+v", s)
+	}
+}
+
+func TestSeries_ForfeitGameHoldsTheSeat(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	url, h := seriesServer(t, hub.Config{ResumeGrace: 100 * time.Millisecond})
+	px := newCutProxy(t, url[len("http://"):])
+
+	x, err := client.Dial(ctx, px.URL(), client.Options{Code: "7373", BestOf: 3, Forfeit: "game"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+	o, err := client.Dial(ctx, url, client.Options{Code: "7373"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	await[client.Start](t, x)
+	await[client.Start](t, o)
+
+	px.cut()
+	await[client.Opponent](t, o)
+	if r := await[client.Result](t, o); r.Status != "O wins!" {
+		t.Fatalf("the dropped player loses the game, got %+v", r)
+	}
+	if s := await[client.Series](t, o); s.Over || s.You != 1 {
+		t.Fatalf("the series goes on, got %+v", s)
+	}
+	if a := await[client.Assigned](t, o); a.You != client.X {
+		t.Fatalf("sides swap for game 2, got %+v", a)
+	}
+	if op := await[client.Opponent](t, o); op.Status != "away" {
+		t.Fatalf("opponent still away, got %+v", op)
+	}
+	if len(h.Conns()) != 2 {
+		t.Fatalf("the seat should be held, conns=%+v", h.Conns())
+	}
+
+	if r := await[client.Result](t, o); r.Status != "X wins!" {
+		t.Fatalf("second game forfeited too, got %+v", r)
+	}
+	if s := await[client.Series](t, o); !s.Over || s.Outcome != "won" || s.You != 2 {
+		t.Fatalf("series over 2-0, got %+v", s)
+	}
+	if len(h.Conns()) != 1 {
+		t.Fatalf("the seat is released once the series is over, conns=%+v", h.Conns())
+	}
+}
+
+func TestSeries_RejectsBadOptions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	url, _ := seriesServer(t, hub.Config{})
+
+	// Too long, or even: a 2-2 series would have no winner.
+	for _, n := range []int{99, 4} {
+		c, err := client.Dial(ctx, url, client.Options{Code: "7474", BestOf: n})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e := await[client.Error](t, c); e.Code != "INVALID" {
+			t.Fatalf("bestOf %d: expected INVALID, got %+v", n, e)
+		}
+		c.Close()
+	}
+	if _, err := hub.NewHub(hub.Config{}, engine.NewEngine()).Reserve(hub.Reservation{X: "ann", O: "bob", Series: match.SeriesOptions{BestOf: 2}}); err == nil {
+		t.Fatal("a reservation for an even series must be refused")
+	}
+}
@@ -0,0 +1,254 @@
+package test
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ws"
+	"github.com/kushgupta-hiver/TTT/pkg/client"
+)
+
+func pairing(first, second string) match.Pairing {
+	return match.Pairing{First: match.Player{ID: first}, Second: match.Player{ID: second}}
+}
+
+func TestSides_RandomIsSeededAndFair(t *testing.T) {
+	a, b := match.RandomSides(42), match.RandomSides(42)
+	xs := 0
+	for i := 0; i < 1000; i++ {
+		got := a.FirstIsX(pairing("p", "q"))
+		if got != b.FirstIsX(pairing("p", "q")) {
+			t.Fatal("same seed must give the same sides")
+		}
+		if got {
+			xs++
+		}
+	}
+	if xs < 400 || xs > 600 {
+		t.Fatalf("first player was X %d/1000 times", xs)
+	}
+}
+
+func TestSides_AlternateSwapsOnRematch(t *testing.T) {
+	p := match.Alternate(match.FirstComeX())
+	if !p.FirstIsX(pairing("p", "q")) {
+		t.Fatal("new pairing defers to the fallback")
+	}
+	rematch := pairing("p", "q")
+	rematch.PrevX = "p"
+	if p.FirstIsX(rematch) {
+		t.Fatal("previous X should play O")
+	}
+	rematch.PrevX = "q"
+	if !p.FirstIsX(rematch) {
+		t.Fatal("previous O should play X")
+	}
+}
+
+func TestSides_BalanceEvensOutHistory(t *testing.T) {
+	p := match.Balance(match.FirstComeX(), match.BalanceOptions{})
+	ann := match.Player{ID: "c1", Name: "ann", Verified: true}
+	bob := match.Player{ID: "c2", Name: "bob", Verified: true}
+	cat := match.Player{ID: "c3", Name: "cat", Verified: true}
+
+	if !p.FirstIsX(match.Pairing{First: ann, Second: bob}) {
+		t.Fatal("even records defer to the tie-break")
+	}
+	// ann has been X once: against bob again, even arriving first, she is O.
+	if p.FirstIsX(match.Pairing{First: ann, Second: bob}) {
+		t.Fatal("ann should play O")
+	}
+	// ann is even again, as is cat (new): a tie.
+	if !p.FirstIsX(match.Pairing{First: cat, Second: ann}) {
+		t.Fatal("tie should defer")
+	}
+	// ann has now been O more often than X: she gets X arriving second.
+	if p.FirstIsX(match.Pairing{First: bob, Second: ann}) {
+		t.Fatal("ann should get X back")
+	}
+}
+
+func TestSides_BalanceCountsSignedInPlayersOnly(t *testing.T) {
+	clk := newFakeClock()
+	p := match.Balance(match.FirstComeX(), match.BalanceOptions{
+		Clock: clk,
+		Idle:  24 * time.Hour,
+		Seed:  map[string]match.SideCount{"ann": {XMinusO: 2, Last: clk.Now()}},
+	})
+	ann := match.Player{ID: "c1", Name: "ann", Verified: true}
+	bob := match.Player{ID: "c2", Name: "bob", Verified: true}
+	guest := match.Player{ID: "c3", Name: "bob"} // declared, not signed in
+
+	// The stored history counts: ann has been X twice more than O.
+	if p.FirstIsX(match.Pairing{First: ann, Second: bob}) {
+		t.Fatal("ann should play O")
+	}
+	// ann and bob are both +1 now. A guest calling themselves bob does not
+	// get bob's record: ann, still ahead on X, plays O.
+	if p.FirstIsX(match.Pairing{First: ann, Second: guest}) {
+		t.Fatal("the guest is even, ann is not")
+	}
+	// ann is even, bob still +1.
+	if !p.FirstIsX(match.Pairing{First: ann, Second: bob}) {
+		t.Fatal("ann has played X less than bob")
+	}
+	// After a quiet day both start even.
+	clk.Advance(25 * time.Hour)
+	if !p.FirstIsX(match.Pairing{First: ann, Second: bob}) {
+		t.Fatal("idle records are forgotten")
+	}
+}
+
+func TestSides_BalanceHoldsUnderConcurrentPairings(t *testing.T) {
+	p := match.Balance(match.FirstComeX(), match.BalanceOptions{})
+	ann := match.Player{ID: "c1", Name: "ann", Verified: true}
+	bob := match.Player{ID: "c2", Name: "bob", Verified: true}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	xs := 0
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if p.FirstIsX(match.Pairing{First: ann, Second: bob}) {
+				mu.Lock()
+				xs++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if xs != 100 {
+		t.Fatalf("ann was X %d/200 times", xs)
+	}
+}
+
+func TestSides_HostChooses(t *testing.T) {
+	p := match.HostChooses(match.FirstComeX())
+	pr := pairing("host", "guest")
+	pr.First.Side = engine.O
+	if p.FirstIsX(pr) {
+		t.Fatal("host asked for O")
+	}
+	pr.First.Side = engine.Empty
+	if !p.FirstIsX(pr) {
+		t.Fatal("no preference defers to the fallback")
+	}
+}
+
+func sidesServer(t *testing.T, sides match.SidePolicy) string {
+	t.Helper()
+	h := hub.NewHub(hub.Config{Sides: sides}, engine.NewEngine())
+	t.Cleanup(func() { h.Close() })
+	ts := httptest.NewServer(ws.NewServer(ws.Config{Hub: h}, engine.NewEngine()))
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+func TestRoomCode_HostPicksSide(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	url := sidesServer(t, match.HostChooses(match.FirstComeX()))
+
+	host, err := client.Dial(ctx, url, client.Options{Code: "3131", Side: client.O})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer host.Close()
+	guest, err := client.Dial(ctx, url, client.Options{Code: "3131", Side: client.O}) // ignored: not the host
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer guest.Close()
+
+	if a := await[client.Assigned](t, host); a.You != client.O {
+		t.Fatalf("host asked for O, got %+v", a)
+	}
+	if s := await[client.Start](t, guest); !s.YourTurn {
+		t.Fatal("guest should be X and move first")
+	}
+}
+
+func TestReserve_OpenSidesFollowPolicy(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	lastComeX := match.SideFunc(func(match.Pairing) bool { return false })
+	h := hub.NewHub(hub.Config{Sides: lastComeX}, engine.NewEngine())
+	t.Cleanup(func() { h.Close() })
+	ts := httptest.NewServer(ws.NewServer(ws.Config{Hub: h}, engine.NewEngine()))
+	t.Cleanup(ts.Close)
+
+	for _, open := range []bool{false, true} {
+		code, err := h.Reserve(hub.Reservation{X: "ann", O: "bob", Open: open})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ann, err := client.Dial(ctx, ts.URL, client.Options{Code: code, Player: "ann"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ann.Close()
+		bob, err := client.Dial(ctx, ts.URL, client.Options{Code: code, Player: "bob"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer bob.Close()
+
+		want := client.X // fixed: ann is X wherever the policy stands
+		if open {
+			want = client.O // open: the policy gives X to the later arrival
+		}
+		if a := await[client.Assigned](t, ann); a.You != want {
+			t.Fatalf("open=%v: ann got %s", open, a.You)
+		}
+	}
+}
+
+func TestRematch_AlternatesSides(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	url := sidesServer(t, match.Alternate(match.FirstComeX()))
+
+	a, err := client.Dial(ctx, url, client.Options{Code: "3232"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := client.Dial(ctx, url, client.Options{Code: "3232"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	marks := func() (client.Mark, client.Mark) {
+		return await[client.Assigned](t, a).You, await[client.Assigned](t, b).You
+	}
+	for game := 0; game < 3; game++ {
+		ma, mb := marks()
+		want := client.X
+		if game%2 == 1 {
+			want = client.O
+		}
+		if ma != want || mb == ma {
+			t.Fatalf("game %d: a=%s b=%s", game, ma, mb)
+		}
+		x := a
+		if ma != client.X {
+			x = b
+		}
+		await[client.Start](t, a)
+		await[client.Start](t, b)
+		_ = x.Resign(ctx)
+		await[client.Result](t, a)
+		await[client.Result](t, b)
+		_ = a.Rematch(ctx)
+		_ = b.Rematch(ctx)
+	}
+}
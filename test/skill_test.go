@@ -0,0 +1,168 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/match"
+)
+
+// skillQueue is a rating matchmaker driven by a fake clock: pairing happens
+// only on Enqueue and Ping, so every test step is deterministic.
+func skillQueue(t *testing.T, clk *fakeClock) (match.SkillMatchmaker, *[]match.RoomCreatedEvent) {
+	t.Helper()
+	var rooms []match.RoomCreatedEvent
+	mm := match.NewSkillMatchmaker(match.SkillOptions{
+		Clock:       clk,
+		Window:      100,
+		Widen:       10,
+		MaxWindow:   500,
+		AvoidRepeat: time.Minute,
+		Rescan:      -1,
+	}, func(ev match.RoomCreatedEvent) { rooms = append(rooms, ev) })
+	t.Cleanup(func() { mm.Close() })
+	return mm, &rooms
+}
+
+func enqueue(t *testing.T, mm match.Matchmaker, id string, rating float64) {
+	t.Helper()
+	if err := mm.Enqueue(context.Background(), match.Player{ID: id, Rating: rating}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func pair(ev match.RoomCreatedEvent) [2]string { return [2]string{ev.X.ID, ev.O.ID} }
+
+func TestSkillMatchmaker_PairsClosestRatings(t *testing.T) {
+	mm, rooms := skillQueue(t, newFakeClock())
+	enqueue(t, mm, "mid", 1500)
+	enqueue(t, mm, "far", 1900)
+	if len(*rooms) != 0 || mm.Pending() != 2 {
+		t.Fatalf("400 apart should not pair yet: %+v", *rooms)
+	}
+	enqueue(t, mm, "close", 1560)
+	enqueue(t, mm, "closer", 1530) // arrives after close; mid already took close
+	if len(*rooms) != 1 || pair((*rooms)[0]) != [2]string{"mid", "close"} {
+		t.Fatalf("expected mid vs close, got %+v", *rooms)
+	}
+	if mm.Pending() != 2 {
+		t.Fatalf("expected far and closer left, got %d", mm.Pending())
+	}
+}
+
+func TestSkillMatchmaker_WindowWidensWithWaiting(t *testing.T) {
+	clk := newFakeClock()
+	mm, rooms := skillQueue(t, clk)
+	enqueue(t, mm, "a", 1500)
+	enqueue(t, mm, "b", 1800)
+
+	clk.Advance(19 * time.Second) // window 290
+	_ = mm.Ping(context.Background())
+	if len(*rooms) != 0 {
+		t.Fatalf("paired too early: %+v", *rooms)
+	}
+	clk.Advance(time.Second) // window 300
+	_ = mm.Ping(context.Background())
+	if len(*rooms) != 1 {
+		t.Fatalf("expected a pairing once the window reached the gap")
+	}
+
+	// MaxWindow still caps how far apart players can be.
+	enqueue(t, mm, "c", 1000)
+	enqueue(t, mm, "d", 2000)
+	clk.Advance(time.Hour)
+	_ = mm.Ping(context.Background())
+	if len(*rooms) != 1 {
+		t.Fatalf("1000 apart exceeds MaxWindow: %+v", *rooms)
+	}
+}
+
+func TestSkillMatchmaker_AvoidsImmediateRepeat(t *testing.T) {
+	clk := newFakeClock()
+	mm, rooms := skillQueue(t, clk)
+	enqueue(t, mm, "a", 1500)
+	enqueue(t, mm, "b", 1500)
+	if len(*rooms) != 1 {
+		t.Fatal("expected first pairing")
+	}
+
+	clk.Advance(10 * time.Second)
+	enqueue(t, mm, "a", 1500)
+	enqueue(t, mm, "b", 1500)
+	if len(*rooms) != 1 {
+		t.Fatalf("a and b just played: %+v", *rooms)
+	}
+	enqueue(t, mm, "c", 1550)
+	if len(*rooms) != 2 || pair((*rooms)[1]) != [2]string{"a", "c"} {
+		t.Fatalf("expected a vs c, got %+v", *rooms)
+	}
+
+	enqueue(t, mm, "a", 1500)
+	clk.Advance(time.Minute)
+	_ = mm.Ping(context.Background())
+	if len(*rooms) != 3 || pair((*rooms)[2]) != [2]string{"b", "a"} {
+		t.Fatalf("repeat allowed after AvoidRepeat, got %+v", *rooms)
+	}
+}
+
+func TestSkillMatchmaker_NeverPairsAPlayerWithThemselves(t *testing.T) {
+	mm, rooms := skillQueue(t, newFakeClock())
+	_ = mm.Enqueue(context.Background(), match.Player{ID: "c1", Name: "ann", Rating: 1500})
+	_ = mm.Enqueue(context.Background(), match.Player{ID: "c2", Name: "ann", Rating: 1500})
+	if len(*rooms) != 0 {
+		t.Fatalf("two connections of one player were paired: %+v", *rooms)
+	}
+}
+
+func TestSkillMatchmaker_ExpectedWait(t *testing.T) {
+	clk := newFakeClock()
+	mm, _ := skillQueue(t, clk)
+	if _, ok := mm.ExpectedWait(1500); ok {
+		t.Fatal("no history yet")
+	}
+
+	for i, wait := range []time.Duration{4 * time.Second, 6 * time.Second, 8 * time.Second} {
+		a, b := "a"+strconvI(i), "b"+strconvI(i)
+		enqueue(t, mm, a, 1500)
+		clk.Advance(wait)
+		enqueue(t, mm, b, 1500)
+	}
+	// Waits were 4s, 0, 6s, 0, 8s, 0: median of six is the fourth, 4s.
+	if d, ok := mm.ExpectedWait(1500); !ok || d != 4*time.Second {
+		t.Fatalf("ExpectedWait = %v, %v", d, ok)
+	}
+
+	enqueue(t, mm, "waiting", 1510)
+	if d, ok := mm.ExpectedWait(1500); !ok || d != 0 {
+		t.Fatalf("a compatible player is waiting, got %v, %v", d, ok)
+	}
+}
+
+func TestSkillMatchmaker_RemoveAndRequeue(t *testing.T) {
+	clk := newFakeClock()
+	mm, rooms := skillQueue(t, clk)
+	enqueue(t, mm, "ghost", 1500)
+	if !mm.Remove("ghost") || mm.Remove("ghost") || mm.Pending() != 0 {
+		t.Fatalf("remove: pending %d", mm.Pending())
+	}
+	if _, ok := mm.ExpectedWait(1500); ok {
+		t.Fatal("a removed player is not waiting")
+	}
+	enqueue(t, mm, "a", 1500)
+	if len(*rooms) != 0 {
+		t.Fatalf("paired with a removed player: %+v", *rooms)
+	}
+
+	// b queued 20s ago and keeps that wait: window 300 reaches a.
+	since := clk.Now()
+	clk.Advance(20 * time.Second)
+	mm.Remove("a")
+	if err := mm.Requeue(context.Background(), match.Player{ID: "b", Rating: 1800}, since); err != nil {
+		t.Fatal(err)
+	}
+	enqueue(t, mm, "a", 1500)
+	if len(*rooms) != 1 || pair((*rooms)[0]) != [2]string{"b", "a"} {
+		t.Fatalf("requeued wait was lost: %+v", *rooms)
+	}
+}
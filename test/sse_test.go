@@ -0,0 +1,129 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+	"github.com/kushgupta-hiver/TTT/internal/transport/sse"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ws"
+	"nhooyr.io/websocket"
+)
+
+type sseStream struct {
+	resp *http.Response
+	sc   *bufio.Scanner
+}
+
+func openSSE(ctx context.Context, t *testing.T, url string) *sseStream {
+	t.Helper()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	return &sseStream{resp: resp, sc: bufio.NewScanner(resp.Body)}
+}
+
+// next returns the JSON payload of the next data event.
+func (s *sseStream) next(t *testing.T) []byte {
+	t.Helper()
+	for s.sc.Scan() {
+		if line := s.sc.Text(); strings.HasPrefix(line, "data: ") {
+			return []byte(strings.TrimPrefix(line, "data: "))
+		}
+	}
+	t.Fatalf("stream ended: %v", s.sc.Err())
+	return nil
+}
+
+func TestSSE_PlaysAgainstWebsocketPlayer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	eng := engine.NewEngine()
+	h := hub.NewHub(hub.Config{}, eng)
+	defer h.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/ws/", ws.NewServer(ws.Config{Hub: h}, eng))
+	mux.Handle("/sse/", sse.NewServer(sse.Config{Hub: h}, eng))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	// SSE player arrives first and becomes X.
+	stream := openSSE(ctx, t, ts.URL+"/sse/4242")
+	defer stream.resp.Body.Close()
+	var sess proto.Session
+	_ = json.Unmarshal(stream.next(t), &sess)
+	if sess.Type != "session" || sess.Session == "" {
+		t.Fatalf("expected session event, got %+v", sess)
+	}
+
+	wc, _, err := websocket.Dial(ctx, wsURLFromHTTP(ts.URL)+"/ws/4242", nil)
+	if err != nil {
+		t.Fatalf("dial ws: %v", err)
+	}
+	defer wc.Close(websocket.StatusNormalClosure, "bye")
+
+	var a proto.Assigned
+	_ = json.Unmarshal(stream.next(t), &a)
+	if a.You != engine.X {
+		t.Fatalf("expected SSE player to be X, got %+v", a)
+	}
+	stream.next(t) // start
+	readUntil(ctx, t, wc, "start")
+
+	resp, err := http.Post(ts.URL+"/sse/send?session="+sess.Session, "text/plain", strings.NewReader("4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", resp.StatusCode)
+	}
+
+	var st proto.State
+	_ = json.Unmarshal(readUntil(ctx, t, wc, "state"), &st)
+	if st.Board[4] != "X" || st.NextTurn != engine.O {
+		t.Fatalf("ws player should see X at 4, got %+v", st)
+	}
+	_ = json.Unmarshal(stream.next(t), &st)
+	if st.Type != "state" || st.ServerSeq != 1 {
+		t.Fatalf("SSE player should see its own move, got %+v", st)
+	}
+
+	// ws player moves; SSE player hears about it
+	_ = wc.Write(ctx, websocket.MessageText, []byte("0"))
+	_ = json.Unmarshal(stream.next(t), &st)
+	if st.Board[0] != "O" || st.ServerSeq != 2 {
+		t.Fatalf("SSE player should see O at 0, got %+v", st)
+	}
+}
+
+func TestSSE_PostToUnknownSession(t *testing.T) {
+	s := sse.NewServer(sse.Config{}, engine.NewEngine())
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/sse/send?session=nope", "text/plain", strings.NewReader("0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.StatusCode)
+	}
+}
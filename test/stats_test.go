@@ -0,0 +1,266 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/stats"
+	"github.com/kushgupta-hiver/TTT/internal/store"
+)
+
+func TestStats_PlayerAggregates(t *testing.T) {
+	tr := stats.NewTracker(stats.Config{Clock: newFakeClock()})
+	for _, g := range []stats.Game{
+		{ID: "g1", X: "ann", O: "bob", Outcome: engine.XWins, Reason: match.ReasonPlay, Moves: 5},
+		{ID: "g2", X: "cat", O: "ann", Outcome: engine.OWins, Reason: match.ReasonPlay, Moves: 6},
+		{ID: "g3", X: "ann", O: "dan", Outcome: engine.Draw, Reason: match.ReasonPlay, Moves: 9},
+		{ID: "g4", X: "ann", O: "cat", Outcome: engine.OWins, Reason: match.ReasonTimeout, Moves: 2},
+		{ID: "g5", X: "bob", O: "ann", Outcome: engine.OWins, Reason: match.ReasonResign, Moves: 3},
+	} {
+		if err := tr.Record(g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.Record(stats.Game{ID: "g1", X: "ann", O: "bob", Outcome: engine.XWins}); !errors.Is(err, stats.ErrDuplicate) {
+		t.Fatalf("expected ErrDuplicate, got %v", err)
+	}
+	if err := tr.Record(stats.Game{ID: "g6", X: "ann", O: "eve", Outcome: engine.Draw, Reason: match.ReasonNoShow}); err != nil {
+		t.Fatal(err)
+	}
+
+	ann, ok := tr.Player("ann")
+	if !ok {
+		t.Fatal("ann has no stats")
+	}
+	if ann.Played != 5 || ann.Wins != 3 || ann.Draws != 1 || ann.Losses != 1 {
+		t.Fatalf("totals: %+v", ann.SideStats)
+	}
+	if (ann.AsX != stats.SideStats{Played: 3, Wins: 1, Draws: 1, Losses: 1}) || (ann.AsO != stats.SideStats{Played: 2, Wins: 2}) {
+		t.Fatalf("by side: X %+v O %+v", ann.AsX, ann.AsO)
+	}
+	if ann.AvgMovesToWin != 3 {
+		t.Fatalf("wins on the board took 3 own moves each, got %v", ann.AvgMovesToWin)
+	}
+	if ann.Forfeits != 1 || ann.ForfeitRate != 0.2 {
+		t.Fatalf("forfeits %d rate %v", ann.Forfeits, ann.ForfeitRate)
+	}
+	if ann.Streak != 1 || ann.BestStreak != 2 {
+		t.Fatalf("streak %d best %d", ann.Streak, ann.BestStreak)
+	}
+	if _, ok := tr.Player("eve"); ok {
+		t.Fatal("a double no-show is not a game")
+	}
+}
+
+func TestLeaderboard_PeriodsAndVariants(t *testing.T) {
+	clock := newFakeClock() // a Tuesday
+	tr := stats.NewTracker(stats.Config{Clock: clock})
+	_ = tr.Record(stats.Game{ID: "1", X: "ann", O: "bob", Outcome: engine.XWins})
+	_ = tr.Record(stats.Game{ID: "2", X: "cat", O: "bob", Outcome: engine.Draw, Variant: "misere"})
+
+	clock.Advance(24 * time.Hour)
+	_ = tr.Record(stats.Game{ID: "3", X: "bob", O: "cat", Outcome: engine.XWins})
+
+	top := func(q stats.Query) []string {
+		t.Helper()
+		p, err := tr.Leaderboard(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, e := range p.Entries {
+			names = append(names, e.Player)
+		}
+		return names
+	}
+	eq := func(got []string, want ...string) bool {
+		if len(got) != len(want) {
+			return false
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	// bob 1.5 in 3, ann 1 in 1, cat 0.5 in 2
+	if got := top(stats.Query{}); !eq(got, "bob", "ann", "cat") {
+		t.Fatalf("all-time: %v", got)
+	}
+	if got := top(stats.Query{Period: stats.Daily}); !eq(got, "bob", "cat") {
+		t.Fatalf("today: %v", got)
+	}
+	if got := top(stats.Query{Period: stats.Weekly}); !eq(got, "bob", "ann", "cat") {
+		t.Fatalf("this week: %v", got)
+	}
+	if got := top(stats.Query{Variant: "misere"}); !eq(got, "bob", "cat") {
+		t.Fatalf("misere: %v", got)
+	}
+	if got := top(stats.Query{Variant: stats.DefaultVariant, Offset: 1, Limit: 1}); !eq(got, "bob") {
+		t.Fatalf("classic page 2: %v", got)
+	}
+
+	clock.Advance(7 * 24 * time.Hour)
+	if got := top(stats.Query{Period: stats.Weekly}); len(got) != 0 {
+		t.Fatalf("a new week starts empty: %v", got)
+	}
+	if _, err := tr.Leaderboard(stats.Query{Period: "month"}); !errors.Is(err, stats.ErrPeriod) {
+		t.Fatalf("expected ErrPeriod, got %v", err)
+	}
+}
+
+func TestStats_GuestsAndSelfPlayAreNotCounted(t *testing.T) {
+	tr := stats.NewTracker(stats.Config{})
+	if err := tr.Record(stats.Game{ID: "1", X: "ann", O: "ann", Outcome: engine.XWins}); !errors.Is(err, stats.ErrSelfPlay) {
+		t.Fatalf("expected ErrSelfPlay, got %v", err)
+	}
+	if err := tr.Record(stats.Game{ID: "2", X: "ann", O: "bob", Outcome: engine.XWins, OGuest: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, period := range []string{stats.AllTime, stats.Weekly, stats.Daily} {
+		p, _ := tr.Leaderboard(stats.Query{Period: period})
+		if len(p.Entries) != 1 || p.Entries[0].Player != "ann" {
+			t.Fatalf("%s board: %+v", period, p.Entries)
+		}
+	}
+	// Losing as a guest named bob leaves the real bob's record alone.
+	if bob, ok := tr.Player("bob"); ok {
+		t.Fatalf("a guest got player stats: %+v", bob)
+	}
+	if ann, ok := tr.Player("ann"); !ok || ann.Wins != 1 {
+		t.Fatalf("ann's win over a guest: %+v", ann)
+	}
+}
+
+func TestStats_SurviveARestart(t *testing.T) {
+	db := store.NewMemory()
+	tr := stats.NewTracker(stats.Config{Store: db})
+	at := time.Now().UTC().Truncate(time.Second)
+	for i, g := range []stats.Game{
+		{ID: "g1", X: "ann", O: "bob", Outcome: engine.XWins, At: at.Add(-time.Hour)},
+		{ID: "g2", X: "bob", O: "ann", Outcome: engine.XWins, At: at},
+	} {
+		if err := db.Update(func(tx store.Tx) error { return stats.Save(tx, g) }); err != nil {
+			t.Fatal(i, err)
+		}
+		_ = tr.Record(g)
+	}
+	err := db.Update(func(tx store.Tx) error {
+		return stats.Save(tx, stats.Game{ID: "g1", X: "ann", O: "bob", Outcome: engine.XWins})
+	})
+	if !errors.Is(err, stats.ErrDuplicate) {
+		t.Fatalf("expected ErrDuplicate, got %v", err)
+	}
+
+	again := stats.NewTracker(stats.Config{Store: db})
+	before, _ := tr.Player("ann")
+	after, ok := again.Player("ann")
+	if !ok || after != before || after.Streak != 0 || after.BestStreak != 1 {
+		t.Fatalf("restarted %+v, was %+v", after, before)
+	}
+	if err := again.Record(stats.Game{ID: "g2", X: "bob", O: "ann", Outcome: engine.XWins}); !errors.Is(err, stats.ErrDuplicate) {
+		t.Fatalf("a saved game is counted once: %v", err)
+	}
+
+	// The stored games also seed the side balance, guests left out.
+	_ = db.Update(func(tx store.Tx) error {
+		return stats.Save(tx, stats.Game{ID: "g3", X: "ann", O: "cat", OGuest: true, Outcome: engine.Draw, At: at})
+	})
+	sides, err := stats.Sides(db)
+	if err != nil || len(sides) != 2 || sides["ann"].XMinusO != 1 || sides["bob"].XMinusO != 0 || !sides["ann"].Last.Equal(at) {
+		t.Fatalf("sides %+v %v", sides, err)
+	}
+}
+
+func TestLeaderboard_StaysSortedAsGamesArrive(t *testing.T) {
+	tr := stats.NewTracker(stats.Config{})
+	r := rand.New(rand.NewSource(7))
+	players := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	half := map[string]int{}
+	played := map[string]int{}
+	for i := 0; i < 500; i++ {
+		x, o := players[r.Intn(len(players))], players[r.Intn(len(players))]
+		if x == o {
+			continue
+		}
+		outcome := []engine.Outcome{engine.XWins, engine.OWins, engine.Draw}[r.Intn(3)]
+		_ = tr.Record(stats.Game{ID: strconv.Itoa(i), X: x, O: o, Outcome: outcome})
+		played[x]++
+		played[o]++
+		switch outcome {
+		case engine.XWins:
+			half[x] += 2
+		case engine.OWins:
+			half[o] += 2
+		default:
+			half[x]++
+			half[o]++
+		}
+	}
+
+	want := append([]string(nil), players...)
+	sort.Slice(want, func(i, j int) bool {
+		a, b := want[i], want[j]
+		if half[a] != half[b] {
+			return half[a] > half[b]
+		}
+		if played[a] != played[b] {
+			return played[a] < played[b]
+		}
+		return a < b
+	})
+	p, _ := tr.Leaderboard(stats.Query{Limit: 100})
+	if p.Total != len(players) {
+		t.Fatalf("total %d", p.Total)
+	}
+	for i, e := range p.Entries {
+		if e.Player != want[i] || e.Rank != i+1 || e.Points != float64(half[want[i]])/2 {
+			t.Fatalf("rank %d: got %+v, want %s with %d half points", i+1, e, want[i], half[want[i]])
+		}
+	}
+}
+
+func TestStats_HTTP(t *testing.T) {
+	tr := stats.NewTracker(stats.Config{})
+	_ = tr.Record(stats.Game{ID: "1", X: "ann", O: "bob", Outcome: engine.XWins, Reason: match.ReasonPlay, Moves: 5})
+	ts := httptest.NewServer(stats.NewHandler(tr))
+	defer ts.Close()
+
+	get := func(path string, v any) int {
+		res, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if v != nil {
+			_ = json.NewDecoder(res.Body).Decode(v)
+		}
+		return res.StatusCode
+	}
+
+	var ann stats.PlayerStats
+	if code := get("/api/stats/ann", &ann); code != http.StatusOK || ann.Wins != 1 || ann.AvgMovesToWin != 3 {
+		t.Fatalf("stats: %d %+v", code, ann)
+	}
+	if code := get("/api/stats/zed", nil); code != http.StatusNotFound {
+		t.Fatalf("unknown player: %d", code)
+	}
+	var page stats.Page
+	if code := get("/api/leaderboard?period=day&limit=1", &page); code != http.StatusOK || page.Total != 2 || len(page.Entries) != 1 || page.Entries[0].Player != "ann" {
+		t.Fatalf("leaderboard: %d %+v", code, page)
+	}
+	if code := get("/api/leaderboard?period=year", nil); code != http.StatusBadRequest {
+		t.Fatalf("bad period: %d", code)
+	}
+}
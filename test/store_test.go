@@ -0,0 +1,247 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/ratings"
+	"github.com/kushgupta-hiver/TTT/internal/store"
+)
+
+func openFileStore(t *testing.T, path string, cfg store.Config) store.Store {
+	t.Helper()
+	cfg.NoSync = true
+	s, err := store.Open(path, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestStore_TransactionsApplyWhollyOrNotAtAll(t *testing.T) {
+	for name, s := range map[string]store.Store{
+		"memory": store.NewMemory(),
+		"file":   openFileStore(t, filepath.Join(t.TempDir(), "db"), store.Config{}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer s.Close()
+			err := s.Update(func(tx store.Tx) error {
+				_ = tx.Put("b", "k2", []byte("two"))
+				_ = tx.Put("b", "k1", []byte("one"))
+				_ = tx.Put("b", "x", []byte("other"))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			boom := errors.New("boom")
+			err = s.Update(func(tx store.Tx) error {
+				_ = tx.Put("b", "k3", []byte("three"))
+				_ = tx.Delete("b", "k1")
+				if v, ok := tx.Get("b", "k3"); !ok || string(v) != "three" {
+					t.Fatalf("a transaction sees its own writes: %q %v", v, ok)
+				}
+				return boom
+			})
+			if !errors.Is(err, boom) {
+				t.Fatalf("expected the callback's error, got %v", err)
+			}
+
+			var keys []string
+			_ = s.View(func(tx store.Tx) error {
+				if err := tx.Put("b", "k9", nil); !errors.Is(err, store.ErrReadOnly) {
+					t.Fatalf("expected ErrReadOnly, got %v", err)
+				}
+				return tx.Each("b", "k", func(k string, _ []byte) error {
+					keys = append(keys, k)
+					return nil
+				})
+			})
+			if len(keys) != 2 || keys[0] != "k1" || keys[1] != "k2" {
+				t.Fatalf("a failed update leaves nothing behind: %v", keys)
+			}
+			if err := s.Ping(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			_ = s.Close()
+			if err := s.Ping(context.Background()); !errors.Is(err, store.ErrClosed) {
+				t.Fatalf("a closed store is not ready: %v", err)
+			}
+		})
+	}
+}
+
+func TestFileStore_SurvivesRestartAndTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	s := openFileStore(t, path, store.Config{})
+	for i := 0; i < 3; i++ {
+		_ = s.Update(func(tx store.Tx) error { return tx.Put("b", strconv.Itoa(i), []byte("v")) })
+	}
+	_ = s.Close()
+
+	// A crash in the middle of the next write leaves half a record.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	_, _ = f.Write([]byte{0, 0, 0, 40, 1, 2, 3, 4, '[', '{'})
+	_ = f.Close()
+
+	s = openFileStore(t, path, store.Config{})
+	defer s.Close()
+	n := 0
+	_ = s.View(func(tx store.Tx) error {
+		return tx.Each("b", "", func(string, []byte) error { n++; return nil })
+	})
+	if n != 3 {
+		t.Fatalf("expected the 3 committed keys, got %d", n)
+	}
+	if err := s.Update(func(tx store.Tx) error { return tx.Put("b", "3", []byte("v")) }); err != nil {
+		t.Fatalf("writes go on after the torn tail is dropped: %v", err)
+	}
+	if s.Version() != store.Migrations[len(store.Migrations)-1].To {
+		t.Fatalf("version %d", s.Version())
+	}
+}
+
+func TestFileStore_MigratesAndRefusesNewerData(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db")
+	v1 := []store.Migration{{To: 1, Name: "initial"}}
+	s := openFileStore(t, path, store.Config{Migrations: v1})
+	_ = s.Update(func(tx store.Tx) error { return tx.Put("names", "ann", []byte("Ann")) })
+	_ = s.Close()
+
+	v2 := append(v1, store.Migration{To: 2, Name: "names to profiles", Up: func(tx store.Tx) error {
+		return tx.Each("names", "", func(k string, v []byte) error {
+			if err := tx.Put("profiles", k, append([]byte("name="), v...)); err != nil {
+				return err
+			}
+			return tx.Delete("names", k)
+		})
+	}})
+	s = openFileStore(t, path, store.Config{Migrations: v2})
+	if s.Version() != 2 {
+		t.Fatalf("version %d", s.Version())
+	}
+	_ = s.View(func(tx store.Tx) error {
+		if v, ok := tx.Get("profiles", "ann"); !ok || string(v) != "name=Ann" {
+			t.Fatalf("migrated value %q %v", v, ok)
+		}
+		if _, ok := tx.Get("names", "ann"); ok {
+			t.Fatal("old key kept")
+		}
+		return nil
+	})
+	_ = s.Close()
+
+	if _, err := store.Open(path, store.Config{Migrations: v1}); !errors.Is(err, store.ErrVersion) {
+		t.Fatalf("an older build must not open newer data: %v", err)
+	}
+	future := filepath.Join(dir, "future")
+	_ = os.WriteFile(future, []byte("ttt-store 99\n"), 0o600)
+	if _, err := store.Open(future, store.Config{}); !errors.Is(err, store.ErrVersion) {
+		t.Fatalf("expected ErrVersion for an unknown file format, got %v", err)
+	}
+}
+
+func TestFileStore_CompactsSupersededWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	s := openFileStore(t, path, store.Config{})
+	for i := 0; i < 10000; i++ {
+		_ = s.Update(func(tx store.Tx) error { return tx.Put("b", strconv.Itoa(i%10), []byte(strconv.Itoa(i))) })
+	}
+	_ = s.Close()
+	if info, _ := os.Stat(path); info.Size() > 256<<10 {
+		t.Fatalf("log not compacted: %d bytes", info.Size())
+	}
+	s = openFileStore(t, path, store.Config{})
+	defer s.Close()
+	_ = s.View(func(tx store.Tx) error {
+		if v, _ := tx.Get("b", "9"); string(v) != "9999" {
+			t.Fatalf("latest value lost: %q", v)
+		}
+		return nil
+	})
+}
+
+func TestStore_GameAndRatingSavedTogether(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	s := openFileStore(t, path, store.Config{})
+	book := ratings.NewBook(ratings.Config{Store: s})
+	rec := match.Record{RoomID: "r1", X: "ann", O: "bob", Outcome: engine.XWins, Reason: match.ReasonPlay, Rated: true}
+	save := func(rec match.Record) error {
+		return s.Update(func(tx store.Tx) error {
+			if err := store.SaveGame(tx, rec.X, rec.O, rec); err != nil {
+				return err
+			}
+			_, _, err := book.Rate(tx, ratings.Game{ID: rec.RoomID, X: rec.X, O: rec.O, Outcome: rec.Outcome})
+			return err
+		})
+	}
+	if err := save(rec); err != nil {
+		t.Fatal(err)
+	}
+	annAfter := book.Get("ann").Rating
+
+	// Rating fails (self-play), so the game is not saved either.
+	bad := match.Record{RoomID: "r2", X: "cat", O: "cat", Outcome: engine.Draw, Rated: true}
+	if err := save(bad); !errors.Is(err, ratings.ErrSelfPlay) {
+		t.Fatalf("expected ErrSelfPlay, got %v", err)
+	}
+	if err := save(rec); !errors.Is(err, store.ErrDuplicate) {
+		t.Fatalf("expected ErrDuplicate, got %v", err)
+	}
+	_ = s.Close()
+
+	s = openFileStore(t, path, store.Config{})
+	defer s.Close()
+	book = ratings.NewBook(ratings.Config{Store: s})
+	if r := book.Get("ann"); r.Rating != annAfter || r.Games != 1 || len(book.History("ann", 0)) != 1 {
+		t.Fatalf("rating after restart: %+v", r)
+	}
+	_ = s.View(func(tx store.Tx) error {
+		if g, ok, _ := store.Game(tx, "r1"); !ok || g.Outcome != engine.XWins {
+			t.Fatalf("game r1: %+v %v", g, ok)
+		}
+		if _, ok, _ := store.Game(tx, "r2"); ok {
+			t.Fatal("r2 was rolled back")
+		}
+		if p, ok, _ := store.Player(tx, "bob"); !ok || p.Games != 1 || p.Rated != 1 {
+			t.Fatalf("bob's profile: %+v", p)
+		}
+		if _, ok, _ := store.Player(tx, "cat"); ok {
+			t.Fatal("cat's profile was rolled back")
+		}
+		return nil
+	})
+}
+
+func TestStore_HandlerServesGamesWithoutChat(t *testing.T) {
+	s := openFileStore(t, filepath.Join(t.TempDir(), "db"), store.Config{})
+	defer s.Close()
+	rec := match.Record{RoomID: "r1", X: "ann", O: "bob", Outcome: engine.XWins, Reason: match.ReasonPlay,
+		Chat: []match.ChatLine{{PlayerID: "bob", Mark: engine.O, Text: "my address is…"}}}
+	if err := s.Update(func(tx store.Tx) error { return store.SaveGame(tx, "ann", "bob", rec) }); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	store.NewHandler(s).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/games/r1", nil))
+	var got map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("%d %s", w.Code, w.Body)
+	}
+	if got["x"] != "ann" || got["o"] != "bob" || got["roomId"] != "r1" {
+		t.Fatalf("game %v", got)
+	}
+	if _, ok := got["chat"]; ok {
+		t.Fatalf("chat served publicly: %v", got)
+	}
+}
@@ -0,0 +1,126 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+	"github.com/kushgupta-hiver/TTT/internal/transport/tcp"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ws"
+	"nhooyr.io/websocket"
+)
+
+type lineConn struct {
+	nc net.Conn
+	rd *bufio.Reader
+}
+
+// expect reads lines until one contains want.
+func (l *lineConn) expect(t *testing.T, want string) {
+	t.Helper()
+	_ = l.nc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var seen []string
+	for {
+		line, err := l.rd.ReadString('\n')
+		if err != nil {
+			t.Fatalf("waiting for %q: %v (saw %q)", want, err, seen)
+		}
+		if strings.Contains(line, want) {
+			return
+		}
+		seen = append(seen, line)
+	}
+}
+
+func (l *lineConn) send(s string) { _, _ = l.nc.Write([]byte(s + "\n")) }
+
+func TestTCP_TerminalPlayerMeetsWebsocketPlayer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	eng := engine.NewEngine()
+	h := hub.NewHub(hub.Config{}, eng)
+	defer h.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() { _ = tcp.NewServer(tcp.Config{Hub: h}, eng).Serve(ln) }()
+
+	ts := httptest.NewServer(ws.NewServer(ws.Config{Hub: h}, eng))
+	defer ts.Close()
+
+	nc, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	term := &lineConn{nc: nc, rd: bufio.NewReader(nc)}
+	term.expect(t, "Room code")
+	term.send("6060")
+	term.expect(t, "Waiting for an opponent")
+
+	wc, _, err := websocket.Dial(ctx, wsURLFromHTTP(ts.URL)+"/ws/6060", nil)
+	if err != nil {
+		t.Fatalf("dial ws: %v", err)
+	}
+	defer wc.Close(websocket.StatusNormalClosure, "bye")
+
+	term.expect(t, "You are X.")
+	term.expect(t, " 0 | 1 | 2 ")
+	term.expect(t, "Your move")
+	readUntil(ctx, t, wc, "start")
+
+	term.send("help")
+	term.expect(t, "rematch")
+	term.send("4")
+	term.expect(t, " 3 | X | 5 ")
+
+	var st proto.State
+	_ = json.Unmarshal(readUntil(ctx, t, wc, "state"), &st)
+	if st.Board[4] != "X" {
+		t.Fatalf("ws player should see the terminal move, got %+v", st)
+	}
+
+	_ = wc.Write(ctx, websocket.MessageText, []byte(`{"type":"resign"}`))
+	term.expect(t, "Game over: X wins!")
+
+	term.send("rematch")
+	var rm proto.Rematch
+	_ = json.Unmarshal(readUntil(ctx, t, wc, "rematch"), &rm)
+	if rm.From != engine.X {
+		t.Fatalf("unexpected rematch offer %+v", rm)
+	}
+	_ = wc.Write(ctx, websocket.MessageText, []byte(`{"type":"rematch"}`))
+	term.expect(t, "Opponent found.")
+	readUntil(ctx, t, wc, "start")
+}
+
+func TestRoomResign_AwardsOpponent(t *testing.T) {
+	ctx := context.Background()
+	r := match.NewRoom("r-resign", engine.NewEngine(), match.Options{})
+	_ = r.Join(ctx, match.Player{ID: "px", Mark: engine.X})
+	_ = r.Join(ctx, match.Player{ID: "po", Mark: engine.O})
+
+	if err := r.Resign(ctx, "px"); err != nil {
+		t.Fatalf("resign: %v", err)
+	}
+	if s := r.State(); s.Status != engine.OWins {
+		t.Fatalf("expected OWins, got %v", s.Status)
+	}
+	if err := r.Resign(ctx, "po"); !errors.Is(err, engine.ErrTerminal) {
+		t.Fatalf("expected ErrTerminal after game over, got %v", err)
+	}
+}
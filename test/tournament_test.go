@@ -0,0 +1,440 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kushgupta-hiver/TTT/internal/engine"
+	"github.com/kushgupta-hiver/TTT/internal/httpx"
+	"github.com/kushgupta-hiver/TTT/internal/hub"
+	"github.com/kushgupta-hiver/TTT/internal/match"
+	"github.com/kushgupta-hiver/TTT/internal/proto"
+	"github.com/kushgupta-hiver/TTT/internal/tournament"
+	"github.com/kushgupta-hiver/TTT/internal/transport/ws"
+	"github.com/kushgupta-hiver/TTT/pkg/client"
+)
+
+// fakeHost books games without a hub; tests finish them by hand.
+type fakeHost struct {
+	mu     sync.Mutex
+	booked []hub.Reservation
+	n      int
+}
+
+func (f *fakeHost) Reserve(r hub.Reservation) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.n++
+	f.booked = append(f.booked, r)
+	return fmt.Sprintf("%04d", f.n), nil
+}
+
+func (f *fakeHost) take() []hub.Reservation {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := f.booked
+	f.booked = nil
+	return out
+}
+
+// playOut finishes every booked game with decide until none are left.
+func playOut(f *fakeHost, decide func(x, o string) (engine.Outcome, string)) (games int) {
+	for {
+		batch := f.take()
+		if len(batch) == 0 {
+			return games
+		}
+		for _, r := range batch {
+			o, reason := decide(r.X, r.O)
+			games++
+			r.OnDone(hub.GameOver{Record: match.Record{Outcome: o, Reason: reason}, X: r.X, O: r.O})
+		}
+	}
+}
+
+func newTournament(t *testing.T, f *fakeHost, cfg tournament.Config, players ...string) tournament.Tournament {
+	t.Helper()
+	tr, err := tournament.NewManager(f).Create(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range players {
+		if err := tr.Register(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+// bySeed makes the earlier-registered player win every game.
+func bySeed(players ...string) func(x, o string) (engine.Outcome, string) {
+	seed := map[string]int{}
+	for i, p := range players {
+		seed[p] = i
+	}
+	return func(x, o string) (engine.Outcome, string) {
+		if seed[x] < seed[o] {
+			return engine.XWins, match.ReasonPlay
+		}
+		return engine.OWins, match.ReasonPlay
+	}
+}
+
+func TestTournament_RoundRobinPairsEveryoneOnce(t *testing.T) {
+	players := []string{"a", "b", "c", "d", "e"}
+	f := &fakeHost{}
+	tr := newTournament(t, f, tournament.Config{Format: tournament.RoundRobin}, players...)
+	if games := playOut(f, bySeed(players...)); games != 10 {
+		t.Fatalf("5 players should play 10 games, played %d", games)
+	}
+
+	v := tr.View()
+	if v.Status != tournament.Finished || len(v.Schedule) != 5 || v.Champion != "a" {
+		t.Fatalf("unexpected view: status=%s rounds=%d champion=%s", v.Status, len(v.Schedule), v.Champion)
+	}
+	met := map[[2]string]int{}
+	byes := map[string]int{}
+	for _, round := range v.Schedule {
+		for _, m := range round {
+			if m.B == "" {
+				byes[m.A]++
+				continue
+			}
+			a, b := min(m.A, m.B), max(m.A, m.B)
+			met[[2]string{a, b}]++
+		}
+	}
+	if len(met) != 10 {
+		t.Fatalf("expected 10 distinct pairings, got %v", met)
+	}
+	for _, p := range players {
+		if byes[p] != 1 {
+			t.Fatalf("each player sits out once with an odd field: %v", byes)
+		}
+	}
+	for i, s := range v.Standings {
+		if s.Player != players[i] || s.Wins != 4-i || s.Points != float64(4-i) || s.Byes != 1 {
+			t.Fatalf("standing %d: %+v", i, s)
+		}
+	}
+}
+
+func TestTournament_SwissAvoidsRematchesAndBreaksTies(t *testing.T) {
+	players := []string{"p1", "p2", "p3", "p4", "p5", "p6", "p7", "p8"}
+	f := &fakeHost{}
+	tr := newTournament(t, f, tournament.Config{Format: tournament.Swiss}, players...)
+	playOut(f, bySeed(players...))
+
+	v := tr.View()
+	if v.Rounds != 3 || len(v.Schedule) != 3 || v.Status != tournament.Finished {
+		t.Fatalf("8 players default to 3 rounds: %+v", v)
+	}
+	met := map[[2]string]bool{}
+	xs := map[string]int{}
+	for _, round := range v.Schedule {
+		for _, m := range round {
+			k := [2]string{min(m.A, m.B), max(m.A, m.B)}
+			if met[k] {
+				t.Fatalf("rematch %v", k)
+			}
+			met[k] = true
+			xs[m.Games[0].X]++
+		}
+	}
+	for p, n := range xs {
+		if n > 2 {
+			t.Fatalf("%s had X %d times in 3 rounds", p, n)
+		}
+	}
+	if v.Champion != "p1" || v.Standings[0].Points != 3 {
+		t.Fatalf("p1 wins everything: %+v", v.Standings[0])
+	}
+	// Players on equal points are separated by Buchholz, then SB.
+	for i := 1; i < len(v.Standings); i++ {
+		a, b := v.Standings[i-1], v.Standings[i]
+		if a.Points == b.Points && a.Buchholz < b.Buchholz {
+			t.Fatalf("tiebreak order broken: %+v before %+v", a, b)
+		}
+	}
+}
+
+func TestTournament_SwissByeGoesToLowestRanked(t *testing.T) {
+	players := []string{"a", "b", "c"}
+	f := &fakeHost{}
+	tr := newTournament(t, f, tournament.Config{Format: tournament.Swiss, Rounds: 3}, players...)
+	playOut(f, bySeed(players...))
+	v := tr.View()
+	byes := map[string]int{}
+	for _, round := range v.Schedule {
+		for _, m := range round {
+			if m.B == "" {
+				byes[m.A]++
+			}
+		}
+	}
+	if len(byes) != 3 {
+		t.Fatalf("each player should get one bye over 3 rounds, got %v", byes)
+	}
+	if v.Standings[0].Player != "a" || v.Standings[0].Points != 3 {
+		t.Fatalf("bye scores a point: %+v", v.Standings)
+	}
+}
+
+func TestTournament_KnockoutBestOfThreeWithByesAndDraws(t *testing.T) {
+	players := []string{"s1", "s2", "s3", "s4", "s5"}
+	f := &fakeHost{}
+	tr := newTournament(t, f, tournament.Config{Format: tournament.Knockout, BestOf: 3}, players...)
+
+	first := tr.View().Schedule[0]
+	if len(first) != 4 || first[0].A != "s1" || first[0].B != "" || !first[0].Done {
+		t.Fatalf("top seed should have a bye: %+v", first)
+	}
+
+	// s5 upsets s4; every other match goes to seed, after a drawn game.
+	drawn := map[[2]string]bool{}
+	playOut(f, func(x, o string) (engine.Outcome, string) {
+		k := [2]string{min(x, o), max(x, o)}
+		if !drawn[k] {
+			drawn[k] = true
+			return engine.Draw, match.ReasonPlay
+		}
+		if k == [2]string{"s4", "s5"} {
+			if x == "s5" {
+				return engine.XWins, match.ReasonPlay
+			}
+			return engine.OWins, match.ReasonPlay
+		}
+		return bySeed(players...)(x, o)
+	})
+
+	v := tr.View()
+	if v.Champion != "s1" || len(v.Schedule) != 3 {
+		t.Fatalf("unexpected bracket: champion=%s rounds=%d", v.Champion, len(v.Schedule))
+	}
+	var upset tournament.Match
+	for _, m := range v.Schedule[0] {
+		if m.A == "s4" {
+			upset = m
+		}
+	}
+	if upset.Winner != "s5" || upset.WinsB != 2 || len(upset.Games) != 3 {
+		t.Fatalf("s5 should beat s4 2-0 after a draw: %+v", upset)
+	}
+	if upset.Games[0].X != "s4" || upset.Games[1].X != "s5" || upset.Games[2].X != "s4" {
+		t.Fatalf("sides should alternate: %+v", upset.Games)
+	}
+	for _, s := range v.Standings {
+		if s.Out == (s.Player == "s1") {
+			t.Fatalf("only the champion stays in: %+v", v.Standings)
+		}
+	}
+}
+
+func TestTournament_DoubleNoShow(t *testing.T) {
+	f := &fakeHost{}
+	tr := newTournament(t, f, tournament.Config{Format: tournament.RoundRobin}, "a", "b")
+	playOut(f, func(x, o string) (engine.Outcome, string) { return engine.Draw, match.ReasonNoShow })
+	v := tr.View()
+	if m := v.Schedule[0][0]; !m.Forfeited || m.Winner != "" {
+		t.Fatalf("expected a double forfeit: %+v", m)
+	}
+	for _, s := range v.Standings {
+		if s.Points != 0 || s.Losses != 1 {
+			t.Fatalf("a double forfeit scores nothing: %+v", s)
+		}
+	}
+}
+
+func TestTournament_RegistrationRules(t *testing.T) {
+	m := tournament.NewManager(&fakeHost{})
+	if _, err := m.Create(tournament.Config{Format: "bracket"}); err == nil {
+		t.Fatal("unknown format accepted")
+	}
+	if _, err := m.Create(tournament.Config{Format: tournament.Knockout, BestOf: 2}); err == nil {
+		t.Fatal("even bestOf accepted")
+	}
+	tr, _ := m.Create(tournament.Config{Format: tournament.Swiss})
+	_ = tr.Register("a")
+	if err := tr.Register("a"); err != tournament.ErrDuplicate {
+		t.Fatalf("expected ErrDuplicate, got %v", err)
+	}
+	if err := tr.Start(); err != tournament.ErrTooFew {
+		t.Fatalf("expected ErrTooFew, got %v", err)
+	}
+	_ = tr.Register("b")
+	if err := tr.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Register("c"); err != tournament.ErrStarted {
+		t.Fatalf("expected ErrStarted, got %v", err)
+	}
+}
+
+func TestReservation_OnlyBookedPlayersAndNoShowForfeit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	h := hub.NewHub(hub.Config{}, engine.NewEngine())
+	defer h.Close()
+	ts := httptest.NewServer(ws.NewServer(ws.Config{Hub: h}, engine.NewEngine()))
+	defer ts.Close()
+
+	done := make(chan hub.GameOver, 1)
+	code, err := h.Reserve(hub.Reservation{X: "ann", O: "bob", NoShow: 200 * time.Millisecond, OnDone: func(g hub.GameOver) { done <- g }})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intruder, err := client.Dial(ctx, ts.URL, client.Options{Code: code, Player: "eve"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer intruder.Close()
+	if e := await[client.Error](t, intruder); e.Code != "ROOM_RESERVED" {
+		t.Fatalf("expected ROOM_RESERVED, got %+v", e)
+	}
+
+	bob, err := client.Dial(ctx, ts.URL, client.Options{Code: code, Player: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bob.Close()
+	if r := await[client.Result](t, bob); r.Status != "O wins!" {
+		t.Fatalf("bob showed up and should win, got %+v", r)
+	}
+	select {
+	case g := <-done:
+		if g.Record.Reason != match.ReasonNoShow || g.Record.Outcome != engine.OWins || g.O != "bob" {
+			t.Fatalf("unexpected game over %+v", g)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnDone not called")
+	}
+}
+
+// readEvents decodes a tournament event stream onto a channel.
+func readEvents(t *testing.T, url string) <-chan proto.Tournament {
+	t.Helper()
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	out := make(chan proto.Tournament, 16)
+	go func() {
+		sc := bufio.NewScanner(res.Body)
+		for sc.Scan() {
+			if data, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+				var ev proto.Tournament
+				if json.Unmarshal([]byte(data), &ev) == nil {
+					out <- ev
+				}
+			}
+		}
+	}()
+	return out
+}
+
+func nextEvent(t *testing.T, events <-chan proto.Tournament, kind string) proto.Tournament {
+	t.Helper()
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			if ev.Event == kind {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("no %q event", kind)
+		}
+	}
+}
+
+func TestTournament_EndToEndOverHTTP(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	h := hub.NewHub(hub.Config{}, engine.NewEngine())
+	t.Cleanup(func() { _ = h.Close() })
+	guard := func(next http.Handler) http.Handler { return httpx.RequireToken("org", next) }
+	mux := http.NewServeMux()
+	api := tournament.NewHandler(tournament.NewManager(h), guard)
+	mux.Handle("/api/tournaments", api)
+	mux.Handle("/api/tournaments/", api)
+	mux.Handle("/ws/", ws.NewServer(ws.Config{Hub: h}, engine.NewEngine()))
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close) // after the event stream below is closed
+
+	post := func(path, body string, auth bool) int {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+path, strings.NewReader(body))
+		if auth {
+			req.Header.Set("Authorization", "Bearer org")
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	if code := post("/api/tournaments", `{"format":"knockout"}`, false); code != http.StatusUnauthorized {
+		t.Fatalf("creating needs the organiser token, got %d", code)
+	}
+	if code := post("/api/tournaments", `{"name":"Friday","format":"knockout"}`, true); code != http.StatusCreated {
+		t.Fatalf("create: %d", code)
+	}
+	post("/api/tournaments/t1/players", `{"player":"ann"}`, true)
+	post("/api/tournaments/t1/players", `{"player":"bob"}`, true)
+
+	events := readEvents(t, ts.URL+"/api/tournaments/t1/events?player=ann")
+	if code := post("/api/tournaments/t1/start", "", true); code != http.StatusOK {
+		t.Fatalf("start: %d", code)
+	}
+	g := nextEvent(t, events, "game")
+	if g.X != "ann" || g.O != "bob" || g.Code == "" {
+		t.Fatalf("unexpected pairing %+v", g)
+	}
+
+	ann, err := client.Dial(ctx, ts.URL, client.Options{Code: g.Code, Player: "ann"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ann.Close()
+	bob, err := client.Dial(ctx, ts.URL, client.Options{Code: g.Code, Player: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bob.Close()
+	await[client.Start](t, bob)
+	_ = bob.Resign(ctx)
+
+	if r := nextEvent(t, events, "result"); r.Winner != "ann" {
+		t.Fatalf("unexpected result %+v", r)
+	}
+	fin := nextEvent(t, events, "finished")
+	if fin.Winner != "ann" || len(fin.Standings) != 2 || fin.Standings[0].Player != "ann" {
+		t.Fatalf("unexpected finish %+v", fin)
+	}
+
+	res, err := http.Get(ts.URL + "/api/tournaments/t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var v tournament.View
+	if err := json.NewDecoder(res.Body).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Status != tournament.Finished || v.Config.Name != "Friday" || v.Schedule[0][0].Games[0].Reason != match.ReasonResign {
+		t.Fatalf("unexpected view %+v", v)
+	}
+}
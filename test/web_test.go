@@ -0,0 +1,51 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kushgupta-hiver/TTT/internal/web"
+)
+
+func TestWeb_ServesEmbeddedClient(t *testing.T) {
+	ts := httptest.NewServer(web.Handler())
+	defer ts.Close()
+
+	get := func(path string) (*http.Response, string) {
+		t.Helper()
+		res, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		b, _ := io.ReadAll(res.Body)
+		return res, string(b)
+	}
+
+	for _, path := range []string{"/", "/?room=1234"} {
+		res, body := get(path)
+		if res.StatusCode != http.StatusOK || !strings.Contains(res.Header.Get("Content-Type"), "text/html") {
+			t.Fatalf("%s: status %d type %q", path, res.StatusCode, res.Header.Get("Content-Type"))
+		}
+		if !strings.Contains(body, `src="/static/app.js"`) {
+			t.Fatalf("%s: page does not load the client script", path)
+		}
+		if csp := res.Header.Get("Content-Security-Policy"); !strings.Contains(csp, "connect-src 'self' ws: wss:") {
+			t.Fatalf("%s: missing CSP, got %q", path, csp)
+		}
+	}
+
+	res, body := get("/static/app.js")
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, `"ttt.json"`) {
+		t.Fatalf("app.js: status %d", res.StatusCode)
+	}
+	if res, _ := get("/static/style.css"); !strings.Contains(res.Header.Get("Content-Type"), "text/css") {
+		t.Fatalf("style.css served as %q", res.Header.Get("Content-Type"))
+	}
+	if res, _ := get("/nope"); res.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown path should 404, got %d", res.StatusCode)
+	}
+}